@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth/credservice"
+)
+
+func runEncrypt(customLogger *shared.CustomLogger, authTokensFilePath string) error {
+	customLogger.Info("Encrypting credential store...", "authTokensFilePath", authTokensFilePath)
+	if err := credservice.EncryptCredStoreFile(authTokensFilePath); err != nil {
+		customLogger.Logger.Error("Failed to encrypt credential store", "error", err)
+		return err
+	}
+	customLogger.Info("Credential store encrypted successfully")
+	return nil
+}
+
+func runDecrypt(customLogger *shared.CustomLogger, authTokensFilePath string) error {
+	customLogger.Info("Decrypting credential store...", "authTokensFilePath", authTokensFilePath)
+	if err := credservice.DecryptCredStoreFile(authTokensFilePath); err != nil {
+		customLogger.Logger.Error("Failed to decrypt credential store", "error", err)
+		return err
+	}
+	customLogger.Info("Credential store decrypted successfully")
+	return nil
+}
+
+func runRotateKey(customLogger *shared.CustomLogger, authTokensFilePath string) error {
+	customLogger.Info("Rotating credential store key...", "authTokensFilePath", authTokensFilePath)
+	if err := credservice.RotateCredStoreKey(authTokensFilePath); err != nil {
+		customLogger.Logger.Error("Failed to rotate credential store key", "error", err)
+		return err
+	}
+	customLogger.Info("Credential store key rotated successfully")
+	return nil
+}
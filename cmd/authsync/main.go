@@ -0,0 +1,67 @@
+// authsync maintains secrets/auth_tokens.json. Without a command it normalizes the credentials.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bluelock-go/shared"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(customLogger *shared.CustomLogger, authTokensFilePath string) error
+}
+
+var commands = []command{
+	{"normalize", "Generate the missing credKeys of the credentials (default)", runNormalize},
+	{"encrypt", "Encrypt the credential store at rest", runEncrypt},
+	{"decrypt", "Decrypt the credential store back to plaintext", runDecrypt},
+	{"rotate-key", "Re-encrypt the credential store with a new key", runRotateKey},
+}
+
+func main() {
+	commandName := "normalize"
+	if len(os.Args) > 1 {
+		commandName = os.Args[1]
+	}
+	var selected *command
+	for i := range commands {
+		if commands[i].name == commandName {
+			selected = &commands[i]
+		}
+	}
+	if selected == nil {
+		fmt.Fprintf(os.Stderr, "authsync: unknown command %q\n\n", commandName)
+		printUsage()
+		os.Exit(2)
+	}
+
+	// Initialize the application logger
+	log.Println("Initializing application logger...")
+	appLoggerFilePath := filepath.Join(shared.RootDir, "logs", "authsync.log")
+	customLogger, logFile, err := shared.NewCustomLogger(appLoggerFilePath, shared.TextLogHandler)
+	if err != nil {
+		log.Fatalf("failed to create custom logger: %v", err)
+	}
+	customLogger.Info("Custom logger initialized", "absoluteFilePath", appLoggerFilePath)
+
+	authTokensFilePath := filepath.Join(shared.RootDir, "secrets", "auth_tokens.json")
+	err = selected.run(customLogger, authTokensFilePath)
+	logFile.Close()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: authsync [command]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.description)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bluelock-go/testing/fakebitbucket"
+)
+
+func runFakeBitbucket(args []string) error {
+	flags := flag.NewFlagSet("fake-bitbucket", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:7991", "address to listen on")
+	datasetPath := flags.String("dataset", "", "JSON dataset to serve, the built-in seed dataset when empty")
+	faultsPath := flags.String("faults", "", "JSON array of faults to inject (unauthorized, rateLimited, slow, malformedJSON)")
+	latency := flags.Duration("latency", 0, "delay every response by this duration")
+	printDataset := flags.Bool("print-dataset", false, "print the seed dataset as JSON, as a starting point for -dataset, and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *printDataset {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(fakebitbucket.SeedDataset())
+	}
+
+	dataset := fakebitbucket.SeedDataset()
+	if *datasetPath != "" {
+		var err error
+		if dataset, err = fakebitbucket.LoadDataset(*datasetPath); err != nil {
+			return err
+		}
+	}
+	var faults []fakebitbucket.Fault
+	if *faultsPath != "" {
+		var err error
+		if faults, err = fakebitbucket.LoadFaults(*faultsPath); err != nil {
+			return err
+		}
+	}
+	if *latency > 0 {
+		faults = append(faults, fakebitbucket.Fault{Kind: fakebitbucket.FaultSlow, Delay: fakebitbucket.Duration(*latency)})
+	}
+
+	fakeServer := fakebitbucket.NewServer(dataset)
+	fakeServer.SetFaults(faults)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *addr, err)
+	}
+	fmt.Printf("Fake Bitbucket Cloud listening on http://%s, set integrations.bitbucketCloud.baseURL to http://%s/2.0\n", listener.Addr(), listener.Addr())
+	return serveUntilInterrupted(&http.Server{Handler: fakeServer, ReadHeaderTimeout: 10 * time.Second}, listener)
+}
+
+// serveUntilInterrupted serves until SIGINT or SIGTERM, then shuts the server down gracefully.
+func serveUntilInterrupted(server *http.Server, listener net.Listener) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
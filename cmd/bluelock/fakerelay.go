@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bluelock-go/testing/fakerelay"
+)
+
+func runFakeRelay(args []string) error {
+	flags := flag.NewFlagSet("fake-relay", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:7992", "address to listen on")
+	apiKey := flags.String("api-key", "fake-relay-key", "bearer API key the requests must carry")
+	dbPath := flags.String("db", "fake_relay.db", "SQLite file keeping the received payloads")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := fakerelay.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *addr, err)
+	}
+	fmt.Printf("Fake relay listening on http://%s, set common.relayBaseURL to http://%s and secrets.ddApiKey to %s\n", listener.Addr(), listener.Addr(), *apiKey)
+	fmt.Printf("Received payloads are kept in %s and listed by GET http://%s/api/v1/fake-relay/payloads\n", *dbPath, listener.Addr())
+	return serveUntilInterrupted(&http.Server{Handler: fakerelay.NewServer(*apiKey, store), ReadHeaderTimeout: 10 * time.Second}, listener)
+}
@@ -0,0 +1,52 @@
+// bluelock is the operator CLI. It bundles small tools that inspect or support the long running services
+// (datapuller, authsync) without having to start them.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"status", "Show job times, token states and repository sync audits of datapuller", runStatus},
+	{"fake-bitbucket", "Serve a fake Bitbucket Cloud API from a seeded dataset for local development", runFakeBitbucket},
+	{"fake-relay", "Serve a fake relay that validates and stores the payloads of datapuller for local development", runFakeRelay},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "bluelock %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "bluelock: unknown command %q\n\n", os.Args[1])
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: bluelock <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Run 'bluelock <command> -h' for the flags of a command.")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/bluelock-go/shared/storage/state/tokenpool"
+)
+
+type statusReport struct {
+	// TokenPool is the path of the token pool the token states, the rate limit reset and the cooldown were read from,
+	// empty when they were read from the state file.
+	TokenPool   string        `json:"tokenPool,omitempty"`
+	Job         statusJob     `json:"job"`
+	Tokens      []statusToken `json:"tokens"`
+	Repos       []statusRepo  `json:"repos"`
+	NeverSynced []statusRepo  `json:"neverSynced"`
+	Failing     []statusRepo  `json:"failing"`
+}
+
+type statusJob struct {
+	LastJobExecutionStartTime time.Time `json:"lastJobExecutionStartTime"`
+	LastJobExecutionEndTime   time.Time `json:"lastJobExecutionEndTime"`
+	OngoingJobStartTime       time.Time `json:"ongoingJobStartTime"`
+	Running                   bool      `json:"running"`
+	RateLimitResetAt          time.Time `json:"rateLimitResetAt"`
+	CooldownCompletedAt       time.Time `json:"cooldownCompletedAt"`
+}
+
+type statusToken struct {
+	Token                    string    `json:"token"`
+	Status                   string    `json:"status"`
+	StatusChangedAt          time.Time `json:"statusChangedAt"`
+	LastUsageAt              time.Time `json:"lastUsageAt"`
+	ExhaustedAt              time.Time `json:"exhaustedAt"`
+	SuccessfulUsageCount     int       `json:"successfulUsageCount"`
+	PreRateLimitSuccessCount int       `json:"preRateLimitSuccessCount"`
+	// Usage counts the requests since the token was added, LastHourUsage those of the current and the previous hour.
+	Usage         token.UsageCounts `json:"usage"`
+	LastHourUsage token.UsageCounts `json:"lastHourUsage"`
+	// EstimatedHourlyQuota is unknown until the token was exhausted once.
+	EstimatedHourlyQuota *int `json:"estimatedHourlyQuota"`
+}
+
+type statusRepo struct {
+	Provider            string     `json:"provider"`
+	RepoUuid            string     `json:"repoUuid"`
+	RepoSlug            string     `json:"repoSlug"`
+	RepoName            string     `json:"repoName"`
+	WorkspaceSlug       string     `json:"workspaceSlug"`
+	Active              bool       `json:"active"`
+	Success             bool       `json:"success"`
+	LastSuccessTime     *time.Time `json:"lastSuccessTime"`
+	ConsecutiveFailures int64      `json:"consecutiveFailures"`
+	ErrorContext        string     `json:"errorContext,omitempty"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	stateFilePath := flags.String("state", filepath.Join(shared.RootDir, "states", "datapuller.json"), "path of the datapuller state file")
+	dbFilePath := flags.String("db", filepath.Join(shared.RootDir, "database.db"), "path of the datapuller SQLite database")
+	tokenPoolFilePath := flags.String("token-pool", defaultTokenPoolFilePath(), "path of the token pool shared by the datapullers, empty to read the token states from the state file")
+	failedThreshold := flags.Int("failed-threshold", 3, "list repositories that failed at least this many consecutive syncs")
+	jsonOutput := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := buildStatusReport(*stateFilePath, *dbFilePath, *tokenPoolFilePath, *failedThreshold)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return printStatusReport(os.Stdout, report, *failedThreshold)
+}
+
+// defaultTokenPoolFilePath resolves tokenPool.path of the configuration like datapuller does. The token states of the
+// state file are only those of the last update of this datapuller, the pool has the live states of every datapuller.
+func defaultTokenPoolFilePath() string {
+	cfg, err := config.LoadMergedConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bluelock status: failed to load configuration, token states are read from the state file unless -token-pool is set: %v\n", err)
+		return ""
+	}
+	tokenPoolFilePath := cfg.TokenPool.Path
+	if tokenPoolFilePath != "" && !filepath.IsAbs(tokenPoolFilePath) {
+		tokenPoolFilePath = filepath.Join(shared.RootDir, tokenPoolFilePath)
+	}
+	return tokenPoolFilePath
+}
+
+func buildStatusReport(stateFilePath, dbFilePath, tokenPoolFilePath string, failedThreshold int) (*statusReport, error) {
+	report := &statusReport{
+		Tokens:      []statusToken{},
+		Repos:       []statusRepo{},
+		NeverSynced: []statusRepo{},
+		Failing:     []statusRepo{},
+	}
+
+	if _, err := os.Stat(stateFilePath); err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	sm, err := statemanager.NewStateManager(stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state file: %w", err)
+	}
+	state := sm.State
+	if tokenPoolFilePath != "" {
+		snapshot, err := tokenpool.ReadSnapshot(tokenPoolFilePath)
+		if err != nil {
+			return nil, err
+		}
+		state.TokenStates = snapshot.TokenStates
+		state.RateLimitResetAt = snapshot.RateLimitResetAt
+		state.CooldownCompletedAt = snapshot.CooldownCompletedAt
+		report.TokenPool = tokenPoolFilePath
+	}
+	report.Job = statusJob{
+		LastJobExecutionStartTime: state.LastJobExecutionStartTime,
+		LastJobExecutionEndTime:   state.LastJobExecutionEndTime,
+		OngoingJobStartTime:       state.OngoingJobStartTime,
+		Running:                   state.OngoingJobStartTime.After(state.LastJobExecutionStartTime),
+		RateLimitResetAt:          state.RateLimitResetAt,
+		CooldownCompletedAt:       state.CooldownCompletedAt,
+	}
+	for credKey, tokenState := range state.TokenStates {
+		tokenReport := statusToken{
+			Token:                    auth.MaskCredKey(credKey),
+			Status:                   string(tokenState.Status),
+			StatusChangedAt:          tokenState.StatusChangedAt,
+			LastUsageAt:              tokenState.LastUsageAt,
+			ExhaustedAt:              tokenState.ExhaustedAt,
+			SuccessfulUsageCount:     tokenState.SuccessfulUsageCount,
+			PreRateLimitSuccessCount: tokenState.PreRateLimitSuccessCount,
+			Usage:                    tokenState.Usage.Total,
+			LastHourUsage:            tokenState.Usage.CountsSince(time.Now().Add(-time.Hour)),
+		}
+		if quota, known := tokenState.Usage.EstimatedHourlyQuota(); known {
+			tokenReport.EstimatedHourlyQuota = &quota
+		}
+		report.Tokens = append(report.Tokens, tokenReport)
+	}
+	sort.Slice(report.Tokens, func(i, j int) bool { return report.Tokens[i].Token < report.Tokens[j].Token })
+
+	if _, err := os.Stat(dbFilePath); err != nil {
+		return nil, fmt.Errorf("failed to read database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", dbFilePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	repoSyncAudits, err := dbgen.New(db).ListRepoSyncAudits(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repo sync audits: %w", err)
+	}
+	for _, repoSyncAudit := range repoSyncAudits {
+		repo := statusRepo{
+			Provider:            repoSyncAudit.Provider,
+			RepoUuid:            repoSyncAudit.RepoUuid,
+			RepoSlug:            repoSyncAudit.RepoSlug,
+			RepoName:            repoSyncAudit.RepoName,
+			WorkspaceSlug:       repoSyncAudit.WorkspaceSlug,
+			Active:              repoSyncAudit.Active,
+			Success:             repoSyncAudit.Success,
+			ConsecutiveFailures: repoSyncAudit.ConsecutiveFailures,
+			ErrorContext:        repoSyncAudit.ErrorContext.String,
+			UpdatedAt:           repoSyncAudit.UpdatedAt,
+		}
+		if repoSyncAudit.SuccessfulSyncTime.Valid {
+			lastSuccessTime := repoSyncAudit.SuccessfulSyncTime.Time
+			repo.LastSuccessTime = &lastSuccessTime
+		}
+		report.Repos = append(report.Repos, repo)
+
+		if !repo.Active {
+			continue
+		}
+		if repo.LastSuccessTime == nil {
+			report.NeverSynced = append(report.NeverSynced, repo)
+		}
+		if failedThreshold > 0 && repo.ConsecutiveFailures >= int64(failedThreshold) {
+			report.Failing = append(report.Failing, repo)
+		}
+	}
+
+	return report, nil
+}
+
+func printStatusReport(w io.Writer, report *statusReport, failedThreshold int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "JOB")
+	fmt.Fprintf(tw, "  last start\t%s\n", formatStatusTime(report.Job.LastJobExecutionStartTime))
+	fmt.Fprintf(tw, "  last end\t%s\n", formatStatusTime(report.Job.LastJobExecutionEndTime))
+	fmt.Fprintf(tw, "  ongoing start\t%s\n", formatStatusTime(report.Job.OngoingJobStartTime))
+	fmt.Fprintf(tw, "  running\t%t\n", report.Job.Running)
+	fmt.Fprintf(tw, "  rate limit reset at\t%s\n", formatStatusTime(report.Job.RateLimitResetAt))
+	fmt.Fprintf(tw, "  cooldown completed at\t%s\n", formatStatusTime(report.Job.CooldownCompletedAt))
+	fmt.Fprintln(tw)
+
+	if report.TokenPool != "" {
+		fmt.Fprintf(tw, "TOKENS (%d) from token pool %s\n", len(report.Tokens), report.TokenPool)
+	} else {
+		fmt.Fprintf(tw, "TOKENS (%d)\n", len(report.Tokens))
+	}
+	fmt.Fprintln(tw, "  TOKEN\tSTATUS\tUSAGE\tPRE RATE LIMIT USAGE\tEST. HOURLY QUOTA\tLAST HOUR OK/FAILED/429\tTOTAL OK/FAILED/429\tBYTES\tLAST USAGE\tEXHAUSTED AT")
+	for _, token := range report.Tokens {
+		estimatedHourlyQuota := "-"
+		if token.EstimatedHourlyQuota != nil {
+			estimatedHourlyQuota = fmt.Sprintf("%d", *token.EstimatedHourlyQuota)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\t%s\t%s\t%s\t%d\t%s\t%s\n", token.Token, token.Status, token.SuccessfulUsageCount,
+			token.PreRateLimitSuccessCount, estimatedHourlyQuota, formatUsageCounts(token.LastHourUsage), formatUsageCounts(token.Usage),
+			token.Usage.Bytes, formatStatusTime(token.LastUsageAt), formatStatusTime(token.ExhaustedAt))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "REPOSITORIES (%d)\n", len(report.Repos))
+	fmt.Fprintln(tw, "  WORKSPACE\tREPO\tACTIVE\tSUCCESS\tLAST SUCCESS\tFAILURES\tERROR")
+	for _, repo := range report.Repos {
+		lastSuccessTime := "never"
+		if repo.LastSuccessTime != nil {
+			lastSuccessTime = formatStatusTime(*repo.LastSuccessTime)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%t\t%t\t%s\t%d\t%s\n", repo.WorkspaceSlug, repo.RepoName, repo.Active, repo.Success,
+			lastSuccessTime, repo.ConsecutiveFailures, repo.ErrorContext)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "NEVER SYNCED (%d)\n", len(report.NeverSynced))
+	for _, repo := range report.NeverSynced {
+		fmt.Fprintf(tw, "  %s/%s\n", repo.WorkspaceSlug, repo.RepoName)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "FAILED %d+ TIMES IN A ROW (%d)\n", failedThreshold, len(report.Failing))
+	for _, repo := range report.Failing {
+		fmt.Fprintf(tw, "  %s/%s\t%d\t%s\n", repo.WorkspaceSlug, repo.RepoName, repo.ConsecutiveFailures, repo.ErrorContext)
+	}
+
+	return tw.Flush()
+}
+
+func formatUsageCounts(counts token.UsageCounts) string {
+	return fmt.Sprintf("%d/%d/%d", counts.SuccessCount, counts.FailureCount, counts.RateLimitedCount)
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
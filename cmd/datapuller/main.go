@@ -1,20 +1,32 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/bluelock-go/config"
 	"github.com/bluelock-go/integrations"
+	"github.com/bluelock-go/integrations/git/identity"
+	"github.com/bluelock-go/integrations/privacy"
+	"github.com/bluelock-go/integrations/relay"
 	"github.com/bluelock-go/shared"
 	"github.com/bluelock-go/shared/auth/credservice"
 	"github.com/bluelock-go/shared/database/dbsetup"
+	"github.com/bluelock-go/shared/httptransport"
 	"github.com/bluelock-go/shared/jobscheduler"
 	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/tokenpool"
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "run the job once without relaying data or persisting database changes")
+	dryRunDir := flag.String("dry-run-dir", "", "directory where dry run payloads are written (default: dryrun/<timestamp>)")
+	flag.Parse()
+
 	// Initialize the application logger
 	log.Println("Initializing application logger...")
 	appLoggerFilePath := filepath.Join(shared.RootDir, "logs", "datapuller.log")
@@ -29,27 +41,83 @@ func main() {
 	}
 	customLogger.Info("Custom logger initialized", "absoluteFilePath", appLoggerFilePath)
 
+	// Load and validate the configuration
+	customLogger.Info("Loading configuration...")
+	if err := config.InitializeConfig(); err != nil {
+		customLogger.Logger.Error("Failed to initialize configuration", "error", err)
+		os.Exit(1)
+	} else {
+		customLogger.Info("Configuration initialized successfully")
+	}
+
+	// Create the HTTP client shared by the integrations and the relay
+	if err := httptransport.InitializeHTTPClient(config.AcquireConfig().HTTPTransport); err != nil {
+		customLogger.Logger.Error("Failed to initialize HTTP client", "error", err)
+		os.Exit(1)
+	}
+
 	// Load authentication tokens
 	customLogger.Info("Loading authentication tokens...")
-	authTokensFilePath := filepath.Join(shared.RootDir, "secrets", "auth_tokens.json")
-	if err = credservice.InitializeAuthCredentialStore(authTokensFilePath, credservice.DatapullCredentialsKey); err != nil {
+	secretsDir := filepath.Join(shared.RootDir, "secrets")
+	credentialProvider, err := credservice.NewCredentialProvider(config.AcquireConfig().Credentials, filepath.Join(secretsDir, "auth_tokens.json"), httptransport.AcquireHTTPClient())
+	if err != nil {
+		customLogger.Logger.Error("Failed to create credential provider", "error", err)
+		os.Exit(1)
+	}
+	fingerprintKeyFilePath := filepath.Join(secretsDir, credservice.FingerprintKeyFileName)
+	if err = credservice.InitializeAuthCredentialStore(credentialProvider, fingerprintKeyFilePath, credservice.DatapullCredentialsKey); err != nil {
 		customLogger.Logger.Error("Failed to initialize authentication credential store", "error", err)
 		os.Exit(1)
 	} else {
-		customLogger.Info("Authentication credential store initialized successfully", "authTokensFilePath", authTokensFilePath)
+		customLogger.Info("Authentication credential store initialized successfully", "provider", credentialProvider.Name())
 	}
 	datapullCredentials := credservice.AcquireCredentials()
 
 	// Initialize the state manager
 	customLogger.Info("Initializing state manager...")
 	stateJsonFilePath := filepath.Join(shared.RootDir, "states", "datapuller.json")
-	if err := statemanager.InitializeStateManager(stateJsonFilePath); err != nil {
+	initializeStateManager := statemanager.InitializeStateManager
+	if *dryRun {
+		// a dry run leaves the token usage, statuses and cached OAuth access tokens of the real runs untouched
+		initializeStateManager = statemanager.InitializeDryRunStateManager
+	}
+	if err := initializeStateManager(stateJsonFilePath); err != nil {
 		customLogger.Logger.Error("Failed to initialize state manager", "error", err)
 		os.Exit(1)
 	} else {
 		customLogger.Info("State manager initialized successfully", "stateJsonFilePath", stateJsonFilePath)
 	}
 	stateManager := statemanager.AcquireStateManager()
+	defer stateManager.Close()
+	tokenSelectionStrategy, err := statemanager.NewTokenSelectionStrategy(config.AcquireConfig().TokenSelection)
+	if err != nil {
+		customLogger.Logger.Error("Failed to create token selection strategy", "error", err)
+		os.Exit(1)
+	}
+	stateManager.SetTokenSelectionStrategy(tokenSelectionStrategy)
+	if statePersistence := config.AcquireConfig().StatePersistence; statePersistence.Mode == config.StatePersistenceWriteBehind {
+		flushInterval := time.Duration(statePersistence.FlushIntervalSeconds) * time.Second
+		if err := stateManager.StartWriteBehind(flushInterval, customLogger); err != nil {
+			customLogger.Logger.Error("Failed to start state write-behind", "error", err)
+			os.Exit(1)
+		}
+		customLogger.Info("State usage accounting is written behind", "flushInterval", flushInterval)
+	}
+	if tokenPoolConfig := config.AcquireConfig().TokenPool; *dryRun && tokenPoolConfig.Path != "" {
+		customLogger.Info("Dry run enabled. Token states are not shared through the token pool")
+	} else if tokenPoolConfig.Path != "" {
+		tokenPoolFilePath := tokenPoolConfig.Path
+		if !filepath.IsAbs(tokenPoolFilePath) {
+			tokenPoolFilePath = filepath.Join(shared.RootDir, tokenPoolFilePath)
+		}
+		pool, err := tokenpool.NewTokenPool(tokenPoolFilePath, tokenpool.DefaultOwner(), time.Duration(tokenPoolConfig.LeaseSeconds)*time.Second)
+		if err != nil {
+			customLogger.Logger.Error("Failed to open token pool", "error", err)
+			os.Exit(1)
+		}
+		stateManager.SetTokenPool(pool, customLogger)
+		customLogger.Info("Token states are shared through the token pool", "tokenPoolFilePath", tokenPoolFilePath)
+	}
 
 	// Sync token status with the latest authentication credentials
 	customLogger.Info("Syncing token status with latest authentication credentials...")
@@ -60,26 +128,50 @@ func main() {
 		customLogger.Info("Token status synced with latest authentication credentials successfully")
 	}
 
-	// Load and validate the configuration
-	customLogger.Info("Loading configuration...")
-	if err := config.InitializeConfig(); err != nil {
-		customLogger.Logger.Error("Failed to initialize configuration", "error", err)
-		os.Exit(1)
+	//Initialize SQLC DB
+	customLogger.Info("Initializing SQLC DB...")
+	if *dryRun {
+		db, tx, err := dbsetup.InitializeDryRunDb()
+		if err != nil {
+			customLogger.Logger.Error("Failed to initialize SQLC DB for dry run", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		defer tx.Rollback()
 	} else {
-		customLogger.Info("Configuration initialized successfully")
+		db, err := dbsetup.InitializeDb()
+		if err != nil {
+			customLogger.Logger.Error("Failed to initialize SQLC DB", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
 	}
 
-	//Initialize SQLC DB
-	customLogger.Info("Initializing SQLC DB...")
-	db, err := dbsetup.InitializeDb()
-	if err != nil {
-		customLogger.Logger.Error("Failed to initialize SQLC DB", "error", err)
+	// Initialize the identity resolver with the alias overrides
+	customLogger.Info("Initializing identity resolver...")
+	aliasOverridesFilePath := filepath.Join(shared.RootDir, "config", "identity_aliases.json")
+	if err := identity.InitializeResolver(aliasOverridesFilePath); err != nil {
+		customLogger.Logger.Error("Failed to initialize identity resolver", "error", err)
 		os.Exit(1)
+	} else {
+		customLogger.Info("Identity resolver initialized successfully", "aliasOverridesFilePath", aliasOverridesFilePath)
+	}
+
+	if *dryRun {
+		outputDir := *dryRunDir
+		if outputDir == "" {
+			outputDir = filepath.Join(shared.RootDir, "dryrun", time.Now().Format("20060102T150405"))
+		}
+		customLogger.Info("Dry run enabled. Payloads will be written to disk instead of the relay", "outputDir", outputDir)
+		if err := relay.InitializeDryRunRelayService(outputDir); err != nil {
+			customLogger.Logger.Error("Failed to initialize dry run relay service", "error", err)
+			os.Exit(1)
+		}
 	}
-	defer db.Close()
 
 	cfg := config.AcquireConfig()
 	customLogger.Info("Configuration loaded successfully", "activeService", cfg.ActiveService)
+	privacy.RedactLogger(customLogger, privacy.AcquireRedactor())
 
 	// initialte services
 	customLogger.Info("Initializing Services...")
@@ -100,6 +192,22 @@ func main() {
 	}
 	customLogger.Info("Initialized All Services Successfully")
 
+	if *dryRun {
+		runDryRun(customLogger, datapullIntegrationSvc)
+		return
+	}
+
+	// Reload the credentials on SIGHUP or when the auth tokens file changes, so tokens can be added or revoked mid-run
+	credentialReloader, err := credservice.NewCredentialReloader(customLogger, credentialProvider, fingerprintKeyFilePath,
+		credservice.DatapullCredentialsKey, datapullIntegrationSvc.ReloadCredentials)
+	if err != nil {
+		customLogger.Error("Failed to initialize credential reloader", "error", err)
+		os.Exit(1)
+	}
+	go credentialReloader.Watch(context.Background())
+	customLogger.Info("Watching credentials for changes", "provider", credentialProvider.Name())
+	go datapullIntegrationSvc.WatchTokenHealth(context.Background())
+
 	// Initialize the job scheduler
 	scheduler, err := jobscheduler.NewJobScheduler(customLogger, stateManager, "Datapull", datapullIntegrationSvc.RunJob, cfg)
 	if err != nil {
@@ -111,7 +219,33 @@ func main() {
 
 	// Start the job scheduler
 	customLogger.Info("Starting job scheduler...")
-	scheduler.Run()
+	runErr := scheduler.Run()
 	customLogger.Info("Job scheduler stopped")
+	if runErr != nil {
+		// os.Exit skips the deferred Close, which writes the usage deferred by the write-behind mode and releases the
+		// token pool leases
+		if err := stateManager.Close(); err != nil {
+			customLogger.Error("Failed to close state manager before exiting", "error", err)
+		}
+		os.Exit(1)
+	}
 	customLogger.Info("Exiting application...")
 }
+
+// runDryRun runs the job exactly once, bypassing the scheduler, and prints what would have been relayed.
+func runDryRun(customLogger *shared.CustomLogger, datapullIntegrationSvc integrations.Integrator) {
+	customLogger.Info("Starting dry run...")
+	jobErr := datapullIntegrationSvc.RunJob()
+	if jobErr != nil {
+		customLogger.Error("Dry run job failed", "error", jobErr)
+	}
+
+	if err := relay.AcquireDryRunRelayService().WriteSummary(os.Stdout); err != nil {
+		customLogger.Error("Failed to write dry run summary", "error", err)
+	}
+	if jobErr != nil {
+		// os.Exit skips the deferred rollback, but the uncommitted transaction is discarded with the connection
+		os.Exit(1)
+	}
+	customLogger.Info("Dry run completed. Database changes rolled back")
+}
@@ -3,10 +3,12 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/patternmatch"
 )
 
 type ServiceKey string
@@ -32,7 +34,17 @@ type Config struct {
 	Integrations  Integrations `json:"integrations"`
 	Common        Common       `json:"common"`
 	Defaults      Defaults     `json:"defaults"`
-	Secrets       Secrets      `json:"secrets"`
+	Privacy       Privacy      `json:"privacy"`
+	Credentials   Credentials  `json:"credentials"`
+	TokenHealth   TokenHealth  `json:"tokenHealth"`
+	// TokenSelection picks the token of each API request
+	TokenSelection   TokenSelection   `json:"tokenSelection"`
+	StatePersistence StatePersistence `json:"statePersistence"`
+	// TokenPool shares the token states between the datapullers of the same host
+	TokenPool TokenPool `json:"tokenPool"`
+	// HTTPTransport configures the connections to the integrations and the relay
+	HTTPTransport HTTPTransport `json:"httpTransport"`
+	Secrets       Secrets       `json:"secrets"`
 }
 
 type Integrations struct {
@@ -48,7 +60,71 @@ type BitbucketServer struct {
 }
 
 type BitbucketCloud struct {
+	// BaseURL is the REST API root, e.g. a fake Bitbucket Cloud server for local development.
+	BaseURL string `json:"baseURL"`
+	// OAuthTokenURL is where OAuth consumers fetch their access tokens. When empty it is derived from BaseURL, the
+	// /site/oauth2/access_token path of its host without the "api." prefix.
+	OAuthTokenURL string `json:"oauthTokenURL"`
+	// Workspace is the workspace that is pulled when AllowedWorkspaces is empty.
 	Workspace string `json:"workspace"`
+	// AllowedWorkspaces lists the workspaces that are pulled, in place of Workspace.
+	AllowedWorkspaces []string   `json:"allowedWorkspaces"`
+	RepoFilter        RepoFilter `json:"repoFilter"`
+}
+
+func (bc BitbucketCloud) Validate() error {
+	if err := validateHTTPURL("baseURL", bc.BaseURL); err != nil {
+		return err
+	}
+	if err := validateHTTPURL("oauthTokenURL", bc.OAuthTokenURL); err != nil {
+		return err
+	}
+	return bc.RepoFilter.Validate()
+}
+
+// validateHTTPURL accepts an empty value or an absolute http or https URL.
+func validateHTTPURL(name, rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL, got %q", name, rawURL)
+	}
+	return nil
+}
+
+// RepoFilter selects which repositories of the allowed workspaces are synced.
+// Slug and project key patterns are globs, or regular expressions when prefixed with "re:".
+// A repository is selected when it matches the include lists (an empty list includes everything)
+// and matches none of the exclude lists.
+type RepoFilter struct {
+	IncludeSlugs       []string `json:"includeSlugs"`
+	ExcludeSlugs       []string `json:"excludeSlugs"`
+	IncludeProjectKeys []string `json:"includeProjectKeys"`
+	ExcludeProjectKeys []string `json:"excludeProjectKeys"`
+	SkipArchived       bool     `json:"skipArchived"`
+}
+
+func (rf RepoFilter) Validate() error {
+	patternLists := []struct {
+		name     string
+		patterns []string
+	}{
+		{"includeSlugs", rf.IncludeSlugs},
+		{"excludeSlugs", rf.ExcludeSlugs},
+		{"includeProjectKeys", rf.IncludeProjectKeys},
+		{"excludeProjectKeys", rf.ExcludeProjectKeys},
+	}
+	for _, patternList := range patternLists {
+		if _, err := patternmatch.Compile(patternList.patterns); err != nil {
+			return fmt.Errorf("invalid repoFilter.%s: %w", patternList.name, err)
+		}
+	}
+	return nil
 }
 
 type Github struct {
@@ -72,10 +148,312 @@ type Defaults struct {
 	RequestSizeThresholdInBytes      int `json:"requestSizeThresholdInBytes"`
 	DefaultDataPullDays              int `json:"defaultDataPullDays"`
 	WaitingTimeForRateLimitInSeconds int `json:"waitingTimeForRateLimitInSeconds"`
+	// InactiveRepoRetentionDays is how long a deactivated repository sync audit is kept before it is purged.
+	InactiveRepoRetentionDays int `json:"inactiveRepoRetentionDays"`
+}
+
+type PrivacyAction string
+
+const (
+	PrivacyActionKeep     PrivacyAction = "keep"
+	PrivacyActionDrop     PrivacyAction = "drop"
+	PrivacyActionHash     PrivacyAction = "hash"
+	PrivacyActionTruncate PrivacyAction = "truncate"
+)
+
+// FieldPolicy is what happens to a personal field before it is relayed or logged. An empty action keeps the field.
+type FieldPolicy struct {
+	Action PrivacyAction `json:"action"`
+	// MaxLength is the number of characters kept by the truncate action.
+	MaxLength int `json:"maxLength,omitempty"`
+}
+
+// Privacy holds the redaction policies of the personal fields of the relayed data.
+// The hash action uses SHA-256 salted with secrets.privacyHashSalt.
+type Privacy struct {
+	ActorEmail    FieldPolicy `json:"actorEmail"`
+	ActorName     FieldPolicy `json:"actorName"`
+	CommitMessage FieldPolicy `json:"commitMessage"`
+	PrTitle       FieldPolicy `json:"prTitle"`
+	PrDescription FieldPolicy `json:"prDescription"`
+}
+
+func (p Privacy) fieldPolicies() []struct {
+	name   string
+	policy FieldPolicy
+} {
+	return []struct {
+		name   string
+		policy FieldPolicy
+	}{
+		{"actorEmail", p.ActorEmail},
+		{"actorName", p.ActorName},
+		{"commitMessage", p.CommitMessage},
+		{"prTitle", p.PrTitle},
+		{"prDescription", p.PrDescription},
+	}
+}
+
+// UsesHash reports whether any field is hashed, which requires a hash salt.
+func (p Privacy) UsesHash() bool {
+	for _, field := range p.fieldPolicies() {
+		if field.policy.Action == PrivacyActionHash {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Privacy) Validate() error {
+	for _, field := range p.fieldPolicies() {
+		switch field.policy.Action {
+		case "", PrivacyActionKeep, PrivacyActionDrop, PrivacyActionHash:
+		case PrivacyActionTruncate:
+			if field.policy.MaxLength <= 0 {
+				return fmt.Errorf("privacy.%s: maxLength must be greater than 0 for the truncate action", field.name)
+			}
+		default:
+			return fmt.Errorf("privacy.%s: unsupported action: %s", field.name, field.policy.Action)
+		}
+	}
+	return nil
+}
+
+// merge overrides the policies of p with the policies set in userPrivacy.
+func (p Privacy) merge(userPrivacy Privacy) Privacy {
+	mergeField := func(defaultPolicy, userPolicy FieldPolicy) FieldPolicy {
+		if userPolicy.Action != "" {
+			return userPolicy
+		}
+		return defaultPolicy
+	}
+	return Privacy{
+		ActorEmail:    mergeField(p.ActorEmail, userPrivacy.ActorEmail),
+		ActorName:     mergeField(p.ActorName, userPrivacy.ActorName),
+		CommitMessage: mergeField(p.CommitMessage, userPrivacy.CommitMessage),
+		PrTitle:       mergeField(p.PrTitle, userPrivacy.PrTitle),
+		PrDescription: mergeField(p.PrDescription, userPrivacy.PrDescription),
+	}
+}
+
+type CredentialProviderKind string
+
+const (
+	CredentialProviderFile    CredentialProviderKind = "file"
+	CredentialProviderEnv     CredentialProviderKind = "env"
+	CredentialProviderCommand CredentialProviderKind = "command"
+	CredentialProviderVault   CredentialProviderKind = "vault"
+)
+
+// Credentials selects where the auth credentials are loaded from. The file provider reads secrets/auth_tokens.json.
+type Credentials struct {
+	Provider CredentialProviderKind `json:"provider"`
+	Env      EnvCredentials         `json:"env"`
+	Command  CommandCredentials     `json:"command"`
+	Vault    VaultCredentials       `json:"vault"`
+}
+
+// EnvCredentials reads credentials from variables such as <prefix>DATAPULL_CREDENTIALS_1_USERNAME and
+// <prefix>DATAPULL_CREDENTIALS_1_PASSWORD.
+type EnvCredentials struct {
+	Prefix string `json:"prefix"`
+}
+
+// CommandCredentials runs a command printing the credential store as JSON on stdout, like a git credential helper.
+type CommandCredentials struct {
+	Path           string   `json:"path"`
+	Args           []string `json:"args"`
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+}
+
+// VaultCredentials reads the credential store from a secret of a Vault compatible KV secrets engine.
+// The token is read from the TokenEnvVar environment variable, never from the configuration.
+type VaultCredentials struct {
+	Address     string `json:"address"`
+	Namespace   string `json:"namespace"`
+	MountPath   string `json:"mountPath"`
+	SecretPath  string `json:"secretPath"`
+	KVVersion   int    `json:"kvVersion"`
+	TokenEnvVar string `json:"tokenEnvVar"`
+}
+
+func (c Credentials) Validate() error {
+	switch c.Provider {
+	case "", CredentialProviderFile, CredentialProviderEnv:
+	case CredentialProviderCommand:
+		if c.Command.Path == "" {
+			return fmt.Errorf("credentials.command.path is required for the command provider")
+		}
+		if c.Command.TimeoutSeconds < 0 {
+			return fmt.Errorf("credentials.command.timeoutSeconds must not be negative")
+		}
+	case CredentialProviderVault:
+		if c.Vault.SecretPath == "" {
+			return fmt.Errorf("credentials.vault.secretPath is required for the vault provider")
+		}
+		if c.Vault.KVVersion != 0 && c.Vault.KVVersion != 1 && c.Vault.KVVersion != 2 {
+			return fmt.Errorf("credentials.vault.kvVersion must be 1 or 2")
+		}
+	default:
+		return fmt.Errorf("unsupported credentials provider: %s", c.Provider)
+	}
+	return nil
+}
+
+// TokenHealth configures the health probes of unauthorized tokens. A token is first probed ProbeIntervalSeconds after
+// it became unauthorized, the interval doubles with every failed probe up to MaxProbeIntervalSeconds, and the token is
+// marked revoked after RevokeAfterFailures consecutive failed probes.
+type TokenHealth struct {
+	Disabled                bool `json:"disabled"`
+	ProbeIntervalSeconds    int  `json:"probeIntervalSeconds"`
+	MaxProbeIntervalSeconds int  `json:"maxProbeIntervalSeconds"`
+	RevokeAfterFailures     int  `json:"revokeAfterFailures"`
+}
+
+func (th TokenHealth) Validate() error {
+	if th.ProbeIntervalSeconds <= 0 {
+		return fmt.Errorf("tokenHealth.probeIntervalSeconds must be greater than 0")
+	}
+	if th.MaxProbeIntervalSeconds < th.ProbeIntervalSeconds {
+		return fmt.Errorf("tokenHealth.maxProbeIntervalSeconds must not be less than probeIntervalSeconds")
+	}
+	if th.RevokeAfterFailures <= 0 {
+		return fmt.Errorf("tokenHealth.revokeAfterFailures must be greater than 0")
+	}
+	return nil
+}
+
+type TokenSelectionStrategyKind string
+
+const (
+	TokenSelectionRoundRobin         TokenSelectionStrategyKind = "roundRobin"
+	TokenSelectionLeastUsed          TokenSelectionStrategyKind = "leastUsed"
+	TokenSelectionMostRemainingQuota TokenSelectionStrategyKind = "mostRemainingQuota"
+	TokenSelectionWeighted           TokenSelectionStrategyKind = "weighted"
+)
+
+// TokenSelection selects the strategy picking the active token of each request. The least used token is picked when
+// no strategy is set.
+type TokenSelection struct {
+	Strategy TokenSelectionStrategyKind `json:"strategy"`
+	Weights  TokenSelectionWeights      `json:"weights"`
+}
+
+// TokenSelectionWeights are the weights of the weighted strategy. Each token is scored by its remaining quota, minus
+// its latency, consecutive failures and usage, every metric relative to the other active tokens.
+type TokenSelectionWeights struct {
+	RemainingQuota float64 `json:"remainingQuota"`
+	Latency        float64 `json:"latency"`
+	Failures       float64 `json:"failures"`
+	Usage          float64 `json:"usage"`
+}
+
+func (ts TokenSelection) Validate() error {
+	switch ts.Strategy {
+	case "", TokenSelectionRoundRobin, TokenSelectionLeastUsed, TokenSelectionMostRemainingQuota:
+	case TokenSelectionWeighted:
+		weights := ts.Weights
+		if weights.RemainingQuota < 0 || weights.Latency < 0 || weights.Failures < 0 || weights.Usage < 0 {
+			return fmt.Errorf("tokenSelection.weights must not be negative")
+		}
+		if weights == (TokenSelectionWeights{}) {
+			return fmt.Errorf("tokenSelection.weights needs a weight greater than 0 for the weighted strategy")
+		}
+	default:
+		return fmt.Errorf("unsupported tokenSelection.strategy: %s", ts.Strategy)
+	}
+	return nil
+}
+
+type StatePersistenceMode string
+
+const (
+	StatePersistenceImmediate   StatePersistenceMode = "immediate"
+	StatePersistenceWriteBehind StatePersistenceMode = "writeBehind"
+)
+
+// StatePersistence selects when the state file is written. The immediate mode writes it on every change. The
+// writeBehind mode writes the usage accounting of the requests every FlushIntervalSeconds, status changes and job
+// times are still written immediately.
+type StatePersistence struct {
+	Mode                 StatePersistenceMode `json:"mode"`
+	FlushIntervalSeconds int                  `json:"flushIntervalSeconds"`
+}
+
+func (sp StatePersistence) Validate() error {
+	switch sp.Mode {
+	case "", StatePersistenceImmediate:
+	case StatePersistenceWriteBehind:
+		if sp.FlushIntervalSeconds <= 0 {
+			return fmt.Errorf("statePersistence.flushIntervalSeconds must be greater than 0 for the writeBehind mode")
+		}
+	default:
+		return fmt.Errorf("unsupported statePersistence.mode: %s", sp.Mode)
+	}
+	return nil
+}
+
+// TokenPool shares the token states between the datapullers using the same auth tokens, e.g. one per workspace on
+// the same host, through a SQLite file at Path, relative to the root directory unless absolute. An empty Path keeps
+// the token states to each process. A datapuller leases the token it selects for LeaseSeconds, the others pick
+// other tokens meanwhile when they can.
+type TokenPool struct {
+	Path         string `json:"path"`
+	LeaseSeconds int    `json:"leaseSeconds"`
+}
+
+func (tp TokenPool) Validate() error {
+	if tp.Path != "" && tp.LeaseSeconds <= 0 {
+		return fmt.Errorf("tokenPool.leaseSeconds must be greater than 0")
+	}
+	return nil
+}
+
+// HTTPTransport configures the HTTP client shared by the integrations and the relay. Without ProxyURL the proxy is
+// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. CABundlePath adds the PEM certificates of
+// e.g. a TLS intercepting proxy to the system roots, ClientCertPath and ClientKeyPath authenticate the client with
+// mTLS. Relative paths are relative to the root directory.
+// ConnectTimeoutSeconds bounds the connection and the TLS handshake, ReadTimeoutSeconds the wait for the response
+// headers and RequestTimeoutSeconds the whole request, including reading the response body.
+type HTTPTransport struct {
+	ProxyURL              string `json:"proxyURL"`
+	CABundlePath          string `json:"caBundlePath"`
+	ClientCertPath        string `json:"clientCertPath"`
+	ClientKeyPath         string `json:"clientKeyPath"`
+	ConnectTimeoutSeconds int    `json:"connectTimeoutSeconds"`
+	ReadTimeoutSeconds    int    `json:"readTimeoutSeconds"`
+	RequestTimeoutSeconds int    `json:"requestTimeoutSeconds"`
+	MaxIdleConnsPerHost   int    `json:"maxIdleConnsPerHost"`
+}
+
+func (ht HTTPTransport) Validate() error {
+	if ht.ProxyURL != "" {
+		proxyURL, err := url.Parse(ht.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("httpTransport.proxyURL is invalid: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("httpTransport.proxyURL must use the http, https or socks5 scheme")
+		}
+	}
+	if (ht.ClientCertPath == "") != (ht.ClientKeyPath == "") {
+		return fmt.Errorf("httpTransport.clientCertPath and httpTransport.clientKeyPath must be set together")
+	}
+	if ht.ConnectTimeoutSeconds <= 0 || ht.ReadTimeoutSeconds <= 0 || ht.RequestTimeoutSeconds <= 0 {
+		return fmt.Errorf("httpTransport timeouts must be greater than 0")
+	}
+	if ht.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("httpTransport.maxIdleConnsPerHost must be greater than 0")
+	}
+	return nil
 }
 
 type Secrets struct {
 	DDApiKey string `json:"ddApiKey"`
+	// PrivacyHashSalt is the organization salt of the privacy hash action.
+	PrivacyHashSalt string `json:"privacyHashSalt"`
 }
 
 func NewDefaults() *Defaults {
@@ -83,6 +461,7 @@ func NewDefaults() *Defaults {
 		RequestSizeThresholdInBytes:      200 * 1024, // 200KB
 		DefaultDataPullDays:              30,
 		WaitingTimeForRateLimitInSeconds: 3600,
+		InactiveRepoRetentionDays:        90,
 	}
 }
 
@@ -142,7 +521,13 @@ func LoadMergedConfig() (*Config, error) {
 		if userConfig.Integrations.BitbucketCloud.Workspace == "" {
 			return nil, fmt.Errorf("bitbucketCloud Workspace is required")
 		}
+		if err := userConfig.Integrations.BitbucketCloud.Validate(); err != nil {
+			return nil, fmt.Errorf("bitbucketCloud: %w", err)
+		}
 		mergedConfig.Integrations.BitbucketCloud = userConfig.Integrations.BitbucketCloud
+		if mergedConfig.Integrations.BitbucketCloud.BaseURL == "" {
+			mergedConfig.Integrations.BitbucketCloud.BaseURL = defaultConfig.Integrations.BitbucketCloud.BaseURL
+		}
 	case GithubKey:
 		if userConfig.Integrations.Github.URL != defaultConfig.Integrations.Github.URL {
 			mergedConfig.Integrations.Github = userConfig.Integrations.Github
@@ -184,9 +569,86 @@ func LoadMergedConfig() (*Config, error) {
 	if userConfig.Defaults.WaitingTimeForRateLimitInSeconds != 0 {
 		mergedConfig.Defaults.WaitingTimeForRateLimitInSeconds = userConfig.Defaults.WaitingTimeForRateLimitInSeconds
 	}
+	if userConfig.Defaults.InactiveRepoRetentionDays != 0 {
+		mergedConfig.Defaults.InactiveRepoRetentionDays = userConfig.Defaults.InactiveRepoRetentionDays
+	}
 	if userConfig.Secrets.DDApiKey != "" {
 		mergedConfig.Secrets.DDApiKey = userConfig.Secrets.DDApiKey
 	}
+	if userConfig.Secrets.PrivacyHashSalt != "" {
+		mergedConfig.Secrets.PrivacyHashSalt = userConfig.Secrets.PrivacyHashSalt
+	}
+
+	// Merge privacy policies
+	if err := userConfig.Privacy.Validate(); err != nil {
+		return nil, err
+	}
+	mergedConfig.Privacy = defaultConfig.Privacy.merge(userConfig.Privacy)
+
+	// Merge credentials provider
+	if userConfig.Credentials.Provider != "" {
+		mergedConfig.Credentials = userConfig.Credentials
+	}
+	// Merge token health probing
+	mergedConfig.TokenHealth.Disabled = userConfig.TokenHealth.Disabled
+	if userConfig.TokenHealth.ProbeIntervalSeconds != 0 {
+		mergedConfig.TokenHealth.ProbeIntervalSeconds = userConfig.TokenHealth.ProbeIntervalSeconds
+	}
+	if userConfig.TokenHealth.MaxProbeIntervalSeconds != 0 {
+		mergedConfig.TokenHealth.MaxProbeIntervalSeconds = userConfig.TokenHealth.MaxProbeIntervalSeconds
+	}
+	if userConfig.TokenHealth.RevokeAfterFailures != 0 {
+		mergedConfig.TokenHealth.RevokeAfterFailures = userConfig.TokenHealth.RevokeAfterFailures
+	}
+	// Merge token selection
+	if userConfig.TokenSelection.Strategy != "" {
+		mergedConfig.TokenSelection.Strategy = userConfig.TokenSelection.Strategy
+	}
+	if userConfig.TokenSelection.Weights != (TokenSelectionWeights{}) {
+		mergedConfig.TokenSelection.Weights = userConfig.TokenSelection.Weights
+	}
+	// Merge state persistence
+	if userConfig.StatePersistence.Mode != "" {
+		mergedConfig.StatePersistence.Mode = userConfig.StatePersistence.Mode
+	}
+	if userConfig.StatePersistence.FlushIntervalSeconds != 0 {
+		mergedConfig.StatePersistence.FlushIntervalSeconds = userConfig.StatePersistence.FlushIntervalSeconds
+	}
+	// Merge token pool
+	if userConfig.TokenPool.Path != "" {
+		mergedConfig.TokenPool.Path = userConfig.TokenPool.Path
+	}
+	if userConfig.TokenPool.LeaseSeconds != 0 {
+		mergedConfig.TokenPool.LeaseSeconds = userConfig.TokenPool.LeaseSeconds
+	}
+	// Merge HTTP transport
+	if userConfig.HTTPTransport.ProxyURL != "" {
+		mergedConfig.HTTPTransport.ProxyURL = userConfig.HTTPTransport.ProxyURL
+	}
+	if userConfig.HTTPTransport.CABundlePath != "" {
+		mergedConfig.HTTPTransport.CABundlePath = userConfig.HTTPTransport.CABundlePath
+	}
+	if userConfig.HTTPTransport.ClientCertPath != "" {
+		mergedConfig.HTTPTransport.ClientCertPath = userConfig.HTTPTransport.ClientCertPath
+	}
+	if userConfig.HTTPTransport.ClientKeyPath != "" {
+		mergedConfig.HTTPTransport.ClientKeyPath = userConfig.HTTPTransport.ClientKeyPath
+	}
+	if userConfig.HTTPTransport.ConnectTimeoutSeconds != 0 {
+		mergedConfig.HTTPTransport.ConnectTimeoutSeconds = userConfig.HTTPTransport.ConnectTimeoutSeconds
+	}
+	if userConfig.HTTPTransport.ReadTimeoutSeconds != 0 {
+		mergedConfig.HTTPTransport.ReadTimeoutSeconds = userConfig.HTTPTransport.ReadTimeoutSeconds
+	}
+	if userConfig.HTTPTransport.RequestTimeoutSeconds != 0 {
+		mergedConfig.HTTPTransport.RequestTimeoutSeconds = userConfig.HTTPTransport.RequestTimeoutSeconds
+	}
+	if userConfig.HTTPTransport.MaxIdleConnsPerHost != 0 {
+		mergedConfig.HTTPTransport.MaxIdleConnsPerHost = userConfig.HTTPTransport.MaxIdleConnsPerHost
+	}
+	if mergedConfig.Privacy.UsesHash() && mergedConfig.Secrets.PrivacyHashSalt == "" {
+		return nil, fmt.Errorf("privacyHashSalt is required when a privacy policy uses the hash action")
+	}
 	// Validate the merged configuration
 	err = mergedConfig.ValidateDefaultsAndCommonConfig()
 	if err != nil {
@@ -228,6 +690,30 @@ func (c *Config) ValidateDefaultsAndCommonConfig() error {
 	if c.Defaults.WaitingTimeForRateLimitInSeconds <= 0 {
 		return fmt.Errorf("waitingTimeForRateLimitInSeconds must be greater than 0")
 	}
+	if c.Defaults.InactiveRepoRetentionDays <= 0 {
+		return fmt.Errorf("inactiveRepoRetentionDays must be greater than 0")
+	}
+	if err := c.Privacy.Validate(); err != nil {
+		return err
+	}
+	if err := c.Credentials.Validate(); err != nil {
+		return err
+	}
+	if err := c.TokenHealth.Validate(); err != nil {
+		return err
+	}
+	if err := c.TokenSelection.Validate(); err != nil {
+		return err
+	}
+	if err := c.StatePersistence.Validate(); err != nil {
+		return err
+	}
+	if err := c.TokenPool.Validate(); err != nil {
+		return err
+	}
+	if err := c.HTTPTransport.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
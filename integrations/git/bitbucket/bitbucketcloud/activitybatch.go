@@ -0,0 +1,91 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
+)
+
+// activityBatchSize is the number of pull requests and commits relayed in one activity payload.
+const activityBatchSize = 100
+
+// activityBatch buffers the pull requests and commits of a repository and relays them in payloads of at most limit
+// entries, so a sync holds one batch in memory whatever the size of the repository.
+type activityBatch struct {
+	bcSvc         *BitbucketCloudSvc
+	repoSyncAudit dbgen.RepositorySyncAudit
+	limit         int
+
+	prs          []gitdtos.BLPullRequest
+	commits      []gitdtos.BLCommit
+	commitHashes set.Set[string]
+}
+
+func (bcSvc *BitbucketCloudSvc) newActivityBatch(repoSyncAudit dbgen.RepositorySyncAudit) *activityBatch {
+	return &activityBatch{bcSvc: bcSvc, repoSyncAudit: repoSyncAudit, limit: activityBatchSize, commitHashes: set.New[string]()}
+}
+
+func (batch *activityBatch) addPullRequest(pr gitdtos.BLPullRequest) error {
+	batch.prs = append(batch.prs, pr)
+	return batch.flushWhenFull()
+}
+
+func (batch *activityBatch) addCommit(commit BBktCloudCommit) error {
+	batch.commits = append(batch.commits, gitdtos.BLCommit{
+		ID:                 commit.Hash,
+		Message:            commit.Message,
+		Committer:          batch.bcSvc.resolveActor(commit.Author.User, commit.Author.Raw),
+		CommitterTimestamp: commit.Date,
+		ChangedFiles:       []gitdtos.BLChangedFile{},
+	})
+	batch.commitHashes.Add(commit.Hash)
+	return batch.flushWhenFull()
+}
+
+// hasCommit tells whether the commit is waiting in the batch. Relayed commits are recorded as such by flush.
+func (batch *activityBatch) hasCommit(hash string) bool {
+	return batch.commitHashes.Contains(hash)
+}
+
+func (batch *activityBatch) flushWhenFull() error {
+	if len(batch.prs)+len(batch.commits) < batch.limit {
+		return nil
+	}
+	return batch.flush()
+}
+
+// flush relays the buffered pull requests and commits, then records the commits as relayed.
+func (batch *activityBatch) flush() error {
+	if len(batch.prs) == 0 && len(batch.commits) == 0 {
+		return nil
+	}
+	data := gitdtos.BLData{
+		Repos: []gitdtos.BLRepo{{
+			Slug:    batch.repoSyncAudit.RepoSlug,
+			Prs:     batch.prs,
+			Commits: batch.commits,
+		}},
+		WorkspaceKey: batch.repoSyncAudit.WorkspaceSlug,
+	}
+	if err := batch.bcSvc.dataRelayer.SendCollectedData(data, url.Values(map[string][]string{"type": {gitdtos.PayloadTypeActivityPull}})); err != nil {
+		return fmt.Errorf("error sending data to data relayer: %w", err)
+	}
+
+	for _, commit := range batch.commits {
+		if err := batch.bcSvc.dbQuerier.CreateRelayedCommit(context.Background(), dbgen.CreateRelayedCommitParams{
+			Provider: batch.repoSyncAudit.Provider,
+			RepoUuid: batch.repoSyncAudit.RepoUuid,
+			Hash:     commit.ID,
+		}); err != nil {
+			return fmt.Errorf("error recording relayed commit: %s: %w", commit.ID, err)
+		}
+	}
+	batch.prs = nil
+	batch.commits = nil
+	batch.commitHashes.Clear()
+	return nil
+}
@@ -1,76 +1,150 @@
 package bitbucketcloud
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bluelock-go/config"
 	"github.com/bluelock-go/shared"
 	"github.com/bluelock-go/shared/auth"
 	"github.com/bluelock-go/shared/auth/credservice"
 	"github.com/bluelock-go/shared/customerrors"
 	"github.com/bluelock-go/shared/di"
+	"github.com/bluelock-go/shared/httptransport"
 	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
 )
 
+// DefaultBaseURL is the root of the Bitbucket Cloud REST API.
+const DefaultBaseURL = "https://api.bitbucket.org/2.0"
+
 type Client struct {
-	baseURL      string
-	httpClient   *http.Client
-	stateManager *statemanager.StateManager
-	logger       *shared.CustomLogger
-	credentials  []auth.Credential
+	baseURL       string
+	oauthTokenURL string
+	httpClient    *http.Client
+	stateManager  *statemanager.StateManager
+	logger        *shared.CustomLogger
+	// credentialsMu keeps a credential reload from swapping the credentials between picking a token and looking up
+	// its credential
+	credentialsMu sync.RWMutex
+	credentials   []auth.Credential
 }
 
+// NewClient creates a Bitbucket Cloud client sending its requests with httpClient, or with a client with a 10s
+// timeout when it is nil.
 func NewClient(httpClient *http.Client, stateManager *statemanager.StateManager, logger *shared.CustomLogger, credentials []auth.Credential) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
 	return &Client{
-		baseURL:      "https://api.bitbucket.org/2.0",
-		httpClient:   httpClient,
-		stateManager: stateManager,
-		logger:       logger,
-		credentials:  credentials,
+		baseURL:       DefaultBaseURL,
+		oauthTokenURL: defaultOAuthTokenURL,
+		httpClient:    httpClient,
+		stateManager:  stateManager,
+		logger:        logger,
+		credentials:   credentials,
 	}
 }
 
+// SetBaseURL points the client to another API root, e.g. a fake Bitbucket Cloud server, along with the OAuth token
+// URL of its host. It must be called before the client sends requests.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+	c.oauthTokenURL = oauthTokenURLOf(c.baseURL)
+}
+
+// SetOAuthTokenURL overrides the OAuth token URL derived from the base URL. It must be called after SetBaseURL.
+func (c *Client) SetOAuthTokenURL(oauthTokenURL string) {
+	c.oauthTokenURL = oauthTokenURL
+}
+
+// Credentials returns the credentials the client currently authenticates with.
+func (c *Client) Credentials() []auth.Credential {
+	c.credentialsMu.RLock()
+	defer c.credentialsMu.RUnlock()
+	return c.credentials
+}
+
+// ReloadCredentials swaps in reloaded credentials and syncs the token states with them, so added tokens are used
+// and revoked tokens are no longer picked by the following requests.
+func (c *Client) ReloadCredentials(credentials []auth.Credential) error {
+	c.credentialsMu.Lock()
+	defer c.credentialsMu.Unlock()
+
+	if err := c.stateManager.SyncTokenStatusWithLatestAuthCredentials(credentials); err != nil {
+		return fmt.Errorf("failed to sync token status with reloaded credentials: %w", err)
+	}
+	c.credentials = credentials
+	return nil
+}
+
 const MAX_ATTEMPTS = 2
 const WAITING_TIME_FOR_RATE_LIMIT_IN_SECONDS = 3
 
 func (c *Client) HandleRequestWithRetries(requestCallback func(*auth.Credential) (*http.Response, error)) (*http.Response, error) {
+	// OAuth consumers whose cached access token was already renewed after a 401 in this call
+	renewedOAuthTokenIDs := map[string]bool{}
+	// exhaustedAt is when the previous attempt ran out of tokens
+	var exhaustedAt time.Time
 	for attemptNumber := range MAX_ATTEMPTS {
 
 		if attemptNumber > 0 {
-			c.logger.Info(fmt.Sprintf("Sleeping for %d seconds", WAITING_TIME_FOR_RATE_LIMIT_IN_SECONDS))
-			time.Sleep(WAITING_TIME_FOR_RATE_LIMIT_IN_SECONDS * time.Second)
+			// the processes sharing the token pool wait for the same reset time
+			resetAt, err := c.stateManager.ScheduleRateLimitReset(exhaustedAt, exhaustedAt.Add(WAITING_TIME_FOR_RATE_LIMIT_IN_SECONDS*time.Second))
+			if err != nil {
+				c.logger.Error("Failed to schedule rate limit reset", "error", err)
+				return nil, fmt.Errorf("failed to schedule rate limit reset: %w", err)
+			}
+			c.logger.Info("Sleeping until rate limit reset", "resetAt", resetAt.Format(time.RFC3339))
+			time.Sleep(time.Until(resetAt))
 			c.logger.Info("Woke up!!\nResetting usage metrics for all tokens")
-			c.stateManager.ResetUsageMetricsForAllTokens(time.Now())
+			reset, err := c.stateManager.ResetUsageMetricsAfterExhaustion(exhaustedAt, time.Now())
+			if err != nil {
+				c.logger.Error("Failed to reset usage metrics for all tokens", "error", err)
+				return nil, fmt.Errorf("failed to reset usage metrics for all tokens: %w", err)
+			}
+			if !reset {
+				c.logger.Info("Usage metrics were already reset by another process of the token pool")
+			}
 			c.logger.Info("Retrying...")
 		}
 
 		for {
-			activeTokenID, err := c.stateManager.GetLeastUsageActiveToken()
+			c.credentialsMu.RLock()
+			activeTokenID, err := c.stateManager.SelectActiveToken()
 			if err != nil {
-				c.logger.Error("Failed to get least usage active token: " + err.Error())
+				c.logger.Error("Failed to select active token: " + err.Error())
 				c.logger.Warn("Current token states: ", "tokenStates", c.stateManager.State.TokenStates)
 				if errors.Is(err, customerrors.ErrCritical) {
+					c.credentialsMu.RUnlock()
 					return nil, err
 				} else if errors.Is(err, statemanager.ErrAllTokensExhausted) {
+					c.credentialsMu.RUnlock()
 					c.logger.Warn("All tokens are exhausted, need to wait for rate limit to reset.")
 					break
 				}
 			}
 
 			if activeTokenID == "" {
+				c.credentialsMu.RUnlock()
 				c.logger.Error("Token ID is empty but no error was returned")
 				return nil, fmt.Errorf("activeTokenID is empty: %w", customerrors.ErrCritical)
 			}
 
-			authCred, err := auth.GetCredentialByCredKey(activeTokenID, c.credentials)
+			authCred, err := auth.GetCredentialByTokenID(activeTokenID, c.credentials)
+			c.credentialsMu.RUnlock()
 			if err != nil {
-				c.logger.Error("Failed to get credential by credKey: " + err.Error())
+				c.logger.Error("Failed to get credential by token ID: " + err.Error())
 				break
 			}
 			if authCred == nil {
@@ -81,45 +155,108 @@ func (c *Client) HandleRequestWithRetries(requestCallback func(*auth.Credential)
 				continue
 			}
 
+			requestStartTime := time.Now()
 			response, err := requestCallback(authCred)
+			if errors.Is(err, ErrCredentialRejected) {
+				c.logger.Error("Credential rejected for token: "+authCred.TokenID, "error", err)
+				c.stateManager.SetTokenStatusToUnauthorized(authCred.TokenID)
+				continue
+			}
 			if err != nil {
+				c.recordTokenResponse(authCred.TokenID, nil, 0, time.Since(requestStartTime))
 				return nil, err
 			}
+			// the body is read here to account its bytes to the token, a page is small enough to be buffered
+			body, readErr := readResponseBody(response)
+			c.recordTokenResponse(authCred.TokenID, response, int64(len(body)), time.Since(requestStartTime))
 			if response.StatusCode == 200 {
+				if readErr != nil {
+					return nil, fmt.Errorf("failed to read response body for token: %s: %w", authCred.TokenID, readErr)
+				}
+				response.Body = io.NopCloser(bytes.NewReader(body))
 				return response, nil
 			}
-			defer response.Body.Close()
 			var message string
-			if body, err := io.ReadAll(response.Body); err != nil {
-				c.logger.Error("Failed to read response body: " + err.Error())
-				message = fmt.Sprintf("failed to read response body: %s", err.Error())
+			if readErr != nil {
+				c.logger.Error("Failed to read response body: " + readErr.Error())
+				message = fmt.Sprintf("failed to read response body: %s", readErr.Error())
 			} else {
 				message = fmt.Sprintf("response body: %s", string(body))
 			}
 
 			switch response.StatusCode {
 			case 401:
+				if authCred.GetType() == auth.OAuthClientCredentials && !renewedOAuthTokenIDs[authCred.TokenID] {
+					// the cached access token may have been revoked, renew it once before giving up on the consumer
+					c.logger.Warn("OAuth access token rejected, renewing it for token: " + authCred.TokenID)
+					renewedOAuthTokenIDs[authCred.TokenID] = true
+					c.stateManager.DeleteOAuthToken(authCred.TokenID)
+					continue
+				}
 				// Handle Unauthorized
-				c.logger.Error("Unauthorized access for token: " + authCred.CredKey)
-				c.stateManager.SetTokenStatusToUnauthorized(authCred.CredKey)
+				c.logger.Error("Unauthorized access for token: " + authCred.TokenID)
+				c.stateManager.SetTokenStatusToUnauthorized(authCred.TokenID)
 			case 429:
 				// Handle Rate Limit Exceeded
-				c.logger.Warn("Rate limit exceeded for token: " + authCred.CredKey)
-				c.stateManager.SetTokenStatusToRateLimited(authCred.CredKey)
+				c.logger.Warn("Rate limit exceeded for token: " + authCred.TokenID)
+				c.stateManager.SetTokenStatusToRateLimited(authCred.TokenID)
 			default:
-				c.logger.Error(fmt.Sprintf("Unhandled response code: %d for token: %s. message: %s", response.StatusCode, authCred.CredKey, message))
-				return nil, fmt.Errorf("unhandled response code: %d for token: %s. message: %s", response.StatusCode, authCred.CredKey, message)
+				if response.StatusCode >= 200 && response.StatusCode < 300 {
+					c.logger.Error(fmt.Sprintf("Unexpected 2xx response code: %d for token: %s. message: %s", response.StatusCode, authCred.TokenID, message))
+					return nil, fmt.Errorf("unexpected 2xx response code: %d for token: %s. message: %s", response.StatusCode, authCred.TokenID, message)
+				}
+				c.logger.Error(fmt.Sprintf("Unhandled response code: %d for token: %s. message: %s", response.StatusCode, authCred.TokenID, message))
+				return nil, fmt.Errorf("unhandled response code: %d for token: %s. message: %s", response.StatusCode, authCred.TokenID, message)
 			}
 		}
+		exhaustedAt = time.Now()
 	}
 
 	return nil, fmt.Errorf("exceeded maximum reset limit(%d) without a successful response", MAX_ATTEMPTS)
 }
 
+// readResponseBody reads and closes the body of a response.
+func readResponseBody(response *http.Response) ([]byte, error) {
+	if response.Body == nil {
+		return nil, nil
+	}
+	defer response.Body.Close()
+	return io.ReadAll(response.Body)
+}
+
+// recordTokenResponse accounts a response to its token and keeps its rate limit headers and latency for the token
+// selection strategies. response is nil when the request failed without one.
+func (c *Client) recordTokenResponse(tokenID string, response *http.Response, bodyBytes int64, latency time.Duration) {
+	observation := token.ResponseObservation{
+		ObservedAt: time.Now(),
+		Latency:    latency,
+		Bytes:      bodyBytes,
+	}
+	if response != nil {
+		observation.StatusCode = response.StatusCode
+		remaining, err := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining"))
+		if err == nil {
+			observation.HasRateLimit = true
+			observation.RateLimitRemaining = remaining
+			// the limit is optional, the remaining requests alone rank the tokens
+			observation.RateLimitLimit, _ = strconv.Atoi(response.Header.Get("X-RateLimit-Limit"))
+		}
+	}
+	if err := c.stateManager.RecordTokenResponse(tokenID, observation); err != nil {
+		c.logger.Warn("Failed to record token response", "tokenID", tokenID, "error", err)
+	}
+}
+
 func (c *Client) getRequestCallback(url string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) func(*auth.Credential) (*http.Response, error) {
 
 	return func(cred *auth.Credential) (*http.Response, error) {
-		token := base64.StdEncoding.EncodeToString(fmt.Appendf(nil, fmt.Sprintf("%s:%s", cred.Username, cred.Password)))
+		authorization, err := c.authorizationHeader(cred)
+		if err != nil {
+			wrappedErr := fmt.Errorf("failed to authorize request: %w", err)
+			c.logger.Error(wrappedErr.Error())
+			sendErrorLogCallback(wrappedErr.Error(), nil)
+			return nil, wrappedErr
+		}
 		req, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
 			wrappedErr := fmt.Errorf("Failed to create new request: %w", err)
@@ -129,9 +266,9 @@ func (c *Client) getRequestCallback(url string, sendErrorLogCallback func(payloa
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", token))
+		req.Header.Set("Authorization", authorization)
 
-		response, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+		response, err := c.httpClient.Do(req)
 		if err != nil {
 			wrappedErr := fmt.Errorf("failed to execute request: %w", err)
 			c.logger.Error(wrappedErr.Error())
@@ -143,182 +280,136 @@ func (c *Client) getRequestCallback(url string, sendErrorLogCallback func(payloa
 }
 
 func (c *Client) GetWorkspaces(sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudWorkspace, error) {
-	workspaces := []BBktCloudWorkspace{}
+	return collectPages(c.GetWorkspacesSeq(sendErrorLogCallback))
+}
+
+// GetWorkspacesSeq streams the workspaces the tokens can access.
+func (c *Client) GetWorkspacesSeq(sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudWorkspace, error] {
 	pageLen := 50
 
 	url := fmt.Sprintf("%s/workspaces?pagelen=%d", c.baseURL, pageLen)
-
-	for len(url) > 0 {
-		response, err := c.HandleRequestWithRetries(c.getRequestCallback(url, sendErrorLogCallback))
-		if err != nil {
-			logMessage := fmt.Sprintf("Failed to get workspaces: %s", err.Error())
-			c.logger.Error(logMessage)
-			return nil, fmt.Errorf("failed to get workspaces: %w", err)
-		}
-		defer response.Body.Close()
-
-		var workspaceResponse BBktCloudPaginatedResponse[BBktCloudWorkspace]
-		if err := json.NewDecoder(response.Body).Decode(&workspaceResponse); err != nil {
-			logMessage := fmt.Sprintf("Failed to decode workspaces response: %s", err.Error())
-			c.logger.Error(logMessage)
-			return workspaces, fmt.Errorf("failed to decode workspaces response: %w", err)
-		}
-
-		workspaces = append(workspaces, workspaceResponse.Values...)
-
-		url = workspaceResponse.Next
-		if url == "" {
-			break
-		}
-	}
-
-	return workspaces, nil
+	return Paginate(c, url, "workspaces", sendErrorLogCallback, PaginationOptions[BBktCloudWorkspace]{})
 }
 
 func (c *Client) GetRepositoriesByWorkspace(workspace string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudRepository, error) {
-	repositories := []BBktCloudRepository{}
+	return collectPages(c.GetRepositoriesByWorkspaceSeq(workspace, sendErrorLogCallback))
+}
+
+// GetRepositoriesByWorkspaceSeq streams the repositories of a workspace.
+func (c *Client) GetRepositoriesByWorkspaceSeq(workspace string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudRepository, error] {
 	pageLen := 100
 
 	url := fmt.Sprintf("%s/repositories/%s?pagelen=%d", c.baseURL, workspace, pageLen)
-
-	for len(url) > 0 {
-		response, err := c.HandleRequestWithRetries(c.getRequestCallback(url, sendErrorLogCallback))
-		if err != nil {
-			logMessage := fmt.Sprintf("Failed to get repositories for workspace url: %s: %s", url, err.Error())
-			c.logger.Error(logMessage)
-			return nil, fmt.Errorf("failed to get repositories for workspace url: %s: %w", url, err)
-		}
-		defer response.Body.Close()
-
-		var repoResponse BBktCloudPaginatedResponse[BBktCloudRepository]
-		if err := json.NewDecoder(response.Body).Decode(&repoResponse); err != nil {
-			logMessage := fmt.Sprintf("Failed to decode repositories response for workspace url: %s: %s", url, err.Error())
-			c.logger.Error(logMessage)
-			return repositories, fmt.Errorf("failed to decode repositories response for workspace url: %s: %w", url, err)
-		}
-
-		repositories = append(repositories, repoResponse.Values...)
-
-		url = repoResponse.Next
-		if url == "" {
-			break
-		}
-	}
-
-	return repositories, nil
+	return Paginate(c, url, "repositories", sendErrorLogCallback, PaginationOptions[BBktCloudRepository]{})
 }
 
 func (c *Client) GetPullRequestsByRepository(workspace, repository string, lastSuccessfulSyncTime time.Time, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudPullRequest, error) {
-	pullRequests := []BBktCloudPullRequest{}
+	return collectPages(c.GetPullRequestsByRepositorySeq(workspace, repository, lastSuccessfulSyncTime, sendErrorLogCallback))
+}
+
+// GetPullRequestsByRepositorySeq streams the pull requests of a repository updated after lastSuccessfulSyncTime, so
+// the pull request a sync cursor was advanced to is not fetched again.
+func (c *Client) GetPullRequestsByRepositorySeq(workspace, repository string, lastSuccessfulSyncTime time.Time, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudPullRequest, error] {
 	pageLen := 50
 
+	// the query has a precision of a second, the pull requests it returns are filtered with the precision of updated_on.
+	// They are sorted by updated_on, so a pull request updated while paging moves to the last page instead of shifting
+	// the pages and being skipped
 	lastSuccessfulSyncTimeUTCString := lastSuccessfulSyncTime.UTC().Format(time.RFC3339)
 	urlQueryParams := url.Values{}
 	urlQueryParams.Add("q", fmt.Sprintf("state IN (\"OPEN\", \"MERGED\", \"DECLINED\", \"SUPERSEDED\") AND updated_on >= %s", lastSuccessfulSyncTimeUTCString))
+	urlQueryParams.Add("sort", "updated_on")
 	urlQueryParams.Add("pagelen", fmt.Sprintf("%d", pageLen))
 	url := fmt.Sprintf("%s/repositories/%s/%s/pullrequests?%s", c.baseURL, workspace, repository, urlQueryParams.Encode())
-
-	for len(url) > 0 {
-		response, err := c.HandleRequestWithRetries(c.getRequestCallback(url, sendErrorLogCallback))
-		if err != nil {
-			logMessage := fmt.Sprintf("Failed to get pull requests for repository url: %s: %s", url, err.Error())
-			c.logger.Error(logMessage)
-			return nil, fmt.Errorf("failed to get pull requests for repository url: %s: %w", url, err)
-		}
-		defer response.Body.Close()
-		var prResponse BBktCloudPaginatedResponse[BBktCloudPullRequest]
-		if err := json.NewDecoder(response.Body).Decode(&prResponse); err != nil {
-			logMessage := fmt.Sprintf("Failed to decode pull requests response for repository url: %s: %s", url, err.Error())
-			c.logger.Error(logMessage)
-			return pullRequests, fmt.Errorf("failed to decode pull requests response for repository url: %s: %w", url, err)
-		}
-
-		pullRequests = append(pullRequests, prResponse.Values...)
-
-		url = prResponse.Next
-		if url == "" {
-			break
+	pullRequests := Paginate(c, url, "pull requests", sendErrorLogCallback, PaginationOptions[BBktCloudPullRequest]{})
+	return func(yield func(BBktCloudPullRequest, error) bool) {
+		for pullRequest, err := range pullRequests {
+			if err == nil && !pullRequest.UpdatedOn.After(lastSuccessfulSyncTime) {
+				continue
+			}
+			if !yield(pullRequest, err) {
+				return
+			}
 		}
 	}
-
-	return pullRequests, nil
 }
 
 func (c *Client) GetPullRequestCommits(workspace, repository string, pullRequestID int, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudCommit, error) {
-	commits := []BBktCloudCommit{}
+	return collectPages(c.GetPullRequestCommitsSeq(workspace, repository, pullRequestID, sendErrorLogCallback))
+}
+
+// GetPullRequestCommitsSeq streams the commits of a pull request.
+func (c *Client) GetPullRequestCommitsSeq(workspace, repository string, pullRequestID int, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudCommit, error] {
 	pageLen := 100
 
 	url := fmt.Sprintf("%s/repositories/%s/%s/pullrequests/%d/commits?pagelen=%d", c.baseURL, workspace, repository, pullRequestID, pageLen)
+	return Paginate(c, url, "pull request commits", sendErrorLogCallback, PaginationOptions[BBktCloudCommit]{})
+}
 
-	for len(url) > 0 {
-		response, err := c.HandleRequestWithRetries(c.getRequestCallback(url, sendErrorLogCallback))
-		if err != nil {
-			return nil, fmt.Errorf("failed to get pull request commits for repository url: %s: %w", url, err)
-		}
-
-		defer response.Body.Close()
-
-		var commitResponse BBktCloudPaginatedResponse[BBktCloudCommit]
-		if err := json.NewDecoder(response.Body).Decode(&commitResponse); err != nil {
-			return commits, fmt.Errorf("failed to decode commits response for repository url: %s: %w", url, err)
-		}
-
-		commits = append(commits, commitResponse.Values...)
-
-		url = commitResponse.Next
-		if url == "" {
-			break
-		}
-	}
-
-	return commits, nil
+func (c *Client) GetBranchesByRepository(workspace, repository string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudRef, error) {
+	return collectPages(c.GetBranchesByRepositorySeq(workspace, repository, sendErrorLogCallback))
 }
 
-func (c *Client) GetCommitsByRepository(workspace, repository string, lastSuccessfulSyncTime time.Time, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudCommit, error) {
-	commits := []BBktCloudCommit{}
+// GetBranchesByRepositorySeq streams the branches of a repository.
+func (c *Client) GetBranchesByRepositorySeq(workspace, repository string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudRef, error] {
 	pageLen := 100
 
-	url := fmt.Sprintf("%s/repositories/%s/%s/commits?pagelen=%d", c.baseURL, workspace, repository, pageLen)
+	url := fmt.Sprintf("%s/repositories/%s/%s/refs/branches?pagelen=%d", c.baseURL, workspace, repository, pageLen)
+	return Paginate(c, url, "branches", sendErrorLogCallback, PaginationOptions[BBktCloudRef]{})
+}
 
-	for len(url) > 0 {
-		response, err := c.HandleRequestWithRetries(c.getRequestCallback(url, sendErrorLogCallback))
-		if err != nil {
-			return nil, fmt.Errorf("failed to get commits for repository url: %s: %w", url, err)
-		}
+// GetCommitsByBranch returns the commits reachable from include but not from any of exclude, newest first.
+// include and exclude accept branch names and commit hashes. A non zero since drops older commits and stops paging
+// at the first page without a newer commit, it bounds the walk of a branch that has no cursor yet.
+func (c *Client) GetCommitsByBranch(workspace, repository, include string, exclude []string, since time.Time, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) ([]BBktCloudCommit, error) {
+	return collectPages(c.GetCommitsByBranchSeq(workspace, repository, include, exclude, since, sendErrorLogCallback))
+}
 
-		defer response.Body.Close()
+// GetCommitsByBranchSeq streams the commits GetCommitsByBranch returns.
+func (c *Client) GetCommitsByBranchSeq(workspace, repository, include string, exclude []string, since time.Time, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) iter.Seq2[BBktCloudCommit, error] {
+	pageLen := 100
 
-		var commitResponse BBktCloudPaginatedResponse[BBktCloudCommit]
-		if err := json.NewDecoder(response.Body).Decode(&commitResponse); err != nil {
-			return commits, fmt.Errorf("failed to decode commits response for repository url: %s: %w", url, err)
-		}
+	urlQueryParams := url.Values{}
+	urlQueryParams.Add("include", include)
+	for _, excluded := range exclude {
+		urlQueryParams.Add("exclude", excluded)
+	}
+	urlQueryParams.Add("pagelen", fmt.Sprintf("%d", pageLen))
+	url := fmt.Sprintf("%s/repositories/%s/%s/commits?%s", c.baseURL, workspace, repository, urlQueryParams.Encode())
 
-		filteredCommits := []BBktCloudCommit{}
-		for _, commit := range commitResponse.Values {
-			if commit.Date.After(lastSuccessfulSyncTime) {
-				filteredCommits = append(filteredCommits, commit)
+	isNewer := func(commit BBktCloudCommit) bool {
+		return since.IsZero() || commit.Date.After(since)
+	}
+	commits := Paginate(c, url, "commits", sendErrorLogCallback, PaginationOptions[BBktCloudCommit]{
+		StopAfterPage: func(page BBktCloudPaginatedResponse[BBktCloudCommit]) bool {
+			return !slices.ContainsFunc(page.Values, isNewer)
+		},
+	})
+	return func(yield func(BBktCloudCommit, error) bool) {
+		for commit, err := range commits {
+			if err == nil && !isNewer(commit) {
+				continue
+			}
+			if !yield(commit, err) {
+				return
 			}
-		}
-		commits = append(commits, filteredCommits...)
-
-		if len(filteredCommits) < pageLen {
-			break
-		}
-
-		url = commitResponse.Next
-		if url == "" {
-			break
 		}
 	}
-
-	return commits, nil
 }
 
 var client = di.NewThreadSafeSingleton(func() *Client {
 	customLogger := shared.AcquireCustomLogger()
 	stateManager := statemanager.AcquireStateManager()
 	credentials := credservice.AcquireCredentials()
-	return NewClient(http.DefaultClient, stateManager, customLogger, credentials)
+	client := NewClient(httptransport.AcquireHTTPClient(), stateManager, customLogger, credentials)
+	bitbucketCloudConfig := config.AcquireConfig().Integrations.BitbucketCloud
+	if bitbucketCloudConfig.BaseURL != "" {
+		client.SetBaseURL(bitbucketCloudConfig.BaseURL)
+	}
+	if bitbucketCloudConfig.OAuthTokenURL != "" {
+		client.SetOAuthTokenURL(bitbucketCloudConfig.OAuthTokenURL)
+	}
+	return client
 })
 
 func AcquireClient() *Client {
@@ -7,8 +7,10 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/bluelock-go/shared"
 	"github.com/bluelock-go/shared/auth"
@@ -39,10 +41,10 @@ func TestHandleRequestWithRetriesWith200StatusCode(t *testing.T) {
 
 	// Create a new client
 	credentials := []auth.Credential{
-		{CredKey: "test-token1"},
-		{CredKey: "test-token2"},
-		{CredKey: "test-token3"},
-		{CredKey: "test-token4"},
+		{TokenID: "test-token1"},
+		{TokenID: "test-token2"},
+		{TokenID: "test-token3"},
+		{TokenID: "test-token4"},
 	}
 	client := NewClient(nil, sm,
 		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}, credentials,
@@ -85,10 +87,10 @@ func TestHandleRequestWithRetriesWithOther2xxStatusCode(t *testing.T) {
 
 	// Create a new client
 	credentials := []auth.Credential{
-		{CredKey: "test-token1"},
-		{CredKey: "test-token2"},
-		{CredKey: "test-token3"},
-		{CredKey: "test-token4"},
+		{TokenID: "test-token1"},
+		{TokenID: "test-token2"},
+		{TokenID: "test-token3"},
+		{TokenID: "test-token4"},
 	}
 	client := NewClient(nil, sm,
 		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}, credentials,
@@ -133,10 +135,10 @@ func TestHandleRequestWithRetriesWith401StatusCode(t *testing.T) {
 
 	// Create a new client
 	credentials := []auth.Credential{
-		{CredKey: "test-token1"},
-		{CredKey: "test-token2"},
-		{CredKey: "test-token3"},
-		{CredKey: "test-token4"},
+		{TokenID: "test-token1"},
+		{TokenID: "test-token2"},
+		{TokenID: "test-token3"},
+		{TokenID: "test-token4"},
 	}
 	client := NewClient(
 		nil, sm,
@@ -189,10 +191,10 @@ func TestHandleRequestWithRetriesWith429StatusCode(t *testing.T) {
 
 	// Create a new client
 	credentials := []auth.Credential{
-		{CredKey: "test-token1"},
-		{CredKey: "test-token2"},
-		{CredKey: "test-token3"},
-		{CredKey: "test-token4"},
+		{TokenID: "test-token1"},
+		{TokenID: "test-token2"},
+		{TokenID: "test-token3"},
+		{TokenID: "test-token4"},
 	}
 	client := NewClient(
 		nil, sm,
@@ -237,7 +239,7 @@ func TestHandleRequestWithRetriesWithOther4xxStatusCode(t *testing.T) {
 
 	// Create a new client
 	credentials := []auth.Credential{
-		{CredKey: "test-token1"},
+		{TokenID: "test-token1"},
 	}
 	client := NewClient(
 		nil, sm,
@@ -262,3 +264,164 @@ func TestHandleRequestWithRetriesWithOther4xxStatusCode(t *testing.T) {
 		assert.Contains(t, err.Error(), fmt.Sprintf("unhandled response code: %d for token:", 404))
 	}
 }
+
+func TestReloadCredentials(t *testing.T) {
+	filePath := "test_state.json"
+	defer os.Remove(filePath)
+
+	sm, err := statemanager.NewStateManager(filePath)
+	if err != nil {
+		t.Errorf("Failed to create StateManager: %v", err)
+	}
+	client := NewClient(nil, sm,
+		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}, []auth.Credential{{TokenID: "test-token1"}},
+	)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(client.Credentials()))
+
+	// revoke test-token1 and add test-token2
+	assert.NoError(t, client.ReloadCredentials([]auth.Credential{{TokenID: "test-token2"}}))
+	assert.Equal(t, []auth.Credential{{TokenID: "test-token2"}}, client.Credentials())
+	assert.NotContains(t, sm.State.TokenStates, "test-token1")
+	assert.Contains(t, sm.State.TokenStates, "test-token2")
+
+	var usedTokenID string
+	response, err := client.HandleRequestWithRetries(func(cred *auth.Credential) (*http.Response, error) {
+		usedTokenID = cred.TokenID
+		return &http.Response{StatusCode: 200}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "test-token2", usedTokenID)
+
+	assert.Error(t, client.ReloadCredentials([]auth.Credential{{}}), "credentials without token ID are rejected")
+	assert.Equal(t, []auth.Credential{{TokenID: "test-token2"}}, client.Credentials(), "the current credentials stay in use")
+}
+
+func TestHandleRequestWithRetriesRecordsRateLimitHeaders(t *testing.T) {
+	filePath := "test_state.json"
+	defer os.Remove(filePath)
+
+	sm, err := statemanager.NewStateManager(filePath)
+	if err != nil {
+		t.Errorf("Failed to create StateManager: %v", err)
+	}
+	client := NewClient(nil, sm,
+		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}, []auth.Credential{{TokenID: "test-token1"}, {TokenID: "test-token2"}},
+	)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(client.Credentials()))
+	sm.SetTokenSelectionStrategy(statemanager.MostRemainingQuotaStrategy{})
+
+	remainingByToken := map[string]string{"test-token1": "120", "test-token2": "900"}
+	var usedTokenIDs []string
+	for range 3 {
+		_, err := client.HandleRequestWithRetries(func(cred *auth.Credential) (*http.Response, error) {
+			usedTokenIDs = append(usedTokenIDs, cred.TokenID)
+			header := http.Header{}
+			header.Set("X-RateLimit-Remaining", remainingByToken[cred.TokenID])
+			header.Set("X-RateLimit-Limit", "1000")
+			return &http.Response{StatusCode: 200, Header: header}, nil
+		})
+		assert.NoError(t, err)
+	}
+
+	// both tokens are tried while their quota is unknown, then the one with more requests left is used
+	assert.Equal(t, []string{"test-token1", "test-token2", "test-token2"}, usedTokenIDs)
+	tokenState := sm.State.TokenStates["test-token1"]
+	remaining, known := tokenState.RemainingQuota()
+	assert.True(t, known)
+	assert.Equal(t, 120, remaining)
+	assert.Equal(t, 1000, sm.State.TokenStates["test-token2"].RateLimitLimit)
+}
+
+func TestHandleRequestWithRetriesAccountsUsage(t *testing.T) {
+	filePath := "test_state.json"
+	defer os.Remove(filePath)
+
+	sm, err := statemanager.NewStateManager(filePath)
+	if err != nil {
+		t.Errorf("Failed to create StateManager: %v", err)
+	}
+	client := NewClient(nil, sm,
+		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}, []auth.Credential{{TokenID: "test-token1"}, {TokenID: "test-token2"}},
+	)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(client.Credentials()))
+
+	statusCodes := map[string]int{"test-token1": 429, "test-token2": 200}
+	response, err := client.HandleRequestWithRetries(func(cred *auth.Credential) (*http.Response, error) {
+		return &http.Response{StatusCode: statusCodes[cred.TokenID], Body: io.NopCloser(bytes.NewReader([]byte(`{"values": []}`)))}, nil
+	})
+	assert.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"values": []}`, string(body), "the accounted body is still returned")
+
+	_, err = client.HandleRequestWithRetries(func(cred *auth.Credential) (*http.Response, error) {
+		return nil, errors.New("connection reset")
+	})
+	assert.Error(t, err)
+
+	rateLimitedToken := sm.State.TokenStates["test-token1"]
+	assert.Equal(t, token.UsageCounts{RateLimitedCount: 1, Bytes: 14}, rateLimitedToken.Usage.Total)
+	usedToken := sm.State.TokenStates["test-token2"]
+	assert.Equal(t, token.UsageCounts{SuccessCount: 1, FailureCount: 1, Bytes: 14}, usedToken.Usage.Total)
+	assert.Equal(t, 1, usedToken.SuccessfulUsageCount)
+	assert.Len(t, usedToken.Usage.HourlyWindows, 1)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestClientSendsRequestsWithItsHTTPClient(t *testing.T) {
+	filePath := "test_state.json"
+	defer os.Remove(filePath)
+
+	sm, err := statemanager.NewStateManager(filePath)
+	if err != nil {
+		t.Errorf("Failed to create StateManager: %v", err)
+	}
+	var requestedURLs []string
+	httpClient := &http.Client{Transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		requestedURLs = append(requestedURLs, request.URL.String())
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader([]byte(`{"values": [{"slug": "acme"}]}`)))}, nil
+	})}
+	client := NewClient(httpClient, sm,
+		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, []auth.Credential{{TokenID: "test-token1"}},
+	)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(client.Credentials()))
+
+	workspaces, err := client.GetWorkspaces(func(payload interface{}, queryParams url.Values) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, []BBktCloudWorkspace{{Slug: "acme"}}, workspaces)
+	assert.Equal(t, []string{"https://api.bitbucket.org/2.0/workspaces?pagelen=50"}, requestedURLs)
+}
+
+func TestGetPullRequestsByRepositorySortsByUpdatedOn(t *testing.T) {
+	filePath := "test_state.json"
+	defer os.Remove(filePath)
+
+	sm, err := statemanager.NewStateManager(filePath)
+	if err != nil {
+		t.Errorf("Failed to create StateManager: %v", err)
+	}
+	var requestedQueries []url.Values
+	httpClient := &http.Client{Transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		requestedQueries = append(requestedQueries, request.URL.Query())
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader([]byte(`{"values": []}`)))}, nil
+	})}
+	client := NewClient(httpClient, sm,
+		&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, []auth.Credential{{TokenID: "test-token1"}},
+	)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(client.Credentials()))
+
+	lastSuccessfulSyncTime := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	_, err = client.GetPullRequestsByRepository("acme", "api", lastSuccessfulSyncTime, func(payload interface{}, queryParams url.Values) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, []url.Values{{
+		"q":       {`state IN ("OPEN", "MERGED", "DECLINED", "SUPERSEDED") AND updated_on >= 2025-03-01T12:30:00Z`},
+		"sort":    {"updated_on"},
+		"pagelen": {"50"},
+	}}, requestedQueries, "pages are sorted by updated_on so the pull requests updated while paging are not skipped")
+}
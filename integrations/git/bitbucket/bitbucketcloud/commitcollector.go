@@ -0,0 +1,141 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/bluelock-go/shared/customerrors"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
+)
+
+// relayCommits walks every branch of the repository from its head down to the head recorded by the branch cursor and
+// adds the commits to the batch. Branches other than the main branch also exclude the main branch, so shared history
+// is fetched once. Commits that show up on several branches or were relayed by a previous sync are dropped.
+// It returns the branches whose commit cursor may advance once the batch is flushed. Failing branches are reported in
+// fetchErr while the other branches are still walked, err reports the batch or the database failing.
+func (bcSvc *BitbucketCloudSvc) relayCommits(repoSyncAudit dbgen.RepositorySyncAudit, cursors repoSyncCursors, batch *activityBatch) (walkedBranches []BBktCloudRef, fetchErr error, err error) {
+	branches, err := bcSvc.apiClient.GetBranchesByRepository(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, bcSvc.dataRelayer.SendPullError)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branches for repository: %s: %w", repoSyncAudit.RepoSlug, err), nil
+	}
+
+	branchNames := set.NewWithCapacity[string](len(branches))
+	for _, branch := range branches {
+		branchNames.Add(branch.Name)
+	}
+	for branchName := range cursors.commitCursors {
+		if branchNames.Contains(branchName) {
+			continue
+		}
+		bcSvc.logger.Debug("Branch was deleted. Dropping its commit sync cursor", "repo", repoSyncAudit.RepoSlug, "branch", branchName)
+		if err := bcSvc.deleteCommitSyncCursor(repoSyncAudit, branchName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var branchErrs []error
+	for _, branch := range branches {
+		cursor, hasCursor := cursors.commitCursors[branch.Name]
+		if hasCursor && cursor.LastCommitHash == branch.Target.Hash {
+			continue
+		}
+
+		branchFetchErr, err := bcSvc.relayBranchCommits(repoSyncAudit, branch, cursors.commitsSince, cursor, hasCursor, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		if branchFetchErr != nil {
+			wrappedErr := fmt.Errorf("error fetching commits of branch: %s: %w", branch.Name, branchFetchErr)
+			if errors.Is(branchFetchErr, customerrors.ErrCritical) {
+				return nil, nil, wrappedErr
+			}
+			bcSvc.logger.Error(wrappedErr.Error())
+			branchErrs = append(branchErrs, wrappedErr)
+			continue
+		}
+		walkedBranches = append(walkedBranches, branch)
+	}
+
+	if len(branchErrs) > 0 {
+		fetchErr = fmt.Errorf("error fetching commits for repository: %s: %w", repoSyncAudit.RepoSlug, errors.Join(branchErrs...))
+	}
+	return walkedBranches, fetchErr, nil
+}
+
+// relayBranchCommits adds the commits of the branch that were neither relayed nor added yet to the batch.
+func (bcSvc *BitbucketCloudSvc) relayBranchCommits(repoSyncAudit dbgen.RepositorySyncAudit, branch BBktCloudRef, commitsSince time.Time, cursor dbgen.CommitSyncCursor, hasCursor bool, batch *activityBatch) (fetchErr error, err error) {
+	for commit, fetchErr := range bcSvc.branchCommitsSeq(repoSyncAudit, branch, commitsSince, cursor, hasCursor) {
+		if fetchErr != nil {
+			return fetchErr, nil
+		}
+		if batch.hasCommit(commit.Hash) {
+			continue
+		}
+		relayed, err := bcSvc.isCommitRelayed(repoSyncAudit, commit.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if relayed {
+			continue
+		}
+		if err := batch.addCommit(commit); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// branchCommitsSeq streams the commits of the branch since its cursor.
+func (bcSvc *BitbucketCloudSvc) branchCommitsSeq(repoSyncAudit dbgen.RepositorySyncAudit, branch BBktCloudRef, commitsSince time.Time, cursor dbgen.CommitSyncCursor, hasCursor bool) iter.Seq2[BBktCloudCommit, error] {
+	var exclude []string
+	if repoSyncAudit.MainBranch != "" && branch.Name != repoSyncAudit.MainBranch {
+		exclude = append(exclude, repoSyncAudit.MainBranch)
+	}
+	// the head is pinned so the cursor matches exactly what was fetched even if the branch moves meanwhile
+	include := branch.Target.Hash
+	if !hasCursor {
+		return bcSvc.apiClient.GetCommitsByBranchSeq(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, include, exclude, commitsSince, bcSvc.dataRelayer.SendPullError)
+	}
+
+	sinceCursor := bcSvc.apiClient.GetCommitsByBranchSeq(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, include, append(slices.Clone(exclude), cursor.LastCommitHash), time.Time{}, bcSvc.dataRelayer.SendPullError)
+	return func(yield func(BBktCloudCommit, error) bool) {
+		fetched := false
+		for commit, err := range sinceCursor {
+			if err != nil && !fetched && !errors.Is(err, customerrors.ErrCritical) {
+				// the previous head is gone when the branch was force pushed, fall back to its date
+				bcSvc.logger.Warn("Could not fetch commits since the last seen head of the branch, falling back to its date",
+					"repo", repoSyncAudit.RepoSlug, "branch", branch.Name, "lastSeenHash", cursor.LastCommitHash, "error", err)
+				for commit, err := range bcSvc.apiClient.GetCommitsByBranchSeq(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, include, exclude, cursor.LastCommitDate, bcSvc.dataRelayer.SendPullError) {
+					if !yield(commit, err) {
+						return
+					}
+				}
+				return
+			}
+			if !yield(commit, err) {
+				return
+			}
+			fetched = true
+		}
+	}
+}
+
+func (bcSvc *BitbucketCloudSvc) isCommitRelayed(repoSyncAudit dbgen.RepositorySyncAudit, hash string) (bool, error) {
+	_, err := bcSvc.dbQuerier.GetRelayedCommit(context.Background(), dbgen.GetRelayedCommitParams{
+		Provider: repoSyncAudit.Provider,
+		RepoUuid: repoSyncAudit.RepoUuid,
+		Hash:     hash,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error getting relayed commit: %w", err)
+	}
+	return true, nil
+}
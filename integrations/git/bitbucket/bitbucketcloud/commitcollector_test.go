@@ -0,0 +1,93 @@
+package bitbucketcloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/relay"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectCommitsWalksBranchesOnce(t *testing.T) {
+	now := time.Now().UTC()
+	commit := func(hash string) BBktCloudCommit {
+		return BBktCloudCommit{Hash: hash, Date: now.Add(-time.Hour)}
+	}
+	branches := []BBktCloudRef{{Name: "main", Target: commit("m2")}, {Name: "feature", Target: commit("f1")}}
+	// commit listings keyed by include and exclude query parameters
+	listings := map[string][]BBktCloudCommit{
+		"m2|":     {commit("m2"), commit("m1")},
+		"f1|main": {commit("f1"), commit("m2")},
+		"m3|m2":   {commit("m3"), commit("f1")},
+	}
+	var requestedListings []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/refs/branches"):
+			json.NewEncoder(w).Encode(BBktCloudPaginatedResponse[BBktCloudRef]{Values: branches})
+		case strings.HasSuffix(r.URL.Path, "/commits"):
+			key := r.URL.Query().Get("include") + "|" + strings.Join(r.URL.Query()["exclude"], ",")
+			requestedListings = append(requestedListings, key)
+			json.NewEncoder(w).Encode(BBktCloudPaginatedResponse[BBktCloudCommit]{Values: listings[key]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	require.NoError(t, sm.ReplaceTokenState("token", token.TokenState{Status: token.TokenActive}))
+	bcSvc.apiClient = NewClient(nil, sm, bcSvc.logger, []auth.Credential{{TokenID: "token"}})
+	bcSvc.apiClient.baseURL = server.URL
+	bcSvc.dataRelayer, err = relay.NewDryRunRelayService(t.TempDir(), "org", config.BitbucketCloudKey)
+	require.NoError(t, err)
+
+	require.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "api", ID: "{uuid-1}", MainBranch: BBktCloudBranch{Name: "main"}}))
+	repoSyncAudit, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	require.NoError(t, err)
+
+	dryRunRelayer := bcSvc.dataRelayer.(*relay.DryRunRelayService)
+	relayCommits := func() []BBktCloudRef {
+		cursors, err := bcSvc.loadRepoSyncCursors(repoSyncAudit)
+		require.NoError(t, err)
+		batch := bcSvc.newActivityBatch(repoSyncAudit)
+		batch.limit = 2
+		walkedBranches, fetchErr, err := bcSvc.relayCommits(repoSyncAudit, cursors, batch)
+		require.NoError(t, err)
+		require.NoError(t, fetchErr)
+		require.NoError(t, batch.flush())
+		for _, branch := range walkedBranches {
+			require.NoError(t, bcSvc.advanceCommitSyncCursor(repoSyncAudit, branch))
+		}
+		return walkedBranches
+	}
+
+	relayCommits()
+	assert.Equal(t, relay.DryRunSummary{DataRequests: 2, Repos: 1, Commits: 3}, dryRunRelayer.Summary(), "shared commits are relayed once, in batches")
+	for _, hash := range []string{"m2", "m1", "f1"} {
+		relayed, err := bcSvc.isCommitRelayed(repoSyncAudit, hash)
+		require.NoError(t, err)
+		assert.True(t, relayed, hash)
+	}
+
+	branches[0].Target = commit("m3")
+	requestedListings = nil
+	walkedBranches := relayCommits()
+	assert.Equal(t, 4, dryRunRelayer.Summary().Commits, "already relayed commits are dropped")
+	assert.Equal(t, []string{"m3|m2"}, requestedListings, "unchanged branches are not fetched again")
+	assert.Len(t, walkedBranches, 1)
+}
@@ -10,13 +10,14 @@ import (
 
 	"github.com/bluelock-go/config"
 	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/integrations/git/identity"
 	"github.com/bluelock-go/integrations/relay"
 	"github.com/bluelock-go/shared"
 	"github.com/bluelock-go/shared/auth"
-	"github.com/bluelock-go/shared/auth/credservice"
 	"github.com/bluelock-go/shared/customerrors"
 	"github.com/bluelock-go/shared/database/dbsetup"
 	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
 	"github.com/bluelock-go/shared/di"
 	"github.com/bluelock-go/shared/storage/state/statemanager"
 )
@@ -24,18 +25,21 @@ import (
 type BitbucketCloudSvc struct {
 	logger       *shared.CustomLogger
 	stateManager *statemanager.StateManager
-	credentials  []auth.Credential
 	config       *config.Config
 	apiClient    *Client
 	dbQuerier    dbgen.Querier
+	runInTx      dbsetup.TxRunner
 	dataRelayer  relay.DataRelayer
+	identities   *identity.Resolver
 }
 
-func NewBitbucketCloudSvc(logger *shared.CustomLogger, stateManager *statemanager.StateManager, credentials []auth.Credential, config *config.Config, dbQuerier dbgen.Querier, client *Client, dataRelayer relay.DataRelayer) *BitbucketCloudSvc {
-	return &BitbucketCloudSvc{logger, stateManager, credentials, config,
+func NewBitbucketCloudSvc(logger *shared.CustomLogger, stateManager *statemanager.StateManager, config *config.Config, dbQuerier dbgen.Querier, runInTx dbsetup.TxRunner, client *Client, dataRelayer relay.DataRelayer, identities *identity.Resolver) *BitbucketCloudSvc {
+	return &BitbucketCloudSvc{logger, stateManager, config,
 		client,
 		dbQuerier,
+		runInTx,
 		dataRelayer,
+		identities,
 	}
 }
 
@@ -49,7 +53,17 @@ func (bcSvc *BitbucketCloudSvc) GetStateManager() *statemanager.StateManager {
 	return bcSvc.stateManager
 }
 func (bcSvc *BitbucketCloudSvc) GetCredentials() []auth.Credential {
-	return bcSvc.credentials
+	return bcSvc.apiClient.Credentials()
+}
+func (bcSvc *BitbucketCloudSvc) ReloadCredentials(credentials []auth.Credential) error {
+	return bcSvc.apiClient.ReloadCredentials(credentials)
+}
+func (bcSvc *BitbucketCloudSvc) WatchTokenHealth(ctx context.Context) {
+	if bcSvc.config.TokenHealth.Disabled {
+		bcSvc.logger.Info("Token health probing is disabled")
+		return
+	}
+	NewTokenHealthChecker(bcSvc.logger, bcSvc.stateManager, bcSvc.apiClient, bcSvc.dataRelayer, bcSvc.config.TokenHealth).Run(ctx)
 }
 func (bcSvc *BitbucketCloudSvc) GetQuerier() dbgen.Querier {
 	return bcSvc.dbQuerier
@@ -62,12 +76,21 @@ func (bcSvc *BitbucketCloudSvc) ValidateEnvVariables() error {
 	if BitbucketCloudConfig.Workspace == "" {
 		return fmt.Errorf("bitbucket Cloud workspace is not set in the configuration")
 	}
+	if _, err := newRepoSelector(BitbucketCloudConfig); err != nil {
+		return fmt.Errorf("bitbucket Cloud repository filter is invalid: %w", err)
+	}
 
 	return nil
 }
 
+// jobCompletionPause is waited at the end of every job. Tests running whole jobs set it to 0.
+var jobCompletionPause = 5 * time.Second
+
 func (bcSvc *BitbucketCloudSvc) RunJob() error {
-	bcSvc.logger.Info("Bitbucket Cloud job started...")
+	runID := relay.NewRunID()
+	bcSvc.dataRelayer.StartRun(runID)
+	defer bcSvc.dataRelayer.EndRun()
+	bcSvc.logger.Info("Bitbucket Cloud job started...", "runID", runID)
 
 	if err := bcSvc.RepoPull(); err != nil {
 		wrappedErr := fmt.Errorf("error pulling repositories from Bitbucket Cloud: %w", err)
@@ -85,7 +108,7 @@ func (bcSvc *BitbucketCloudSvc) RunJob() error {
 		}
 	}
 
-	time.Sleep(time.Second * 5)
+	time.Sleep(jobCompletionPause)
 	bcSvc.logger.Info("Bitbucket Cloud job completed.")
 	return nil
 }
@@ -93,6 +116,20 @@ func (bcSvc *BitbucketCloudSvc) RunJob() error {
 func (bcSvc *BitbucketCloudSvc) RepoPull() *gitdtos.BLRootErrorPayload {
 	rootErrorPayload := &gitdtos.BLRootErrorPayload{}
 	bcSvc.logger.Info("Pulling repositories from Bitbucket Cloud...")
+	selector, err := newRepoSelector(bcSvc.config.Integrations.BitbucketCloud)
+	if err != nil {
+		wrappedErr := fmt.Errorf("invalid repository filter configuration: %w: %w", err, customerrors.ErrCritical)
+		bcSvc.logger.Error(wrappedErr.Error())
+		rootErrorPayload.CriticalErrors = append(rootErrorPayload.CriticalErrors, wrappedErr)
+		return rootErrorPayload
+	}
+	if err := bcSvc.deactivateReposOfDisallowedWorkspaces(selector); err != nil {
+		wrappedErr := fmt.Errorf("error deactivating repositories of workspaces that are no longer allowed: %w", err)
+		bcSvc.logger.Error(wrappedErr.Error())
+		rootErrorPayload.CriticalErrors = append(rootErrorPayload.CriticalErrors, wrappedErr)
+		return rootErrorPayload
+	}
+
 	workspaces, err := bcSvc.apiClient.GetWorkspaces(bcSvc.dataRelayer.SendPullError)
 	if err != nil {
 		wrappedErr := fmt.Errorf("error pulling workspaces from Bitbucket Cloud: %w", err)
@@ -110,21 +147,20 @@ func (bcSvc *BitbucketCloudSvc) RepoPull() *gitdtos.BLRootErrorPayload {
 	}
 	bcSvc.logger.Info("Found workspaces", "count", len(workspaces))
 
-	// var expectedWorkspace *BBktCloudWorkspace = nil
-	// for _, workspace := range workspaces {
-	// 	if bcSvc.config.Integrations.BitbucketCloud.Workspace == workspace.Slug {
-	// 		expectedWorkspace = &workspace
-	// 	}
-	// }
-	// if expectedWorkspace == nil {
-	// 	wrappedErr := fmt.Errorf("unable to fetch %s workspace. make sure each token user is able to access the workspace: %v", bcSvc.config.Integrations.BitbucketCloud.Workspace, customerrors.ErrCritical)
-	// 	bcSvc.logger.Error(wrappedErr.Error())
-	// 	rootErrorPayload.CriticalErrors = append(rootErrorPayload.CriticalErrors, wrappedErr)
-	// 	return rootErrorPayload
-	// }
-
-	// for _, workspace := range []BBktCloudWorkspace{*expectedWorkspace} {
+	for _, workspaceSlug := range selector.missingWorkspaces(workspaces) {
+		errorMessage := fmt.Sprintf("allowed workspace %s was not returned by Bitbucket Cloud. make sure each token user is able to access the workspace", workspaceSlug)
+		bcSvc.logger.Error(errorMessage)
+		rootErrorPayload.WorkspaceErrors = append(rootErrorPayload.WorkspaceErrors, gitdtos.BLWorkspaceError{
+			WorkspaceSlug:  workspaceSlug,
+			RepoFetchError: errorMessage,
+		})
+	}
+
 	for _, workspace := range workspaces {
+		if !selector.isWorkspaceAllowed(workspace.Slug) {
+			bcSvc.logger.Debug("Skipping workspace that is not in allowedWorkspaces", "workspace", workspace.Slug)
+			continue
+		}
 		workspaceError := gitdtos.BLWorkspaceError{
 			WorkspaceSlug: workspace.Slug,
 		}
@@ -146,10 +182,22 @@ func (bcSvc *BitbucketCloudSvc) RepoPull() *gitdtos.BLRootErrorPayload {
 		}
 		bcSvc.logger.Info("Found repositories", "count", len(repos))
 		devDRepos := []gitdtos.BLRepo{}
+		fetchedRepoUUIDs := set.NewWithCapacity[string](len(repos))
 		for _, repo := range repos {
+			fetchedRepoUUIDs.Add(repo.ID)
 			repoError := gitdtos.BLRepoError{
 				RepoID: repo.Slug,
 			}
+			if reason := selector.exclusionReason(repo); reason != "" {
+				bcSvc.logger.Info("Repository excluded by repo filter", "name", repo.Name, "reason", reason)
+				if err := bcSvc.deactivateRepo(workspace.Slug, repo); err != nil {
+					wrappedErr := fmt.Errorf("error deactivating excluded repo: %s: %w", repo.Slug, err)
+					bcSvc.logger.Error(wrappedErr.Error())
+					repoError.RepoProcessingError = wrappedErr.Error()
+					workspaceError.RepoErrors = append(workspaceError.RepoErrors, repoError)
+				}
+				continue
+			}
 			devDRepos = append(devDRepos, gitdtos.BLRepo{
 				Slug:     repo.Slug,
 				Name:     repo.Name,
@@ -160,37 +208,25 @@ func (bcSvc *BitbucketCloudSvc) RepoPull() *gitdtos.BLRootErrorPayload {
 				Prs:      []gitdtos.BLPullRequest{},
 			})
 			bcSvc.logger.Info("Repository", "name", repo.Name)
-			if existingRepoSyncAudit, err := bcSvc.dbQuerier.GetRepoSyncAuditByID(context.Background(), repo.Slug); err == nil {
-				bcSvc.logger.Debug("Repository found in database", "name", existingRepoSyncAudit.RepoName)
-				continue
-			} else if errors.Is(err, sql.ErrNoRows) {
-				// If the error is a no rows error, create a new repo sync audit
-				bcSvc.logger.Info("Repository not found in database. Creating new repo sync audit", "name", repo.Name)
-			} else {
-				wrappedErr := fmt.Errorf("error getting repo sync audit for repo: %s: %w", repo.Slug, err)
+			if err := bcSvc.trackRepo(workspace.Slug, repo); err != nil {
+				wrappedErr := fmt.Errorf("error tracking repo sync audit for repo: %s: %w", repo.Slug, err)
 				bcSvc.logger.Error(wrappedErr.Error())
 				repoError.RepoProcessingError = wrappedErr.Error()
 				workspaceError.RepoErrors = append(workspaceError.RepoErrors, repoError)
 				continue
 			}
+		}
 
-			if _, err := bcSvc.dbQuerier.CreateRepoSyncAudit(context.Background(), dbgen.CreateRepoSyncAuditParams{
-				ID:                 repo.Slug,
-				RepoName:           repo.Name,
-				WorkspaceSlug:      workspace.Slug,
-				SuccessfulSyncTime: sql.NullTime{Valid: false},
-				Success:            false,
-				ErrorContext:       sql.NullString{Valid: false},
-			}); err != nil {
-				wrappedErr := fmt.Errorf("error creating repo sync audit for repo: %s: %w", repo.Slug, err)
+		// Only a complete repository listing tells which tracked repositories are gone
+		if err == nil && len(repos) > 0 {
+			if err := bcSvc.deactivateVanishedRepos(workspace.Slug, fetchedRepoUUIDs); err != nil {
+				wrappedErr := fmt.Errorf("error deactivating vanished repositories: %w", err)
 				bcSvc.logger.Error(wrappedErr.Error())
-				repoError.RepoProcessingError = wrappedErr.Error()
-				workspaceError.RepoErrors = append(workspaceError.RepoErrors, repoError)
-				continue
+				workspaceError.WorkspaceProcessingError = wrappedErr.Error()
 			}
 		}
 
-		if err := bcSvc.dataRelayer.SendCollectedData(devDRepos, url.Values(map[string][]string{"type": {"repo_pull"}})); err != nil {
+		if err := bcSvc.dataRelayer.SendCollectedData(devDRepos, url.Values(map[string][]string{"type": {gitdtos.PayloadTypeRepoPull}})); err != nil {
 			wrappedErr := fmt.Errorf("error sending pull data to data relayer: %w", err)
 			bcSvc.logger.Error(wrappedErr.Error())
 			if errors.Is(err, customerrors.ErrCritical) {
@@ -205,6 +241,11 @@ func (bcSvc *BitbucketCloudSvc) RepoPull() *gitdtos.BLRootErrorPayload {
 		}
 	}
 
+	if err := bcSvc.purgeInactiveRepoSyncAudits(); err != nil {
+		// purging is housekeeping only, the next run retries it
+		bcSvc.logger.Error("Error purging inactive repo sync audits", "error", err)
+	}
+
 	if !rootErrorPayload.IsEmpty() {
 		return rootErrorPayload
 	}
@@ -238,10 +279,12 @@ func (bcSvc *BitbucketCloudSvc) GitActivityPull() *gitdtos.BLRootErrorPayload {
 			repoSyncAudit.ErrorContext = sql.NullString{String: err.Error(), Valid: true}
 			repoSyncAudit.UpdatedAt = currentSyncTime
 			if _, err := bcSvc.dbQuerier.UpdateRepoSyncAudit(context.Background(), dbgen.UpdateRepoSyncAuditParams{
-				ID:                 repoSyncAudit.ID,
+				Provider:           repoSyncAudit.Provider,
+				RepoUuid:           repoSyncAudit.RepoUuid,
+				RepoSlug:           repoSyncAudit.RepoSlug,
 				RepoName:           repoSyncAudit.RepoName,
 				WorkspaceSlug:      repoSyncAudit.WorkspaceSlug,
-				SuccessfulSyncTime: sql.NullTime{Time: currentSyncTime, Valid: true},
+				SuccessfulSyncTime: repoSyncAudit.SuccessfulSyncTime,
 				Success:            false,
 				ErrorContext:       sql.NullString{String: err.Error(), Valid: true},
 			}); err != nil {
@@ -256,7 +299,9 @@ func (bcSvc *BitbucketCloudSvc) GitActivityPull() *gitdtos.BLRootErrorPayload {
 			repoSyncAudit.ErrorContext = sql.NullString{Valid: false}
 			repoSyncAudit.UpdatedAt = currentSyncTime
 			if _, err := bcSvc.dbQuerier.UpdateRepoSyncAudit(context.Background(), dbgen.UpdateRepoSyncAuditParams{
-				ID:                 repoSyncAudit.ID,
+				Provider:           repoSyncAudit.Provider,
+				RepoUuid:           repoSyncAudit.RepoUuid,
+				RepoSlug:           repoSyncAudit.RepoSlug,
 				RepoName:           repoSyncAudit.RepoName,
 				WorkspaceSlug:      repoSyncAudit.WorkspaceSlug,
 				SuccessfulSyncTime: sql.NullTime{Time: currentSyncTime, Valid: true},
@@ -280,8 +325,9 @@ func (bcSvc *BitbucketCloudSvc) getAllActiveRepoSyncAudits() ([]dbgen.Repository
 	limit := 100
 	for {
 		repoSyncAuditsPerPage, err := bcSvc.dbQuerier.ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(context.Background(), dbgen.ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAtParams{
-			Offset: int64(len(repoSyncAudits)),
-			Limit:  int64(limit),
+			Provider: repoSyncAuditProvider,
+			Offset:   int64(len(repoSyncAudits)),
+			Limit:    int64(limit),
 		})
 		if err != nil {
 			return nil, fmt.Errorf("error getting paginated repo sync audits: %w", err)
@@ -296,51 +342,55 @@ func (bcSvc *BitbucketCloudSvc) getAllActiveRepoSyncAudits() ([]dbgen.Repository
 
 func (bcSvc *BitbucketCloudSvc) syncGitActivityForRepo(repoSyncAudit dbgen.RepositorySyncAudit) error {
 	repoError := &gitdtos.BLRepoError{
-		RepoID: repoSyncAudit.ID,
-	}
-	devDRepo := gitdtos.BLRepo{
-		Slug: repoSyncAudit.ID,
+		RepoID: repoSyncAudit.RepoSlug,
 	}
-	var lastSuccessfulSyncTime time.Time
-	if repoSyncAudit.SuccessfulSyncTime.Valid && !repoSyncAudit.SuccessfulSyncTime.Time.IsZero() {
-		lastSuccessfulSyncTime = repoSyncAudit.SuccessfulSyncTime.Time
-	} else {
-		lastSuccessfulSyncTime = time.Now().AddDate(0, 0, -bcSvc.config.Defaults.DefaultDataPullDays)
+	syncStartTime := time.Now()
+	cursors, err := bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	if err != nil {
+		return fmt.Errorf("error loading sync cursors for repository: %s: %w", repoSyncAudit.RepoSlug, err)
 	}
+	// the activity is relayed in batches, cursors only advance once the data they cover has been relayed
+	batch := bcSvc.newActivityBatch(repoSyncAudit)
+	var advancePullRequestCursor bool
+	var newPullRequestWatermark time.Time
+
 	// pull requests for the repository
 	{
-		fetchedPRs, err := bcSvc.apiClient.GetPullRequestsByRepository(repoSyncAudit.WorkspaceSlug, repoSyncAudit.ID, lastSuccessfulSyncTime, bcSvc.dataRelayer.SendPullError)
-		if err != nil {
-			wrappedErr := fmt.Errorf("error fetching pull requests for repository: %s: %w", repoSyncAudit.ID, err)
-			bcSvc.logger.Error(wrappedErr.Error())
-			if errors.Is(err, customerrors.ErrCritical) {
-				return wrappedErr
-			}
-			repoError.PrFetchError = wrappedErr.Error()
-		}
-
-		devDPRs := []gitdtos.BLPullRequest{}
-		for _, bBktCloudPr := range fetchedPRs {
-			prError := gitdtos.BLPrError{
-				PrID: bBktCloudPr.ID,
-			}
-
-			fetchedPrCommits, err := bcSvc.apiClient.GetPullRequestCommits(repoSyncAudit.WorkspaceSlug, repoSyncAudit.ID, bBktCloudPr.ID, bcSvc.dataRelayer.SendPullError)
+		failedPrIDs := set.New[int]()
+		// the pull requests are streamed page by page, only their ID and update time are kept for the watermark
+		syncedPRs := []BBktCloudPullRequest{}
+		var prFetchErr error
+		for bBktCloudPr, err := range bcSvc.apiClient.GetPullRequestsByRepositorySeq(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, cursors.pullRequestsSince, bcSvc.dataRelayer.SendPullError) {
 			if err != nil {
-				wrappedErr := fmt.Errorf("error fetching pull request commits for repository: %s: %w", repoSyncAudit.ID, err)
+				wrappedErr := fmt.Errorf("error fetching pull requests for repository: %s: %w", repoSyncAudit.RepoSlug, err)
 				bcSvc.logger.Error(wrappedErr.Error())
 				if errors.Is(err, customerrors.ErrCritical) {
 					return wrappedErr
 				}
-				prError.CommitFetchError = wrappedErr.Error()
+				repoError.PrFetchError = wrappedErr.Error()
+				prFetchErr = err
+				break
+			}
+			syncedPRs = append(syncedPRs, BBktCloudPullRequest{ID: bBktCloudPr.ID, UpdatedOn: bBktCloudPr.UpdatedOn})
+			prError := gitdtos.BLPrError{
+				PrID: bBktCloudPr.ID,
 			}
 
 			devDCommits := []gitdtos.BLCommit{}
-			for _, commit := range fetchedPrCommits {
+			for commit, err := range bcSvc.apiClient.GetPullRequestCommitsSeq(repoSyncAudit.WorkspaceSlug, repoSyncAudit.RepoSlug, bBktCloudPr.ID, bcSvc.dataRelayer.SendPullError) {
+				if err != nil {
+					wrappedErr := fmt.Errorf("error fetching pull request commits for repository: %s: %w", repoSyncAudit.RepoSlug, err)
+					bcSvc.logger.Error(wrappedErr.Error())
+					if errors.Is(err, customerrors.ErrCritical) {
+						return wrappedErr
+					}
+					prError.CommitFetchError = wrappedErr.Error()
+					break
+				}
 				devDCommits = append(devDCommits, gitdtos.BLCommit{
 					ID:                 commit.Hash,
 					Message:            commit.Message,
-					Committer:          convertBBktCloudUserToDevDActor(commit.Author.User, commit.Author.Raw),
+					Committer:          bcSvc.resolveActor(commit.Author.User, commit.Author.Raw),
 					CommitterTimestamp: commit.Date,
 					ChangedFiles:       []gitdtos.BLChangedFile{},
 				})
@@ -349,7 +399,7 @@ func (bcSvc *BitbucketCloudSvc) syncGitActivityForRepo(repoSyncAudit dbgen.Repos
 			isOpen := bBktCloudPr.State == string(BBktCloudPullRequestStateOpen)
 			reviewers := make([]gitdtos.BLActor, len(bBktCloudPr.Reviewers))
 			for i, reviewer := range bBktCloudPr.Reviewers {
-				reviewers[i] = convertBBktCloudUserToDevDActor(reviewer, "")
+				reviewers[i] = bcSvc.resolveActor(reviewer, "")
 			}
 			devDPR := gitdtos.BLPullRequest{
 				ID:           bBktCloudPr.ID,
@@ -362,75 +412,88 @@ func (bcSvc *BitbucketCloudSvc) syncGitActivityForRepo(repoSyncAudit dbgen.Repos
 				UpdatedDate:  bBktCloudPr.UpdatedOn,
 				SourceBranch: bBktCloudPr.Source.Branch.Name,
 				TargetBranch: bBktCloudPr.Destination.Branch.Name,
-				Author:       convertBBktCloudUserToDevDActor(bBktCloudPr.Author, ""),
+				Author:       bcSvc.resolveActor(bBktCloudPr.Author, ""),
 				Reviewers:    reviewers,
 				CommentCount: bBktCloudPr.CommentCount,
 				Link:         bBktCloudPr.Links.HTML.Href,
 				PrCommits:    devDCommits,
 			}
-			devDPRs = append(devDPRs, devDPR)
+			if err := batch.addPullRequest(devDPR); err != nil {
+				return err
+			}
 
 			if !prError.IsEmpty() {
 				repoError.PrErrors = append(repoError.PrErrors, prError)
+				failedPrIDs.Add(bBktCloudPr.ID)
 			}
 		}
-		if len(devDPRs) > 0 {
-			devDRepo.Prs = devDPRs
+		if prFetchErr == nil {
+			newPullRequestWatermark, advancePullRequestCursor = pullRequestWatermark(syncedPRs, failedPrIDs)
 		}
 	}
 
 	// commits for the repository
-	{
-		fetchedCommits, err := bcSvc.apiClient.GetCommitsByRepository(repoSyncAudit.WorkspaceSlug, repoSyncAudit.ID, lastSuccessfulSyncTime, bcSvc.dataRelayer.SendPullError)
-		if err != nil {
-			wrappedErr := fmt.Errorf("error fetching commits for repository: %s: %w", repoSyncAudit.ID, err)
-			bcSvc.logger.Error(wrappedErr.Error())
-			if errors.Is(err, customerrors.ErrCritical) {
-				return wrappedErr
-			}
-			repoError.CommitFetchError = wrappedErr.Error()
-		}
-
-		devDCommits := []gitdtos.BLCommit{}
-		for _, commit := range fetchedCommits {
-			devDCommits = append(devDCommits, gitdtos.BLCommit{
-				ID:                 commit.Hash,
-				Message:            commit.Message,
-				Committer:          convertBBktCloudUserToDevDActor(commit.Author.User, commit.Author.Raw),
-				CommitterTimestamp: commit.Date,
-				ChangedFiles:       []gitdtos.BLChangedFile{},
-			})
-		}
-		if len(devDCommits) > 0 {
-			devDRepo.Commits = devDCommits
+	walkedBranches, fetchErr, err := bcSvc.relayCommits(repoSyncAudit, cursors, batch)
+	if err != nil {
+		return fmt.Errorf("error relaying commits for repository: %s: %w", repoSyncAudit.RepoSlug, err)
+	}
+	if fetchErr != nil {
+		wrappedErr := fmt.Errorf("error collecting commits for repository: %s: %w", repoSyncAudit.RepoSlug, fetchErr)
+		bcSvc.logger.Error(wrappedErr.Error())
+		if errors.Is(fetchErr, customerrors.ErrCritical) {
+			return wrappedErr
 		}
+		repoError.CommitFetchError = wrappedErr.Error()
 	}
 
-	if !devDRepo.IsEmpty() {
-		data := gitdtos.BLData{
-			Repos: []gitdtos.BLRepo{
-				devDRepo,
-			},
-			WorkspaceKey: repoSyncAudit.WorkspaceSlug,
+	if err := batch.flush(); err != nil {
+		return err
+	}
+	if advancePullRequestCursor {
+		if err := bcSvc.advancePullRequestSyncCursor(repoSyncAudit, newPullRequestWatermark); err != nil {
+			return err
 		}
-		if err := bcSvc.dataRelayer.SendCollectedData(data, url.Values(map[string][]string{"type": {"activity_pull"}})); err != nil {
-			return fmt.Errorf("error sending data to data relayer: %w", err)
+	}
+	for _, branch := range walkedBranches {
+		if err := bcSvc.advanceCommitSyncCursor(repoSyncAudit, branch); err != nil {
+			return err
 		}
 	}
 	if !repoError.IsEmpty() {
 		if err := bcSvc.dataRelayer.SendPullError(repoError, nil); err != nil {
 			return fmt.Errorf("error sending error logs to data relayer: %w", err)
 		}
+		// what could be fetched was relayed, the repo sync audit still records the failure
+		return fmt.Errorf("repository was partially synced: %w", repoError)
 	}
 
-	return nil
+	return bcSvc.advanceActivitySyncCursor(repoSyncAudit, syncStartTime)
+}
+
+// resolveActor maps a Bitbucket Cloud user and the raw git author of a commit to the canonical actor of the person.
+func (bcSvc *BitbucketCloudSvc) resolveActor(bBktCloudActor BBKtCloudUser, rawAuthor string) gitdtos.BLActor {
+	authorName, authorEmail := identity.ParseRawAuthor(rawAuthor)
+	displayName := bBktCloudActor.DisplayName
+	if displayName == "" {
+		displayName = authorName
+	}
+	actor, err := bcSvc.identities.Resolve(identity.Observation{
+		AccountID:   bBktCloudActor.AccountID,
+		DisplayName: displayName,
+		Email:       authorEmail,
+	})
+	if err != nil {
+		bcSvc.logger.Error("Error resolving actor identity. Relaying the actor as observed", "error", err)
+		return convertBBktCloudUserToDevDActor(bBktCloudActor, displayName, authorEmail)
+	}
+	return actor
 }
 
-func convertBBktCloudUserToDevDActor(bBktCloudActor BBKtCloudUser, emailAddress string) gitdtos.BLActor {
+func convertBBktCloudUserToDevDActor(bBktCloudActor BBKtCloudUser, displayName, emailAddress string) gitdtos.BLActor {
 	return gitdtos.BLActor{
 		ID:           bBktCloudActor.AccountID,
-		Name:         bBktCloudActor.DisplayName,
-		DisplayName:  bBktCloudActor.DisplayName,
+		Name:         displayName,
+		DisplayName:  displayName,
 		EmailAddress: emailAddress,
 	}
 }
@@ -439,11 +502,12 @@ var bitbucketCloudSvc = di.NewThreadSafeSingleton(func() *BitbucketCloudSvc {
 	customLogger := shared.AcquireCustomLogger()
 	cfg := config.AcquireConfig()
 	statemanager := statemanager.AcquireStateManager()
-	credentials := credservice.AcquireCredentials()
 	dbQuerier := dbsetup.AcquireQuerier()
+	runInTx := dbsetup.AcquireTxRunner()
 	client := AcquireClient()
-	bluelockDataRelayer := relay.AcquireBluelockRelayService()
-	return NewBitbucketCloudSvc(customLogger, statemanager, credentials, cfg, dbQuerier, client, bluelockDataRelayer)
+	dataRelayer := relay.AcquireDataRelayer()
+	identities := identity.AcquireResolver()
+	return NewBitbucketCloudSvc(customLogger, statemanager, cfg, dbQuerier, runInTx, client, dataRelayer, identities)
 })
 
 func AcquireBitbucketCloudSvc() *BitbucketCloudSvc {
@@ -0,0 +1,120 @@
+package bitbucketcloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/token"
+)
+
+const (
+	defaultOAuthTokenURL = "https://bitbucket.org/site/oauth2/access_token"
+	// oauthTokenExpiryMargin renews access tokens that would expire during a request
+	oauthTokenExpiryMargin = time.Minute
+)
+
+// oauthTokenURLOf returns the OAuth token URL of the Bitbucket Cloud site serving the API at baseURL: the token
+// endpoint of api.bitbucket.org is on bitbucket.org, a fake server serves both.
+func oauthTokenURLOf(baseURL string) string {
+	apiURL, err := url.Parse(baseURL)
+	if err != nil || apiURL.Host == "" {
+		return defaultOAuthTokenURL
+	}
+	tokenURL := url.URL{Scheme: apiURL.Scheme, Host: strings.TrimPrefix(apiURL.Host, "api."), Path: "/site/oauth2/access_token"}
+	return tokenURL.String()
+}
+
+// ErrCredentialRejected is returned when the credential itself is refused before any API request, e.g. an OAuth
+// consumer whose client secret was revoked. The token is marked unauthorized like on a 401 response.
+var ErrCredentialRejected = errors.New("credential rejected")
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// authorizationHeader returns the Authorization header value for the credential.
+func (c *Client) authorizationHeader(cred *auth.Credential) (string, error) {
+	switch cred.GetType() {
+	case auth.BearerCredential:
+		return "Bearer " + cred.AccessToken, nil
+	case auth.OAuthClientCredentials:
+		accessToken, err := c.oauthAccessToken(cred)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + accessToken, nil
+	default:
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password)), nil
+	}
+}
+
+// oauthAccessToken returns the cached access token of the consumer, fetching a new one when it is missing or
+// about to expire.
+func (c *Client) oauthAccessToken(cred *auth.Credential) (string, error) {
+	if cached, ok := c.stateManager.GetOAuthToken(cred.TokenID); ok && cached.IsValidAt(time.Now(), oauthTokenExpiryMargin) {
+		return cached.AccessToken, nil
+	}
+
+	oauthToken, err := c.fetchOAuthToken(cred)
+	if err != nil {
+		return "", err
+	}
+	if err := c.stateManager.SetOAuthToken(cred.TokenID, oauthToken); err != nil {
+		c.logger.Warn("Failed to cache OAuth access token", "tokenID", cred.TokenID, "error", err)
+	}
+	c.logger.Info("Fetched OAuth access token", "tokenID", cred.TokenID, "expiresAt", oauthToken.ExpiresAt)
+	return oauthToken.AccessToken, nil
+}
+
+// fetchOAuthToken requests an access token with the client credentials grant.
+func (c *Client) fetchOAuthToken(cred *auth.Credential) (token.OAuthToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, c.oauthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return token.OAuthToken{}, fmt.Errorf("failed to create OAuth token request: %w", err)
+	}
+	req.SetBasicAuth(cred.ClientID, cred.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	requestedAt := time.Now()
+	response, err := c.httpClient.Do(req)
+	if err != nil {
+		return token.OAuthToken{}, fmt.Errorf("failed to execute OAuth token request: %w", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return token.OAuthToken{}, fmt.Errorf("failed to read OAuth token response: %w", err)
+	}
+
+	switch {
+	case response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized:
+		// the body only names the OAuth error, e.g. invalid_client, it holds no secret
+		return token.OAuthToken{}, fmt.Errorf("OAuth consumer %s: status code %d: %s: %w", cred.TokenID, response.StatusCode, body, ErrCredentialRejected)
+	case response.StatusCode != http.StatusOK:
+		return token.OAuthToken{}, fmt.Errorf("OAuth token request for %s failed: status code %d", cred.TokenID, response.StatusCode)
+	}
+
+	var tokenResponse oauthTokenResponse
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return token.OAuthToken{}, fmt.Errorf("failed to decode OAuth token response: %w", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return token.OAuthToken{}, fmt.Errorf("OAuth token response for %s has no access token", cred.TokenID)
+	}
+	return token.OAuthToken{
+		AccessToken: tokenResponse.AccessToken,
+		ExpiresAt:   requestedAt.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+	}, nil
+}
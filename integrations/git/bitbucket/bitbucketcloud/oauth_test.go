@@ -0,0 +1,128 @@
+package bitbucketcloud
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOAuthServer serves an OAuth token endpoint for client-id/client-secret and an API accepting the issued
+// access tokens and the static-token bearer token.
+func newTestOAuthServer(t *testing.T, tokenRequests *atomic.Int32, revokedAccessTokens map[string]bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/site/oauth2/access_token":
+			clientID, clientSecret, _ := r.BasicAuth()
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			if clientID != "client-id" || clientSecret != "client-secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_client"}`))
+				return
+			}
+			count := tokenRequests.Add(1)
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access-token-" + string(rune('0'+count)), "token_type": "bearer", "expires_in": 7200,
+			})
+		case "/2.0/workspaces":
+			accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if accessToken == "static-token" || (strings.HasPrefix(accessToken, "access-token-") && !revokedAccessTokens[accessToken]) {
+				w.Write([]byte(`{"values": []}`))
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestOAuthClient(t *testing.T, server *httptest.Server, creds []auth.Credential) (*Client, *statemanager.StateManager) {
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	for i := range creds {
+		creds[i].TokenID = "tok-" + string(rune('a'+i))
+	}
+	require.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(creds))
+
+	client := NewClient(nil, sm, &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, creds)
+	client.SetBaseURL(server.URL + "/2.0")
+	return client, sm
+}
+
+func TestOAuthTokenURLOf(t *testing.T) {
+	assert.Equal(t, defaultOAuthTokenURL, oauthTokenURLOf(DefaultBaseURL))
+	assert.Equal(t, "http://127.0.0.1:7990/site/oauth2/access_token", oauthTokenURLOf("http://127.0.0.1:7990/2.0"))
+	assert.Equal(t, defaultOAuthTokenURL, oauthTokenURLOf("not a url"))
+}
+
+func noopSendErrorLog(payload interface{}, queryParams url.Values) error {
+	return nil
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	var tokenRequests atomic.Int32
+	revokedAccessTokens := map[string]bool{}
+	server := newTestOAuthServer(t, &tokenRequests, revokedAccessTokens)
+	client, sm := newTestOAuthClient(t, server, []auth.Credential{
+		{Type: auth.OAuthClientCredentials, ClientID: "client-id", ClientSecret: "client-secret"},
+	})
+
+	_, err := client.GetWorkspaces(noopSendErrorLog)
+	require.NoError(t, err)
+	_, err = client.GetWorkspaces(noopSendErrorLog)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), tokenRequests.Load(), "the access token is cached")
+	cached, ok := sm.GetOAuthToken("tok-a")
+	require.True(t, ok)
+	assert.Equal(t, "access-token-1", cached.AccessToken)
+
+	// a revoked access token is renewed once
+	revokedAccessTokens["access-token-1"] = true
+	_, err = client.GetWorkspaces(noopSendErrorLog)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), tokenRequests.Load())
+	status, _ := sm.GetTokenStatus("tok-a")
+	assert.Equal(t, token.TokenActive, status)
+
+	// an expired access token is renewed before the request
+	require.NoError(t, sm.SetOAuthToken("tok-a", token.OAuthToken{AccessToken: "access-token-1", ExpiresAt: cached.ExpiresAt.AddDate(0, 0, -1)}))
+	_, err = client.GetWorkspaces(noopSendErrorLog)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), tokenRequests.Load())
+}
+
+func TestOAuthClientCredentialsRejected(t *testing.T) {
+	var tokenRequests atomic.Int32
+	server := newTestOAuthServer(t, &tokenRequests, map[string]bool{})
+	client, sm := newTestOAuthClient(t, server, []auth.Credential{
+		{Type: auth.OAuthClientCredentials, ClientID: "client-id", ClientSecret: "revoked-secret"},
+		{Type: auth.BearerCredential, AccessToken: "static-token"},
+	})
+	// make the rejected consumer the least used token
+	require.NoError(t, sm.UpdateTokenUsage("tok-b", time.Now()))
+
+	_, err := client.GetWorkspaces(noopSendErrorLog)
+	require.NoError(t, err, "the bearer token is used once the consumer is rejected")
+	status, _ := sm.GetTokenStatus("tok-a")
+	assert.Equal(t, token.TokenUnauthorized, status)
+	status, _ = sm.GetTokenStatus("tok-b")
+	assert.Equal(t, token.TokenActive, status)
+}
@@ -0,0 +1,79 @@
+package bitbucketcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/url"
+)
+
+// PaginationOptions tunes the paging of Paginate.
+type PaginationOptions[T any] struct {
+	// OnPage is called with every fetched page, numbered from 1, before its values are yielded.
+	OnPage func(pageNumber int, page BBktCloudPaginatedResponse[T])
+	// StopAfterPage ends the paging once the values of a page are yielded when it reports true, e.g. when a page holds
+	// nothing newer than the last sync.
+	StopAfterPage func(page BBktCloudPaginatedResponse[T]) bool
+}
+
+// Paginate streams the values of a paginated endpoint of the Bitbucket Cloud API, starting at firstPageURL and
+// following the next links. A page is fetched when the values of the previous one are consumed, so only one page is
+// held in memory, and breaking out of the loop stops the paging. A failing page is yielded as an error, after which
+// the paging stops. resource names the values in the errors.
+func Paginate[T any](c *Client, firstPageURL, resource string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error, options PaginationOptions[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		pageURL := firstPageURL
+		for pageNumber := 1; pageURL != ""; pageNumber++ {
+			page, err := fetchPage[T](c, pageURL, resource, sendErrorLogCallback)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if options.OnPage != nil {
+				options.OnPage(pageNumber, page)
+			}
+
+			for _, value := range page.Values {
+				if !yield(value, nil) {
+					return
+				}
+			}
+
+			if options.StopAfterPage != nil && options.StopAfterPage(page) {
+				return
+			}
+			pageURL = page.Next
+		}
+	}
+}
+
+// fetchPage requests and decodes one page, closing its body before the next page is requested.
+func fetchPage[T any](c *Client, pageURL, resource string, sendErrorLogCallback func(payload interface{}, queryParams url.Values) error) (BBktCloudPaginatedResponse[T], error) {
+	var page BBktCloudPaginatedResponse[T]
+	response, err := c.HandleRequestWithRetries(c.getRequestCallback(pageURL, sendErrorLogCallback))
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("Failed to get %s for url: %s: %s", resource, pageURL, err.Error()))
+		return page, fmt.Errorf("failed to get %s for url: %s: %w", resource, pageURL, err)
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		c.logger.Error(fmt.Sprintf("Failed to decode %s response for url: %s: %s", resource, pageURL, err.Error()))
+		return page, fmt.Errorf("failed to decode %s response for url: %s: %w", resource, pageURL, err)
+	}
+	return page, nil
+}
+
+// collectPages gathers the values of a pagination. On error it returns the values of the pages before the failing
+// one along with the error.
+func collectPages[T any](values iter.Seq2[T, error]) ([]T, error) {
+	collected := []T{}
+	for value, err := range values {
+		if err != nil {
+			return collected, err
+		}
+		collected = append(collected, value)
+	}
+	return collected, nil
+}
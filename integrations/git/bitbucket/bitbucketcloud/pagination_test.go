@@ -0,0 +1,138 @@
+package bitbucketcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPagingTestClient serves pages of pageSize values numbered from 0 until valueCount, and counts the requested pages.
+// A page number listed in failingPages answers with a body that is not JSON.
+func newPagingTestClient(t *testing.T, valueCount, pageSize int, failingPages ...int) (*Client, *int) {
+	requestedPages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPages++
+		pageNumber, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		for _, failingPage := range failingPages {
+			if pageNumber == failingPage {
+				w.Write([]byte("not json"))
+				return
+			}
+		}
+		page := BBktCloudPaginatedResponse[int]{Values: []int{}}
+		for value := pageNumber * pageSize; value < min((pageNumber+1)*pageSize, valueCount); value++ {
+			page.Values = append(page.Values, value)
+		}
+		if (pageNumber+1)*pageSize < valueCount {
+			page.Next = fmt.Sprintf("http://%s%s?page=%d", r.Host, r.URL.Path, pageNumber+1)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	require.NoError(t, sm.ReplaceTokenState("token", token.TokenState{Status: token.TokenActive}))
+	client := NewClient(nil, sm, &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, []auth.Credential{{TokenID: "token"}})
+	client.baseURL = server.URL
+	return client, &requestedPages
+}
+
+func noopPagingSendErrorLog(payload interface{}, queryParams url.Values) error {
+	return nil
+}
+
+func TestPaginate(t *testing.T) {
+	client, requestedPages := newPagingTestClient(t, 25, 10)
+
+	var pageNumbers, pageSizes []int
+	values, err := collectPages(Paginate(client, client.baseURL+"/values?page=0", "values", noopPagingSendErrorLog, PaginationOptions[int]{
+		OnPage: func(pageNumber int, page BBktCloudPaginatedResponse[int]) {
+			pageNumbers = append(pageNumbers, pageNumber)
+			pageSizes = append(pageSizes, len(page.Values))
+		},
+	}))
+	require.NoError(t, err)
+	assert.Len(t, values, 25)
+	assert.Equal(t, 24, values[24])
+	assert.Equal(t, []int{1, 2, 3}, pageNumbers)
+	assert.Equal(t, []int{10, 10, 5}, pageSizes)
+	assert.Equal(t, 3, *requestedPages)
+}
+
+func TestPaginateStopsEarly(t *testing.T) {
+	client, requestedPages := newPagingTestClient(t, 100, 10)
+
+	// breaking out of the loop stops the paging
+	for value, err := range Paginate(client, client.baseURL+"/values?page=0", "values", noopPagingSendErrorLog, PaginationOptions[int]{}) {
+		require.NoError(t, err)
+		if value == 12 {
+			break
+		}
+	}
+	assert.Equal(t, 2, *requestedPages, "pages are fetched as their values are consumed")
+
+	// so does the predicate, after the values of its page
+	*requestedPages = 0
+	values, err := collectPages(Paginate(client, client.baseURL+"/values?page=0", "values", noopPagingSendErrorLog, PaginationOptions[int]{
+		StopAfterPage: func(page BBktCloudPaginatedResponse[int]) bool {
+			return page.Values[0] >= 20
+		},
+	}))
+	require.NoError(t, err)
+	assert.Len(t, values, 30)
+	assert.Equal(t, 3, *requestedPages)
+}
+
+func TestPaginateFailingPage(t *testing.T) {
+	client, requestedPages := newPagingTestClient(t, 30, 10, 1)
+
+	values, err := collectPages(Paginate(client, client.baseURL+"/values?page=0", "values", noopPagingSendErrorLog, PaginationOptions[int]{}))
+	assert.ErrorContains(t, err, "failed to decode values response")
+	assert.Len(t, values, 10, "the values before the failing page are kept")
+	assert.Equal(t, 2, *requestedPages, "the paging stops at the failing page")
+}
+
+func TestGetCommitsByBranchSeqStopsAtOlderPage(t *testing.T) {
+	now := time.Now().UTC()
+	since := now.Add(-time.Hour)
+	pages := [][]BBktCloudCommit{
+		{{Hash: "c1", Date: now}, {Hash: "c2", Date: now.Add(-2 * time.Hour)}},
+		{{Hash: "c3", Date: now.Add(-3 * time.Hour)}},
+		{{Hash: "c4", Date: now.Add(-4 * time.Hour)}},
+	}
+	requestedPages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPages++
+		pageNumber, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page := BBktCloudPaginatedResponse[BBktCloudCommit]{Values: pages[pageNumber]}
+		if pageNumber+1 < len(pages) {
+			page.Next = fmt.Sprintf("http://%s%s?page=%d", r.Host, r.URL.Path, pageNumber+1)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	client, _ := newPagingTestClient(t, 0, 1)
+	client.baseURL = server.URL
+
+	commits, err := client.GetCommitsByBranch("acme", "api", "main", nil, since, noopPagingSendErrorLog)
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "c1", commits[0].Hash)
+	assert.Equal(t, 2, requestedPages, "the first page without a newer commit ends the paging")
+}
@@ -0,0 +1,85 @@
+package bitbucketcloud
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared/datastructures/set"
+	"github.com/bluelock-go/shared/patternmatch"
+)
+
+// repoSelector applies the workspace allow list and the repository filter of the Bitbucket Cloud configuration.
+type repoSelector struct {
+	allowedWorkspaces  set.Set[string]
+	includeSlugs       *patternmatch.Matcher
+	excludeSlugs       *patternmatch.Matcher
+	includeProjectKeys *patternmatch.Matcher
+	excludeProjectKeys *patternmatch.Matcher
+	skipArchived       bool
+}
+
+func newRepoSelector(bitbucketCloudConfig config.BitbucketCloud) (*repoSelector, error) {
+	repoFilter := bitbucketCloudConfig.RepoFilter
+	rs := &repoSelector{
+		allowedWorkspaces: set.NewFromSlice(bitbucketCloudConfig.AllowedWorkspaces),
+		skipArchived:      repoFilter.SkipArchived,
+	}
+	// the configured workspace is the allow list by default
+	if rs.allowedWorkspaces.IsEmpty() && bitbucketCloudConfig.Workspace != "" {
+		rs.allowedWorkspaces.Add(bitbucketCloudConfig.Workspace)
+	}
+
+	var err error
+	if rs.includeSlugs, err = patternmatch.Compile(repoFilter.IncludeSlugs); err != nil {
+		return nil, fmt.Errorf("invalid includeSlugs: %w", err)
+	}
+	if rs.excludeSlugs, err = patternmatch.Compile(repoFilter.ExcludeSlugs); err != nil {
+		return nil, fmt.Errorf("invalid excludeSlugs: %w", err)
+	}
+	if rs.includeProjectKeys, err = patternmatch.Compile(repoFilter.IncludeProjectKeys); err != nil {
+		return nil, fmt.Errorf("invalid includeProjectKeys: %w", err)
+	}
+	if rs.excludeProjectKeys, err = patternmatch.Compile(repoFilter.ExcludeProjectKeys); err != nil {
+		return nil, fmt.Errorf("invalid excludeProjectKeys: %w", err)
+	}
+	return rs, nil
+}
+
+// isWorkspaceAllowed reports whether the workspace should be pulled. Every workspace is allowed when neither
+// allowedWorkspaces nor workspace is configured.
+func (rs *repoSelector) isWorkspaceAllowed(workspaceSlug string) bool {
+	return rs.allowedWorkspaces.IsEmpty() || rs.allowedWorkspaces.Contains(workspaceSlug)
+}
+
+// missingWorkspaces returns the allowed workspaces that are not among the fetched ones.
+func (rs *repoSelector) missingWorkspaces(workspaces []BBktCloudWorkspace) []string {
+	fetched := set.New[string]()
+	for _, workspace := range workspaces {
+		fetched.Add(workspace.Slug)
+	}
+	missing := []string{}
+	for workspaceSlug := range rs.allowedWorkspaces.Difference(fetched) {
+		missing = append(missing, workspaceSlug)
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// exclusionReason returns why the repository is filtered out, or an empty string if it is selected.
+func (rs *repoSelector) exclusionReason(repo BBktCloudRepository) string {
+	switch {
+	case rs.skipArchived && repo.IsArchived:
+		return "repository is archived"
+	case !rs.includeSlugs.IsEmpty() && !rs.includeSlugs.Match(repo.Slug):
+		return "slug does not match includeSlugs"
+	case rs.excludeSlugs.Match(repo.Slug):
+		return "slug matches excludeSlugs"
+	case !rs.includeProjectKeys.IsEmpty() && !rs.includeProjectKeys.Match(repo.Project.Key):
+		return "project key does not match includeProjectKeys"
+	case rs.excludeProjectKeys.Match(repo.Project.Key):
+		return "project key matches excludeProjectKeys"
+	default:
+		return ""
+	}
+}
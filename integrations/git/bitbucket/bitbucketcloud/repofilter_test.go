@@ -0,0 +1,63 @@
+package bitbucketcloud
+
+import (
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoSelectorExclusionReason(t *testing.T) {
+	selector, err := newRepoSelector(config.BitbucketCloud{
+		AllowedWorkspaces: []string{"acme", "acme-labs"},
+		RepoFilter: config.RepoFilter{
+			IncludeSlugs:       []string{"svc-*", "re:^lib-[a-z]+$"},
+			ExcludeSlugs:       []string{"*-deprecated"},
+			ExcludeProjectKeys: []string{"SANDBOX"},
+			SkipArchived:       true,
+		},
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		repo     BBktCloudRepository
+		selected bool
+	}{
+		{BBktCloudRepository{Slug: "svc-payments", Project: BBktCloudProject{Key: "CORE"}}, true},
+		{BBktCloudRepository{Slug: "lib-utils"}, true},
+		{BBktCloudRepository{Slug: "frontend"}, false},
+		{BBktCloudRepository{Slug: "svc-billing-deprecated"}, false},
+		{BBktCloudRepository{Slug: "svc-playground", Project: BBktCloudProject{Key: "SANDBOX"}}, false},
+		{BBktCloudRepository{Slug: "svc-legacy", IsArchived: true}, false},
+	}
+	for _, testCase := range testCases {
+		reason := selector.exclusionReason(testCase.repo)
+		assert.Equal(t, testCase.selected, reason == "", "repo %s: reason %q", testCase.repo.Slug, reason)
+	}
+
+	assert.True(t, selector.isWorkspaceAllowed("acme"))
+	assert.False(t, selector.isWorkspaceAllowed("other"))
+	assert.Equal(t, []string{"acme-labs"}, selector.missingWorkspaces([]BBktCloudWorkspace{{Slug: "acme"}, {Slug: "other"}}))
+}
+
+func TestRepoSelectorDefaultsToTheConfiguredWorkspace(t *testing.T) {
+	selector, err := newRepoSelector(config.BitbucketCloud{Workspace: "acme"})
+	assert.NoError(t, err)
+	assert.True(t, selector.isWorkspaceAllowed("acme"))
+	assert.False(t, selector.isWorkspaceAllowed("other"))
+	assert.Equal(t, []string{"acme"}, selector.missingWorkspaces(nil))
+
+	selector, err = newRepoSelector(config.BitbucketCloud{Workspace: "acme", AllowedWorkspaces: []string{"acme-labs"}})
+	assert.NoError(t, err)
+	assert.False(t, selector.isWorkspaceAllowed("acme"), "allowedWorkspaces replaces the workspace")
+	assert.True(t, selector.isWorkspaceAllowed("acme-labs"))
+}
+
+func TestRepoSelectorWithoutConfigurationSelectsEverything(t *testing.T) {
+	selector, err := newRepoSelector(config.BitbucketCloud{})
+	assert.NoError(t, err)
+
+	assert.True(t, selector.isWorkspaceAllowed("any"))
+	assert.Empty(t, selector.missingWorkspaces(nil))
+	assert.Empty(t, selector.exclusionReason(BBktCloudRepository{Slug: "anything", IsArchived: true}))
+}
@@ -0,0 +1,224 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluelock-go/config"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
+)
+
+// repoSyncAuditProvider is the provider column of the repo sync audits owned by this integration.
+const repoSyncAuditProvider = string(config.BitbucketCloudKey)
+
+// legacyRepoUUIDPrefix marks repo sync audits migrated from the slug keyed schema whose repository UUID was never seen.
+// See migration 20261018110000_key_repo_sync_audit_on_provider_repo_uuid.sql.
+const legacyRepoUUIDPrefix = "legacy:"
+
+// findRepoSyncAudit looks the repository up by its UUID. A migrated row without a known UUID is matched by workspace and slug instead.
+func (bcSvc *BitbucketCloudSvc) findRepoSyncAudit(workspaceSlug string, repo BBktCloudRepository) (dbgen.RepositorySyncAudit, error) {
+	repoSyncAudit, err := bcSvc.dbQuerier.GetRepoSyncAudit(context.Background(), dbgen.GetRepoSyncAuditParams{
+		Provider: repoSyncAuditProvider,
+		RepoUuid: repo.ID,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		return repoSyncAudit, err
+	}
+
+	legacyRepoSyncAudit, err := bcSvc.dbQuerier.GetRepoSyncAuditBySlug(context.Background(), dbgen.GetRepoSyncAuditBySlugParams{
+		Provider:      repoSyncAuditProvider,
+		WorkspaceSlug: workspaceSlug,
+		RepoSlug:      repo.Slug,
+	})
+	if err != nil {
+		return legacyRepoSyncAudit, err
+	}
+	if !strings.HasPrefix(legacyRepoSyncAudit.RepoUuid, legacyRepoUUIDPrefix) {
+		// the slug belongs to another repository that was deleted or renamed
+		return dbgen.RepositorySyncAudit{}, sql.ErrNoRows
+	}
+	return legacyRepoSyncAudit, nil
+}
+
+// trackRepo makes sure the repository has an active repo sync audit with its current slug, name and workspace.
+// Audits are keyed by the repository UUID, so a renamed or moved repository keeps its sync history.
+func (bcSvc *BitbucketCloudSvc) trackRepo(workspaceSlug string, repo BBktCloudRepository) error {
+	if repo.ID == "" {
+		return fmt.Errorf("repository %s has no uuid", repo.Slug)
+	}
+
+	existingRepoSyncAudit, err := bcSvc.findRepoSyncAudit(workspaceSlug, repo)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcSvc.logger.Info("Repository not found in database. Creating new repo sync audit", "name", repo.Name)
+		if _, err := bcSvc.dbQuerier.CreateRepoSyncAudit(context.Background(), dbgen.CreateRepoSyncAuditParams{
+			Provider:           repoSyncAuditProvider,
+			RepoUuid:           repo.ID,
+			RepoSlug:           repo.Slug,
+			RepoName:           repo.Name,
+			WorkspaceSlug:      workspaceSlug,
+			MainBranch:         repo.MainBranch.Name,
+			SuccessfulSyncTime: sql.NullTime{Valid: false},
+			Success:            false,
+			ErrorContext:       sql.NullString{Valid: false},
+		}); err != nil {
+			return fmt.Errorf("error creating repo sync audit: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting repo sync audit: %w", err)
+	}
+	bcSvc.logger.Debug("Repository found in database", "name", existingRepoSyncAudit.RepoName)
+
+	if existingRepoSyncAudit.RepoUuid != repo.ID {
+		bcSvc.logger.Info("Replacing legacy repo sync audit key with the repository uuid", "name", repo.Name, "uuid", repo.ID)
+		if err := bcSvc.runInTx(func(dbQuerier dbgen.Querier) error {
+			if _, err := dbQuerier.UpdateRepoSyncAuditRepoUUID(context.Background(), dbgen.UpdateRepoSyncAuditRepoUUIDParams{
+				Provider:    repoSyncAuditProvider,
+				RepoUuid:    existingRepoSyncAudit.RepoUuid,
+				NewRepoUuid: repo.ID,
+			}); err != nil {
+				return fmt.Errorf("error replacing legacy repo uuid of repo sync audit: %w", err)
+			}
+			return reassignRepoSyncCursors(dbQuerier, repoSyncAuditProvider, existingRepoSyncAudit.RepoUuid, repo.ID)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if existingRepoSyncAudit.RepoSlug != repo.Slug || existingRepoSyncAudit.RepoName != repo.Name || existingRepoSyncAudit.WorkspaceSlug != workspaceSlug ||
+		existingRepoSyncAudit.MainBranch != repo.MainBranch.Name {
+		bcSvc.logger.Info("Repository was renamed, moved or got another main branch. Updating repo sync audit", "uuid", repo.ID,
+			"previousSlug", existingRepoSyncAudit.RepoSlug, "previousWorkspace", existingRepoSyncAudit.WorkspaceSlug,
+			"previousMainBranch", existingRepoSyncAudit.MainBranch,
+			"slug", repo.Slug, "workspace", workspaceSlug, "mainBranch", repo.MainBranch.Name)
+		if _, err := bcSvc.dbQuerier.UpdateRepoSyncAuditLocation(context.Background(), dbgen.UpdateRepoSyncAuditLocationParams{
+			Provider:      repoSyncAuditProvider,
+			RepoUuid:      repo.ID,
+			RepoSlug:      repo.Slug,
+			RepoName:      repo.Name,
+			WorkspaceSlug: workspaceSlug,
+			MainBranch:    repo.MainBranch.Name,
+		}); err != nil {
+			return fmt.Errorf("error updating location of repo sync audit: %w", err)
+		}
+		return nil
+	}
+
+	if !existingRepoSyncAudit.Active {
+		bcSvc.logger.Info("Repository is selected again. Reactivating repo sync audit", "name", repo.Name)
+		if err := bcSvc.updateRepoSyncAuditActiveStatus(repo.ID, true); err != nil {
+			return fmt.Errorf("error reactivating repo sync audit: %w", err)
+		}
+	}
+	return nil
+}
+
+// deactivateRepo deactivates the repo sync audit of the repository if it is tracked.
+func (bcSvc *BitbucketCloudSvc) deactivateRepo(workspaceSlug string, repo BBktCloudRepository) error {
+	existingRepoSyncAudit, err := bcSvc.findRepoSyncAudit(workspaceSlug, repo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting repo sync audit: %w", err)
+	}
+	if !existingRepoSyncAudit.Active {
+		return nil
+	}
+	return bcSvc.updateRepoSyncAuditActiveStatus(existingRepoSyncAudit.RepoUuid, false)
+}
+
+func (bcSvc *BitbucketCloudSvc) updateRepoSyncAuditActiveStatus(repoUUID string, active bool) error {
+	if _, err := bcSvc.dbQuerier.UpdateRepoSyncAuditActiveStatus(context.Background(), dbgen.UpdateRepoSyncAuditActiveStatusParams{
+		Provider: repoSyncAuditProvider,
+		RepoUuid: repoUUID,
+		Active:   active,
+	}); err != nil {
+		return fmt.Errorf("error updating repo sync audit active status: %w", err)
+	}
+	return nil
+}
+
+// listRepoSyncAudits returns every repo sync audit of this integration, active or not.
+func (bcSvc *BitbucketCloudSvc) listRepoSyncAudits() ([]dbgen.RepositorySyncAudit, error) {
+	allRepoSyncAudits, err := bcSvc.dbQuerier.ListRepoSyncAudits(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error listing repo sync audits: %w", err)
+	}
+	repoSyncAudits := []dbgen.RepositorySyncAudit{}
+	for _, repoSyncAudit := range allRepoSyncAudits {
+		if repoSyncAudit.Provider == repoSyncAuditProvider {
+			repoSyncAudits = append(repoSyncAudits, repoSyncAudit)
+		}
+	}
+	return repoSyncAudits, nil
+}
+
+// deactivateReposOfDisallowedWorkspaces deactivates the tracked repositories whose workspace was removed from allowedWorkspaces.
+func (bcSvc *BitbucketCloudSvc) deactivateReposOfDisallowedWorkspaces(selector *repoSelector) error {
+	repoSyncAudits, err := bcSvc.listRepoSyncAudits()
+	if err != nil {
+		return err
+	}
+	for _, repoSyncAudit := range repoSyncAudits {
+		if !repoSyncAudit.Active || selector.isWorkspaceAllowed(repoSyncAudit.WorkspaceSlug) {
+			continue
+		}
+		bcSvc.logger.Info("Deactivating repository of a workspace that is not allowed anymore", "name", repoSyncAudit.RepoName, "workspace", repoSyncAudit.WorkspaceSlug)
+		if err := bcSvc.updateRepoSyncAuditActiveStatus(repoSyncAudit.RepoUuid, false); err != nil {
+			return fmt.Errorf("error deactivating repo sync audit for repo: %s: %w", repoSyncAudit.RepoSlug, err)
+		}
+	}
+	return nil
+}
+
+// deactivateVanishedRepos deactivates the active repo sync audits of the workspace whose repository was not returned
+// by Bitbucket Cloud anymore, i.e. it was deleted, moved away or the tokens lost access to it.
+// It must only be called with the complete list of repositories of the workspace.
+func (bcSvc *BitbucketCloudSvc) deactivateVanishedRepos(workspaceSlug string, fetchedRepoUUIDs set.Set[string]) error {
+	repoSyncAudits, err := bcSvc.listRepoSyncAudits()
+	if err != nil {
+		return err
+	}
+
+	for _, repoSyncAudit := range repoSyncAudits {
+		if !repoSyncAudit.Active || repoSyncAudit.WorkspaceSlug != workspaceSlug || fetchedRepoUUIDs.Contains(repoSyncAudit.RepoUuid) {
+			continue
+		}
+		bcSvc.logger.Warn("Repository vanished from Bitbucket Cloud. Deactivating repo sync audit", "name", repoSyncAudit.RepoName, "workspace", workspaceSlug)
+		if err := bcSvc.updateRepoSyncAuditActiveStatus(repoSyncAudit.RepoUuid, false); err != nil {
+			return fmt.Errorf("error deactivating repo sync audit for repo: %s: %w", repoSyncAudit.RepoSlug, err)
+		}
+	}
+	return nil
+}
+
+// purgeInactiveRepoSyncAudits deletes the repo sync audits that have been inactive for longer than the retention window.
+func (bcSvc *BitbucketCloudSvc) purgeInactiveRepoSyncAudits() error {
+	cutoff := time.Now().UTC().AddDate(0, 0, -bcSvc.config.Defaults.InactiveRepoRetentionDays)
+	repoSyncAudits, err := bcSvc.dbQuerier.ListInactiveRepoSyncAuditUpdatedBefore(context.Background(), dbgen.ListInactiveRepoSyncAuditUpdatedBeforeParams{
+		Provider: repoSyncAuditProvider,
+		Cutoff:   cutoff,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing inactive repo sync audits: %w", err)
+	}
+
+	for _, repoSyncAudit := range repoSyncAudits {
+		if _, err := bcSvc.dbQuerier.DeleteInactiveRepoSyncAudit(context.Background(), dbgen.DeleteInactiveRepoSyncAuditParams{
+			Provider: repoSyncAuditProvider,
+			RepoUuid: repoSyncAudit.RepoUuid,
+		}); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error deleting inactive repo sync audit for repo: %s: %w", repoSyncAudit.RepoSlug, err)
+		}
+		if err := bcSvc.deleteRepoSyncCursors(repoSyncAuditProvider, repoSyncAudit.RepoUuid); err != nil {
+			return fmt.Errorf("error deleting sync cursors for repo: %s: %w", repoSyncAudit.RepoSlug, err)
+		}
+		bcSvc.logger.Info("Purged inactive repo sync audit", "name", repoSyncAudit.RepoName, "workspace", repoSyncAudit.WorkspaceSlug, "inactiveSince", repoSyncAudit.UpdatedAt)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/identity"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/database/dbsetup"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
+	"github.com/bluelock-go/testing/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQuerier(t *testing.T) (dbgen.Querier, *sql.DB) {
+	db := testdb.Open(t)
+	return dbgen.New(db), db
+}
+
+func newTestBitbucketCloudSvc(t *testing.T, dbQuerier dbgen.Querier, db *sql.DB) *BitbucketCloudSvc {
+	cfg := &config.Config{Defaults: *config.NewDefaults()}
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	return NewBitbucketCloudSvc(logger, nil, cfg, dbQuerier, dbsetup.NewTxRunner(db), nil, nil, identity.NewResolver(logger, dbQuerier))
+}
+
+func getTestRepoSyncAudit(t *testing.T, dbQuerier dbgen.Querier, repoUUID string) (dbgen.RepositorySyncAudit, error) {
+	t.Helper()
+	return dbQuerier.GetRepoSyncAudit(context.Background(), dbgen.GetRepoSyncAuditParams{
+		Provider: repoSyncAuditProvider,
+		RepoUuid: repoUUID,
+	})
+}
+
+func TestTrackRepoCarriesOverRenamedRepo(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+
+	repo := BBktCloudRepository{Slug: "api", Name: "api", ID: "{uuid-1}"}
+	assert.NoError(t, bcSvc.trackRepo("acme", repo))
+	_, err := dbQuerier.UpdateRepoSyncAudit(context.Background(), dbgen.UpdateRepoSyncAuditParams{
+		Provider: repoSyncAuditProvider, RepoUuid: "{uuid-1}", RepoSlug: "api", RepoName: "api", WorkspaceSlug: "acme", Success: true,
+	})
+	assert.NoError(t, err)
+
+	renamedRepo := BBktCloudRepository{Slug: "public-api", Name: "public-api", ID: "{uuid-1}"}
+	assert.NoError(t, bcSvc.trackRepo("other", renamedRepo))
+
+	renamed, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	assert.NoError(t, err)
+	assert.True(t, renamed.Success, "sync history should be carried over")
+	assert.Equal(t, "public-api", renamed.RepoSlug)
+	assert.Equal(t, "other", renamed.WorkspaceSlug)
+}
+
+func TestTrackRepoKeepsSameSlugInDifferentWorkspacesApart(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+
+	assert.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "api", ID: "{uuid-1}"}))
+	assert.NoError(t, bcSvc.trackRepo("other", BBktCloudRepository{Slug: "api", ID: "{uuid-2}"}))
+
+	repoSyncAudits, err := bcSvc.listRepoSyncAudits()
+	assert.NoError(t, err)
+	assert.Len(t, repoSyncAudits, 2)
+	acme, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", acme.WorkspaceSlug)
+	other, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-2}")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", other.WorkspaceSlug)
+}
+
+func TestTrackRepoAdoptsLegacyRepoSyncAudit(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+
+	_, err := db.Exec(`INSERT INTO repository_sync_audit (provider, repo_uuid, repo_slug, repo_name, workspace_slug, success)
+		VALUES ('BitbucketCloud', 'legacy:acme/api', 'api', 'api', 'acme', TRUE)`)
+	require.NoError(t, err)
+
+	assert.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "api", Name: "api", ID: "{uuid-1}"}))
+
+	_, err = getTestRepoSyncAudit(t, dbQuerier, "legacy:acme/api")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	adopted, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	assert.NoError(t, err)
+	assert.True(t, adopted.Success, "sync history should be carried over")
+}
+
+func TestTrackRepoKeepsSyncCursorsOfLegacyRepoSyncAudit(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+
+	_, err := db.Exec(`INSERT INTO repository_sync_audit (provider, repo_uuid, repo_slug, repo_name, workspace_slug, success)
+		VALUES ('BitbucketCloud', 'legacy:acme/api', 'api', 'api', 'acme', TRUE)`)
+	require.NoError(t, err)
+	legacy := dbgen.RepositorySyncAudit{Provider: repoSyncAuditProvider, RepoUuid: "legacy:acme/api"}
+	watermark := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, bcSvc.advancePullRequestSyncCursor(legacy, watermark))
+	require.NoError(t, bcSvc.advanceActivitySyncCursor(legacy, watermark))
+	require.NoError(t, bcSvc.advanceCommitSyncCursor(legacy, BBktCloudRef{Name: "main", Target: BBktCloudCommit{Hash: "m1", Date: watermark}}))
+	require.NoError(t, dbQuerier.CreateRelayedCommit(context.Background(), dbgen.CreateRelayedCommitParams{Provider: repoSyncAuditProvider, RepoUuid: "legacy:acme/api", Hash: "m1"}))
+
+	require.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "api", Name: "api", ID: "{uuid-1}"}))
+
+	adopted, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	require.NoError(t, err)
+	cursors, err := bcSvc.loadRepoSyncCursors(adopted)
+	require.NoError(t, err)
+	assert.True(t, watermark.Equal(cursors.pullRequestsSince), "the pull request cursor survives, got %v", cursors.pullRequestsSince)
+	assert.True(t, watermark.Equal(cursors.commitsSince), "the activity cursor survives, got %v", cursors.commitsSince)
+	assert.Equal(t, "m1", cursors.commitCursors["main"].LastCommitHash)
+	relayed, err := bcSvc.isCommitRelayed(adopted, "m1")
+	require.NoError(t, err)
+	assert.True(t, relayed)
+
+	legacyCursors, err := bcSvc.loadRepoSyncCursors(legacy)
+	require.NoError(t, err)
+	assert.Empty(t, legacyCursors.commitCursors, "nothing is left under the legacy key")
+}
+
+func TestDeactivateVanishedReposAndPurge(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+
+	assert.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "kept", ID: "{uuid-1}"}))
+	assert.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "deleted", ID: "{uuid-2}"}))
+	assert.NoError(t, bcSvc.trackRepo("other", BBktCloudRepository{Slug: "elsewhere", ID: "{uuid-3}"}))
+
+	assert.NoError(t, bcSvc.deactivateVanishedRepos("acme", set.NewFromSlice([]string{"{uuid-1}"})))
+
+	kept, _ := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	deleted, _ := getTestRepoSyncAudit(t, dbQuerier, "{uuid-2}")
+	elsewhere, _ := getTestRepoSyncAudit(t, dbQuerier, "{uuid-3}")
+	assert.True(t, kept.Active)
+	assert.False(t, deleted.Active)
+	assert.True(t, elsewhere.Active, "repositories of other workspaces must not be touched")
+
+	// still inside the retention window
+	assert.NoError(t, bcSvc.purgeInactiveRepoSyncAudits())
+	_, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-2}")
+	assert.NoError(t, err)
+
+	_, err = db.Exec("UPDATE repository_sync_audit SET updated_at = datetime('now', '-365 days') WHERE repo_uuid = '{uuid-2}'")
+	assert.NoError(t, err)
+	assert.NoError(t, bcSvc.purgeInactiveRepoSyncAudits())
+	_, err = getTestRepoSyncAudit(t, dbQuerier, "{uuid-2}")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,237 @@
+package bitbucketcloud
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/integrations/git/identity"
+	"github.com/bluelock-go/integrations/relay"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/database/dbsetup"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/bluelock-go/testing/fakebitbucket"
+	"github.com/bluelock-go/testing/fakerelay"
+	"github.com/bluelock-go/testing/httpfixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const runJobFixturePath = "testdata/runjob_fixture.json"
+
+// runJobTestEnv runs whole jobs against a fake relay, with the database and the state file in a temp dir.
+type runJobTestEnv struct {
+	bcSvc     *BitbucketCloudSvc
+	relay     *fakerelay.Server
+	dbQuerier dbgen.Querier
+}
+
+// newRunJobTestEnv sends the Bitbucket requests to baseURL through transport.
+func newRunJobTestEnv(t *testing.T, transport http.RoundTripper, baseURL string) *runJobTestEnv {
+	previousPause := jobCompletionPause
+	jobCompletionPause = 0
+	t.Cleanup(func() { jobCompletionPause = previousPause })
+
+	relayStore, err := fakerelay.OpenStore(filepath.Join(t.TempDir(), "relay.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { relayStore.Close() })
+	relayServer := fakerelay.NewServer("relay-key", relayStore)
+	relayHTTPServer := httptest.NewServer(relayServer)
+	t.Cleanup(relayHTTPServer.Close)
+
+	dbQuerier, db := newTestQuerier(t)
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	require.NoError(t, sm.ReplaceTokenState("token", token.TokenState{Status: token.TokenActive}))
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	cfg := &config.Config{Defaults: *config.NewDefaults()}
+	// the seeded dataset has fixed dates, they must stay in the pull window
+	cfg.Defaults.DefaultDataPullDays = 100 * 365
+	cfg.Integrations.BitbucketCloud.Workspace = "acme"
+
+	client := NewClient(&http.Client{Transport: transport}, sm, logger, []auth.Credential{{TokenID: "token", Username: "bot", Password: "app-password"}})
+	client.SetBaseURL(baseURL)
+	relayService := relay.NewBluelockRelayService(relayHTTPServer.Client(), relayHTTPServer.URL, "org", config.BitbucketCloudKey, "relay-key")
+	bcSvc := NewBitbucketCloudSvc(logger, sm, cfg, dbQuerier, dbsetup.NewTxRunner(db), client, relayService, identity.NewResolver(logger, dbQuerier))
+	return &runJobTestEnv{bcSvc: bcSvc, relay: relayServer, dbQuerier: dbQuerier}
+}
+
+// relayedPayloads returns the payloads the relay received, which all match their schema.
+func relayedPayloads(t *testing.T, relayServer *fakerelay.Server) []fakerelay.Payload {
+	t.Helper()
+	payloads, err := relayServer.Payloads()
+	require.NoError(t, err)
+	for _, payload := range payloads {
+		assert.True(t, payload.Valid, "%s %s payload does not match its schema: %v", payload.Kind, payload.Type, payload.Violations)
+	}
+	return payloads
+}
+
+// relayedData decodes the bodies of the pull-data payloads of a type.
+func relayedData[T any](t *testing.T, relayServer *fakerelay.Server, payloadType string) []T {
+	t.Helper()
+	var decoded []T
+	for _, payload := range relayedPayloads(t, relayServer) {
+		if payload.Kind != fakerelay.KindData || payload.Type != payloadType {
+			continue
+		}
+		var body T
+		require.NoError(t, json.Unmarshal(payload.Body, &body))
+		decoded = append(decoded, body)
+	}
+	return decoded
+}
+
+func relayedErrors(t *testing.T, relayServer *fakerelay.Server) []string {
+	t.Helper()
+	var errorBodies []string
+	for _, payload := range relayedPayloads(t, relayServer) {
+		if payload.Kind == fakerelay.KindError {
+			errorBodies = append(errorBodies, string(payload.Body))
+		}
+	}
+	return errorBodies
+}
+
+// runJobsAndAssertRelays runs a first job that relays the whole seeded dataset, then a second one that relays no
+// commit again.
+func runJobsAndAssertRelays(t *testing.T, env *runJobTestEnv) {
+	require.NoError(t, env.bcSvc.RunJob())
+	assert.Empty(t, relayedErrors(t, env.relay))
+
+	repoPulls := relayedData[[]gitdtos.BLRepo](t, env.relay, "repo_pull")
+	require.Len(t, repoPulls, 1)
+	require.Len(t, repoPulls[0], 2)
+	assert.Equal(t, "api", repoPulls[0][0].Slug)
+	assert.Equal(t, "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0001}", repoPulls[0][0].ID)
+	assert.False(t, repoPulls[0][0].IsPublic)
+	assert.Equal(t, "https://bitbucket.org/acme/api", repoPulls[0][0].Link)
+	assert.Equal(t, "web", repoPulls[0][1].Slug)
+
+	activity := map[string]gitdtos.BLRepo{}
+	for _, data := range relayedData[gitdtos.BLData](t, env.relay, "activity_pull") {
+		assert.Equal(t, "acme", data.WorkspaceKey)
+		require.Len(t, data.Repos, 1)
+		activity[data.Repos[0].Slug] = data.Repos[0]
+	}
+	require.Len(t, activity, 2)
+	api := activity["api"]
+	assert.ElementsMatch(t, []string{"a3", "a2", "a1", "f2", "f1"}, commitIDs(api.Commits), "the feature branch commits are listed once")
+	require.Len(t, api.Prs, 2)
+	prsByID := map[int]gitdtos.BLPullRequest{}
+	for _, pr := range api.Prs {
+		prsByID[pr.ID] = pr
+	}
+	loginPR := prsByID[2]
+	assert.Equal(t, "Login form", loginPR.Title)
+	assert.True(t, loginPR.Open)
+	assert.Equal(t, "feature/login", loginPR.SourceBranch)
+	assert.Equal(t, "main", loginPR.TargetBranch)
+	assert.Equal(t, "Jane Doe", loginPR.Author.DisplayName)
+	assert.Equal(t, []string{"f2", "f1"}, commitIDs(loginPR.PrCommits))
+	assert.True(t, prsByID[1].Closed)
+	assert.Equal(t, []string{"w1"}, commitIDs(activity["web"].Commits))
+
+	for _, repoUUID := range []string{"{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0001}", "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0002}"} {
+		repoSyncAudit, err := getTestRepoSyncAudit(t, env.dbQuerier, repoUUID)
+		require.NoError(t, err)
+		assert.True(t, repoSyncAudit.Success, repoSyncAudit.RepoSlug)
+		assert.True(t, repoSyncAudit.SuccessfulSyncTime.Valid, repoSyncAudit.RepoSlug)
+	}
+
+	runIDs := map[string]bool{}
+	for _, payload := range relayedPayloads(t, env.relay) {
+		runIDs[payload.RunID] = true
+	}
+	assert.Len(t, runIDs, 1, "the payloads of a job share its run ID")
+	assert.NotContains(t, runIDs, "")
+
+	require.NoError(t, env.relay.Reset())
+	require.NoError(t, env.bcSvc.RunJob())
+	assert.Empty(t, relayedErrors(t, env.relay))
+	assert.Len(t, relayedData[[]gitdtos.BLRepo](t, env.relay, "repo_pull"), 1)
+	for _, data := range relayedData[gitdtos.BLData](t, env.relay, "activity_pull") {
+		for _, repo := range data.Repos {
+			assert.Empty(t, repo.Commits, "commits of %s were relayed again", repo.Slug)
+			assert.Empty(t, repo.Prs, "pull requests of %s were relayed again", repo.Slug)
+		}
+	}
+}
+
+func commitIDs(commits []gitdtos.BLCommit) []string {
+	ids := []string{}
+	for _, commit := range commits {
+		ids = append(ids, commit.ID)
+	}
+	return ids
+}
+
+func TestRunJobAgainstFakeBitbucket(t *testing.T) {
+	bitbucketServer := httptest.NewServer(fakebitbucket.NewServer(fakebitbucket.SeedDataset()))
+	defer bitbucketServer.Close()
+
+	env := newRunJobTestEnv(t, http.DefaultTransport, bitbucketServer.URL+"/2.0")
+	runJobsAndAssertRelays(t, env)
+}
+
+func TestRunJobReportsFakeBitbucketFaults(t *testing.T) {
+	fakeServer := fakebitbucket.NewServer(fakebitbucket.SeedDataset())
+	fakeServer.SetFaults([]fakebitbucket.Fault{{Kind: fakebitbucket.FaultMalformedJSON, PathPrefix: "/2.0/repositories/acme/api/pullrequests/2/commits"}})
+	bitbucketServer := httptest.NewServer(fakeServer)
+	defer bitbucketServer.Close()
+
+	env := newRunJobTestEnv(t, http.DefaultTransport, bitbucketServer.URL+"/2.0/")
+	require.NoError(t, env.bcSvc.RunJob())
+
+	errorBodies := relayedErrors(t, env.relay)
+	require.Len(t, errorBodies, 1)
+	var repoError gitdtos.BLRepoError
+	require.NoError(t, json.Unmarshal([]byte(errorBodies[0]), &repoError))
+	assert.Equal(t, "api", repoError.RepoID)
+	require.Len(t, repoError.PrErrors, 1)
+	assert.Equal(t, 2, repoError.PrErrors[0].PrID)
+	assert.Contains(t, repoError.PrErrors[0].CommitFetchError, "failed to decode pull request commits response")
+
+	activity := relayedData[gitdtos.BLData](t, env.relay, "activity_pull")
+	assert.Len(t, activity, 2, "the other data is still relayed")
+
+	api, err := getTestRepoSyncAudit(t, env.dbQuerier, "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0001}")
+	require.NoError(t, err)
+	assert.False(t, api.Success, "a partially synced repository is recorded as failed")
+	assert.Contains(t, api.ErrorContext.String, "repository was partially synced")
+	assert.Equal(t, int64(1), api.ConsecutiveFailures)
+	web, err := getTestRepoSyncAudit(t, env.dbQuerier, "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0002}")
+	require.NoError(t, err)
+	assert.True(t, web.Success)
+	assert.Equal(t, int64(0), web.ConsecutiveFailures)
+}
+
+// TestRunJobReplaysRecordedFixture runs the jobs offline from the recorded Bitbucket interactions. Run it with
+// BLUELOCK_RECORD_FIXTURES=1 to record the fixture again against the fake server.
+func TestRunJobReplaysRecordedFixture(t *testing.T) {
+	baseURL := "https://api.bitbucket.org/2.0"
+	if os.Getenv(httpfixture.RecordEnvVar) != "" {
+		bitbucketServer := httptest.NewServer(fakebitbucket.NewServer(fakebitbucket.SeedDataset()))
+		t.Cleanup(bitbucketServer.Close)
+		baseURL = bitbucketServer.URL + "/2.0"
+	}
+	// the pull request query holds the time of the last sync
+	transport := httpfixture.Transport(t, runJobFixturePath, http.DefaultTransport, "q")
+
+	env := newRunJobTestEnv(t, transport, baseURL)
+	runJobsAndAssertRelays(t, env)
+	if replayer, ok := transport.(*httpfixture.Replayer); ok {
+		assert.Empty(t, replayer.Unused(), "every recorded interaction is replayed")
+	}
+}
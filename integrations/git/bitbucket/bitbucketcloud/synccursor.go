@@ -0,0 +1,171 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/shared/datastructures/set"
+)
+
+// repoSyncCursors tells where the previous syncs of a repository stopped for each kind of data.
+type repoSyncCursors struct {
+	pullRequestsSince time.Time
+	// commitsSince bounds the commits of branches without a cursor
+	commitsSince  time.Time
+	commitCursors map[string]dbgen.CommitSyncCursor
+}
+
+// loadRepoSyncCursors reads the cursors of the repository. An entity without a cursor of its own starts at the last
+// fully relayed activity sync, or DefaultDataPullDays ago for a repository that never synced.
+func (bcSvc *BitbucketCloudSvc) loadRepoSyncCursors(repoSyncAudit dbgen.RepositorySyncAudit) (repoSyncCursors, error) {
+	ctx := context.Background()
+	since := time.Now().AddDate(0, 0, -bcSvc.config.Defaults.DefaultDataPullDays)
+
+	activityCursor, err := bcSvc.dbQuerier.GetActivitySyncCursor(ctx, dbgen.GetActivitySyncCursorParams{
+		Provider: repoSyncAudit.Provider,
+		RepoUuid: repoSyncAudit.RepoUuid,
+	})
+	if err == nil {
+		since = activityCursor.LastSyncedAt
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return repoSyncCursors{}, fmt.Errorf("error getting activity sync cursor: %w", err)
+	} else if repoSyncAudit.Success && repoSyncAudit.SuccessfulSyncTime.Valid && !repoSyncAudit.SuccessfulSyncTime.Time.IsZero() {
+		// repositories synced before the cursors existed
+		since = repoSyncAudit.SuccessfulSyncTime.Time
+	}
+	cursors := repoSyncCursors{pullRequestsSince: since, commitsSince: since, commitCursors: map[string]dbgen.CommitSyncCursor{}}
+
+	pullRequestCursor, err := bcSvc.dbQuerier.GetPullRequestSyncCursor(ctx, dbgen.GetPullRequestSyncCursorParams{
+		Provider: repoSyncAudit.Provider,
+		RepoUuid: repoSyncAudit.RepoUuid,
+	})
+	if err == nil {
+		cursors.pullRequestsSince = pullRequestCursor.UpdatedOnWatermark
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return repoSyncCursors{}, fmt.Errorf("error getting pull request sync cursor: %w", err)
+	}
+
+	commitCursors, err := bcSvc.dbQuerier.ListCommitSyncCursors(ctx, dbgen.ListCommitSyncCursorsParams{
+		Provider: repoSyncAudit.Provider,
+		RepoUuid: repoSyncAudit.RepoUuid,
+	})
+	if err != nil {
+		return repoSyncCursors{}, fmt.Errorf("error listing commit sync cursors: %w", err)
+	}
+	for _, commitCursor := range commitCursors {
+		cursors.commitCursors[commitCursor.Branch] = commitCursor
+	}
+
+	return cursors, nil
+}
+
+// pullRequestWatermark returns the updated_on watermark the pull request cursor can advance to. Pull requests whose
+// commits could not be fetched hold the watermark back so they are fetched again by the next sync.
+func pullRequestWatermark(pullRequests []BBktCloudPullRequest, failedPrIDs set.Set[int]) (time.Time, bool) {
+	var newestSynced, oldestFailed time.Time
+	for _, pullRequest := range pullRequests {
+		if failedPrIDs.Contains(pullRequest.ID) {
+			if oldestFailed.IsZero() || pullRequest.UpdatedOn.Before(oldestFailed) {
+				oldestFailed = pullRequest.UpdatedOn
+			}
+			continue
+		}
+		if pullRequest.UpdatedOn.After(newestSynced) {
+			newestSynced = pullRequest.UpdatedOn
+		}
+	}
+
+	if !oldestFailed.IsZero() && (newestSynced.IsZero() || oldestFailed.Before(newestSynced)) {
+		// the next sync fetches the pull requests updated after the watermark, the failed pull request included
+		return oldestFailed.Add(-time.Microsecond), true
+	}
+	return newestSynced, !newestSynced.IsZero()
+}
+
+func (bcSvc *BitbucketCloudSvc) advancePullRequestSyncCursor(repoSyncAudit dbgen.RepositorySyncAudit, watermark time.Time) error {
+	if _, err := bcSvc.dbQuerier.UpsertPullRequestSyncCursor(context.Background(), dbgen.UpsertPullRequestSyncCursorParams{
+		Provider:           repoSyncAudit.Provider,
+		RepoUuid:           repoSyncAudit.RepoUuid,
+		UpdatedOnWatermark: watermark,
+	}); err != nil {
+		return fmt.Errorf("error advancing pull request sync cursor: %w", err)
+	}
+	return nil
+}
+
+// advanceCommitSyncCursor moves the cursor of the branch to the head the branch had when its commits were collected.
+func (bcSvc *BitbucketCloudSvc) advanceCommitSyncCursor(repoSyncAudit dbgen.RepositorySyncAudit, branch BBktCloudRef) error {
+	if _, err := bcSvc.dbQuerier.UpsertCommitSyncCursor(context.Background(), dbgen.UpsertCommitSyncCursorParams{
+		Provider:       repoSyncAudit.Provider,
+		RepoUuid:       repoSyncAudit.RepoUuid,
+		Branch:         branch.Name,
+		LastCommitHash: branch.Target.Hash,
+		LastCommitDate: branch.Target.Date,
+	}); err != nil {
+		return fmt.Errorf("error advancing commit sync cursor of branch: %s: %w", branch.Name, err)
+	}
+	return nil
+}
+
+func (bcSvc *BitbucketCloudSvc) deleteCommitSyncCursor(repoSyncAudit dbgen.RepositorySyncAudit, branchName string) error {
+	if err := bcSvc.dbQuerier.DeleteCommitSyncCursor(context.Background(), dbgen.DeleteCommitSyncCursorParams{
+		Provider: repoSyncAudit.Provider,
+		RepoUuid: repoSyncAudit.RepoUuid,
+		Branch:   branchName,
+	}); err != nil {
+		return fmt.Errorf("error deleting commit sync cursor of branch: %s: %w", branchName, err)
+	}
+	return nil
+}
+
+func (bcSvc *BitbucketCloudSvc) advanceActivitySyncCursor(repoSyncAudit dbgen.RepositorySyncAudit, syncedAt time.Time) error {
+	if _, err := bcSvc.dbQuerier.UpsertActivitySyncCursor(context.Background(), dbgen.UpsertActivitySyncCursorParams{
+		Provider:     repoSyncAudit.Provider,
+		RepoUuid:     repoSyncAudit.RepoUuid,
+		LastSyncedAt: syncedAt,
+	}); err != nil {
+		return fmt.Errorf("error advancing activity sync cursor: %w", err)
+	}
+	return nil
+}
+
+// deleteRepoSyncCursors drops every cursor and relayed commit of the repository, its next sync starts over from the default window.
+func (bcSvc *BitbucketCloudSvc) deleteRepoSyncCursors(provider, repoUUID string) error {
+	ctx := context.Background()
+	if err := bcSvc.dbQuerier.DeletePullRequestSyncCursor(ctx, dbgen.DeletePullRequestSyncCursorParams{Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error deleting pull request sync cursor: %w", err)
+	}
+	if err := bcSvc.dbQuerier.DeleteCommitSyncCursors(ctx, dbgen.DeleteCommitSyncCursorsParams{Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error deleting commit sync cursors: %w", err)
+	}
+	if err := bcSvc.dbQuerier.DeleteActivitySyncCursor(ctx, dbgen.DeleteActivitySyncCursorParams{Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error deleting activity sync cursor: %w", err)
+	}
+	if err := bcSvc.dbQuerier.DeleteRelayedCommits(ctx, dbgen.DeleteRelayedCommitsParams{Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error deleting relayed commits: %w", err)
+	}
+	return nil
+}
+
+// reassignRepoSyncCursors moves every cursor and relayed commit of the repository to another repository UUID, so the
+// repository keeps syncing from where it stopped.
+func reassignRepoSyncCursors(dbQuerier dbgen.Querier, provider, repoUUID, newRepoUUID string) error {
+	ctx := context.Background()
+	if err := dbQuerier.ReassignPullRequestSyncCursor(ctx, dbgen.ReassignPullRequestSyncCursorParams{NewRepoUuid: newRepoUUID, Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error reassigning pull request sync cursor: %w", err)
+	}
+	if err := dbQuerier.ReassignCommitSyncCursors(ctx, dbgen.ReassignCommitSyncCursorsParams{NewRepoUuid: newRepoUUID, Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error reassigning commit sync cursors: %w", err)
+	}
+	if err := dbQuerier.ReassignActivitySyncCursor(ctx, dbgen.ReassignActivitySyncCursorParams{NewRepoUuid: newRepoUUID, Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error reassigning activity sync cursor: %w", err)
+	}
+	if err := dbQuerier.ReassignRelayedCommits(ctx, dbgen.ReassignRelayedCommitsParams{NewRepoUuid: newRepoUUID, Provider: provider, RepoUuid: repoUUID}); err != nil {
+		return fmt.Errorf("error reassigning relayed commits: %w", err)
+	}
+	return nil
+}
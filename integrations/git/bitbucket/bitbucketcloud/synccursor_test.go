@@ -0,0 +1,76 @@
+package bitbucketcloud
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared/datastructures/set"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequestWatermark(t *testing.T) {
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	pullRequests := []BBktCloudPullRequest{
+		{ID: 1, UpdatedOn: base},
+		{ID: 2, UpdatedOn: base.Add(2 * time.Hour)},
+		{ID: 3, UpdatedOn: base.Add(time.Hour)},
+	}
+
+	watermark, ok := pullRequestWatermark(pullRequests, set.New[int]())
+	assert.True(t, ok)
+	assert.Equal(t, base.Add(2*time.Hour), watermark)
+
+	watermark, ok = pullRequestWatermark(pullRequests, set.NewFromSlice([]int{3}))
+	assert.True(t, ok)
+	assert.Equal(t, base.Add(time.Hour-time.Microsecond), watermark, "a failed pull request holds the watermark back")
+
+	_, ok = pullRequestWatermark(nil, set.New[int]())
+	assert.False(t, ok)
+}
+
+func TestLoadRepoSyncCursors(t *testing.T) {
+	dbQuerier, db := newTestQuerier(t)
+	bcSvc := newTestBitbucketCloudSvc(t, dbQuerier, db)
+	require.NoError(t, bcSvc.trackRepo("acme", BBktCloudRepository{Slug: "api", ID: "{uuid-1}"}))
+	repoSyncAudit, err := getTestRepoSyncAudit(t, dbQuerier, "{uuid-1}")
+	require.NoError(t, err)
+
+	cursors, err := bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	require.NoError(t, err)
+	defaultSince := time.Now().AddDate(0, 0, -bcSvc.config.Defaults.DefaultDataPullDays)
+	assert.WithinDuration(t, defaultSince, cursors.pullRequestsSince, time.Minute)
+	assert.WithinDuration(t, defaultSince, cursors.commitsSince, time.Minute)
+	assert.Empty(t, cursors.commitCursors)
+
+	// a failed sync must not move anything
+	repoSyncAudit.SuccessfulSyncTime = sql.NullTime{Time: time.Now(), Valid: true}
+	repoSyncAudit.Success = false
+	cursors, err = bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	require.NoError(t, err)
+	assert.WithinDuration(t, defaultSince, cursors.pullRequestsSince, time.Minute)
+
+	activitySyncedAt := time.Date(2026, 10, 10, 8, 0, 0, 0, time.UTC)
+	watermark := time.Date(2026, 10, 12, 9, 30, 0, 0, time.UTC)
+	branch := BBktCloudRef{Name: "main", Target: BBktCloudCommit{Hash: "abc123", Date: time.Date(2026, 10, 11, 7, 0, 0, 0, time.UTC)}}
+	require.NoError(t, bcSvc.advanceActivitySyncCursor(repoSyncAudit, activitySyncedAt))
+	cursors, err = bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	require.NoError(t, err)
+	assert.True(t, activitySyncedAt.Equal(cursors.pullRequestsSince), "entities without a cursor start at the activity cursor")
+	assert.True(t, activitySyncedAt.Equal(cursors.commitsSince))
+
+	require.NoError(t, bcSvc.advancePullRequestSyncCursor(repoSyncAudit, watermark))
+	require.NoError(t, bcSvc.advanceCommitSyncCursor(repoSyncAudit, branch))
+	cursors, err = bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	require.NoError(t, err)
+	assert.True(t, watermark.Equal(cursors.pullRequestsSince))
+	assert.True(t, activitySyncedAt.Equal(cursors.commitsSince), "branches without a cursor still start at the activity cursor")
+	assert.Equal(t, "abc123", cursors.commitCursors["main"].LastCommitHash)
+
+	require.NoError(t, bcSvc.deleteRepoSyncCursors(repoSyncAudit.Provider, repoSyncAudit.RepoUuid))
+	cursors, err = bcSvc.loadRepoSyncCursors(repoSyncAudit)
+	require.NoError(t, err)
+	assert.WithinDuration(t, defaultSince, cursors.pullRequestsSince, time.Minute)
+	assert.Empty(t, cursors.commitCursors)
+}
@@ -0,0 +1,152 @@
+package bitbucketcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/integrations/relay"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+)
+
+type probeResult int
+
+const (
+	probeHealthy probeResult = iota
+	probeUnauthorized
+	// probeInconclusive is a probe that says nothing about the token, e.g. a network error or a rate limit.
+	// It is neither counted as a failure nor restores the token.
+	probeInconclusive
+)
+
+// TokenHealthChecker probes the unauthorized tokens against the cheap /user endpoint, so tokens whose access was
+// restored are used again and tokens that keep failing are marked revoked. Every status change is reported to the
+// relay as a pull error.
+type TokenHealthChecker struct {
+	logger       *shared.CustomLogger
+	stateManager *statemanager.StateManager
+	client       *Client
+	dataRelayer  relay.DataRelayer
+	config       config.TokenHealth
+}
+
+func NewTokenHealthChecker(logger *shared.CustomLogger, stateManager *statemanager.StateManager, client *Client, dataRelayer relay.DataRelayer, config config.TokenHealth) *TokenHealthChecker {
+	return &TokenHealthChecker{logger, stateManager, client, dataRelayer, config}
+}
+
+func (hc *TokenHealthChecker) probeInterval() time.Duration {
+	return time.Duration(hc.config.ProbeIntervalSeconds) * time.Second
+}
+
+// Run probes the due tokens every probe interval until ctx is done.
+func (hc *TokenHealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(hc.probeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := hc.ProbeDueTokens(time.Now()); err != nil {
+				hc.logger.Error("Failed to probe token health", "error", err)
+			}
+		}
+	}
+}
+
+// ProbeDueTokens probes the unauthorized tokens whose probe is due and reports their status changes.
+func (hc *TokenHealthChecker) ProbeDueTokens(now time.Time) error {
+	var tokenErrors []gitdtos.BLTokenError
+	for _, tokenID := range hc.stateManager.GetTokensDueForProbe(now, hc.probeInterval()) {
+		cred, err := auth.GetCredentialByTokenID(tokenID, hc.client.Credentials())
+		if err != nil {
+			// the credential was removed by a reload, its state is dropped with the next sync
+			continue
+		}
+
+		result, probeErr := hc.probe(cred)
+		switch result {
+		case probeHealthy:
+			restored, err := hc.stateManager.RestoreUnauthorizedToken(tokenID)
+			if err != nil {
+				return fmt.Errorf("failed to restore token %s: %w", tokenID, err)
+			}
+			if restored {
+				hc.logger.Info("Token passed its health probe and is active again", "tokenID", tokenID)
+				tokenErrors = append(tokenErrors, gitdtos.BLTokenError{
+					TokenID: tokenID, PreviousStatus: string(token.TokenUnauthorized), Status: string(token.TokenActive),
+				})
+			}
+		case probeUnauthorized:
+			maxProbeInterval := time.Duration(hc.config.MaxProbeIntervalSeconds) * time.Second
+			status, err := hc.stateManager.RecordFailedTokenProbe(tokenID, now, hc.probeInterval(), maxProbeInterval, hc.config.RevokeAfterFailures)
+			if err != nil {
+				return fmt.Errorf("failed to record failed probe of token %s: %w", tokenID, err)
+			}
+			if status == token.TokenRevoked {
+				hc.logger.Warn("Token kept failing its health probes and is revoked", "tokenID", tokenID, "error", probeErr)
+				tokenErrors = append(tokenErrors, gitdtos.BLTokenError{
+					TokenID: tokenID, PreviousStatus: string(token.TokenUnauthorized), Status: string(token.TokenRevoked),
+					TokenHealthError: probeErr.Error(),
+				})
+			} else {
+				hc.logger.Info("Token failed its health probe", "tokenID", tokenID, "error", probeErr)
+			}
+		case probeInconclusive:
+			hc.logger.Warn("Token health probe was inconclusive", "tokenID", tokenID, "error", probeErr)
+		}
+	}
+
+	if len(tokenErrors) == 0 {
+		return nil
+	}
+	if err := hc.dataRelayer.SendPullError(&gitdtos.BLRootErrorPayload{TokenErrors: tokenErrors}, nil); err != nil {
+		return fmt.Errorf("error sending token status changes to data relayer: %w", err)
+	}
+	return nil
+}
+
+// probe requests the authenticated user with the credential. A 403 means the credential authenticated but lacks the
+// account scope, which is healthy for a token pulling repositories.
+func (hc *TokenHealthChecker) probe(cred *auth.Credential) (probeResult, error) {
+	if cred.GetType() == auth.OAuthClientCredentials {
+		// the cached access token may be the revoked part, the consumer is probed with a new one
+		hc.stateManager.DeleteOAuthToken(cred.TokenID)
+	}
+	authorization, err := hc.client.authorizationHeader(cred)
+	if errors.Is(err, ErrCredentialRejected) {
+		return probeUnauthorized, err
+	} else if err != nil {
+		return probeInconclusive, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, hc.client.baseURL+"/user", nil)
+	if err != nil {
+		return probeInconclusive, fmt.Errorf("failed to create probe request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	response, err := hc.client.httpClient.Do(req)
+	if err != nil {
+		return probeInconclusive, fmt.Errorf("failed to execute probe request: %w", err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusForbidden:
+		return probeHealthy, nil
+	case http.StatusUnauthorized:
+		return probeUnauthorized, fmt.Errorf("probe request unauthorized: status code %d", response.StatusCode)
+	default:
+		return probeInconclusive, fmt.Errorf("unexpected probe response: status code %d", response.StatusCode)
+	}
+}
@@ -0,0 +1,122 @@
+package bitbucketcloud
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingRelayer keeps the pull errors sent to the relay.
+type recordingRelayer struct {
+	mu         sync.Mutex
+	pullErrors []interface{}
+}
+
+func (r *recordingRelayer) StartRun(runID string) {}
+
+func (r *recordingRelayer) EndRun() {}
+
+func (r *recordingRelayer) SendCollectedData(payload interface{}, queryParams url.Values) error {
+	return nil
+}
+
+func (r *recordingRelayer) SendPullError(payload interface{}, queryParams url.Values) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pullErrors = append(r.pullErrors, payload)
+	return nil
+}
+
+func (r *recordingRelayer) SendDataAndError(dataPayload interface{}, errorPayload interface{}, queryParams url.Values) error {
+	return nil
+}
+
+func TestTokenHealthChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		case "restored-token":
+			w.Write([]byte(`{"username": "bot"}`))
+		case "scoped-token":
+			w.WriteHeader(http.StatusForbidden)
+		case "flaky-token":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	creds := []auth.Credential{
+		{Type: auth.BearerCredential, AccessToken: "restored-token", TokenID: "tok-restored"},
+		{Type: auth.BearerCredential, AccessToken: "scoped-token", TokenID: "tok-scoped"},
+		{Type: auth.BearerCredential, AccessToken: "flaky-token", TokenID: "tok-flaky"},
+		{Type: auth.BearerCredential, AccessToken: "revoked-token", TokenID: "tok-revoked"},
+		{Type: auth.BearerCredential, AccessToken: "active-token", TokenID: "tok-active"},
+	}
+	require.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(creds))
+	for _, tokenID := range []string{"tok-restored", "tok-scoped", "tok-flaky", "tok-revoked"} {
+		require.NoError(t, sm.SetTokenStatusToUnauthorized(tokenID))
+	}
+
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	client := NewClient(nil, sm, logger, creds)
+	client.baseURL = server.URL
+	relayer := &recordingRelayer{}
+	checker := NewTokenHealthChecker(logger, sm, client, relayer, config.TokenHealth{
+		ProbeIntervalSeconds: 60, MaxProbeIntervalSeconds: 600, RevokeAfterFailures: 2,
+	})
+
+	now := time.Now()
+	require.NoError(t, checker.ProbeDueTokens(now))
+	assert.Empty(t, relayer.pullErrors, "no token is due before the probe interval")
+
+	require.NoError(t, checker.ProbeDueTokens(now.Add(time.Minute)))
+	for tokenID, expectedStatus := range map[string]token.TokenStatus{
+		"tok-restored": token.TokenActive,
+		"tok-scoped":   token.TokenActive,
+		"tok-flaky":    token.TokenUnauthorized,
+		"tok-revoked":  token.TokenUnauthorized,
+		"tok-active":   token.TokenActive,
+	} {
+		status, _ := sm.GetTokenStatus(tokenID)
+		assert.Equal(t, expectedStatus, status, tokenID)
+	}
+	assert.Equal(t, 0, sm.State.TokenStates["tok-flaky"].ProbeFailureCount, "inconclusive probes are not failures")
+	assert.Equal(t, 1, sm.State.TokenStates["tok-revoked"].ProbeFailureCount)
+	require.Len(t, relayer.pullErrors, 1)
+	assert.ElementsMatch(t, []gitdtos.BLTokenError{
+		{TokenID: "tok-restored", PreviousStatus: "unauthorized", Status: "active"},
+		{TokenID: "tok-scoped", PreviousStatus: "unauthorized", Status: "active"},
+	}, relayer.pullErrors[0].(*gitdtos.BLRootErrorPayload).TokenErrors)
+
+	require.NoError(t, checker.ProbeDueTokens(now.Add(time.Minute+59*time.Second)))
+	assert.Len(t, relayer.pullErrors, 1, "the failing token waits for its backoff")
+
+	require.NoError(t, checker.ProbeDueTokens(now.Add(2*time.Minute)))
+	status, _ := sm.GetTokenStatus("tok-revoked")
+	assert.Equal(t, token.TokenRevoked, status)
+	require.Len(t, relayer.pullErrors, 2)
+	tokenErrors := relayer.pullErrors[1].(*gitdtos.BLRootErrorPayload).TokenErrors
+	require.Len(t, tokenErrors, 1)
+	assert.Equal(t, "tok-revoked", tokenErrors[0].TokenID)
+	assert.Equal(t, "revoked", tokenErrors[0].Status)
+	assert.NotContains(t, tokenErrors[0].TokenHealthError, "revoked-token", "the access token is not reported")
+}
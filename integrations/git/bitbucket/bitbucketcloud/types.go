@@ -13,11 +13,19 @@ type BBktCloudWorkspace struct {
 }
 
 type BBktCloudRepository struct {
-	Slug      string         `json:"slug"`
-	Name      string         `json:"name"`
-	ID        string         `json:"uuid"`
-	IsPrivate bool           `json:"is_private"`
-	Links     BBktCloudLinks `json:"links"`
+	Slug       string           `json:"slug"`
+	Name       string           `json:"name"`
+	ID         string           `json:"uuid"`
+	IsPrivate  bool             `json:"is_private"`
+	IsArchived bool             `json:"is_archived"`
+	Project    BBktCloudProject `json:"project"`
+	MainBranch BBktCloudBranch  `json:"mainbranch"`
+	Links      BBktCloudLinks   `json:"links"`
+}
+
+type BBktCloudProject struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
 }
 
 type BBktCloudLinks struct {
@@ -63,6 +71,12 @@ type BBktCloudBranch struct {
 	Name string `json:"name"`
 }
 
+// BBktCloudRef is a branch as listed by /refs/branches, Target is its head commit.
+type BBktCloudRef struct {
+	Name   string          `json:"name"`
+	Target BBktCloudCommit `json:"target"`
+}
+
 type BBCloudSlimCommit struct {
 	Hash  string         `json:"hash"`
 	Links BBktCloudLinks `json:"links"`
@@ -0,0 +1,29 @@
+package gitdtos
+
+import "time"
+
+// PayloadSchemaVersion is the version of the payload schemas published in schemas/v<version>. It is increased by a
+// DTO change the published schemas do not accept, e.g. a removed or retyped property, and the new schemas are
+// published next to the previous ones.
+const PayloadSchemaVersion = 1
+
+// Payload types, sent as the type query parameter of pull-data requests and as the type of every envelope.
+const (
+	PayloadTypeRepoPull     = "repo_pull"
+	PayloadTypeActivityPull = "activity_pull"
+	PayloadTypePullError    = "pull_error"
+)
+
+// BLEnvelope is the body of every request to the relay: the payload is the data member of a pull-data request and
+// the error member of a pull-error request, next to the members identifying it. RunID identifies the job that
+// sent the payload, it is empty for the payloads sent outside of a job such as the token health reports.
+type BLEnvelope struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	OrgCode       string      `json:"orgCode"`
+	Service       string      `json:"service"`
+	Type          string      `json:"type"`
+	RunID         string      `json:"runId"`
+	SentAt        time.Time   `json:"sentAt"`
+	Data          interface{} `json:"data,omitempty"`
+	Error         interface{} `json:"error,omitempty"`
+}
@@ -6,14 +6,32 @@ type BLRootErrorPayload struct {
 	CriticalErrors      []interface{}      `json:"critical,omitempty"`
 	WorkspaceFetchError string             `json:"workspace_fetch_error,omitempty"`
 	WorkspaceErrors     []BLWorkspaceError `json:"workspace_errors,omitempty"`
+	TokenErrors         []BLTokenError     `json:"token_errors,omitempty"`
 }
 
 func (e *BLRootErrorPayload) Error() string {
-	return fmt.Sprintf("critical errors: %v, workspace fetch error: %s, workspace errors: %v", e.CriticalErrors, e.WorkspaceFetchError, e.WorkspaceErrors)
+	return fmt.Sprintf("critical errors: %v, workspace fetch error: %s, workspace errors: %v, token errors: %v", e.CriticalErrors, e.WorkspaceFetchError, e.WorkspaceErrors, e.TokenErrors)
 }
 
 func (e *BLRootErrorPayload) IsEmpty() bool {
-	return len(e.CriticalErrors) == 0 && e.WorkspaceFetchError == "" && len(e.WorkspaceErrors) == 0
+	return len(e.CriticalErrors) == 0 && e.WorkspaceFetchError == "" && len(e.WorkspaceErrors) == 0 && len(e.TokenErrors) == 0
+}
+
+// BLTokenError reports a status transition of a token found by its health probe, e.g. a token that was restored or
+// revoked. The token is identified by its token ID only.
+type BLTokenError struct {
+	TokenID          string `json:"token_id"`
+	PreviousStatus   string `json:"previous_status"`
+	Status           string `json:"status"`
+	TokenHealthError string `json:"token_health_error,omitempty"`
+}
+
+func (e BLTokenError) Error() string {
+	return fmt.Sprintf("token %s status changed from %s to %s: %s", e.TokenID, e.PreviousStatus, e.Status, e.TokenHealthError)
+}
+
+func (e BLTokenError) IsEmpty() bool {
+	return e.PreviousStatus == e.Status
 }
 
 type BLWorkspaceError struct {
@@ -101,3 +119,4 @@ var _ ErrorWithIsEmpty = (*BLRepoError)(nil)
 var _ ErrorWithIsEmpty = (*BLPrError)(nil)
 var _ ErrorWithIsEmpty = (*BLCommitError)(nil)
 var _ ErrorWithIsEmpty = (*BLChangedFileError)(nil)
+var _ ErrorWithIsEmpty = (*BLTokenError)(nil)
@@ -0,0 +1,91 @@
+package gitdtos
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/bluelock-go/shared/jsonschema"
+)
+
+// dtoTypes are the types sent to the relay, by name. Their property names mix camelCase (createdDate) and snake_case
+// (changed_files, workspace_slug), and BLAdditionalParam1 embeds BLAdditionalParam for a reviewer it shadows: both
+// are part of the published contract and kept as they are.
+var dtoTypes = map[string]reflect.Type{
+	"BLEnvelope":         reflect.TypeFor[BLEnvelope](),
+	"BLChangedFile":      reflect.TypeFor[BLChangedFile](),
+	"BLActor":            reflect.TypeFor[BLActor](),
+	"BLCommit":           reflect.TypeFor[BLCommit](),
+	"BLAdditionalParam":  reflect.TypeFor[BLAdditionalParam](),
+	"BLAdditionalParam1": reflect.TypeFor[BLAdditionalParam1](),
+	"BLActivityInfo":     reflect.TypeFor[BLActivityInfo](),
+	"BLPullRequest":      reflect.TypeFor[BLPullRequest](),
+	"BLRepo":             reflect.TypeFor[BLRepo](),
+	"BLData":             reflect.TypeFor[BLData](),
+	"BLRootErrorPayload": reflect.TypeFor[BLRootErrorPayload](),
+	"BLTokenError":       reflect.TypeFor[BLTokenError](),
+	"BLWorkspaceError":   reflect.TypeFor[BLWorkspaceError](),
+	"BLRepoError":        reflect.TypeFor[BLRepoError](),
+	"BLPrError":          reflect.TypeFor[BLPrError](),
+	"BLCommitError":      reflect.TypeFor[BLCommitError](),
+	"BLChangedFileError": reflect.TypeFor[BLChangedFileError](),
+}
+
+// PayloadSchema returns the schema of the request body of a payload type: the envelope with its data member, or its
+// error member for pull errors, which are a repository error, a root error payload or the message of a failed
+// request.
+func PayloadSchema(payloadType string) (*jsonschema.Schema, error) {
+	switch payloadType {
+	case PayloadTypeRepoPull:
+		return envelopeSchema(payloadType, "data", jsonschema.Generate(reflect.TypeFor[[]BLRepo]())), nil
+	case PayloadTypeActivityPull:
+		return envelopeSchema(payloadType, "data", jsonschema.Generate(reflect.TypeFor[BLData]())), nil
+	case PayloadTypePullError:
+		return envelopeSchema(payloadType, "error", jsonschema.AnyOf(
+			jsonschema.Generate(reflect.TypeFor[BLRepoError]()),
+			jsonschema.Generate(reflect.TypeFor[BLRootErrorPayload]()),
+			jsonschema.Generate(reflect.TypeFor[string]()),
+		)), nil
+	default:
+		return nil, fmt.Errorf("unknown payload type %q", payloadType)
+	}
+}
+
+func envelopeSchema(payloadType, member string, payload *jsonschema.Schema) *jsonschema.Schema {
+	schema := jsonschema.Generate(reflect.TypeFor[BLEnvelope]())
+	schema.Title = payloadType
+	envelope := schema.Defs["BLEnvelope"]
+	envelope.Properties["schemaVersion"].Const = PayloadSchemaVersion
+	envelope.Properties["type"].Const = payloadType
+
+	for name, def := range payload.Defs {
+		schema.Defs[name] = def
+	}
+	memberSchema := *payload
+	memberSchema.Schema = ""
+	memberSchema.Defs = nil
+	envelope.Properties[member] = &memberSchema
+	if member == "data" {
+		delete(envelope.Properties, "error")
+	} else {
+		delete(envelope.Properties, "data")
+	}
+	envelope.Required = append(envelope.Required, member)
+	slices.Sort(envelope.Required)
+	return schema
+}
+
+// Schemas returns the schemas to publish by file name: one per DTO and one per payload type.
+func Schemas() map[string]*jsonschema.Schema {
+	schemas := map[string]*jsonschema.Schema{}
+	for name, dtoType := range dtoTypes {
+		schema := jsonschema.Generate(dtoType)
+		schema.Title = name
+		schemas[name+".schema.json"] = schema
+	}
+	for _, payloadType := range []string{PayloadTypeRepoPull, PayloadTypeActivityPull, PayloadTypePullError} {
+		schema, _ := PayloadSchema(payloadType)
+		schemas[payloadType+".payload.schema.json"] = schema
+	}
+	return schemas
+}
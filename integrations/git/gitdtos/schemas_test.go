@@ -0,0 +1,126 @@
+package gitdtos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishSchemasEnvVar publishes the schemas of the current DTOs when set, unless they break the published ones.
+const publishSchemasEnvVar = "BLUELOCK_PUBLISH_SCHEMAS"
+
+func encodeSchema(t *testing.T, schema *jsonschema.Schema) []byte {
+	t.Helper()
+	encoded, err := json.MarshalIndent(schema, "", "  ")
+	require.NoError(t, err)
+	return append(encoded, '\n')
+}
+
+// TestPublishedSchemasAreCompatible fails when a DTO change breaks the schemas published for PayloadSchemaVersion,
+// and when they are not up to date. Run it with BLUELOCK_PUBLISH_SCHEMAS=1 to publish them.
+func TestPublishedSchemasAreCompatible(t *testing.T) {
+	dir := filepath.Join("schemas", fmt.Sprintf("v%d", PayloadSchemaVersion))
+	publish := os.Getenv(publishSchemasEnvVar) != ""
+	schemas := Schemas()
+
+	published := map[string][]byte{}
+	entries, err := os.ReadDir(dir)
+	if !publish {
+		require.NoError(t, err, "no schemas are published for version %d, run with %s=1", PayloadSchemaVersion, publishSchemasEnvVar)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		published[entry.Name()] = content
+	}
+
+	breaking := false
+	for name, content := range published {
+		current, ok := schemas[name]
+		if !ok {
+			breaking = true
+			t.Errorf("%s is published for version %d and no longer generated, removing it needs a new PayloadSchemaVersion", name, PayloadSchemaVersion)
+			continue
+		}
+		var publishedSchema jsonschema.Schema
+		require.NoError(t, json.Unmarshal(content, &publishedSchema), name)
+		if problems := jsonschema.Incompatibilities(&publishedSchema, current); len(problems) > 0 {
+			breaking = true
+			t.Errorf("the DTO change breaks %s published for version %d, increase PayloadSchemaVersion and run with %s=1:\n  %s",
+				name, PayloadSchemaVersion, publishSchemasEnvVar, strings.Join(problems, "\n  "))
+		}
+	}
+	if breaking {
+		return
+	}
+
+	if publish {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		for name, schema := range schemas {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), encodeSchema(t, schema), 0644))
+		}
+		return
+	}
+	for name, schema := range schemas {
+		content, ok := published[name]
+		if !ok {
+			t.Errorf("%s is not published, run with %s=1", name, publishSchemasEnvVar)
+		} else if string(content) != string(encodeSchema(t, schema)) {
+			t.Errorf("%s is compatible with its published schema but outdated, run with %s=1", name, publishSchemasEnvVar)
+		}
+	}
+}
+
+func envelopeJSON(t *testing.T, envelope BLEnvelope) []byte {
+	t.Helper()
+	encoded, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	return encoded
+}
+
+func TestPayloadSchemasAcceptEncodedPayloads(t *testing.T) {
+	actor := BLActor{ID: "{1}", Name: "jane", DisplayName: "Jane Doe"}
+	repo := BLRepo{
+		Slug: "api", Name: "API", ID: "{2}", Link: "https://bitbucket.org/acme/api",
+		Commits: []BLCommit{{ID: "a1", Committer: actor, CommitterTimestamp: time.Now(), ChangedFiles: []BLChangedFile{{Filename: "main.go", ChangeType: "added", Additions: 3}}}},
+		Prs: []BLPullRequest{{
+			ID: 1, Title: "Login", Author: actor, Reviewers: []BLActor{actor}, CreatedDate: time.Now(), UpdatedDate: time.Now(),
+			ActivityInfo: []BLActivityInfo{{ID: "1", Type: "approval", Actor: actor, UpdatedAt: time.Now(), AdditionalParam1: BLAdditionalParam1{Reviewer: actor}}},
+		}},
+	}
+	newEnvelope := func(payloadType string, data, pullError interface{}) BLEnvelope {
+		return BLEnvelope{SchemaVersion: PayloadSchemaVersion, OrgCode: "org", Service: "BitbucketCloud", Type: payloadType, RunID: "run", SentAt: time.Now(), Data: data, Error: pullError}
+	}
+
+	for _, envelope := range []BLEnvelope{
+		newEnvelope(PayloadTypeRepoPull, []BLRepo{{Slug: "api"}}, nil),
+		newEnvelope(PayloadTypeActivityPull, BLData{Repos: []BLRepo{repo}, WorkspaceKey: "acme"}, nil),
+		newEnvelope(PayloadTypePullError, nil, BLRepoError{RepoID: "api", PrErrors: []BLPrError{{PrID: 1, CommitFetchError: "timeout"}}}),
+		newEnvelope(PayloadTypePullError, nil, &BLRootErrorPayload{TokenErrors: []BLTokenError{{TokenID: "t1", PreviousStatus: "active", Status: "revoked"}}}),
+		newEnvelope(PayloadTypePullError, nil, "failed to get repositories"),
+	} {
+		schema, err := PayloadSchema(envelope.Type)
+		require.NoError(t, err)
+		assert.NoError(t, schema.ValidateJSON(envelopeJSON(t, envelope)), envelope.Type)
+	}
+
+	schema, err := PayloadSchema(PayloadTypePullError)
+	require.NoError(t, err)
+	envelope := newEnvelope(PayloadTypePullError, nil, "failed")
+	envelope.SchemaVersion = PayloadSchemaVersion + 1
+	assert.ErrorContains(t, schema.ValidateJSON(envelopeJSON(t, envelope)), "/schemaVersion: must be")
+	envelope.SchemaVersion = PayloadSchemaVersion
+	envelope.Error = nil
+	assert.ErrorContains(t, schema.ValidateJSON(envelopeJSON(t, envelope)), `missing required property "error"`)
+
+	_, err = PayloadSchema("unknown")
+	assert.Error(t, err)
+}
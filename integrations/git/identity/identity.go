@@ -0,0 +1,296 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+)
+
+type AliasKind string
+
+const (
+	AliasKindAccountID   AliasKind = "account_id"
+	AliasKindEmail       AliasKind = "email"
+	AliasKindDisplayName AliasKind = "display_name"
+)
+
+type AliasSource string
+
+const (
+	// AliasSourceObserved aliases are learned from the data of the git provider.
+	AliasSourceObserved AliasSource = "observed"
+	// AliasSourceOverride aliases come from the alias overrides file and always win over observed ones.
+	AliasSourceOverride AliasSource = "override"
+)
+
+// Observation is an actor as reported by a git provider. Any field may be empty.
+type Observation struct {
+	AccountID   string
+	DisplayName string
+	Email       string
+}
+
+// ParseRawAuthor splits a git author string such as "Jane Doe <jane@example.com>" into its name and email.
+func ParseRawAuthor(raw string) (name, email string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ""
+	}
+	// git does not enforce RFC 5322, so the name is taken verbatim instead of parsing it as a mail address
+	start, end := strings.LastIndex(raw, "<"), strings.LastIndex(raw, ">")
+	if start >= 0 && end > start {
+		return strings.Trim(strings.TrimSpace(raw[:start]), `"`), strings.TrimSpace(raw[start+1 : end])
+	}
+	if strings.Contains(raw, "@") && !strings.ContainsAny(raw, " \t") {
+		return "", raw
+	}
+	return raw, ""
+}
+
+// Resolver maps the actors observed in git data to canonical identities stored in SQLite, so one person is reported
+// with the same actor no matter whether a commit, a pull request or a review is seen, or which email was used.
+type Resolver struct {
+	logger    *shared.CustomLogger
+	dbQuerier dbgen.Querier
+	mu        sync.Mutex
+}
+
+func NewResolver(logger *shared.CustomLogger, dbQuerier dbgen.Querier) *Resolver {
+	return &Resolver{logger: logger, dbQuerier: dbQuerier}
+}
+
+// Resolve returns the canonical actor of the observation. Identities linked by the observation, e.g. an email
+// identity and an account identity seen on the same commit, are merged unless overrides keep them apart. Two
+// accounts are never merged, an email seen with both keeps resolving to the account it was first seen with.
+func (r *Resolver) Resolve(observation Observation) (gitdtos.BLActor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	observation = normalizeObservation(observation)
+	keys := observationKeys(observation)
+	if len(keys) == 0 {
+		return gitdtos.BLActor{}, nil
+	}
+
+	aliases := make([]dbgen.IdentityAlias, 0, len(keys))
+	for _, key := range keys {
+		alias, err := r.dbQuerier.GetIdentityAlias(context.Background(), dbgen.GetIdentityAliasParams{Kind: string(key.kind), Value: key.value})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return gitdtos.BLActor{}, fmt.Errorf("error getting identity alias: %w", err)
+		}
+		// display names are ambiguous, only an explicit override may resolve one
+		if key.kind == AliasKindDisplayName && alias.Source != string(AliasSourceOverride) {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+
+	identityID := primaryIdentityID(observation, aliases)
+	if identityID == "" {
+		identityID = newIdentityID(observation)
+		if _, err := r.dbQuerier.UpsertIdentity(context.Background(), dbgen.UpsertIdentityParams{
+			ID:          identityID,
+			DisplayName: observation.DisplayName,
+			Email:       observation.Email,
+		}); err != nil {
+			return gitdtos.BLActor{}, fmt.Errorf("error creating identity: %w", err)
+		}
+	}
+
+	// identities that are not merged keep their aliases, the observation does not take them over
+	keptApart := map[string]bool{}
+	for _, alias := range aliases {
+		if alias.IdentityID == identityID || keptApart[alias.IdentityID] {
+			continue
+		}
+		merged, err := r.mergeIdentity(alias.IdentityID, identityID)
+		if err != nil {
+			return gitdtos.BLActor{}, err
+		}
+		keptApart[alias.IdentityID] = !merged
+	}
+
+	for _, key := range keys {
+		if key.kind == AliasKindDisplayName {
+			continue
+		}
+		if err := r.recordObservedAlias(key, identityID, keptApart); err != nil {
+			return gitdtos.BLActor{}, err
+		}
+	}
+
+	identity, err := r.dbQuerier.GetIdentity(context.Background(), identityID)
+	if err != nil {
+		return gitdtos.BLActor{}, fmt.Errorf("error getting identity: %s: %w", identityID, err)
+	}
+	if (identity.DisplayName == "" && observation.DisplayName != "") || (identity.Email == "" && observation.Email != "") {
+		identity, err = r.dbQuerier.UpsertIdentity(context.Background(), dbgen.UpsertIdentityParams{
+			ID:          identity.ID,
+			DisplayName: firstNonEmpty(identity.DisplayName, observation.DisplayName),
+			Email:       firstNonEmpty(identity.Email, observation.Email),
+		})
+		if err != nil {
+			return gitdtos.BLActor{}, fmt.Errorf("error completing identity: %s: %w", identityID, err)
+		}
+	}
+
+	return gitdtos.BLActor{
+		ID:           identity.ID,
+		Name:         identity.DisplayName,
+		DisplayName:  identity.DisplayName,
+		EmailAddress: identity.Email,
+	}, nil
+}
+
+// mergeIdentity moves every alias of the source identity to the target identity and drops the source identity.
+// Identities defined by overrides and account identities are never merged away, so two accounts sharing an email
+// stay apart. It reports whether the identities were merged.
+func (r *Resolver) mergeIdentity(sourceIdentityID, targetIdentityID string) (bool, error) {
+	overrideCount, err := r.dbQuerier.CountIdentityAliasesBySource(context.Background(), dbgen.CountIdentityAliasesBySourceParams{
+		IdentityID: sourceIdentityID,
+		Source:     string(AliasSourceOverride),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error counting override aliases of identity: %s: %w", sourceIdentityID, err)
+	}
+	if overrideCount > 0 {
+		r.logger.Warn("Observed actor links two identities but one of them is defined by overrides. Keeping them apart",
+			"identity", sourceIdentityID, "resolvedIdentity", targetIdentityID)
+		return false, nil
+	}
+
+	accountCount, err := r.dbQuerier.CountIdentityAliasesByKind(context.Background(), dbgen.CountIdentityAliasesByKindParams{
+		IdentityID: sourceIdentityID,
+		Kind:       string(AliasKindAccountID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error counting account aliases of identity: %s: %w", sourceIdentityID, err)
+	}
+	if accountCount > 0 {
+		r.logger.Warn("Observed actor shares an alias with another account. Keeping the accounts apart, the shared alias stays ambiguous",
+			"identity", sourceIdentityID, "resolvedIdentity", targetIdentityID)
+		return false, nil
+	}
+
+	r.logger.Info("Merging identities", "identity", sourceIdentityID, "into", targetIdentityID)
+	if err := r.dbQuerier.ReassignIdentityAliases(context.Background(), dbgen.ReassignIdentityAliasesParams{
+		NewIdentityID: targetIdentityID,
+		IdentityID:    sourceIdentityID,
+	}); err != nil {
+		return false, fmt.Errorf("error reassigning aliases of identity: %s: %w", sourceIdentityID, err)
+	}
+	if err := r.dbQuerier.DeleteIdentity(context.Background(), sourceIdentityID); err != nil {
+		return false, fmt.Errorf("error deleting merged identity: %s: %w", sourceIdentityID, err)
+	}
+	return true, nil
+}
+
+// recordObservedAlias points the alias at the identity, unless it is an override or belongs to an identity kept
+// apart from it.
+func (r *Resolver) recordObservedAlias(key aliasKey, identityID string, keptApart map[string]bool) error {
+	alias, err := r.dbQuerier.GetIdentityAlias(context.Background(), dbgen.GetIdentityAliasParams{Kind: string(key.kind), Value: key.value})
+	if err == nil && (alias.IdentityID == identityID || alias.Source == string(AliasSourceOverride) || keptApart[alias.IdentityID]) {
+		return nil
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error getting identity alias: %w", err)
+	}
+
+	if err := r.dbQuerier.UpsertIdentityAlias(context.Background(), dbgen.UpsertIdentityAliasParams{
+		Kind:       string(key.kind),
+		Value:      key.value,
+		IdentityID: identityID,
+		Source:     string(AliasSourceObserved),
+	}); err != nil {
+		return fmt.Errorf("error recording identity alias: %w", err)
+	}
+	return nil
+}
+
+type aliasKey struct {
+	kind  AliasKind
+	value string
+}
+
+// observationKeys returns the alias keys of the observation, strongest first.
+func observationKeys(observation Observation) []aliasKey {
+	keys := []aliasKey{}
+	if observation.AccountID != "" {
+		keys = append(keys, aliasKey{AliasKindAccountID, observation.AccountID})
+	}
+	if observation.Email != "" {
+		keys = append(keys, aliasKey{AliasKindEmail, observation.Email})
+	}
+	if observation.DisplayName != "" {
+		keys = append(keys, aliasKey{AliasKindDisplayName, normalizeDisplayName(observation.DisplayName)})
+	}
+	return keys
+}
+
+// primaryIdentityID picks the identity the observation resolves to. Overrides win, then the strongest observed key.
+// An empty ID means a new identity is needed, which is also the case for a new account so that the identities
+// already known by email are merged into the account rather than the other way around.
+func primaryIdentityID(observation Observation, aliases []dbgen.IdentityAlias) string {
+	for _, alias := range aliases {
+		if alias.Source == string(AliasSourceOverride) {
+			return alias.IdentityID
+		}
+	}
+	if len(aliases) > 0 && (observation.AccountID == "" || aliases[0].Kind == string(AliasKindAccountID)) {
+		return aliases[0].IdentityID
+	}
+	return ""
+}
+
+// newIdentityID keeps the account ID of the git provider as identity ID so actors stay stable for the relay.
+// Authors without an account get an ID derived from their email, or their name as a last resort.
+func newIdentityID(observation Observation) string {
+	switch {
+	case observation.AccountID != "":
+		return observation.AccountID
+	case observation.Email != "":
+		return "email:" + shortHash(observation.Email)
+	default:
+		return "name:" + shortHash(normalizeDisplayName(observation.DisplayName))
+	}
+}
+
+func normalizeObservation(observation Observation) Observation {
+	return Observation{
+		AccountID:   strings.TrimSpace(observation.AccountID),
+		DisplayName: strings.TrimSpace(observation.DisplayName),
+		Email:       normalizeEmail(observation.Email),
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func normalizeDisplayName(displayName string) string {
+	return strings.ToLower(strings.Join(strings.Fields(displayName), " "))
+}
+
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluelock-go/shared"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+	"github.com/bluelock-go/testing/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResolver(t *testing.T) (*Resolver, dbgen.Querier) {
+	dbQuerier := dbgen.New(testdb.Open(t))
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	return NewResolver(logger, dbQuerier), dbQuerier
+}
+
+func TestParseRawAuthor(t *testing.T) {
+	tests := []struct {
+		raw, name, email string
+	}{
+		{"Jane Doe <jane@example.com>", "Jane Doe", "jane@example.com"},
+		{"<jane@example.com>", "", "jane@example.com"},
+		{"jane@example.com", "", "jane@example.com"},
+		{"Jane (CI) Doe <jane@localhost>", "Jane (CI) Doe", "jane@localhost"},
+		{"\"Doe, Jane\" <jane@example.com>", "Doe, Jane", "jane@example.com"},
+		{"build bot", "build bot", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		name, email := ParseRawAuthor(tt.raw)
+		assert.Equal(t, tt.name, name, tt.raw)
+		assert.Equal(t, tt.email, email, tt.raw)
+	}
+}
+
+func TestResolveMergesEmailIdentityIntoAccount(t *testing.T) {
+	resolver, _ := newTestResolver(t)
+
+	unlinked, err := resolver.Resolve(Observation{DisplayName: "Jane Doe", Email: "Jane@Example.com"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, unlinked.ID, "unlinked authors still get an ID")
+	assert.Equal(t, "jane@example.com", unlinked.EmailAddress)
+
+	again, err := resolver.Resolve(Observation{Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, unlinked, again, "the same email resolves to the same identity")
+
+	linked, err := resolver.Resolve(Observation{AccountID: "acc-1", DisplayName: "Jane Doe", Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "acc-1", linked.ID)
+	assert.Equal(t, "jane@example.com", linked.EmailAddress)
+
+	byEmail, err := resolver.Resolve(Observation{Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "acc-1", byEmail.ID, "the email identity is merged into the account")
+
+	byAccount, err := resolver.Resolve(Observation{AccountID: "acc-1", DisplayName: "Jane Doe"})
+	require.NoError(t, err)
+	assert.Equal(t, linked, byAccount, "reviews without email resolve to the same actor")
+}
+
+func TestResolveKeepsAccountsSharingAnEmailApart(t *testing.T) {
+	resolver, dbQuerier := newTestResolver(t)
+
+	first, err := resolver.Resolve(Observation{AccountID: "acc-1", DisplayName: "Build Bot", Email: "ci@example.com"})
+	require.NoError(t, err)
+	second, err := resolver.Resolve(Observation{AccountID: "acc-2", DisplayName: "Release Bot", Email: "ci@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "acc-1", first.ID)
+	assert.Equal(t, "acc-2", second.ID, "an account is not merged into another one sharing its email")
+
+	for _, accountID := range []string{"acc-1", "acc-2"} {
+		_, err := dbQuerier.GetIdentity(context.Background(), accountID)
+		assert.NoError(t, err, accountID)
+		actor, err := resolver.Resolve(Observation{AccountID: accountID})
+		require.NoError(t, err)
+		assert.Equal(t, accountID, actor.ID)
+	}
+	byEmail, err := resolver.Resolve(Observation{Email: "ci@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "acc-1", byEmail.ID, "the shared email stays with the account it was first seen with")
+}
+
+func TestResolveIgnoresObservedDisplayNames(t *testing.T) {
+	resolver, _ := newTestResolver(t)
+
+	first, err := resolver.Resolve(Observation{DisplayName: "Alex", Email: "alex@one.example"})
+	require.NoError(t, err)
+	second, err := resolver.Resolve(Observation{DisplayName: "Alex", Email: "alex@two.example"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID, "a shared display name alone does not merge people")
+}
+
+func TestApplyOverrides(t *testing.T) {
+	resolver, dbQuerier := newTestResolver(t)
+
+	observed, err := resolver.Resolve(Observation{Email: "jane@personal.example.org"})
+	require.NoError(t, err)
+
+	require.NoError(t, resolver.ApplyOverrides(AliasOverrides{Identities: []IdentityOverride{{
+		ID:           "jane-doe",
+		DisplayName:  "Jane Doe",
+		Email:        "jane.doe@example.com",
+		Emails:       []string{"Jane@Personal.example.org"},
+		AccountIDs:   []string{"acc-1"},
+		DisplayNames: []string{"jdoe"},
+	}}}))
+	_, err = dbQuerier.GetIdentity(context.Background(), observed.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "observed identities without aliases are dropped")
+
+	expected := Observation{AccountID: "jane-doe", DisplayName: "Jane Doe", Email: "jane.doe@example.com"}
+	for _, observation := range []Observation{
+		{Email: "jane@personal.example.org"},
+		{AccountID: "acc-1", DisplayName: "Jane D."},
+		{DisplayName: "JDoe"},
+	} {
+		actor, err := resolver.Resolve(observation)
+		require.NoError(t, err)
+		assert.Equal(t, expected, Observation{AccountID: actor.ID, DisplayName: actor.DisplayName, Email: actor.EmailAddress}, observation)
+	}
+
+	other, err := resolver.Resolve(Observation{AccountID: "acc-2", Email: "jane.doe@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "jane-doe", other.ID, "overrides win over the account of the observation")
+	account, err := dbQuerier.GetIdentityAlias(context.Background(), dbgen.GetIdentityAliasParams{Kind: string(AliasKindAccountID), Value: "acc-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "jane-doe", account.IdentityID)
+
+	require.NoError(t, resolver.ApplyOverrides(AliasOverrides{}))
+	alias, err := dbQuerier.GetIdentityAlias(context.Background(), dbgen.GetIdentityAliasParams{Kind: string(AliasKindDisplayName), Value: "jdoe"})
+	assert.ErrorIs(t, err, sql.ErrNoRows, "removed overrides are dropped, got %v", alias)
+}
+
+func TestAliasOverridesValidate(t *testing.T) {
+	assert.Error(t, AliasOverrides{Identities: []IdentityOverride{{DisplayName: "No ID"}}}.Validate())
+	assert.Error(t, AliasOverrides{Identities: []IdentityOverride{{ID: "a"}, {ID: "a"}}}.Validate())
+	assert.Error(t, AliasOverrides{Identities: []IdentityOverride{
+		{ID: "a", Email: "same@example.com"},
+		{ID: "b", Emails: []string{"Same@example.com"}},
+	}}.Validate())
+	assert.NoError(t, AliasOverrides{Identities: []IdentityOverride{{ID: "a", Email: "a@example.com", Emails: []string{"a@example.com"}}}}.Validate())
+
+	overrides, err := LoadAliasOverrides(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, overrides.Identities)
+}
@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/database/dbsetup"
+	dbgen "github.com/bluelock-go/shared/database/generated"
+)
+
+// AliasOverrides is the content of the alias overrides file. It pins actors to a canonical identity, for example
+// to merge the work and personal emails of one person or to split two people sharing a display name.
+type AliasOverrides struct {
+	Identities []IdentityOverride `json:"identities"`
+}
+
+type IdentityOverride struct {
+	ID           string   `json:"id"`
+	DisplayName  string   `json:"displayName"`
+	Email        string   `json:"email"`
+	Emails       []string `json:"emails"`
+	AccountIDs   []string `json:"accountIds"`
+	DisplayNames []string `json:"displayNames"`
+}
+
+// LoadAliasOverrides reads the alias overrides file. A missing file means there are no overrides.
+func LoadAliasOverrides(filePath string) (AliasOverrides, error) {
+	overrides := AliasOverrides{}
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	} else if err != nil {
+		return overrides, fmt.Errorf("failed to read alias overrides file: %w", err)
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("failed to parse alias overrides file: %w", err)
+	}
+	if err := overrides.Validate(); err != nil {
+		return overrides, fmt.Errorf("invalid alias overrides file: %w", err)
+	}
+	return overrides, nil
+}
+
+// Validate makes sure every identity has an ID and no alias is claimed by two identities.
+func (ao AliasOverrides) Validate() error {
+	identityIDs := map[string]bool{}
+	claimedBy := map[aliasKey]string{}
+	for i, identityOverride := range ao.Identities {
+		if identityOverride.ID == "" {
+			return fmt.Errorf("identities[%d]: id is required", i)
+		}
+		if identityIDs[identityOverride.ID] {
+			return fmt.Errorf("identities[%d]: duplicate id %s", i, identityOverride.ID)
+		}
+		identityIDs[identityOverride.ID] = true
+
+		for _, key := range identityOverride.aliasKeys() {
+			if owner, ok := claimedBy[key]; ok {
+				return fmt.Errorf("identities[%d]: %s %s is already an alias of %s", i, key.kind, key.value, owner)
+			}
+			claimedBy[key] = identityOverride.ID
+		}
+	}
+	return nil
+}
+
+func (override IdentityOverride) aliasKeys() []aliasKey {
+	keys := []aliasKey{}
+	emails := append([]string{override.Email}, override.Emails...)
+	for _, email := range emails {
+		if email = normalizeEmail(email); email != "" && !containsAliasKey(keys, aliasKey{AliasKindEmail, email}) {
+			keys = append(keys, aliasKey{AliasKindEmail, email})
+		}
+	}
+	for _, accountID := range override.AccountIDs {
+		if accountID != "" {
+			keys = append(keys, aliasKey{AliasKindAccountID, accountID})
+		}
+	}
+	for _, displayName := range override.DisplayNames {
+		if displayName = normalizeDisplayName(displayName); displayName != "" {
+			keys = append(keys, aliasKey{AliasKindDisplayName, displayName})
+		}
+	}
+	return keys
+}
+
+func containsAliasKey(keys []aliasKey, key aliasKey) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyOverrides replaces the override aliases stored in the identity table with the given overrides.
+// Observed identities that lose every alias to an override are dropped.
+func (r *Resolver) ApplyOverrides(overrides AliasOverrides) error {
+	if err := overrides.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx := context.Background()
+	if err := r.dbQuerier.DeleteIdentityAliasesBySource(ctx, string(AliasSourceOverride)); err != nil {
+		return fmt.Errorf("error deleting previous override aliases: %w", err)
+	}
+	for _, identityOverride := range overrides.Identities {
+		if _, err := r.dbQuerier.UpsertIdentity(ctx, dbgen.UpsertIdentityParams{
+			ID:          identityOverride.ID,
+			DisplayName: identityOverride.DisplayName,
+			Email:       normalizeEmail(identityOverride.Email),
+		}); err != nil {
+			return fmt.Errorf("error upserting override identity: %s: %w", identityOverride.ID, err)
+		}
+		for _, key := range identityOverride.aliasKeys() {
+			if err := r.dbQuerier.UpsertIdentityAlias(ctx, dbgen.UpsertIdentityAliasParams{
+				Kind:       string(key.kind),
+				Value:      key.value,
+				IdentityID: identityOverride.ID,
+				Source:     string(AliasSourceOverride),
+			}); err != nil {
+				return fmt.Errorf("error upserting override alias of identity: %s: %w", identityOverride.ID, err)
+			}
+		}
+	}
+	if err := r.dbQuerier.DeleteOrphanIdentities(ctx); err != nil {
+		return fmt.Errorf("error deleting orphan identities: %w", err)
+	}
+	r.logger.Info("Identity alias overrides applied", "identities", len(overrides.Identities))
+	return nil
+}
+
+var resolver *Resolver
+
+// InitializeResolver creates the identity resolver and applies the alias overrides file to the identity table.
+func InitializeResolver(aliasOverridesFilePath string) error {
+	if resolver != nil {
+		return fmt.Errorf("identity resolver already initialized")
+	}
+
+	overrides, err := LoadAliasOverrides(aliasOverridesFilePath)
+	if err != nil {
+		return err
+	}
+	newResolver := NewResolver(shared.AcquireCustomLogger(), dbsetup.AcquireQuerier())
+	if err := newResolver.ApplyOverrides(overrides); err != nil {
+		return fmt.Errorf("failed to apply alias overrides: %w", err)
+	}
+	resolver = newResolver
+	return nil
+}
+
+func AcquireResolver() *Resolver {
+	if resolver == nil {
+		panic("identity resolver not initialized, call InitializeResolver first")
+	}
+	return resolver
+}
@@ -1,6 +1,7 @@
 package integrations
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bluelock-go/config"
@@ -17,6 +18,10 @@ type Integrator interface {
 	GetConfig() *config.Config
 	// GetCredentials returns the credentials of the integrator.
 	GetCredentials() []auth.Credential
+	// ReloadCredentials swaps in reloaded credentials while the integrator runs.
+	ReloadCredentials(credentials []auth.Credential) error
+	// WatchTokenHealth probes the unauthorized tokens until ctx is done, restoring the ones that work again.
+	WatchTokenHealth(ctx context.Context)
 	// GetStateManager returns the state manager of the integrator.
 	GetStateManager() *statemanager.StateManager
 	// ValidateEnvVariables validates the environment variables for the integrator.
@@ -0,0 +1,98 @@
+package privacy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared"
+)
+
+// Log attribute keys whose values are redacted like the matching relayed field.
+const (
+	LogKeyActorEmail    = "actorEmail"
+	LogKeyActorName     = "actorName"
+	LogKeyCommitMessage = "commitMessage"
+	LogKeyPrTitle       = "prTitle"
+	LogKeyPrDescription = "prDescription"
+)
+
+var logKeyRedactions = map[string]func(r *Redactor, value string) string{
+	LogKeyActorEmail:    (*Redactor).ActorEmail,
+	"email":             (*Redactor).ActorEmail,
+	"emailAddress":      (*Redactor).ActorEmail,
+	LogKeyActorName:     (*Redactor).ActorName,
+	"displayName":       (*Redactor).ActorName,
+	"authorName":        (*Redactor).ActorName,
+	LogKeyCommitMessage: (*Redactor).CommitMessage,
+	LogKeyPrTitle:       (*Redactor).PrTitle,
+	LogKeyPrDescription: (*Redactor).PrDescription,
+}
+
+// LogHandler redacts the personal fields of log records before passing them to the wrapped handler.
+// Attributes are matched by key, and gitdtos values are redacted like a relay payload.
+type LogHandler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+func NewLogHandler(next slog.Handler, redactor *Redactor) *LogHandler {
+	return &LogHandler{next, redactor}
+}
+
+func (h *LogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redactedAttrs[i] = h.redactAttr(attr)
+	}
+	return &LogHandler{h.next.WithAttrs(redactedAttrs), h.redactor}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{h.next.WithGroup(name), h.redactor}
+}
+
+func (h *LogHandler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		groupAttrs := value.Group()
+		redactedAttrs := make([]slog.Attr, len(groupAttrs))
+		for i, groupAttr := range groupAttrs {
+			redactedAttrs[i] = h.redactAttr(groupAttr)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redactedAttrs...)}
+	case slog.KindString:
+		if redact, ok := logKeyRedactions[attr.Key]; ok {
+			return slog.String(attr.Key, redact(h.redactor, value.String()))
+		}
+	case slog.KindAny:
+		switch value.Any().(type) {
+		case gitdtos.BLData, *gitdtos.BLData, []gitdtos.BLRepo, gitdtos.BLRepo, gitdtos.BLPullRequest, []gitdtos.BLCommit, gitdtos.BLCommit, gitdtos.BLActor:
+			return slog.Any(attr.Key, h.redactor.Payload(value.Any()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// RedactLogger makes every user of the logger go through the redactor. Call it once the configuration is loaded,
+// before the services start logging.
+func RedactLogger(logger *shared.CustomLogger, redactor *Redactor) {
+	if redactor.IsNoop() {
+		return
+	}
+	logger.Logger = slog.New(NewLogHandler(logger.Handler(), redactor))
+}
@@ -0,0 +1,197 @@
+package privacy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared/di"
+)
+
+// Redactor applies the privacy policies of the configuration to the personal fields of the relayed data.
+type Redactor struct {
+	policy config.Privacy
+	salt   string
+}
+
+func NewRedactor(policy config.Privacy, salt string) *Redactor {
+	return &Redactor{policy, salt}
+}
+
+// IsNoop reports whether every field is kept as is.
+func (r *Redactor) IsNoop() bool {
+	for _, fieldPolicy := range []config.FieldPolicy{r.policy.ActorEmail, r.policy.ActorName, r.policy.CommitMessage, r.policy.PrTitle, r.policy.PrDescription} {
+		if fieldPolicy.Action != "" && fieldPolicy.Action != config.PrivacyActionKeep {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Redactor) apply(fieldPolicy config.FieldPolicy, value string) string {
+	if value == "" {
+		return value
+	}
+	switch fieldPolicy.Action {
+	case config.PrivacyActionDrop:
+		return ""
+	case config.PrivacyActionHash:
+		return r.hash(value)
+	case config.PrivacyActionTruncate:
+		if runes := []rune(value); len(runes) > fieldPolicy.MaxLength {
+			return string(runes[:fieldPolicy.MaxLength])
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+func (r *Redactor) hash(value string) string {
+	sum := sha256.Sum256([]byte(r.salt + value))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Redactor) ActorEmail(email string) string {
+	return r.apply(r.policy.ActorEmail, email)
+}
+
+func (r *Redactor) ActorName(name string) string {
+	return r.apply(r.policy.ActorName, name)
+}
+
+func (r *Redactor) CommitMessage(message string) string {
+	return r.apply(r.policy.CommitMessage, message)
+}
+
+func (r *Redactor) PrTitle(title string) string {
+	return r.apply(r.policy.PrTitle, title)
+}
+
+func (r *Redactor) PrDescription(description string) string {
+	return r.apply(r.policy.PrDescription, description)
+}
+
+// Actor returns a redacted copy of the actor. Identities of authors without a git provider account are derived from
+// their email or name with an unsalted hash, so their ID is re-hashed with the salt whenever that field is not kept,
+// truncated included.
+func (r *Redactor) Actor(actor gitdtos.BLActor) gitdtos.BLActor {
+	switch {
+	case strings.HasPrefix(actor.ID, "email:") && r.redacts(r.policy.ActorEmail):
+		actor.ID = "email:" + r.hash(actor.ID)
+	case strings.HasPrefix(actor.ID, "name:") && r.redacts(r.policy.ActorName):
+		actor.ID = "name:" + r.hash(actor.ID)
+	}
+	actor.Name = r.ActorName(actor.Name)
+	actor.DisplayName = r.ActorName(actor.DisplayName)
+	actor.EmailAddress = r.ActorEmail(actor.EmailAddress)
+	return actor
+}
+
+func (r *Redactor) redacts(fieldPolicy config.FieldPolicy) bool {
+	return fieldPolicy.Action != "" && fieldPolicy.Action != config.PrivacyActionKeep
+}
+
+func (r *Redactor) Commit(commit gitdtos.BLCommit) gitdtos.BLCommit {
+	commit.Message = r.CommitMessage(commit.Message)
+	commit.Committer = r.Actor(commit.Committer)
+	return commit
+}
+
+func (r *Redactor) Commits(commits []gitdtos.BLCommit) []gitdtos.BLCommit {
+	if commits == nil {
+		return nil
+	}
+	redacted := make([]gitdtos.BLCommit, len(commits))
+	for i, commit := range commits {
+		redacted[i] = r.Commit(commit)
+	}
+	return redacted
+}
+
+func (r *Redactor) PullRequest(pullRequest gitdtos.BLPullRequest) gitdtos.BLPullRequest {
+	pullRequest.Title = r.PrTitle(pullRequest.Title)
+	pullRequest.Description = r.PrDescription(pullRequest.Description)
+	pullRequest.Author = r.Actor(pullRequest.Author)
+	if pullRequest.Reviewers != nil {
+		reviewers := make([]gitdtos.BLActor, len(pullRequest.Reviewers))
+		for i, reviewer := range pullRequest.Reviewers {
+			reviewers[i] = r.Actor(reviewer)
+		}
+		pullRequest.Reviewers = reviewers
+	}
+	if pullRequest.ActivityInfo != nil {
+		activities := make([]gitdtos.BLActivityInfo, len(pullRequest.ActivityInfo))
+		for i, activity := range pullRequest.ActivityInfo {
+			activity.Actor = r.Actor(activity.Actor)
+			activities[i] = activity
+		}
+		pullRequest.ActivityInfo = activities
+	}
+	pullRequest.PrCommits = r.Commits(pullRequest.PrCommits)
+	return pullRequest
+}
+
+func (r *Redactor) Repo(repo gitdtos.BLRepo) gitdtos.BLRepo {
+	repo.Commits = r.Commits(repo.Commits)
+	if repo.Prs != nil {
+		pullRequests := make([]gitdtos.BLPullRequest, len(repo.Prs))
+		for i, pullRequest := range repo.Prs {
+			pullRequests[i] = r.PullRequest(pullRequest)
+		}
+		repo.Prs = pullRequests
+	}
+	return repo
+}
+
+func (r *Redactor) Repos(repos []gitdtos.BLRepo) []gitdtos.BLRepo {
+	if repos == nil {
+		return nil
+	}
+	redacted := make([]gitdtos.BLRepo, len(repos))
+	for i, repo := range repos {
+		redacted[i] = r.Repo(repo)
+	}
+	return redacted
+}
+
+// Payload returns a redacted copy of a relay payload. Payloads without personal fields are returned unchanged.
+func (r *Redactor) Payload(payload interface{}) interface{} {
+	switch data := payload.(type) {
+	case gitdtos.BLData:
+		data.Repos = r.Repos(data.Repos)
+		return data
+	case *gitdtos.BLData:
+		if data == nil {
+			return data
+		}
+		redacted := *data
+		redacted.Repos = r.Repos(data.Repos)
+		return &redacted
+	case []gitdtos.BLRepo:
+		return r.Repos(data)
+	case gitdtos.BLRepo:
+		return r.Repo(data)
+	case gitdtos.BLPullRequest:
+		return r.PullRequest(data)
+	case []gitdtos.BLCommit:
+		return r.Commits(data)
+	case gitdtos.BLCommit:
+		return r.Commit(data)
+	case gitdtos.BLActor:
+		return r.Actor(data)
+	default:
+		return payload
+	}
+}
+
+var redactor = di.NewThreadSafeSingleton(func() *Redactor {
+	cfg := config.AcquireConfig()
+	return NewRedactor(cfg.Privacy, cfg.Secrets.PrivacyHashSalt)
+})
+
+func AcquireRedactor() *Redactor {
+	return redactor.Acquire()
+}
@@ -0,0 +1,120 @@
+package privacy
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedactor() *Redactor {
+	return NewRedactor(config.Privacy{
+		ActorEmail:    config.FieldPolicy{Action: config.PrivacyActionHash},
+		ActorName:     config.FieldPolicy{Action: config.PrivacyActionDrop},
+		CommitMessage: config.FieldPolicy{Action: config.PrivacyActionTruncate, MaxLength: 5},
+		PrTitle:       config.FieldPolicy{Action: config.PrivacyActionKeep},
+	}, "org-salt")
+}
+
+func TestRedactorFieldActions(t *testing.T) {
+	redactor := newTestRedactor()
+
+	hashed := redactor.ActorEmail("jane@example.com")
+	assert.Len(t, hashed, 64)
+	assert.Equal(t, hashed, redactor.ActorEmail("jane@example.com"), "hashing is deterministic")
+	assert.NotEqual(t, hashed, NewRedactor(redactor.policy, "other-salt").ActorEmail("jane@example.com"), "hashing is salted")
+	assert.Empty(t, redactor.ActorName("Jane Doe"))
+	assert.Equal(t, "Fix é", redactor.CommitMessage("Fix é in the parser"), "truncation counts characters")
+	assert.Equal(t, "Fix", redactor.CommitMessage("Fix"))
+	assert.Equal(t, "Add login", redactor.PrTitle("Add login"))
+	assert.Equal(t, "Details", redactor.PrDescription("Details"), "an empty action keeps the field")
+	assert.Empty(t, redactor.ActorEmail(""), "empty values are not hashed")
+
+	assert.False(t, redactor.IsNoop())
+	assert.True(t, NewRedactor(config.Privacy{ActorEmail: config.FieldPolicy{Action: config.PrivacyActionKeep}}, "").IsNoop())
+}
+
+func TestRedactorPayloadDoesNotModifyTheOriginal(t *testing.T) {
+	redactor := newTestRedactor()
+	jane := gitdtos.BLActor{ID: "acc-1", Name: "Jane Doe", DisplayName: "Jane Doe", EmailAddress: "jane@example.com"}
+	unlinked := gitdtos.BLActor{ID: "email:0123456789abcdef", EmailAddress: "john@example.com"}
+	data := gitdtos.BLData{Repos: []gitdtos.BLRepo{{
+		Slug:    "api",
+		Commits: []gitdtos.BLCommit{{ID: "c1", Message: "Initial commit", Committer: unlinked}},
+		Prs: []gitdtos.BLPullRequest{{
+			Title:        "Add login",
+			Description:  "Details",
+			Author:       jane,
+			Reviewers:    []gitdtos.BLActor{jane},
+			ActivityInfo: []gitdtos.BLActivityInfo{{Actor: jane}},
+			PrCommits:    []gitdtos.BLCommit{{ID: "c2", Message: "Login", Committer: jane}},
+		}},
+	}}}
+
+	redacted, ok := redactor.Payload(data).(gitdtos.BLData)
+	require.True(t, ok)
+	repo := redacted.Repos[0]
+	assert.Equal(t, "Initi", repo.Commits[0].Message)
+	assert.NotEqual(t, unlinked.ID, repo.Commits[0].Committer.ID, "IDs derived from emails are re-hashed")
+	assert.True(t, strings.HasPrefix(repo.Commits[0].Committer.ID, "email:"))
+	pullRequest := repo.Prs[0]
+	assert.Equal(t, "Add login", pullRequest.Title)
+	for _, actor := range []gitdtos.BLActor{pullRequest.Author, pullRequest.Reviewers[0], pullRequest.ActivityInfo[0].Actor, pullRequest.PrCommits[0].Committer} {
+		assert.Equal(t, "acc-1", actor.ID)
+		assert.Empty(t, actor.DisplayName)
+		assert.Equal(t, redactor.ActorEmail("jane@example.com"), actor.EmailAddress)
+	}
+
+	assert.Equal(t, "Initial commit", data.Repos[0].Commits[0].Message)
+	assert.Equal(t, jane, data.Repos[0].Prs[0].Reviewers[0])
+	assert.Equal(t, "jane@example.com", data.Repos[0].Prs[0].PrCommits[0].Committer.EmailAddress)
+
+	errorPayload := &gitdtos.BLRepoError{RepoID: "api"}
+	assert.Same(t, errorPayload, redactor.Payload(errorPayload), "payloads without personal fields are passed through")
+}
+
+func TestRedactorRehashesDerivedActorIDsUnlessKept(t *testing.T) {
+	emailActor := gitdtos.BLActor{ID: "email:0123456789abcdef", EmailAddress: "john@example.com"}
+	nameActor := gitdtos.BLActor{ID: "name:0123456789abcdef", Name: "John Doe"}
+
+	truncating := NewRedactor(config.Privacy{
+		ActorEmail: config.FieldPolicy{Action: config.PrivacyActionTruncate, MaxLength: 4},
+		ActorName:  config.FieldPolicy{Action: config.PrivacyActionTruncate, MaxLength: 4},
+	}, "org-salt")
+	assert.NotEqual(t, emailActor.ID, truncating.Actor(emailActor).ID, "truncated emails do not keep the unsalted hash")
+	assert.True(t, strings.HasPrefix(truncating.Actor(emailActor).ID, "email:"))
+	assert.NotEqual(t, nameActor.ID, truncating.Actor(nameActor).ID)
+	assert.Equal(t, "john", truncating.Actor(emailActor).EmailAddress)
+
+	keeping := NewRedactor(config.Privacy{
+		ActorEmail:    config.FieldPolicy{Action: config.PrivacyActionKeep},
+		CommitMessage: config.FieldPolicy{Action: config.PrivacyActionDrop},
+	}, "org-salt")
+	assert.Equal(t, emailActor, keeping.Actor(emailActor))
+	assert.Equal(t, nameActor, keeping.Actor(nameActor), "an empty action keeps the field")
+}
+
+func TestLogHandlerRedactsPersonalFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil), newTestRedactor()))
+
+	logger.With("email", "jane@example.com").Info("Resolved actor",
+		LogKeyActorName, "Jane Doe",
+		"repo", "api",
+		slog.Group("commit", LogKeyCommitMessage, "Initial commit"),
+		"actor", gitdtos.BLActor{ID: "acc-1", DisplayName: "Jane Doe"},
+	)
+
+	output := buf.String()
+	assert.NotContains(t, output, "jane@example.com")
+	assert.NotContains(t, output, "Jane Doe")
+	assert.NotContains(t, output, "Initial commit")
+	assert.Contains(t, output, "commit.commitMessage=Initi")
+	assert.Contains(t, output, "repo=api")
+	assert.Contains(t, output, "acc-1")
+}
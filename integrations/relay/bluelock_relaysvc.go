@@ -6,25 +6,50 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
 	"github.com/bluelock-go/shared/di"
+	"github.com/bluelock-go/shared/httptransport"
 )
 
+// BluelockRelayService sends every payload in a gitdtos.BLEnvelope, with the ID of the current job run.
 type BluelockRelayService struct {
-	BaseURL string
-	APIKey  string
+	BaseURL    string
+	APIKey     string
+	orgCode    string
+	service    config.ServiceKey
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	runID string
 }
 
-func NewBluelockRelayService(relayBaseURL string, orgCode string, activeIntegrationService config.ServiceKey, apiKey string) *BluelockRelayService {
+func NewBluelockRelayService(httpClient *http.Client, relayBaseURL string, orgCode string, activeIntegrationService config.ServiceKey, apiKey string) *BluelockRelayService {
 	baseURL := fmt.Sprintf("%s/api/v1/bluelock/%s/%s", relayBaseURL, orgCode, activeIntegrationService)
-	return &BluelockRelayService{baseURL, apiKey}
+	return &BluelockRelayService{BaseURL: baseURL, APIKey: apiKey, orgCode: orgCode, service: activeIntegrationService, httpClient: httpClient}
+}
+
+func (blrsvc *BluelockRelayService) StartRun(runID string) {
+	blrsvc.mu.Lock()
+	defer blrsvc.mu.Unlock()
+	blrsvc.runID = runID
+}
+
+func (blrsvc *BluelockRelayService) EndRun() {
+	blrsvc.StartRun("")
+}
+
+func (blrsvc *BluelockRelayService) envelope(payloadType string) gitdtos.BLEnvelope {
+	blrsvc.mu.Lock()
+	defer blrsvc.mu.Unlock()
+	return newEnvelope(blrsvc.orgCode, blrsvc.service, payloadType, blrsvc.runID)
 }
 
 func (blrsvc *BluelockRelayService) SendCollectedData(payload interface{}, queryParams url.Values) error {
-	dataPayload := map[string]interface{}{
-		"data": payload,
-	}
+	dataPayload := blrsvc.envelope(queryParams.Get("type"))
+	dataPayload.Data = payload
 	jsonPayload, err := json.Marshal(dataPayload)
 	if err != nil {
 		return fmt.Errorf("failed to send collected data: error marshalling data payload: %w", err)
@@ -41,7 +66,7 @@ func (blrsvc *BluelockRelayService) SendCollectedData(payload interface{}, query
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Authorization", "Bearer "+blrsvc.APIKey)
 
-	response, err := http.DefaultClient.Do(request)
+	response, err := blrsvc.httpClient.Do(request)
 	if err != nil {
 		return fmt.Errorf("failed to send collected data: error making request: %w", err)
 	}
@@ -54,9 +79,8 @@ func (blrsvc *BluelockRelayService) SendCollectedData(payload interface{}, query
 }
 
 func (blrsvc *BluelockRelayService) SendPullError(payload interface{}, queryParams url.Values) error {
-	errorPayload := map[string]interface{}{
-		"error": payload,
-	}
+	errorPayload := blrsvc.envelope(gitdtos.PayloadTypePullError)
+	errorPayload.Error = payload
 	jsonPayload, err := json.Marshal(errorPayload)
 	if err != nil {
 		return fmt.Errorf("failed to send pull error: error marshalling error payload: %w", err)
@@ -73,7 +97,7 @@ func (blrsvc *BluelockRelayService) SendPullError(payload interface{}, queryPara
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Authorization", "Bearer "+blrsvc.APIKey)
 
-	response, err := http.DefaultClient.Do(request)
+	response, err := blrsvc.httpClient.Do(request)
 	if err != nil {
 		return fmt.Errorf("failed to send pull error: error making request: %w", err)
 	}
@@ -116,7 +140,7 @@ var bluelockRelayService = di.NewThreadSafeSingleton(func() *BluelockRelayServic
 	apiKey := cfg.Secrets.DDApiKey
 	orgCode := cfg.Common.OrgCode
 	activeIntegrationService := cfg.ActiveService
-	return NewBluelockRelayService(relayBaseURL, orgCode, activeIntegrationService, apiKey)
+	return NewBluelockRelayService(httptransport.AcquireHTTPClient(), relayBaseURL, orgCode, activeIntegrationService, apiKey)
 })
 
 func AcquireBluelockRelayService() *BluelockRelayService {
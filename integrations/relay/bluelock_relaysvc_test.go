@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBluelockRelayServiceSendsWithItsHTTPClient(t *testing.T) {
+	var requests []*http.Request
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	relayService := NewBluelockRelayService(server.Client(), server.URL, "org", config.BitbucketCloudKey, "api-key")
+	relayService.StartRun("run-1")
+	require.NoError(t, relayService.SendDataAndError([]string{"repo"}, "failure", url.Values{"type": {"repo_pull"}}))
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/api/v1/bluelock/org/BitbucketCloud/pull-data", requests[0].URL.Path)
+	assert.Equal(t, "repo_pull", requests[0].URL.Query().Get("type"))
+	assert.Equal(t, "Bearer api-key", requests[0].Header.Get("Authorization"))
+	assert.Equal(t, []any{"repo"}, payloads[0]["data"])
+	assert.Equal(t, float64(gitdtos.PayloadSchemaVersion), payloads[0]["schemaVersion"])
+	assert.Equal(t, "org", payloads[0]["orgCode"])
+	assert.Equal(t, "BitbucketCloud", payloads[0]["service"])
+	assert.Equal(t, "repo_pull", payloads[0]["type"])
+	assert.Equal(t, "run-1", payloads[0]["runId"])
+	assert.NotEmpty(t, payloads[0]["sentAt"])
+	assert.NotContains(t, payloads[0], "error")
+	assert.Equal(t, "/api/v1/bluelock/org/BitbucketCloud/pull-error", requests[1].URL.Path)
+	assert.Equal(t, "failure", payloads[1]["error"])
+	assert.Equal(t, "pull_error", payloads[1]["type"])
+
+	relayService.EndRun()
+	require.NoError(t, relayService.SendPullError("token failure", nil))
+	require.Len(t, payloads, 3)
+	assert.Equal(t, "", payloads[2]["runId"], "payloads between runs carry no run ID")
+
+	server.Close()
+	assert.Error(t, relayService.SendPullError("failure", nil))
+}
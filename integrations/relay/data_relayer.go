@@ -1,8 +1,21 @@
 package relay
 
-import "net/url"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/integrations/privacy"
+)
 
 type DataRelayer interface {
+	// StartRun sets the ID of the job run the following payloads belong to.
+	StartRun(runID string)
+	// EndRun clears the run ID, so payloads sent between runs, like the token health reports, carry an empty one.
+	EndRun()
 	SendCollectedData(payload interface{}, queryParams url.Values) error
 	SendPullError(payload interface{}, queryParams url.Values) error
 
@@ -11,3 +24,36 @@ type DataRelayer interface {
 }
 
 var _ DataRelayer = (*BluelockRelayService)(nil)
+
+// NewRunID returns the ID of a new job run, sortable by start time.
+func NewRunID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// newEnvelope returns the envelope of a payload of payloadType sent now, during the run runID.
+func newEnvelope(orgCode string, service config.ServiceKey, payloadType string, runID string) gitdtos.BLEnvelope {
+	return gitdtos.BLEnvelope{
+		SchemaVersion: gitdtos.PayloadSchemaVersion,
+		OrgCode:       orgCode,
+		Service:       string(service),
+		Type:          payloadType,
+		RunID:         runID,
+		SentAt:        time.Now().UTC(),
+	}
+}
+
+// AcquireDataRelayer returns the dry run relayer when one was initialized, otherwise the Bluelock relay service.
+// Either way the payloads are redacted according to the privacy policies first.
+func AcquireDataRelayer() DataRelayer {
+	var dataRelayer DataRelayer = dryRunRelayService
+	if dryRunRelayService == nil {
+		dataRelayer = AcquireBluelockRelayService()
+	}
+	redactor := privacy.AcquireRedactor()
+	if redactor.IsNoop() {
+		return dataRelayer
+	}
+	return NewRedactingRelayService(dataRelayer, redactor)
+}
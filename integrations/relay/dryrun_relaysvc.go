@@ -0,0 +1,209 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared/datastructures/set"
+)
+
+// DryRunRelayService is a DataRelayer that never talks to the relay. Every payload that would have been
+// sent is written as a JSON file to OutputDir, in the gitdtos.BLEnvelope the relay would have received, and counted,
+// so a dry run can be inspected afterwards.
+type DryRunRelayService struct {
+	OutputDir string
+	orgCode   string
+	service   config.ServiceKey
+
+	mu       sync.Mutex
+	sequence int
+	runID    string
+	summary  DryRunSummary
+	// repoSlugs counts every repository once, it is sent in the repo pull and again in each of its activity batches
+	repoSlugs set.Set[string]
+}
+
+// DryRunSummary counts what a dry run would have sent to the relay. Repos counts the distinct repositories.
+type DryRunSummary struct {
+	DataRequests  int `json:"dataRequests"`
+	ErrorRequests int `json:"errorRequests"`
+	Repos         int `json:"repos"`
+	Prs           int `json:"prs"`
+	PrCommits     int `json:"prCommits"`
+	Commits       int `json:"commits"`
+}
+
+// DryRunRecord is the content of a single file written by DryRunRelayService. Body is the request body the relay
+// would have received.
+type DryRunRecord struct {
+	Endpoint    string             `json:"endpoint"`
+	QueryParams url.Values         `json:"queryParams,omitempty"`
+	RecordedAt  time.Time          `json:"recordedAt"`
+	Body        gitdtos.BLEnvelope `json:"body"`
+}
+
+func NewDryRunRelayService(outputDir string, orgCode string, activeIntegrationService config.ServiceKey) (*DryRunRelayService, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dry run output directory: %w", err)
+	}
+	return &DryRunRelayService{OutputDir: outputDir, orgCode: orgCode, service: activeIntegrationService, repoSlugs: set.New[string]()}, nil
+}
+
+func (drsvc *DryRunRelayService) StartRun(runID string) {
+	drsvc.mu.Lock()
+	defer drsvc.mu.Unlock()
+	drsvc.runID = runID
+}
+
+func (drsvc *DryRunRelayService) EndRun() {
+	drsvc.StartRun("")
+}
+
+func (drsvc *DryRunRelayService) SendCollectedData(payload interface{}, queryParams url.Values) error {
+	if err := drsvc.record("pull-data", queryParams.Get("type"), payload, nil, queryParams); err != nil {
+		return fmt.Errorf("failed to record collected data: %w", err)
+	}
+
+	drsvc.mu.Lock()
+	defer drsvc.mu.Unlock()
+	drsvc.summary.DataRequests++
+	switch data := payload.(type) {
+	case []gitdtos.BLRepo:
+		drsvc.addRepos(data)
+	case gitdtos.BLData:
+		drsvc.addRepos(data.Repos)
+	case *gitdtos.BLData:
+		drsvc.addRepos(data.Repos)
+	}
+	return nil
+}
+
+func (drsvc *DryRunRelayService) SendPullError(payload interface{}, queryParams url.Values) error {
+	if err := drsvc.record("pull-error", gitdtos.PayloadTypePullError, nil, payload, queryParams); err != nil {
+		return fmt.Errorf("failed to record pull error: %w", err)
+	}
+
+	drsvc.mu.Lock()
+	defer drsvc.mu.Unlock()
+	drsvc.summary.ErrorRequests++
+	return nil
+}
+
+func (drsvc *DryRunRelayService) SendDataAndError(dataPayload interface{}, errorPayload interface{}, queryParams url.Values) error {
+	if dataPayload == nil {
+		return fmt.Errorf("data payload is nil")
+	}
+	if err := drsvc.SendCollectedData(dataPayload, queryParams); err != nil {
+		return err
+	}
+	if errorPayload != nil {
+		return drsvc.SendPullError(errorPayload, queryParams)
+	}
+	return nil
+}
+
+// Summary returns a snapshot of the counters collected so far.
+func (drsvc *DryRunRelayService) Summary() DryRunSummary {
+	drsvc.mu.Lock()
+	defer drsvc.mu.Unlock()
+	return drsvc.summary
+}
+
+// WriteSummary prints the summary in a human readable form to w and persists it as summary.json in OutputDir.
+func (drsvc *DryRunRelayService) WriteSummary(w io.Writer) error {
+	summary := drsvc.Summary()
+
+	fmt.Fprintln(w, "Dry run summary (nothing was sent to the relay):")
+	fmt.Fprintf(w, "  repos:           %d\n", summary.Repos)
+	fmt.Fprintf(w, "  pull requests:   %d\n", summary.Prs)
+	fmt.Fprintf(w, "  pr commits:      %d\n", summary.PrCommits)
+	fmt.Fprintf(w, "  commits:         %d\n", summary.Commits)
+	fmt.Fprintf(w, "  errors:          %d\n", summary.ErrorRequests)
+	fmt.Fprintf(w, "  payloads written to: %s\n", drsvc.OutputDir)
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dry run summary: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(drsvc.OutputDir, "summary.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write dry run summary: %w", err)
+	}
+	return nil
+}
+
+func (drsvc *DryRunRelayService) record(endpoint string, payloadType string, dataPayload interface{}, errorPayload interface{}, queryParams url.Values) error {
+	drsvc.mu.Lock()
+	drsvc.sequence++
+	sequence := drsvc.sequence
+	body := newEnvelope(drsvc.orgCode, drsvc.service, payloadType, drsvc.runID)
+	drsvc.mu.Unlock()
+	body.Data = dataPayload
+	body.Error = errorPayload
+
+	data, err := json.MarshalIndent(DryRunRecord{
+		Endpoint:    endpoint,
+		QueryParams: queryParams,
+		RecordedAt:  time.Now(),
+		Body:        body,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling payload: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%05d-%s", sequence, endpoint)
+	if payloadType := queryParams.Get("type"); payloadType != "" {
+		fileName = fmt.Sprintf("%s-%s", fileName, payloadType)
+	}
+	if err := os.WriteFile(filepath.Join(drsvc.OutputDir, fileName+".json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing payload file: %w", err)
+	}
+	return nil
+}
+
+// addRepos counts the repositories and their activity. The caller holds mu.
+func (drsvc *DryRunRelayService) addRepos(repos []gitdtos.BLRepo) {
+	s := &drsvc.summary
+	for _, repo := range repos {
+		drsvc.repoSlugs.Add(repo.Slug)
+		s.Commits += len(repo.Commits)
+		s.Prs += len(repo.Prs)
+		for _, pr := range repo.Prs {
+			s.PrCommits += len(pr.PrCommits)
+		}
+	}
+	s.Repos = drsvc.repoSlugs.Size()
+}
+
+var dryRunRelayService *DryRunRelayService
+
+// InitializeDryRunRelayService switches AcquireDataRelayer over to a DryRunRelayService writing into outputDir.
+func InitializeDryRunRelayService(outputDir string) error {
+	if dryRunRelayService != nil {
+		return fmt.Errorf("dry run relay service already initialized")
+	}
+
+	cfg := config.AcquireConfig()
+	var err error
+	dryRunRelayService, err = NewDryRunRelayService(outputDir, cfg.Common.OrgCode, cfg.ActiveService)
+	if err != nil {
+		return fmt.Errorf("failed to initialize dry run relay service: %w", err)
+	}
+	return nil
+}
+
+func AcquireDryRunRelayService() *DryRunRelayService {
+	if dryRunRelayService == nil {
+		panic("dry run relay service not initialized, call InitializeDryRunRelayService first")
+	}
+	return dryRunRelayService
+}
+
+var _ DataRelayer = (*DryRunRelayService)(nil)
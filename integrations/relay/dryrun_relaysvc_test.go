@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunRelayServiceRecordsPayloadsAndSummary(t *testing.T) {
+	outputDir := t.TempDir()
+	drsvc, err := NewDryRunRelayService(outputDir, "org", config.BitbucketCloudKey)
+	assert.NoError(t, err)
+	drsvc.StartRun("run-1")
+
+	repos := []gitdtos.BLRepo{{Slug: "repo-1"}, {Slug: "repo-2"}}
+	err = drsvc.SendCollectedData(repos, url.Values{"type": {"repo_pull"}})
+	assert.NoError(t, err)
+
+	activity := gitdtos.BLData{
+		WorkspaceKey: "workspace",
+		Repos: []gitdtos.BLRepo{{
+			Slug:    "repo-1",
+			Commits: []gitdtos.BLCommit{{ID: "a"}, {ID: "b"}},
+			Prs: []gitdtos.BLPullRequest{
+				{ID: 1, PrCommits: []gitdtos.BLCommit{{ID: "c"}}},
+				{ID: 2},
+			},
+		}},
+	}
+	err = drsvc.SendCollectedData(activity, url.Values{"type": {"activity_pull"}})
+	assert.NoError(t, err)
+
+	err = drsvc.SendPullError(gitdtos.BLRepoError{RepoID: "repo-1", PrFetchError: "boom"}, nil)
+	assert.NoError(t, err)
+
+	summary := drsvc.Summary()
+	assert.Equal(t, DryRunSummary{DataRequests: 2, ErrorRequests: 1, Repos: 2, Prs: 2, PrCommits: 1, Commits: 2}, summary)
+
+	files, err := filepath.Glob(filepath.Join(outputDir, "*.json"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(outputDir, "00001-pull-data-repo_pull.json"),
+		filepath.Join(outputDir, "00002-pull-data-activity_pull.json"),
+		filepath.Join(outputDir, "00003-pull-error.json"),
+	}, files)
+
+	var record DryRunRecord
+	readRecord(t, filepath.Join(outputDir, "00003-pull-error.json"), &record)
+	assert.Equal(t, "pull-error", record.Endpoint)
+	assert.Equal(t, gitdtos.PayloadSchemaVersion, record.Body.SchemaVersion)
+	assert.Equal(t, "org", record.Body.OrgCode)
+	assert.Equal(t, "BitbucketCloud", record.Body.Service)
+	assert.Equal(t, gitdtos.PayloadTypePullError, record.Body.Type)
+	assert.Equal(t, "run-1", record.Body.RunID)
+	assert.NotZero(t, record.Body.SentAt)
+	assert.NotNil(t, record.Body.Error)
+	assert.Nil(t, record.Body.Data)
+
+	readRecord(t, filepath.Join(outputDir, "00001-pull-data-repo_pull.json"), &record)
+	assert.Equal(t, gitdtos.PayloadTypeRepoPull, record.Body.Type)
+	assert.NotNil(t, record.Body.Data)
+	assert.Nil(t, record.Body.Error)
+
+	drsvc.EndRun()
+	assert.NoError(t, drsvc.SendPullError("token failure", nil))
+	readRecord(t, filepath.Join(outputDir, "00004-pull-error.json"), &record)
+	assert.Empty(t, record.Body.RunID, "payloads between runs carry no run ID")
+
+	var out bytes.Buffer
+	assert.NoError(t, drsvc.WriteSummary(&out))
+	assert.Contains(t, out.String(), "pull requests:   2")
+	_, err = os.Stat(filepath.Join(outputDir, "summary.json"))
+	assert.NoError(t, err)
+}
+
+func readRecord(t *testing.T, filePath string, record *DryRunRecord) {
+	t.Helper()
+	*record = DryRunRecord{}
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, record))
+}
@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"net/url"
+
+	"github.com/bluelock-go/integrations/privacy"
+)
+
+// RedactingRelayService applies the privacy policies to every payload before handing it to the wrapped DataRelayer.
+type RedactingRelayService struct {
+	next     DataRelayer
+	redactor *privacy.Redactor
+}
+
+var _ DataRelayer = (*RedactingRelayService)(nil)
+
+func NewRedactingRelayService(next DataRelayer, redactor *privacy.Redactor) *RedactingRelayService {
+	return &RedactingRelayService{next, redactor}
+}
+
+func (rrsvc *RedactingRelayService) StartRun(runID string) {
+	rrsvc.next.StartRun(runID)
+}
+
+func (rrsvc *RedactingRelayService) EndRun() {
+	rrsvc.next.EndRun()
+}
+
+func (rrsvc *RedactingRelayService) SendCollectedData(payload interface{}, queryParams url.Values) error {
+	return rrsvc.next.SendCollectedData(rrsvc.redactor.Payload(payload), queryParams)
+}
+
+func (rrsvc *RedactingRelayService) SendPullError(payload interface{}, queryParams url.Values) error {
+	return rrsvc.next.SendPullError(rrsvc.redactor.Payload(payload), queryParams)
+}
+
+func (rrsvc *RedactingRelayService) SendDataAndError(dataPayload interface{}, errorPayload interface{}, queryParams url.Values) error {
+	return rrsvc.next.SendDataAndError(rrsvc.redactor.Payload(dataPayload), rrsvc.redactor.Payload(errorPayload), queryParams)
+}
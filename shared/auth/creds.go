@@ -1,16 +1,38 @@
 package auth
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/bluelock-go/shared/customerrors"
 )
 
+// CredentialType selects how a credential authenticates against the API.
+type CredentialType string
+
+const (
+	// BasicCredential is a username and app password sent with HTTP Basic auth. It is the default.
+	BasicCredential CredentialType = "basic"
+	// BearerCredential is an access token, e.g. a workspace, project or repository access token.
+	BearerCredential CredentialType = "bearer"
+	// OAuthClientCredentials is an OAuth 2.0 consumer whose access tokens are fetched with the client credentials grant.
+	OAuthClientCredentials CredentialType = "oauthClientCredentials"
+)
+
+var ValidCredentialTypes = []CredentialType{BasicCredential, BearerCredential, OAuthClientCredentials}
+
 type Credential struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	CredKey  string `json:"credKey"`
+	Type         CredentialType `json:"type,omitempty"`
+	Username     string         `json:"username,omitempty"`
+	Password     string         `json:"password,omitempty"`
+	AccessToken  string         `json:"accessToken,omitempty"`
+	ClientID     string         `json:"clientId,omitempty"`
+	ClientSecret string         `json:"clientSecret,omitempty"`
+	CredKey      string         `json:"credKey"`
+	// TokenID is the fingerprint of CredKey used in state files and logs. It is derived on load and never persisted.
+	TokenID string `json:"-"`
 }
 
 func NewCredentials(username, password string) *Credential {
@@ -24,20 +46,55 @@ func (c *Credential) GetCredential() (string, string) {
 	return c.Username, c.Password
 }
 
+// GetType returns the type of the credential, credentials without a type are basic ones.
+func (c *Credential) GetType() CredentialType {
+	if c.Type == "" {
+		return BasicCredential
+	}
+	return c.Type
+}
+
 func (c *Credential) GenerateCredKeyIfAbsent() string {
 	if c.CredKey == "" {
-		c.CredKey = base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		var secret string
+		switch c.GetType() {
+		case BearerCredential:
+			secret = c.AccessToken
+		case OAuthClientCredentials:
+			secret = c.ClientID + ":" + c.ClientSecret
+		default:
+			secret = c.Username + ":" + c.Password
+		}
+		c.CredKey = base64.StdEncoding.EncodeToString([]byte(secret))
 	}
 	return c.CredKey
 }
 
-func GetCredentialByCredKey(credKey string, creds []Credential) (*Credential, error) {
+// Redacted keeps credentials out of the logs, only the token ID is printed.
+func (c Credential) Redacted() any {
+	if c.TokenID != "" {
+		return c.TokenID
+	}
+	return MaskCredKey(c.CredKey)
+}
+
+// MaskCredKey returns a short, non-reversible identifier that is safe to print for a token ID of a state file.
+// Token IDs are printed as is, credKeys of state files written before token IDs existed are hashed.
+func MaskCredKey(credKey string) string {
+	if IsTokenID(credKey) {
+		return credKey
+	}
+	sum := sha256.Sum256([]byte(credKey))
+	return "cred-" + hex.EncodeToString(sum[:4])
+}
+
+func GetCredentialByTokenID(tokenID string, creds []Credential) (*Credential, error) {
 	for _, cred := range creds {
-		if cred.CredKey == credKey {
+		if cred.TokenID == tokenID {
 			return &cred, nil
 		}
 	}
-	return nil, fmt.Errorf("credential with credKey %s not found: %w", credKey, customerrors.ErrCritical)
+	return nil, fmt.Errorf("credential with token ID %s not found: %w", MaskCredKey(tokenID), customerrors.ErrCritical)
 }
 
 func ValidateCredentials(credStoreKey string, creds []Credential) error {
@@ -45,9 +102,29 @@ func ValidateCredentials(credStoreKey string, creds []Credential) error {
 		if cred.CredKey == "" {
 			return fmt.Errorf("invalid credentials: CredKey must not be empty for authCredentialStoreKey %s", credStoreKey)
 		}
-		if cred.Username == "" || cred.Password == "" {
-			return fmt.Errorf("invalid credentials for key %s: Username and Password must not be empty", cred.CredKey)
+		if err := cred.validateSecrets(); err != nil {
+			return fmt.Errorf("invalid credentials for key %s: %w", MaskCredKey(cred.CredKey), err)
+		}
+	}
+	return nil
+}
+
+func (c *Credential) validateSecrets() error {
+	switch c.GetType() {
+	case BasicCredential:
+		if c.Username == "" || c.Password == "" {
+			return fmt.Errorf("Username and Password must not be empty")
+		}
+	case BearerCredential:
+		if c.AccessToken == "" {
+			return fmt.Errorf("AccessToken must not be empty for a %s credential", BearerCredential)
+		}
+	case OAuthClientCredentials:
+		if c.ClientID == "" || c.ClientSecret == "" {
+			return fmt.Errorf("ClientID and ClientSecret must not be empty for an %s credential", OAuthClientCredentials)
 		}
+	default:
+		return fmt.Errorf("unsupported credential type %q, valid types are: %v", c.Type, ValidCredentialTypes)
 	}
 	return nil
 }
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCredentialTypes(t *testing.T) {
+	creds := []Credential{
+		{Username: "user", Password: "password"},
+		{Type: BearerCredential, AccessToken: "access-token"},
+		{Type: OAuthClientCredentials, ClientID: "client-id", ClientSecret: "client-secret"},
+	}
+	for i := range creds {
+		creds[i].GenerateCredKeyIfAbsent()
+	}
+	assert.NoError(t, ValidateCredentials("datapullCredentials", creds))
+	assert.Equal(t, BasicCredential, creds[0].GetType(), "credentials without a type are basic ones")
+	assert.NotEqual(t, creds[1].CredKey, creds[2].CredKey)
+
+	for _, invalid := range []Credential{
+		{Username: "user"},
+		{Type: BearerCredential, Username: "user", Password: "password"},
+		{Type: OAuthClientCredentials, ClientID: "client-id"},
+		{Type: "kerberos", Username: "user", Password: "password"},
+	} {
+		invalid.GenerateCredKeyIfAbsent()
+		err := ValidateCredentials("datapullCredentials", []Credential{invalid})
+		if assert.Error(t, err, invalid.Type) && invalid.CredKey != "" {
+			assert.NotContains(t, err.Error(), invalid.CredKey, "the credKey is not part of the error")
+		}
+	}
+}
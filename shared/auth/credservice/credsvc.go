@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/bluelock-go/shared"
@@ -22,6 +23,9 @@ const (
 
 type AuthCredentialStore map[CredKey][]auth.Credential
 
+// FingerprintKeyFileName is the HMAC key of the token IDs, kept in the secrets directory.
+const FingerprintKeyFileName = "token_fingerprint.key"
+
 func NormalizeAndPersistCredentials(filePath string) (AuthCredentialStore, error) {
 	credStore, data, err := LoadAuthTokensFromFileAndValidate(filePath)
 	if err != nil {
@@ -46,6 +50,16 @@ func NormalizeAndPersistCredentials(filePath string) (AuthCredentialStore, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal updated credentials: %w", err)
 	}
+	// an encrypted credential store stays encrypted
+	if IsEncryptedCredStore(data) {
+		key, err := LoadCredStoreKey(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credential store key: %w", err)
+		}
+		if credStoreInBytes, err = EncryptCredStore(credStoreInBytes, key); err != nil {
+			return nil, fmt.Errorf("failed to encrypt updated credentials: %w", err)
+		}
+	}
 
 	//  write in a temporary file and rename it to the original file
 	if err := atomicWriteFile(filePath, credStoreInBytes); err != nil {
@@ -83,9 +97,13 @@ func LoadAuthTokensFromFileAndValidate(filePath string) (AuthCredentialStore, []
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	plaintext, err := readCredStoreFile(filePath, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt credential store: %w", err)
+	}
 
 	var credStore AuthCredentialStore
-	if err := json.Unmarshal(data, &credStore); err != nil {
+	if err := json.Unmarshal(plaintext, &credStore); err != nil {
 		return nil, nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
 
@@ -96,31 +114,44 @@ func LoadAuthTokensFromFileAndValidate(filePath string) (AuthCredentialStore, []
 	return credStore, data, nil
 }
 
-func takeBackupOfCredStore(filePath string, credStoreInBytes []byte) error {
+func credStoreBackupFilePath(filePath string) string {
 	re := regexp.MustCompile(`\.json$`)
-	backupFilePath := re.ReplaceAllString(filePath, ".backup.json")
-	if err := os.WriteFile(backupFilePath, credStoreInBytes, 0644); err != nil {
+	return re.ReplaceAllString(filePath, ".backup.json")
+}
+
+func takeBackupOfCredStore(filePath string, credStoreInBytes []byte) error {
+	backupFilePath := credStoreBackupFilePath(filePath)
+	if err := writeSecretFile(backupFilePath, credStoreInBytes); err != nil {
 		return fmt.Errorf("failed to create backup file: %w", err)
 	}
 
 	return nil
 }
 
-func atomicWriteFile(filePath string, data []byte) error {
+// lockFile takes the lock guarding the writes of filePath, waiting up to 5 seconds for another process to release it.
+func lockFile(filePath string) (*flock.Flock, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	lock := flock.New(filePath + ".lock")
 	if ok, err := lock.TryLockContext(ctx, 10*time.Millisecond); err != nil {
-		return fmt.Errorf("failed to acquire lock: %w", err)
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
 	} else if !ok {
-		return fmt.Errorf("failed to acquire lock in 5 seconds: another process is holding the lock")
+		return nil, fmt.Errorf("failed to acquire lock in 5 seconds: another process is holding the lock")
+	}
+	return lock, nil
+}
+
+func atomicWriteFile(filePath string, data []byte) error {
+	lock, err := lockFile(filePath)
+	if err != nil {
+		return err
 	}
 	defer lock.Unlock()
 
 	// Create a temporary file
 	tempFilePath := filePath + ".tmp"
-	if err := os.WriteFile(tempFilePath, data, 0644); err != nil {
+	if err := writeSecretFile(tempFilePath, data); err != nil {
 		return fmt.Errorf("failed to write to temporary file: %w", err)
 	}
 
@@ -152,40 +183,62 @@ func (credStore AuthCredentialStore) validateCredStore() error {
 	return nil
 }
 
-var authCredentialStore AuthCredentialStore
-var credentials []auth.Credential
+var (
+	credentialsMu       sync.RWMutex
+	authCredentialStore AuthCredentialStore
+	credentials         []auth.Credential
+)
 
-func InitializeAuthCredentialStore(authTokensFilePath string, credentialKey CredKey) error {
+// InitializeAuthCredentialStore loads the credential store from the provider. The HMAC key of the token IDs is read
+// from fingerprintKeyFilePath.
+func InitializeAuthCredentialStore(provider CredentialProvider, fingerprintKeyFilePath string, credentialKey CredKey) error {
 	customLogger := shared.AcquireCustomLogger()
 
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
 	if authCredentialStore != nil {
 		return fmt.Errorf("auth credential store is already initialized")
 	}
 
-	var err error
-	authCredentialStore, _, err = LoadAuthTokensFromFileAndValidate(authTokensFilePath)
+	fingerprintKey, err := auth.LoadOrCreateFingerprintKey(fingerprintKeyFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to load authentication tokens: %w", err)
-	} else {
-		customLogger.Info("Authentication tokens loaded successfully", "authTokensFilePath", authTokensFilePath)
+		return fmt.Errorf("failed to load token fingerprint key: %w", err)
 	}
+	credStore, creds, err := loadCredentials(context.Background(), provider, auth.NewFingerprinter(fingerprintKey), credentialKey)
+	if err != nil {
+		return err
+	}
+	customLogger.Info("Authentication tokens loaded successfully", "provider", provider.Name())
+	authCredentialStore, credentials = credStore, creds
+	customLogger.Info("Datapull credentials found in the credential store", "credentials", credentials)
 
-	var ok bool
-	credentials, ok = authCredentialStore[credentialKey]
+	return nil
+}
+
+// loadCredentials loads the credential store from the provider and returns the validated credentials of
+// credentialKey with their token IDs assigned.
+func loadCredentials(ctx context.Context, provider CredentialProvider, fingerprinter *auth.Fingerprinter, credentialKey CredKey) (AuthCredentialStore, []auth.Credential, error) {
+	credStore, err := provider.LoadCredStore(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load authentication tokens from %s: %w", provider.Name(), err)
+	}
+
+	creds, ok := credStore[credentialKey]
 	if !ok {
-		return fmt.Errorf("datapull credentials not found in the credential store")
-	} else if err := auth.ValidateCredentials(string(credentialKey), credentials); err != nil {
-		return fmt.Errorf("invalid datapull credentials: %w", err)
-	} else if len(credentials) == 0 {
-		return fmt.Errorf("no datapull credentials found in the credential store")
-	} else {
-		customLogger.Info("Datapull credentials found in the credential store", "credentials", credentials)
+		return nil, nil, fmt.Errorf("datapull credentials not found in the credential store")
+	} else if err := auth.ValidateCredentials(string(credentialKey), creds); err != nil {
+		return nil, nil, fmt.Errorf("invalid datapull credentials: %w", err)
+	} else if len(creds) == 0 {
+		return nil, nil, fmt.Errorf("no datapull credentials found in the credential store")
 	}
+	fingerprinter.AssignTokenIDs(creds)
 
-	return nil
+	return credStore, creds, nil
 }
 
 func AcquireCredentials() []auth.Credential {
+	credentialsMu.RLock()
+	defer credentialsMu.RUnlock()
 	if authCredentialStore == nil {
 		panic("auth credential store not initialized, call InitializeAuthCredentialStore first")
 	}
@@ -0,0 +1,350 @@
+package credservice
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CredStoreKeyEnvVar holds the base64 encoded AES-256 key of an encrypted credential store. It takes precedence
+	// over the key file.
+	CredStoreKeyEnvVar = "BLUELOCK_CRED_STORE_KEY"
+	// CredStoreNewKeyEnvVar holds the key rotate-key switches to. Without it a new key is generated into the key file.
+	CredStoreNewKeyEnvVar = "BLUELOCK_CRED_STORE_NEW_KEY"
+	// CredStoreKeyFileName is the key file of an encrypted credential store, kept next to the auth tokens file.
+	CredStoreKeyFileName = "cred_store.key"
+
+	credStoreEncryptionAlgorithm = "aes-256-gcm"
+	credStoreKeyByteLen          = 32
+	// secretFileMode is the mode of every file holding credentials or keys
+	secretFileMode = 0600
+)
+
+var ErrCredStoreKeyNotFound = fmt.Errorf("credential store key not found: set %s or create the key file", CredStoreKeyEnvVar)
+
+// encryptedCredStore is the on-disk format of an encrypted credential store.
+type encryptedCredStore struct {
+	Encryption string `json:"encryption"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// IsEncryptedCredStore reports whether data is an encrypted credential store rather than a plaintext one.
+func IsEncryptedCredStore(data []byte) bool {
+	var envelope encryptedCredStore
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return false
+	}
+	return envelope.Encryption != "" && envelope.Ciphertext != ""
+}
+
+func EncryptCredStore(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newCredStoreCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	envelope := encryptedCredStore{
+		Encryption: credStoreEncryptionAlgorithm,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	}
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+func DecryptCredStore(data, key []byte) ([]byte, error) {
+	var envelope encryptedCredStore
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal encrypted credential store: %w", err)
+	}
+	if envelope.Encryption != credStoreEncryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported credential store encryption: %s", envelope.Encryption)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	gcm, err := newCredStoreCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size: %d", len(nonce))
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential store, wrong key or corrupted file: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newCredStoreCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != credStoreKeyByteLen {
+		return nil, fmt.Errorf("credential store key must be %d bytes, got %d", credStoreKeyByteLen, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func credStoreKeyFilePath(authTokensFilePath string) string {
+	return filepath.Join(filepath.Dir(authTokensFilePath), CredStoreKeyFileName)
+}
+
+// LoadCredStoreKey returns the key from CredStoreKeyEnvVar, or else from the key file next to the auth tokens file.
+func LoadCredStoreKey(authTokensFilePath string) ([]byte, error) {
+	if encodedKey := os.Getenv(CredStoreKeyEnvVar); encodedKey != "" {
+		key, err := decodeCredStoreKey(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", CredStoreKeyEnvVar, err)
+		}
+		return key, nil
+	}
+
+	keyFilePath := credStoreKeyFilePath(authTokensFilePath)
+	encodedKey, err := os.ReadFile(keyFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCredStoreKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read credential store key file: %w", err)
+	}
+	key, err := decodeCredStoreKey(string(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential store key file %s: %w", keyFilePath, err)
+	}
+	return key, nil
+}
+
+func decodeCredStoreKey(encodedKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("key is not base64 encoded: %w", err)
+	}
+	if len(key) != credStoreKeyByteLen {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", credStoreKeyByteLen, len(key))
+	}
+	return key, nil
+}
+
+func generateCredStoreKey() ([]byte, error) {
+	key := make([]byte, credStoreKeyByteLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate credential store key: %w", err)
+	}
+	return key, nil
+}
+
+func generateCredStoreKeyFile(keyFilePath string) ([]byte, error) {
+	key, err := generateCredStoreKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSecretFile(keyFilePath, []byte(base64.StdEncoding.EncodeToString(key)+"\n")); err != nil {
+		return nil, fmt.Errorf("failed to write credential store key file: %w", err)
+	}
+	return key, nil
+}
+
+// writeSecretFile writes data with secretFileMode, tightening the mode of an existing file as well.
+func writeSecretFile(filePath string, data []byte) error {
+	if err := os.WriteFile(filePath, data, secretFileMode); err != nil {
+		return err
+	}
+	return os.Chmod(filePath, secretFileMode)
+}
+
+// readCredStoreFile returns the plaintext of the auth tokens file, decrypting it when it is encrypted.
+func readCredStoreFile(filePath string, data []byte) ([]byte, error) {
+	if !IsEncryptedCredStore(data) {
+		return data, nil
+	}
+	key, err := LoadCredStoreKey(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptCredStore(data, key)
+}
+
+// EncryptCredStoreFile encrypts a plaintext auth tokens file, and its plaintext backup if any, in place. The key is
+// generated into the key file when neither the environment variable nor the key file provides one.
+func EncryptCredStoreFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read credential store: %w", err)
+	}
+	if IsEncryptedCredStore(data) {
+		return fmt.Errorf("credential store is already encrypted")
+	}
+	var credStore AuthCredentialStore
+	if err := json.Unmarshal(data, &credStore); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	key, err := LoadCredStoreKey(filePath)
+	if errors.Is(err, ErrCredStoreKeyNotFound) {
+		key, err = generateCredStoreKeyFile(credStoreKeyFilePath(filePath))
+	}
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptCredStore(data, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credential store: %w", err)
+	}
+	if err := atomicWriteFile(filePath, encrypted); err != nil {
+		return err
+	}
+
+	backupFilePath := credStoreBackupFilePath(filePath)
+	backupData, err := os.ReadFile(backupFilePath)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && IsEncryptedCredStore(backupData)) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read credential store backup: %w", err)
+	}
+	encryptedBackup, err := EncryptCredStore(backupData, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credential store backup: %w", err)
+	}
+	return writeSecretFile(backupFilePath, encryptedBackup)
+}
+
+// DecryptCredStoreFile turns an encrypted auth tokens file back into plaintext.
+func DecryptCredStoreFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read credential store: %w", err)
+	}
+	if !IsEncryptedCredStore(data) {
+		return fmt.Errorf("credential store is not encrypted")
+	}
+	plaintext, err := readCredStoreFile(filePath, data)
+	if err != nil {
+		return err
+	}
+	return atomicWriteFile(filePath, plaintext)
+}
+
+// RotateCredStoreKey re-encrypts the auth tokens file with a new key. The new key comes from CredStoreNewKeyEnvVar,
+// which the operator then moves to CredStoreKeyEnvVar, or is generated into the key file, keeping the previous key
+// file as a .previous file.
+// The store and its backup are re-encrypted to temporary files first, then the key file and the store are swapped in
+// that order. The previous key file is restored when the store cannot be swapped, so the store and the key file never
+// disagree.
+func RotateCredStoreKey(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read credential store: %w", err)
+	}
+	if !IsEncryptedCredStore(data) {
+		return fmt.Errorf("credential store is not encrypted, encrypt it first")
+	}
+	plaintext, err := readCredStoreFile(filePath, data)
+	if err != nil {
+		return err
+	}
+	// the backup is re-encrypted as well, it would be unreadable with the new key otherwise
+	backupFilePath := credStoreBackupFilePath(filePath)
+	backupPlaintext, err := os.ReadFile(backupFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		backupPlaintext = nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read credential store backup: %w", err)
+	} else if backupPlaintext, err = readCredStoreFile(filePath, backupPlaintext); err != nil {
+		return fmt.Errorf("failed to decrypt credential store backup: %w", err)
+	}
+
+	var newKey []byte
+	keyFilePath := credStoreKeyFilePath(filePath)
+	var previousKeyFile []byte
+	if encodedKey := os.Getenv(CredStoreNewKeyEnvVar); encodedKey != "" {
+		if newKey, err = decodeCredStoreKey(encodedKey); err != nil {
+			return fmt.Errorf("invalid %s: %w", CredStoreNewKeyEnvVar, err)
+		}
+	} else {
+		if os.Getenv(CredStoreKeyEnvVar) != "" {
+			return fmt.Errorf("the key is set by %s, set the new key in %s", CredStoreKeyEnvVar, CredStoreNewKeyEnvVar)
+		}
+		if previousKeyFile, err = os.ReadFile(keyFilePath); err != nil {
+			return fmt.Errorf("failed to read credential store key file: %w", err)
+		}
+		if newKey, err = generateCredStoreKey(); err != nil {
+			return err
+		}
+	}
+
+	rotatedFilePath := filePath + ".rotating"
+	rotatedBackupFilePath := backupFilePath + ".rotating"
+	defer os.Remove(rotatedFilePath)
+	defer os.Remove(rotatedBackupFilePath)
+	encrypted, err := EncryptCredStore(plaintext, newKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credential store: %w", err)
+	}
+	if err := writeSecretFile(rotatedFilePath, encrypted); err != nil {
+		return fmt.Errorf("failed to write re-encrypted credential store: %w", err)
+	}
+	if backupPlaintext != nil {
+		encryptedBackup, err := EncryptCredStore(backupPlaintext, newKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt credential store backup: %w", err)
+		}
+		if err := writeSecretFile(rotatedBackupFilePath, encryptedBackup); err != nil {
+			return fmt.Errorf("failed to write re-encrypted credential store backup: %w", err)
+		}
+	}
+
+	lock, err := lockFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if previousKeyFile != nil {
+		if err := writeSecretFile(keyFilePath+".previous", previousKeyFile); err != nil {
+			return fmt.Errorf("failed to keep the previous credential store key: %w", err)
+		}
+		if err := writeSecretFile(keyFilePath, []byte(base64.StdEncoding.EncodeToString(newKey)+"\n")); err != nil {
+			return errors.Join(fmt.Errorf("failed to write credential store key file: %w", err), restoreCredStoreKeyFile(keyFilePath, previousKeyFile))
+		}
+	}
+	if err := os.Rename(rotatedFilePath, filePath); err != nil {
+		err = fmt.Errorf("failed to replace credential store: %w", err)
+		if previousKeyFile != nil {
+			err = errors.Join(err, restoreCredStoreKeyFile(keyFilePath, previousKeyFile))
+		}
+		return err
+	}
+	if backupPlaintext == nil {
+		return nil
+	}
+	if err := os.Rename(rotatedBackupFilePath, backupFilePath); err != nil {
+		return fmt.Errorf("failed to replace credential store backup, it is still encrypted with the previous key: %w", err)
+	}
+	return nil
+}
+
+// restoreCredStoreKeyFile puts the previous key file back after a failed rotation.
+func restoreCredStoreKeyFile(keyFilePath string, previousKeyFile []byte) error {
+	if err := writeSecretFile(keyFilePath, previousKeyFile); err != nil {
+		return fmt.Errorf("failed to restore the previous credential store key, it is kept in %s.previous: %w", keyFilePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package credservice
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCredStoreFile(t *testing.T) string {
+	t.Setenv(CredStoreKeyEnvVar, "")
+	t.Setenv(CredStoreNewKeyEnvVar, "")
+	filePath := filepath.Join(t.TempDir(), "auth_tokens.json")
+	require.NoError(t, os.WriteFile(filePath, data, 0644))
+	return filePath
+}
+
+func assertSecretFile(t *testing.T, filePath string) {
+	t.Helper()
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), filePath)
+}
+
+func TestEncryptedCredStoreLifecycle(t *testing.T) {
+	filePath := newTestCredStoreFile(t)
+	_, err := NormalizeAndPersistCredentials(filePath)
+	require.NoError(t, err)
+	assertSecretFile(t, filePath)
+	assertSecretFile(t, credStoreBackupFilePath(filePath))
+
+	require.NoError(t, EncryptCredStoreFile(filePath))
+	assertSecretFile(t, credStoreKeyFilePath(filePath))
+	for _, path := range []string{filePath, credStoreBackupFilePath(filePath)} {
+		encrypted, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, IsEncryptedCredStore(encrypted), path)
+		assert.NotContains(t, string(encrypted), "password_1", path)
+	}
+	assert.Error(t, EncryptCredStoreFile(filePath), "encrypting twice is refused")
+
+	credStore, _, err := LoadAuthTokensFromFileAndValidate(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "password_1", credStore[DatapullCredentialsKey][0].Password)
+
+	_, err = NormalizeAndPersistCredentials(filePath)
+	require.NoError(t, err)
+	normalized, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedCredStore(normalized), "normalizing keeps the store encrypted")
+
+	previousKey, err := LoadCredStoreKey(filePath)
+	require.NoError(t, err)
+	require.NoError(t, RotateCredStoreKey(filePath))
+	newKey, err := LoadCredStoreKey(filePath)
+	require.NoError(t, err)
+	assert.NotEqual(t, previousKey, newKey)
+	assertSecretFile(t, credStoreKeyFilePath(filePath)+".previous")
+	rotated, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	_, err = DecryptCredStore(rotated, previousKey)
+	assert.Error(t, err, "the previous key no longer decrypts the store")
+	backup, err := os.ReadFile(credStoreBackupFilePath(filePath))
+	require.NoError(t, err)
+	_, err = DecryptCredStore(backup, newKey)
+	assert.NoError(t, err, "the backup is rotated as well")
+
+	require.NoError(t, DecryptCredStoreFile(filePath))
+	assertSecretFile(t, filePath)
+	credStore, _, err = LoadAuthTokensFromFileAndValidate(filePath)
+	require.NoError(t, err)
+	assert.Len(t, credStore[DatapullCredentialsKey], 3)
+}
+
+func TestEncryptedCredStoreKeyFromEnv(t *testing.T) {
+	filePath := newTestCredStoreFile(t)
+	key := make([]byte, credStoreKeyByteLen)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	t.Setenv(CredStoreKeyEnvVar, base64.StdEncoding.EncodeToString(key))
+
+	require.NoError(t, EncryptCredStoreFile(filePath))
+	_, err = os.Stat(credStoreKeyFilePath(filePath))
+	assert.ErrorIs(t, err, os.ErrNotExist, "no key file is generated when the key is set by the environment")
+
+	assert.Error(t, RotateCredStoreKey(filePath), "rotating an environment key needs the new key")
+	newKey := make([]byte, credStoreKeyByteLen)
+	_, err = rand.Read(newKey)
+	require.NoError(t, err)
+	t.Setenv(CredStoreNewKeyEnvVar, base64.StdEncoding.EncodeToString(newKey))
+	require.NoError(t, RotateCredStoreKey(filePath))
+
+	_, _, err = LoadAuthTokensFromFileAndValidate(filePath)
+	assert.Error(t, err, "the store is encrypted with the new key")
+	t.Setenv(CredStoreKeyEnvVar, base64.StdEncoding.EncodeToString(newKey))
+	_, _, err = LoadAuthTokensFromFileAndValidate(filePath)
+	assert.NoError(t, err)
+
+	t.Setenv(CredStoreKeyEnvVar, "")
+	_, _, err = LoadAuthTokensFromFileAndValidate(filePath)
+	assert.ErrorIs(t, err, ErrCredStoreKeyNotFound)
+}
+
+func TestRotateCredStoreKeyKeepsTheKeyWhenTheStoreCannotBeReEncrypted(t *testing.T) {
+	filePath := newTestCredStoreFile(t)
+	require.NoError(t, EncryptCredStoreFile(filePath))
+	keyFile, err := os.ReadFile(credStoreKeyFilePath(filePath))
+	require.NoError(t, err)
+	encrypted, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	// the re-encrypted store cannot be written next to the store
+	require.NoError(t, os.Mkdir(filePath+".rotating", 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(filePath+".rotating", "file"), nil, 0600))
+	assert.Error(t, RotateCredStoreKey(filePath))
+
+	unchangedKeyFile, err := os.ReadFile(credStoreKeyFilePath(filePath))
+	require.NoError(t, err)
+	assert.Equal(t, keyFile, unchangedKeyFile, "the key is swapped only once the store is re-encrypted")
+	unchanged, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, unchanged)
+	_, _, err = LoadAuthTokensFromFileAndValidate(filePath)
+	assert.NoError(t, err)
+}
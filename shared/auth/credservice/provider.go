@@ -0,0 +1,328 @@
+package credservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared/auth"
+)
+
+// CredentialProvider loads the auth credential store from a secret source.
+type CredentialProvider interface {
+	// Name identifies the provider in logs and errors. It never contains secrets.
+	Name() string
+	LoadCredStore(ctx context.Context) (AuthCredentialStore, error)
+}
+
+var (
+	_ CredentialProvider = (*FileCredentialProvider)(nil)
+	_ CredentialProvider = (*EnvCredentialProvider)(nil)
+	_ CredentialProvider = (*CommandCredentialProvider)(nil)
+	_ CredentialProvider = (*VaultCredentialProvider)(nil)
+)
+
+const (
+	defaultEnvCredentialsPrefix     = "BLUELOCK_"
+	defaultCredentialCommandTimeout = 10 * time.Second
+	defaultVaultMountPath           = "secret"
+	defaultVaultKVVersion           = 2
+	defaultVaultTokenEnvVar         = "VAULT_TOKEN"
+	vaultAddressEnvVar              = "VAULT_ADDR"
+)
+
+// NewCredentialProvider returns the provider selected by the configuration. The file provider reads authTokensFilePath
+// and the Vault provider sends its requests with httpClient.
+func NewCredentialProvider(cfg config.Credentials, authTokensFilePath string, httpClient *http.Client) (CredentialProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case config.CredentialProviderEnv:
+		return NewEnvCredentialProvider(cfg.Env.Prefix), nil
+	case config.CredentialProviderCommand:
+		return NewCommandCredentialProvider(cfg.Command.Path, cfg.Command.Args, time.Duration(cfg.Command.TimeoutSeconds)*time.Second), nil
+	case config.CredentialProviderVault:
+		return NewVaultCredentialProvider(cfg.Vault, httpClient)
+	default:
+		return NewFileCredentialProvider(authTokensFilePath), nil
+	}
+}
+
+// finalizeCredStore generates the credKeys that sources other than the file cannot persist, then applies the
+// validation every provider shares.
+func finalizeCredStore(credStore AuthCredentialStore) (AuthCredentialStore, error) {
+	for _, creds := range credStore {
+		for i := range creds {
+			creds[i].GenerateCredKeyIfAbsent()
+		}
+	}
+	if err := credStore.validateCredStore(); err != nil {
+		return nil, fmt.Errorf("invalid credential store: %w", err)
+	}
+	return credStore, nil
+}
+
+// FileCredentialProvider reads the auth tokens file, decrypting it when it is encrypted.
+type FileCredentialProvider struct {
+	FilePath string
+}
+
+func NewFileCredentialProvider(filePath string) *FileCredentialProvider {
+	return &FileCredentialProvider{filePath}
+}
+
+func (p *FileCredentialProvider) Name() string {
+	return "file:" + p.FilePath
+}
+
+func (p *FileCredentialProvider) LoadCredStore(ctx context.Context) (AuthCredentialStore, error) {
+	credStore, _, err := LoadAuthTokensFromFileAndValidate(p.FilePath)
+	return credStore, err
+}
+
+// EnvCredentialProvider reads numbered credentials from environment variables, e.g.
+// BLUELOCK_DATAPULL_CREDENTIALS_1_USERNAME and BLUELOCK_DATAPULL_CREDENTIALS_1_PASSWORD. Other credential types set
+// _TYPE along with _ACCESS_TOKEN, or _CLIENT_ID and _CLIENT_SECRET.
+type EnvCredentialProvider struct {
+	Prefix string
+}
+
+func NewEnvCredentialProvider(prefix string) *EnvCredentialProvider {
+	if prefix == "" {
+		prefix = defaultEnvCredentialsPrefix
+	}
+	return &EnvCredentialProvider{prefix}
+}
+
+func (p *EnvCredentialProvider) Name() string {
+	return "env:" + p.Prefix
+}
+
+var envCredentialPattern = regexp.MustCompile(`^([A-Z0-9_]+?)_(\d+)_(TYPE|USERNAME|PASSWORD|ACCESS_TOKEN|CLIENT_ID|CLIENT_SECRET)$`)
+
+func (p *EnvCredentialProvider) LoadCredStore(ctx context.Context) (AuthCredentialStore, error) {
+	storeKeysByEnvName := map[string]CredKey{}
+	for _, credKey := range []CredKey{DatapullCredentialsKey, CommitAnalysisCredentialsKey} {
+		storeKeysByEnvName[envName(string(credKey))] = credKey
+	}
+
+	type indexedCredential struct {
+		index int
+		cred  auth.Credential
+	}
+	found := map[CredKey]map[int]*auth.Credential{}
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, p.Prefix) {
+			continue
+		}
+		match := envCredentialPattern.FindStringSubmatch(strings.TrimPrefix(name, p.Prefix))
+		if match == nil {
+			continue
+		}
+		storeKey, ok := storeKeysByEnvName[match[1]]
+		if !ok {
+			continue
+		}
+		index, _ := strconv.Atoi(match[2])
+		if found[storeKey] == nil {
+			found[storeKey] = map[int]*auth.Credential{}
+		}
+		if found[storeKey][index] == nil {
+			found[storeKey][index] = &auth.Credential{}
+		}
+		cred := found[storeKey][index]
+		switch match[3] {
+		case "TYPE":
+			cred.Type = auth.CredentialType(value)
+		case "USERNAME":
+			cred.Username = value
+		case "PASSWORD":
+			cred.Password = value
+		case "ACCESS_TOKEN":
+			cred.AccessToken = value
+		case "CLIENT_ID":
+			cred.ClientID = value
+		case "CLIENT_SECRET":
+			cred.ClientSecret = value
+		}
+	}
+
+	credStore := AuthCredentialStore{}
+	for storeKey, credsByIndex := range found {
+		indexedCreds := make([]indexedCredential, 0, len(credsByIndex))
+		for index, cred := range credsByIndex {
+			indexedCreds = append(indexedCreds, indexedCredential{index, *cred})
+		}
+		sort.Slice(indexedCreds, func(i, j int) bool { return indexedCreds[i].index < indexedCreds[j].index })
+		for _, indexedCred := range indexedCreds {
+			credStore[storeKey] = append(credStore[storeKey], indexedCred.cred)
+		}
+	}
+	return finalizeCredStore(credStore)
+}
+
+// envName turns a camel case store key such as datapullCredentials into DATAPULL_CREDENTIALS.
+func envName(camelCase string) string {
+	var builder strings.Builder
+	for i, r := range camelCase {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			builder.WriteByte('_')
+		}
+		builder.WriteRune(r)
+	}
+	return strings.ToUpper(builder.String())
+}
+
+// CommandCredentialProvider runs an external command that prints the credential store as JSON on stdout.
+type CommandCredentialProvider struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+func NewCommandCredentialProvider(path string, args []string, timeout time.Duration) *CommandCredentialProvider {
+	if timeout <= 0 {
+		timeout = defaultCredentialCommandTimeout
+	}
+	return &CommandCredentialProvider{path, args, timeout}
+}
+
+func (p *CommandCredentialProvider) Name() string {
+	return "command:" + p.Path
+}
+
+func (p *CommandCredentialProvider) LoadCredStore(ctx context.Context) (AuthCredentialStore, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var credStore AuthCredentialStore
+	if err := json.Unmarshal(stdout.Bytes(), &credStore); err != nil {
+		// the output holds the secrets, so it is not part of the error
+		return nil, fmt.Errorf("credential command did not print a JSON credential store: %w", err)
+	}
+	return finalizeCredStore(credStore)
+}
+
+// VaultCredentialProvider reads the credential store from a secret of a Vault compatible KV secrets engine.
+// The secret data is the credential store itself, e.g. {"datapullCredentials": [...]}.
+type VaultCredentialProvider struct {
+	Address    string
+	Namespace  string
+	MountPath  string
+	SecretPath string
+	KVVersion  int
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewVaultCredentialProvider(cfg config.VaultCredentials, httpClient *http.Client) (*VaultCredentialProvider, error) {
+	provider := &VaultCredentialProvider{
+		Address:    cfg.Address,
+		Namespace:  cfg.Namespace,
+		MountPath:  cfg.MountPath,
+		SecretPath: cfg.SecretPath,
+		KVVersion:  cfg.KVVersion,
+		HTTPClient: httpClient,
+	}
+	if provider.Address == "" {
+		provider.Address = os.Getenv(vaultAddressEnvVar)
+	}
+	if provider.Address == "" {
+		return nil, fmt.Errorf("vault address is required: set credentials.vault.address or %s", vaultAddressEnvVar)
+	}
+	if provider.MountPath == "" {
+		provider.MountPath = defaultVaultMountPath
+	}
+	if provider.KVVersion == 0 {
+		provider.KVVersion = defaultVaultKVVersion
+	}
+	tokenEnvVar := cfg.TokenEnvVar
+	if tokenEnvVar == "" {
+		tokenEnvVar = defaultVaultTokenEnvVar
+	}
+	if provider.Token = os.Getenv(tokenEnvVar); provider.Token == "" {
+		return nil, fmt.Errorf("vault token is required: set %s", tokenEnvVar)
+	}
+	return provider, nil
+}
+
+func (p *VaultCredentialProvider) Name() string {
+	return "vault:" + p.MountPath + "/" + p.SecretPath
+}
+
+func (p *VaultCredentialProvider) secretURL() string {
+	mountPath := strings.Trim(p.MountPath, "/")
+	secretPath := strings.Trim(p.SecretPath, "/")
+	if p.KVVersion == 2 {
+		return fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(p.Address, "/"), mountPath, secretPath)
+	}
+	return fmt.Sprintf("%s/v1/%s/%s", strings.TrimRight(p.Address, "/"), mountPath, secretPath)
+}
+
+func (p *VaultCredentialProvider) LoadCredStore(ctx context.Context) (AuthCredentialStore, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.secretURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	request.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		request.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	response, err := p.HTTPClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read vault secret %s: status code %d", p.Name(), response.StatusCode)
+	}
+
+	var secret struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vault response: %w", err)
+	}
+	data := secret.Data
+	if p.KVVersion == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(secret.Data, &versioned); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal vault KV v2 secret: %w", err)
+		}
+		data = versioned.Data
+	}
+
+	var credStore AuthCredentialStore
+	if err := json.Unmarshal(data, &credStore); err != nil {
+		return nil, fmt.Errorf("vault secret is not a credential store: %w", err)
+	}
+	return finalizeCredStore(credStore)
+}
@@ -0,0 +1,130 @@
+package credservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCredStoreJSON = `{"datapullCredentials": [{"username": "user_1", "password": "password_1"}, {"username": "user_2", "password": "password_2"}]}`
+
+func TestEnvCredentialProvider(t *testing.T) {
+	t.Setenv("TEST_BL_DATAPULL_CREDENTIALS_2_USERNAME", "user_2")
+	t.Setenv("TEST_BL_DATAPULL_CREDENTIALS_2_PASSWORD", "password_2")
+	t.Setenv("TEST_BL_DATAPULL_CREDENTIALS_10_USERNAME", "user_10")
+	t.Setenv("TEST_BL_DATAPULL_CREDENTIALS_10_PASSWORD", "password_10")
+	t.Setenv("TEST_BL_COMMIT_ANALYSIS_CREDENTIALS_1_USERNAME", "user_4")
+	t.Setenv("TEST_BL_COMMIT_ANALYSIS_CREDENTIALS_1_PASSWORD", "password_4")
+	t.Setenv("TEST_BL_COMMIT_ANALYSIS_CREDENTIALS_2_TYPE", "oauthClientCredentials")
+	t.Setenv("TEST_BL_COMMIT_ANALYSIS_CREDENTIALS_2_CLIENT_ID", "client_id")
+	t.Setenv("TEST_BL_COMMIT_ANALYSIS_CREDENTIALS_2_CLIENT_SECRET", "client_secret")
+	t.Setenv("TEST_BL_UNKNOWN_CREDENTIALS_1_USERNAME", "ignored")
+
+	credStore, err := NewEnvCredentialProvider("TEST_BL_").LoadCredStore(context.Background())
+	require.NoError(t, err)
+	require.Len(t, credStore[DatapullCredentialsKey], 2)
+	assert.Equal(t, "user_2", credStore[DatapullCredentialsKey][0].Username, "credentials are ordered by number")
+	assert.Equal(t, "user_10", credStore[DatapullCredentialsKey][1].Username)
+	assert.NotEmpty(t, credStore[DatapullCredentialsKey][0].CredKey, "credKeys are generated")
+	assert.Equal(t, "password_4", credStore[CommitAnalysisCredentialsKey][0].Password)
+	assert.Equal(t, auth.OAuthClientCredentials, credStore[CommitAnalysisCredentialsKey][1].Type)
+	assert.Equal(t, "client_secret", credStore[CommitAnalysisCredentialsKey][1].ClientSecret)
+	assert.Len(t, credStore, 2)
+
+	t.Setenv("TEST_BL_DATAPULL_CREDENTIALS_10_PASSWORD", "")
+	_, err = NewEnvCredentialProvider("TEST_BL_").LoadCredStore(context.Background())
+	assert.Error(t, err, "credentials without password are rejected")
+}
+
+func TestCommandCredentialProvider(t *testing.T) {
+	provider := NewCommandCredentialProvider("sh", []string{"-c", "printf '%s' '" + testCredStoreJSON + "'"}, time.Second)
+	credStore, err := provider.LoadCredStore(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, credStore[DatapullCredentialsKey], 2)
+
+	_, err = NewCommandCredentialProvider("sh", []string{"-c", "echo 'vault sealed' >&2; exit 3"}, time.Second).LoadCredStore(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault sealed")
+
+	_, err = NewCommandCredentialProvider("sh", []string{"-c", "echo '{\"commitAnalysisCredentials\": []}'"}, time.Second).LoadCredStore(context.Background())
+	assert.Error(t, err, "the datapull credentials are required")
+
+	_, err = NewCommandCredentialProvider("sh", []string{"-c", "sleep 5"}, 50*time.Millisecond).LoadCredStore(context.Background())
+	assert.Error(t, err, "slow commands are killed")
+}
+
+func TestVaultCredentialProvider(t *testing.T) {
+	var credStore map[string]any
+	require.NoError(t, json.Unmarshal([]byte(testCredStoreJSON), &credStore))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/bluelock/datapull":
+			assert.Equal(t, "team-a", r.Header.Get("X-Vault-Namespace"))
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": credStore, "metadata": map[string]any{"version": 3}}})
+		case "/v1/secret/bluelock/datapull":
+			json.NewEncoder(w).Encode(map[string]any{"data": credStore})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("TEST_VAULT_TOKEN", "vault-token")
+
+	kvV2, err := NewVaultCredentialProvider(config.VaultCredentials{
+		Address: server.URL, Namespace: "team-a", MountPath: "kv", SecretPath: "bluelock/datapull", TokenEnvVar: "TEST_VAULT_TOKEN",
+	}, server.Client())
+	require.NoError(t, err)
+	loaded, err := kvV2.LoadCredStore(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, loaded[DatapullCredentialsKey], 2)
+
+	kvV1, err := NewVaultCredentialProvider(config.VaultCredentials{
+		Address: server.URL + "/", SecretPath: "/bluelock/datapull", KVVersion: 1, TokenEnvVar: "TEST_VAULT_TOKEN",
+	}, server.Client())
+	require.NoError(t, err)
+	loaded, err = kvV1.LoadCredStore(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "user_1", loaded[DatapullCredentialsKey][0].Username)
+
+	t.Setenv("TEST_VAULT_TOKEN", "")
+	_, err = NewVaultCredentialProvider(config.VaultCredentials{Address: server.URL, SecretPath: "bluelock/datapull", TokenEnvVar: "TEST_VAULT_TOKEN"}, server.Client())
+	assert.Error(t, err, "a token is required")
+
+	kvV2.Token = "wrong-token"
+	_, err = kvV2.LoadCredStore(context.Background())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "wrong-token")
+}
+
+func TestNewCredentialProvider(t *testing.T) {
+	provider, err := NewCredentialProvider(config.Credentials{}, "secrets/auth_tokens.json", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "file:secrets/auth_tokens.json", provider.Name())
+
+	provider, err = NewCredentialProvider(config.Credentials{Provider: config.CredentialProviderEnv}, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "env:BLUELOCK_", provider.Name())
+
+	_, err = NewCredentialProvider(config.Credentials{Provider: config.CredentialProviderCommand}, "", nil)
+	assert.Error(t, err, "the command provider needs a command")
+	_, err = NewCredentialProvider(config.Credentials{Provider: "keychain"}, "", nil)
+	assert.Error(t, err)
+
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	httpClient := &http.Client{}
+	provider, err = NewCredentialProvider(config.Credentials{Provider: config.CredentialProviderVault, Vault: config.VaultCredentials{Address: "https://vault.example.com", SecretPath: "bluelock"}}, "", httpClient)
+	require.NoError(t, err)
+	assert.Same(t, httpClient, provider.(*VaultCredentialProvider).HTTPClient)
+}
@@ -0,0 +1,125 @@
+package credservice
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+)
+
+// defaultCredentialPollInterval is how often the file provider's auth tokens file is checked for changes.
+const defaultCredentialPollInterval = 10 * time.Second
+
+// CredentialReloader reloads the credentials while the process runs, so tokens can be added or revoked without a
+// restart. A reload is triggered by SIGHUP, and for the file provider also by a change of the auth tokens file.
+type CredentialReloader struct {
+	logger        *shared.CustomLogger
+	provider      CredentialProvider
+	fingerprinter *auth.Fingerprinter
+	credentialKey CredKey
+	// onReload receives the new credentials, it must swap them into the services using the credentials.
+	onReload     func([]auth.Credential) error
+	PollInterval time.Duration
+	lastModTime  time.Time
+}
+
+// NewCredentialReloader returns a reloader for the credentials loaded by InitializeAuthCredentialStore.
+func NewCredentialReloader(logger *shared.CustomLogger, provider CredentialProvider, fingerprintKeyFilePath string, credentialKey CredKey, onReload func([]auth.Credential) error) (*CredentialReloader, error) {
+	fingerprintKey, err := auth.LoadOrCreateFingerprintKey(fingerprintKeyFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token fingerprint key: %w", err)
+	}
+	reloader := &CredentialReloader{
+		logger:        logger,
+		provider:      provider,
+		fingerprinter: auth.NewFingerprinter(fingerprintKey),
+		credentialKey: credentialKey,
+		onReload:      onReload,
+		PollInterval:  defaultCredentialPollInterval,
+	}
+	reloader.lastModTime, _ = reloader.modTime()
+	return reloader, nil
+}
+
+// Reload loads and validates the credentials again and hands them to onReload. An invalid credential store is
+// rejected and the current credentials stay in use. It reports whether the token set changed.
+func (r *CredentialReloader) Reload(ctx context.Context) (bool, error) {
+	credStore, creds, err := loadCredentials(ctx, r.provider, r.fingerprinter, r.credentialKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to reload credentials, keeping the current ones: %w", err)
+	}
+
+	// rewrites that keep the same tokens, e.g. by authsync normalize, would otherwise reset the token states
+	if slices.Equal(tokenIDs(creds), tokenIDs(AcquireCredentials())) {
+		r.logger.Info("Credentials reloaded, the tokens are unchanged", "provider", r.provider.Name())
+		return false, nil
+	}
+
+	if err := r.onReload(creds); err != nil {
+		return false, fmt.Errorf("failed to apply reloaded credentials: %w", err)
+	}
+	credentialsMu.Lock()
+	authCredentialStore, credentials = credStore, creds
+	credentialsMu.Unlock()
+	r.logger.Info("Credentials reloaded", "provider", r.provider.Name(), "credentials", creds)
+	return true, nil
+}
+
+func tokenIDs(creds []auth.Credential) []string {
+	ids := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		ids = append(ids, cred.TokenID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// modTime returns the modification time of the auth tokens file of the file provider.
+func (r *CredentialReloader) modTime() (time.Time, bool) {
+	fileProvider, ok := r.provider.(*FileCredentialProvider)
+	if !ok {
+		return time.Time{}, false
+	}
+	info, err := os.Stat(fileProvider.FilePath)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// Watch reloads the credentials on SIGHUP and, for the file provider, when the auth tokens file changes. It blocks
+// until ctx is done, reload errors are logged.
+func (r *CredentialReloader) Watch(ctx context.Context) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+			r.logger.Info("Received SIGHUP. Reloading credentials...")
+			r.lastModTime, _ = r.modTime()
+		case <-ticker.C:
+			modTime, ok := r.modTime()
+			if !ok || modTime.Equal(r.lastModTime) {
+				continue
+			}
+			r.logger.Info("Auth tokens file changed. Reloading credentials...")
+			r.lastModTime = modTime
+		}
+		if _, err := r.Reload(ctx); err != nil {
+			r.logger.Error("Failed to reload credentials", "error", err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package credservice
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCredentialReloader(t *testing.T, onReload func([]auth.Credential) error) (*CredentialReloader, string) {
+	filePath := newTestCredStoreFile(t)
+	fingerprintKeyFilePath := filepath.Join(t.TempDir(), FingerprintKeyFileName)
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	reloader, err := NewCredentialReloader(logger, NewFileCredentialProvider(filePath), fingerprintKeyFilePath, DatapullCredentialsKey, onReload)
+	require.NoError(t, err)
+
+	credStore, creds, err := loadCredentials(context.Background(), reloader.provider, reloader.fingerprinter, DatapullCredentialsKey)
+	require.NoError(t, err)
+	credentialsMu.Lock()
+	authCredentialStore, credentials = credStore, creds
+	credentialsMu.Unlock()
+	t.Cleanup(func() {
+		credentialsMu.Lock()
+		authCredentialStore, credentials = nil, nil
+		credentialsMu.Unlock()
+	})
+	return reloader, filePath
+}
+
+func TestCredentialReloaderReload(t *testing.T) {
+	var reloaded []auth.Credential
+	reloader, filePath := newTestCredentialReloader(t, func(creds []auth.Credential) error {
+		reloaded = creds
+		return nil
+	})
+
+	changed, err := reloader.Reload(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed, "the same tokens are not applied again")
+	assert.Nil(t, reloaded)
+
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"datapullCredentials": [{"credKey": "datapull_user_1", "username": "user_1", "password": "password_1"}]}`), 0600))
+	changed, err = reloader.Reload(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	require.Len(t, reloaded, 1)
+	assert.NotEmpty(t, reloaded[0].TokenID, "reloaded credentials have their token IDs")
+	assert.Equal(t, reloaded, AcquireCredentials())
+
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"datapullCredentials": [{"username": "user_1"}]}`), 0600))
+	_, err = reloader.Reload(context.Background())
+	assert.Error(t, err, "an invalid credential store is rejected")
+	assert.Len(t, AcquireCredentials(), 1, "the current credentials stay in use")
+}
+
+func TestCredentialReloaderReloadRejectedByService(t *testing.T) {
+	reloader, filePath := newTestCredentialReloader(t, func(creds []auth.Credential) error {
+		return assert.AnError
+	})
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"datapullCredentials": [{"credKey": "datapull_user_1", "username": "user_1", "password": "password_1"}]}`), 0600))
+
+	_, err := reloader.Reload(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Len(t, AcquireCredentials(), 3)
+}
+
+func TestCredentialReloaderWatchesFile(t *testing.T) {
+	reloadedChan := make(chan []auth.Credential, 1)
+	reloader, filePath := newTestCredentialReloader(t, func(creds []auth.Credential) error {
+		reloadedChan <- creds
+		return nil
+	})
+	reloader.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"datapullCredentials": [{"credKey": "datapull_user_9", "username": "user_9", "password": "password_9"}]}`), 0600))
+	select {
+	case reloaded := <-reloadedChan:
+		require.Len(t, reloaded, 1)
+		assert.Equal(t, "user_9", reloaded[0].Username)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the changed auth tokens file was not reloaded")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	tokenIDPrefix         = "tok-"
+	fingerprintKeyByteLen = 32
+)
+
+// Fingerprinter derives the token ID of a credential: an HMAC of its credKey that identifies the token in state
+// files and logs without revealing the secret behind it.
+type Fingerprinter struct {
+	key []byte
+}
+
+func NewFingerprinter(key []byte) *Fingerprinter {
+	return &Fingerprinter{key}
+}
+
+func (f *Fingerprinter) Fingerprint(credKey string) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write([]byte(credKey))
+	return tokenIDPrefix + hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// AssignTokenIDs sets the token ID of every credential.
+func (f *Fingerprinter) AssignTokenIDs(creds []Credential) {
+	for i := range creds {
+		creds[i].TokenID = f.Fingerprint(creds[i].CredKey)
+	}
+}
+
+// IsTokenID reports whether id is a token ID rather than a raw credKey.
+func IsTokenID(id string) bool {
+	return strings.HasPrefix(id, tokenIDPrefix)
+}
+
+// LoadOrCreateFingerprintKey reads the HMAC key of the token IDs, generating it on first use.
+// The key must stay stable, otherwise every token ID changes and the token states are lost.
+func LoadOrCreateFingerprintKey(filePath string) ([]byte, error) {
+	key, err := os.ReadFile(filePath)
+	if err == nil {
+		if len(key) < fingerprintKeyByteLen {
+			return nil, fmt.Errorf("fingerprint key %s is shorter than %d bytes", filePath, fingerprintKeyByteLen)
+		}
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read fingerprint key: %w", err)
+	}
+
+	key = make([]byte, fingerprintKeyByteLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate fingerprint key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create fingerprint key directory: %w", err)
+	}
+	// O_EXCL so that two processes starting together agree on the key that won
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return LoadOrCreateFingerprintKey(filePath)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create fingerprint key: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(key); err != nil {
+		return nil, fmt.Errorf("failed to write fingerprint key: %w", err)
+	}
+	return key, nil
+}
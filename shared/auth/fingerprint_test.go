@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	credKey := "dXNlcjpwYXNzd29yZA=="
+	fingerprinter := NewFingerprinter([]byte("key-1"))
+
+	tokenID := fingerprinter.Fingerprint(credKey)
+	assert.True(t, IsTokenID(tokenID))
+	assert.NotContains(t, tokenID, credKey)
+	assert.Equal(t, tokenID, fingerprinter.Fingerprint(credKey), "token IDs are stable")
+	assert.NotEqual(t, tokenID, NewFingerprinter([]byte("key-2")).Fingerprint(credKey), "token IDs depend on the key")
+	assert.NotEqual(t, tokenID, fingerprinter.Fingerprint("b3RoZXI6cGFzc3dvcmQ="))
+
+	creds := []Credential{{Username: "user", Password: "password", CredKey: credKey}}
+	fingerprinter.AssignTokenIDs(creds)
+	assert.Equal(t, tokenID, creds[0].TokenID)
+	assert.Equal(t, tokenID, creds[0].Redacted())
+	assert.Equal(t, tokenID, MaskCredKey(tokenID), "token IDs are safe to print")
+	assert.NotContains(t, MaskCredKey(credKey), credKey)
+
+	cred, err := GetCredentialByTokenID(tokenID, creds)
+	require.NoError(t, err)
+	assert.Equal(t, "user", cred.Username)
+	_, err = GetCredentialByTokenID(credKey, creds)
+	assert.Error(t, err)
+}
+
+func TestLoadOrCreateFingerprintKey(t *testing.T) {
+	keyFilePath := filepath.Join(t.TempDir(), "secrets", "token_fingerprint.key")
+
+	key, err := LoadOrCreateFingerprintKey(keyFilePath)
+	require.NoError(t, err)
+	assert.Len(t, key, fingerprintKeyByteLen)
+	info, err := os.Stat(keyFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reloadedKey, err := LoadOrCreateFingerprintKey(keyFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, key, reloadedKey)
+
+	require.NoError(t, os.WriteFile(keyFilePath, []byte("short"), 0600))
+	_, err = LoadOrCreateFingerprintKey(keyFilePath)
+	assert.Error(t, err)
+}
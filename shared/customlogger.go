@@ -41,6 +41,8 @@ func NewCustomLogger(filepath string, handlerType HandlerType) (*CustomLogger, *
 				if ok {
 					a.Value = slog.StringValue(handleSourcePath(RootDir, source))
 				}
+			default:
+				a = RedactSecretAttr(group, a)
 			}
 			return a
 		},
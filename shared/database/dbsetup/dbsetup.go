@@ -13,6 +13,28 @@ import (
 
 var db database.DBTX
 var querier database.Querier
+var txRunner TxRunner
+
+// TxRunner runs fn with a querier whose queries are committed together when fn succeeds, and rolled back otherwise.
+type TxRunner func(fn func(database.Querier) error) error
+
+// NewTxRunner returns a TxRunner beginning its transactions on sqlDB.
+func NewTxRunner(sqlDB *sql.DB) TxRunner {
+	return func(fn func(database.Querier) error) error {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		if err := fn(database.New(sqlDB).WithTx(tx)); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	}
+}
 
 func InitializeDb() (*sql.DB, error) {
 	if db != nil {
@@ -25,9 +47,34 @@ func InitializeDb() (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	querier = database.New(db)
+	txRunner = NewTxRunner(db.(*sql.DB))
 	return db.(*sql.DB), nil
 }
 
+// InitializeDryRunDb opens the database like InitializeDb, but every query made through AcquireQuerier
+// runs inside the returned transaction. The caller must roll it back so a dry run never persists anything.
+func InitializeDryRunDb() (*sql.DB, *sql.Tx, error) {
+	if db != nil {
+		return nil, nil, fmt.Errorf("database already initialized")
+	}
+
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(shared.RootDir, "database.db"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("failed to begin dry run transaction: %w", err)
+	}
+
+	db = sqlDB
+	querier = database.New(sqlDB).WithTx(tx)
+	// the dry run transaction is never committed, the queries of a TxRunner run in it
+	txRunner = func(fn func(database.Querier) error) error { return fn(querier) }
+	return sqlDB, tx, nil
+}
+
 func AcquireQuerier() database.Querier {
 	if db == nil {
 		panic("database not initialized, call InitializeDb first")
@@ -37,3 +84,11 @@ func AcquireQuerier() database.Querier {
 	}
 	return querier
 }
+
+// AcquireTxRunner returns the TxRunner of the database opened by InitializeDb or InitializeDryRunDb.
+func AcquireTxRunner() TxRunner {
+	if txRunner == nil {
+		panic("database not initialized, call InitializeDb first")
+	}
+	return txRunner
+}
@@ -9,14 +9,65 @@ import (
 	"time"
 )
 
+type ActivitySyncCursor struct {
+	Provider     string    `json:"provider"`
+	RepoUuid     string    `json:"repo_uuid"`
+	LastSyncedAt time.Time `json:"last_synced_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CommitSyncCursor struct {
+	Provider       string    `json:"provider"`
+	RepoUuid       string    `json:"repo_uuid"`
+	Branch         string    `json:"branch"`
+	LastCommitHash string    `json:"last_commit_hash"`
+	LastCommitDate time.Time `json:"last_commit_date"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Identity struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type IdentityAlias struct {
+	Kind       string    `json:"kind"`
+	Value      string    `json:"value"`
+	IdentityID string    `json:"identity_id"`
+	Source     string    `json:"source"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type PullRequestSyncCursor struct {
+	Provider           string    `json:"provider"`
+	RepoUuid           string    `json:"repo_uuid"`
+	UpdatedOnWatermark time.Time `json:"updated_on_watermark"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type RelayedCommit struct {
+	Provider  string    `json:"provider"`
+	RepoUuid  string    `json:"repo_uuid"`
+	Hash      string    `json:"hash"`
+	RelayedAt time.Time `json:"relayed_at"`
+}
+
 type RepositorySyncAudit struct {
-	ID                 string         `json:"id"`
-	RepoName           string         `json:"repo_name"`
-	WorkspaceSlug      string         `json:"workspace_slug"`
-	Active             bool           `json:"active"`
-	SuccessfulSyncTime sql.NullTime   `json:"successful_sync_time"`
-	UpdatedAt          time.Time      `json:"updated_at"`
-	CreatedAt          time.Time      `json:"created_at"`
-	Success            bool           `json:"success"`
-	ErrorContext       sql.NullString `json:"error_context"`
+	Provider            string         `json:"provider"`
+	RepoUuid            string         `json:"repo_uuid"`
+	RepoSlug            string         `json:"repo_slug"`
+	RepoName            string         `json:"repo_name"`
+	WorkspaceSlug       string         `json:"workspace_slug"`
+	Active              bool           `json:"active"`
+	SuccessfulSyncTime  sql.NullTime   `json:"successful_sync_time"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	CreatedAt           time.Time      `json:"created_at"`
+	Success             bool           `json:"success"`
+	ErrorContext        sql.NullString `json:"error_context"`
+	ConsecutiveFailures int64          `json:"consecutive_failures"`
+	MainBranch          string         `json:"main_branch"`
 }
@@ -9,12 +9,45 @@ import (
 )
 
 type Querier interface {
+	CountIdentityAliasesByKind(ctx context.Context, arg CountIdentityAliasesByKindParams) (int64, error)
+	CountIdentityAliasesBySource(ctx context.Context, arg CountIdentityAliasesBySourceParams) (int64, error)
+	CreateRelayedCommit(ctx context.Context, arg CreateRelayedCommitParams) error
 	CreateRepoSyncAudit(ctx context.Context, arg CreateRepoSyncAuditParams) (RepositorySyncAudit, error)
-	DeleteInactiveRepoSyncAudit(ctx context.Context, id string) (RepositorySyncAudit, error)
-	GetRepoSyncAuditByID(ctx context.Context, id string) (RepositorySyncAudit, error)
+	DeleteActivitySyncCursor(ctx context.Context, arg DeleteActivitySyncCursorParams) error
+	DeleteCommitSyncCursor(ctx context.Context, arg DeleteCommitSyncCursorParams) error
+	DeleteCommitSyncCursors(ctx context.Context, arg DeleteCommitSyncCursorsParams) error
+	DeleteIdentity(ctx context.Context, id string) error
+	DeleteIdentityAliasesBySource(ctx context.Context, source string) error
+	DeleteInactiveRepoSyncAudit(ctx context.Context, arg DeleteInactiveRepoSyncAuditParams) (RepositorySyncAudit, error)
+	DeleteOrphanIdentities(ctx context.Context) error
+	DeletePullRequestSyncCursor(ctx context.Context, arg DeletePullRequestSyncCursorParams) error
+	DeleteRelayedCommits(ctx context.Context, arg DeleteRelayedCommitsParams) error
+	GetActivitySyncCursor(ctx context.Context, arg GetActivitySyncCursorParams) (ActivitySyncCursor, error)
+	GetCommitSyncCursor(ctx context.Context, arg GetCommitSyncCursorParams) (CommitSyncCursor, error)
+	GetIdentity(ctx context.Context, id string) (Identity, error)
+	GetIdentityAlias(ctx context.Context, arg GetIdentityAliasParams) (IdentityAlias, error)
+	GetPullRequestSyncCursor(ctx context.Context, arg GetPullRequestSyncCursorParams) (PullRequestSyncCursor, error)
+	GetRelayedCommit(ctx context.Context, arg GetRelayedCommitParams) (RelayedCommit, error)
+	GetRepoSyncAudit(ctx context.Context, arg GetRepoSyncAuditParams) (RepositorySyncAudit, error)
+	GetRepoSyncAuditBySlug(ctx context.Context, arg GetRepoSyncAuditBySlugParams) (RepositorySyncAudit, error)
 	ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(ctx context.Context, arg ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAtParams) ([]RepositorySyncAudit, error)
+	ListCommitSyncCursors(ctx context.Context, arg ListCommitSyncCursorsParams) ([]CommitSyncCursor, error)
+	ListInactiveRepoSyncAuditUpdatedBefore(ctx context.Context, arg ListInactiveRepoSyncAuditUpdatedBeforeParams) ([]RepositorySyncAudit, error)
+	ListRepoSyncAudits(ctx context.Context) ([]RepositorySyncAudit, error)
+	ReassignActivitySyncCursor(ctx context.Context, arg ReassignActivitySyncCursorParams) error
+	ReassignCommitSyncCursors(ctx context.Context, arg ReassignCommitSyncCursorsParams) error
+	ReassignIdentityAliases(ctx context.Context, arg ReassignIdentityAliasesParams) error
+	ReassignPullRequestSyncCursor(ctx context.Context, arg ReassignPullRequestSyncCursorParams) error
+	ReassignRelayedCommits(ctx context.Context, arg ReassignRelayedCommitsParams) error
 	UpdateRepoSyncAudit(ctx context.Context, arg UpdateRepoSyncAuditParams) (RepositorySyncAudit, error)
 	UpdateRepoSyncAuditActiveStatus(ctx context.Context, arg UpdateRepoSyncAuditActiveStatusParams) (RepositorySyncAudit, error)
+	UpdateRepoSyncAuditLocation(ctx context.Context, arg UpdateRepoSyncAuditLocationParams) (RepositorySyncAudit, error)
+	UpdateRepoSyncAuditRepoUUID(ctx context.Context, arg UpdateRepoSyncAuditRepoUUIDParams) (RepositorySyncAudit, error)
+	UpsertActivitySyncCursor(ctx context.Context, arg UpsertActivitySyncCursorParams) (ActivitySyncCursor, error)
+	UpsertCommitSyncCursor(ctx context.Context, arg UpsertCommitSyncCursorParams) (CommitSyncCursor, error)
+	UpsertIdentity(ctx context.Context, arg UpsertIdentityParams) (Identity, error)
+	UpsertIdentityAlias(ctx context.Context, arg UpsertIdentityAliasParams) error
+	UpsertPullRequestSyncCursor(ctx context.Context, arg UpsertPullRequestSyncCursorParams) (PullRequestSyncCursor, error)
 }
 
 var _ Querier = (*Queries)(nil)
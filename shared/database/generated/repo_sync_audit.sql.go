@@ -11,15 +11,18 @@ import (
 )
 
 const createRepoSyncAudit = `-- name: CreateRepoSyncAudit :one
-INSERT INTO repository_sync_audit (id, repo_name, workspace_slug, successful_sync_time, success, error_context)
-VALUES (?1, ?2, ?3, ?4, ?5, ?6)
-RETURNING id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+INSERT INTO repository_sync_audit (provider, repo_uuid, repo_slug, repo_name, workspace_slug, main_branch, successful_sync_time, success, error_context)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 `
 
 type CreateRepoSyncAuditParams struct {
-	ID                 string         `json:"id"`
+	Provider           string         `json:"provider"`
+	RepoUuid           string         `json:"repo_uuid"`
+	RepoSlug           string         `json:"repo_slug"`
 	RepoName           string         `json:"repo_name"`
 	WorkspaceSlug      string         `json:"workspace_slug"`
+	MainBranch         string         `json:"main_branch"`
 	SuccessfulSyncTime sql.NullTime   `json:"successful_sync_time"`
 	Success            bool           `json:"success"`
 	ErrorContext       sql.NullString `json:"error_context"`
@@ -27,16 +30,21 @@ type CreateRepoSyncAuditParams struct {
 
 func (q *Queries) CreateRepoSyncAudit(ctx context.Context, arg CreateRepoSyncAuditParams) (RepositorySyncAudit, error) {
 	row := q.db.QueryRowContext(ctx, createRepoSyncAudit,
-		arg.ID,
+		arg.Provider,
+		arg.RepoUuid,
+		arg.RepoSlug,
 		arg.RepoName,
 		arg.WorkspaceSlug,
+		arg.MainBranch,
 		arg.SuccessfulSyncTime,
 		arg.Success,
 		arg.ErrorContext,
 	)
 	var i RepositorySyncAudit
 	err := row.Scan(
-		&i.ID,
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
 		&i.RepoName,
 		&i.WorkspaceSlug,
 		&i.Active,
@@ -45,21 +53,30 @@ func (q *Queries) CreateRepoSyncAudit(ctx context.Context, arg CreateRepoSyncAud
 		&i.CreatedAt,
 		&i.Success,
 		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
 	)
 	return i, err
 }
 
 const deleteInactiveRepoSyncAudit = `-- name: DeleteInactiveRepoSyncAudit :one
 DELETE FROM repository_sync_audit
-WHERE id = ?1 AND active = FALSE
-RETURNING id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+WHERE provider = ?1 AND repo_uuid = ?2 AND active = FALSE
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 `
 
-func (q *Queries) DeleteInactiveRepoSyncAudit(ctx context.Context, id string) (RepositorySyncAudit, error) {
-	row := q.db.QueryRowContext(ctx, deleteInactiveRepoSyncAudit, id)
+type DeleteInactiveRepoSyncAuditParams struct {
+	Provider string `json:"provider"`
+	RepoUuid string `json:"repo_uuid"`
+}
+
+func (q *Queries) DeleteInactiveRepoSyncAudit(ctx context.Context, arg DeleteInactiveRepoSyncAuditParams) (RepositorySyncAudit, error) {
+	row := q.db.QueryRowContext(ctx, deleteInactiveRepoSyncAudit, arg.Provider, arg.RepoUuid)
 	var i RepositorySyncAudit
 	err := row.Scan(
-		&i.ID,
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
 		&i.RepoName,
 		&i.WorkspaceSlug,
 		&i.Active,
@@ -68,21 +85,30 @@ func (q *Queries) DeleteInactiveRepoSyncAudit(ctx context.Context, id string) (R
 		&i.CreatedAt,
 		&i.Success,
 		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
 	)
 	return i, err
 }
 
-const getRepoSyncAuditByID = `-- name: GetRepoSyncAuditByID :one
-SELECT id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+const getRepoSyncAudit = `-- name: GetRepoSyncAudit :one
+SELECT provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 FROM repository_sync_audit
-WHERE id = ?1
+WHERE provider = ?1 AND repo_uuid = ?2
 `
 
-func (q *Queries) GetRepoSyncAuditByID(ctx context.Context, id string) (RepositorySyncAudit, error) {
-	row := q.db.QueryRowContext(ctx, getRepoSyncAuditByID, id)
+type GetRepoSyncAuditParams struct {
+	Provider string `json:"provider"`
+	RepoUuid string `json:"repo_uuid"`
+}
+
+func (q *Queries) GetRepoSyncAudit(ctx context.Context, arg GetRepoSyncAuditParams) (RepositorySyncAudit, error) {
+	row := q.db.QueryRowContext(ctx, getRepoSyncAudit, arg.Provider, arg.RepoUuid)
 	var i RepositorySyncAudit
 	err := row.Scan(
-		&i.ID,
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
 		&i.RepoName,
 		&i.WorkspaceSlug,
 		&i.Active,
@@ -91,25 +117,120 @@ func (q *Queries) GetRepoSyncAuditByID(ctx context.Context, id string) (Reposito
 		&i.CreatedAt,
 		&i.Success,
 		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
+	)
+	return i, err
+}
+
+const getRepoSyncAuditBySlug = `-- name: GetRepoSyncAuditBySlug :one
+SELECT provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
+FROM repository_sync_audit
+WHERE provider = ?1 AND workspace_slug = ?2 AND repo_slug = ?3
+ORDER BY active DESC, updated_at DESC
+LIMIT 1
+`
+
+type GetRepoSyncAuditBySlugParams struct {
+	Provider      string `json:"provider"`
+	WorkspaceSlug string `json:"workspace_slug"`
+	RepoSlug      string `json:"repo_slug"`
+}
+
+func (q *Queries) GetRepoSyncAuditBySlug(ctx context.Context, arg GetRepoSyncAuditBySlugParams) (RepositorySyncAudit, error) {
+	row := q.db.QueryRowContext(ctx, getRepoSyncAuditBySlug,
+		arg.Provider,
+		arg.WorkspaceSlug,
+		arg.RepoSlug,
+	)
+	var i RepositorySyncAudit
+	err := row.Scan(
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
+		&i.RepoName,
+		&i.WorkspaceSlug,
+		&i.Active,
+		&i.SuccessfulSyncTime,
+		&i.UpdatedAt,
+		&i.CreatedAt,
+		&i.Success,
+		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
 	)
 	return i, err
 }
 
 const listActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt = `-- name: ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt :many
-SELECT id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+SELECT provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 FROM repository_sync_audit
-WHERE active = TRUE
+WHERE provider = ?1 AND active = TRUE
 ORDER BY successful_sync_time ASC, created_at ASC
-LIMIT ?2 OFFSET ?1
+LIMIT ?3 OFFSET ?2
 `
 
 type ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAtParams struct {
-	Offset int64 `json:"offset"`
-	Limit  int64 `json:"limit"`
+	Provider string `json:"provider"`
+	Offset   int64  `json:"offset"`
+	Limit    int64  `json:"limit"`
 }
 
 func (q *Queries) ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(ctx context.Context, arg ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAtParams) ([]RepositorySyncAudit, error) {
-	rows, err := q.db.QueryContext(ctx, listActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt, arg.Offset, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, listActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt,
+		arg.Provider,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RepositorySyncAudit
+	for rows.Next() {
+		var i RepositorySyncAudit
+		if err := rows.Scan(
+			&i.Provider,
+			&i.RepoUuid,
+			&i.RepoSlug,
+			&i.RepoName,
+			&i.WorkspaceSlug,
+			&i.Active,
+			&i.SuccessfulSyncTime,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.Success,
+			&i.ErrorContext,
+			&i.ConsecutiveFailures,
+			&i.MainBranch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInactiveRepoSyncAuditUpdatedBefore = `-- name: ListInactiveRepoSyncAuditUpdatedBefore :many
+SELECT provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
+FROM repository_sync_audit
+WHERE provider = ?1 AND active = FALSE AND datetime(updated_at) < datetime(?2)
+ORDER BY updated_at ASC
+`
+
+type ListInactiveRepoSyncAuditUpdatedBeforeParams struct {
+	Provider string      `json:"provider"`
+	Cutoff   interface{} `json:"cutoff"`
+}
+
+func (q *Queries) ListInactiveRepoSyncAuditUpdatedBefore(ctx context.Context, arg ListInactiveRepoSyncAuditUpdatedBeforeParams) ([]RepositorySyncAudit, error) {
+	rows, err := q.db.QueryContext(ctx, listInactiveRepoSyncAuditUpdatedBefore, arg.Provider, arg.Cutoff)
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +239,9 @@ func (q *Queries) ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(ctx
 	for rows.Next() {
 		var i RepositorySyncAudit
 		if err := rows.Scan(
-			&i.ID,
+			&i.Provider,
+			&i.RepoUuid,
+			&i.RepoSlug,
 			&i.RepoName,
 			&i.WorkspaceSlug,
 			&i.Active,
@@ -127,6 +250,51 @@ func (q *Queries) ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(ctx
 			&i.CreatedAt,
 			&i.Success,
 			&i.ErrorContext,
+			&i.ConsecutiveFailures,
+			&i.MainBranch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRepoSyncAudits = `-- name: ListRepoSyncAudits :many
+SELECT provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
+FROM repository_sync_audit
+ORDER BY provider ASC, workspace_slug ASC, repo_name ASC
+`
+
+func (q *Queries) ListRepoSyncAudits(ctx context.Context) ([]RepositorySyncAudit, error) {
+	rows, err := q.db.QueryContext(ctx, listRepoSyncAudits)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RepositorySyncAudit
+	for rows.Next() {
+		var i RepositorySyncAudit
+		if err := rows.Scan(
+			&i.Provider,
+			&i.RepoUuid,
+			&i.RepoSlug,
+			&i.RepoName,
+			&i.WorkspaceSlug,
+			&i.Active,
+			&i.SuccessfulSyncTime,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.Success,
+			&i.ErrorContext,
+			&i.ConsecutiveFailures,
+			&i.MainBranch,
 		); err != nil {
 			return nil, err
 		}
@@ -143,37 +311,45 @@ func (q *Queries) ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt(ctx
 
 const updateRepoSyncAudit = `-- name: UpdateRepoSyncAudit :one
 UPDATE repository_sync_audit
-SET repo_name = ?1,
-    workspace_slug = ?2,
-    successful_sync_time = ?3,
-    success = ?4,
-    error_context = ?5,
+SET repo_slug = ?1,
+    repo_name = ?2,
+    workspace_slug = ?3,
+    successful_sync_time = ?4,
+    success = ?5,
+    error_context = ?6,
+    consecutive_failures = CASE WHEN ?5 THEN 0 ELSE consecutive_failures + 1 END,
     updated_at = CURRENT_TIMESTAMP
-WHERE id = ?6
-RETURNING id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+WHERE provider = ?7 AND repo_uuid = ?8
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 `
 
 type UpdateRepoSyncAuditParams struct {
+	RepoSlug           string         `json:"repo_slug"`
 	RepoName           string         `json:"repo_name"`
 	WorkspaceSlug      string         `json:"workspace_slug"`
 	SuccessfulSyncTime sql.NullTime   `json:"successful_sync_time"`
 	Success            bool           `json:"success"`
 	ErrorContext       sql.NullString `json:"error_context"`
-	ID                 string         `json:"id"`
+	Provider           string         `json:"provider"`
+	RepoUuid           string         `json:"repo_uuid"`
 }
 
 func (q *Queries) UpdateRepoSyncAudit(ctx context.Context, arg UpdateRepoSyncAuditParams) (RepositorySyncAudit, error) {
 	row := q.db.QueryRowContext(ctx, updateRepoSyncAudit,
+		arg.RepoSlug,
 		arg.RepoName,
 		arg.WorkspaceSlug,
 		arg.SuccessfulSyncTime,
 		arg.Success,
 		arg.ErrorContext,
-		arg.ID,
+		arg.Provider,
+		arg.RepoUuid,
 	)
 	var i RepositorySyncAudit
 	err := row.Scan(
-		&i.ID,
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
 		&i.RepoName,
 		&i.WorkspaceSlug,
 		&i.Active,
@@ -182,6 +358,8 @@ func (q *Queries) UpdateRepoSyncAudit(ctx context.Context, arg UpdateRepoSyncAud
 		&i.CreatedAt,
 		&i.Success,
 		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
 	)
 	return i, err
 }
@@ -190,20 +368,115 @@ const updateRepoSyncAuditActiveStatus = `-- name: UpdateRepoSyncAuditActiveStatu
 UPDATE repository_sync_audit
 SET active = ?1,
     updated_at = CURRENT_TIMESTAMP
-WHERE id = ?2
-RETURNING id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context
+WHERE provider = ?2 AND repo_uuid = ?3
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
 `
 
 type UpdateRepoSyncAuditActiveStatusParams struct {
-	Active bool   `json:"active"`
-	ID     string `json:"id"`
+	Active   bool   `json:"active"`
+	Provider string `json:"provider"`
+	RepoUuid string `json:"repo_uuid"`
 }
 
 func (q *Queries) UpdateRepoSyncAuditActiveStatus(ctx context.Context, arg UpdateRepoSyncAuditActiveStatusParams) (RepositorySyncAudit, error) {
-	row := q.db.QueryRowContext(ctx, updateRepoSyncAuditActiveStatus, arg.Active, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateRepoSyncAuditActiveStatus,
+		arg.Active,
+		arg.Provider,
+		arg.RepoUuid,
+	)
+	var i RepositorySyncAudit
+	err := row.Scan(
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
+		&i.RepoName,
+		&i.WorkspaceSlug,
+		&i.Active,
+		&i.SuccessfulSyncTime,
+		&i.UpdatedAt,
+		&i.CreatedAt,
+		&i.Success,
+		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
+	)
+	return i, err
+}
+
+const updateRepoSyncAuditLocation = `-- name: UpdateRepoSyncAuditLocation :one
+UPDATE repository_sync_audit
+SET repo_slug = ?1,
+    repo_name = ?2,
+    workspace_slug = ?3,
+    main_branch = ?4,
+    active = TRUE,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = ?5 AND repo_uuid = ?6
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
+`
+
+type UpdateRepoSyncAuditLocationParams struct {
+	RepoSlug      string `json:"repo_slug"`
+	RepoName      string `json:"repo_name"`
+	WorkspaceSlug string `json:"workspace_slug"`
+	MainBranch    string `json:"main_branch"`
+	Provider      string `json:"provider"`
+	RepoUuid      string `json:"repo_uuid"`
+}
+
+func (q *Queries) UpdateRepoSyncAuditLocation(ctx context.Context, arg UpdateRepoSyncAuditLocationParams) (RepositorySyncAudit, error) {
+	row := q.db.QueryRowContext(ctx, updateRepoSyncAuditLocation,
+		arg.RepoSlug,
+		arg.RepoName,
+		arg.WorkspaceSlug,
+		arg.MainBranch,
+		arg.Provider,
+		arg.RepoUuid,
+	)
+	var i RepositorySyncAudit
+	err := row.Scan(
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
+		&i.RepoName,
+		&i.WorkspaceSlug,
+		&i.Active,
+		&i.SuccessfulSyncTime,
+		&i.UpdatedAt,
+		&i.CreatedAt,
+		&i.Success,
+		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
+	)
+	return i, err
+}
+
+const updateRepoSyncAuditRepoUUID = `-- name: UpdateRepoSyncAuditRepoUUID :one
+UPDATE repository_sync_audit
+SET repo_uuid = ?1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = ?2 AND repo_uuid = ?3
+RETURNING provider, repo_uuid, repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures, main_branch
+`
+
+type UpdateRepoSyncAuditRepoUUIDParams struct {
+	NewRepoUuid string `json:"new_repo_uuid"`
+	Provider    string `json:"provider"`
+	RepoUuid    string `json:"repo_uuid"`
+}
+
+func (q *Queries) UpdateRepoSyncAuditRepoUUID(ctx context.Context, arg UpdateRepoSyncAuditRepoUUIDParams) (RepositorySyncAudit, error) {
+	row := q.db.QueryRowContext(ctx, updateRepoSyncAuditRepoUUID,
+		arg.NewRepoUuid,
+		arg.Provider,
+		arg.RepoUuid,
+	)
 	var i RepositorySyncAudit
 	err := row.Scan(
-		&i.ID,
+		&i.Provider,
+		&i.RepoUuid,
+		&i.RepoSlug,
 		&i.RepoName,
 		&i.WorkspaceSlug,
 		&i.Active,
@@ -212,6 +485,8 @@ func (q *Queries) UpdateRepoSyncAuditActiveStatus(ctx context.Context, arg Updat
 		&i.CreatedAt,
 		&i.Success,
 		&i.ErrorContext,
+		&i.ConsecutiveFailures,
+		&i.MainBranch,
 	)
 	return i, err
 }
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE repository_sync_audit ADD COLUMN repo_uuid TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_repository_sync_audit_repo_uuid ON repository_sync_audit (repo_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS idx_repository_sync_audit_repo_uuid;
+ALTER TABLE repository_sync_audit DROP COLUMN repo_uuid;
+-- +goose StatementEnd
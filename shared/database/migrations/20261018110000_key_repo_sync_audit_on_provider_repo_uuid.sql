@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE repository_sync_audit_new (
+    provider TEXT NOT NULL,
+    repo_uuid TEXT NOT NULL,
+    repo_slug TEXT NOT NULL,
+    repo_name TEXT NOT NULL,
+    workspace_slug TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    successful_sync_time TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    success BOOLEAN NOT NULL,
+    error_context TEXT,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (provider, repo_uuid)
+);
+
+-- Rows whose repository UUID was never seen get a "legacy:<workspace>/<slug>" placeholder.
+-- The next repository pull replaces it with the real UUID.
+INSERT INTO repository_sync_audit_new (provider, repo_uuid, repo_slug, repo_name, workspace_slug, active,
+    successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures)
+SELECT 'BitbucketCloud',
+    COALESCE(repo_uuid, 'legacy:' || workspace_slug || '/' || id),
+    id, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures
+FROM repository_sync_audit;
+
+DROP TABLE repository_sync_audit;
+ALTER TABLE repository_sync_audit_new RENAME TO repository_sync_audit;
+CREATE INDEX IF NOT EXISTS idx_repository_sync_audit_workspace_slug_repo_slug ON repository_sync_audit (provider, workspace_slug, repo_slug);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+CREATE TABLE repository_sync_audit_old (
+    id TEXT PRIMARY KEY,
+    repo_name TEXT NOT NULL,
+    workspace_slug TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    successful_sync_time TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    success BOOLEAN NOT NULL,
+    error_context TEXT,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    repo_uuid TEXT
+);
+
+-- slugs are only unique within a workspace, keep the most recently updated row per slug
+INSERT OR REPLACE INTO repository_sync_audit_old (id, repo_name, workspace_slug, active, successful_sync_time,
+    updated_at, created_at, success, error_context, consecutive_failures, repo_uuid)
+SELECT repo_slug, repo_name, workspace_slug, active, successful_sync_time, updated_at, created_at, success, error_context, consecutive_failures,
+    CASE WHEN repo_uuid LIKE 'legacy:%' THEN NULL ELSE repo_uuid END
+FROM repository_sync_audit
+ORDER BY updated_at ASC;
+
+DROP TABLE repository_sync_audit;
+ALTER TABLE repository_sync_audit_old RENAME TO repository_sync_audit;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_repository_sync_audit_repo_uuid ON repository_sync_audit (repo_uuid);
+-- +goose StatementEnd
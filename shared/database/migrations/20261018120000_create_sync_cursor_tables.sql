@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS pull_request_sync_cursor (
+    provider TEXT NOT NULL,
+    repo_uuid TEXT NOT NULL,
+    updated_on_watermark TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, repo_uuid)
+);
+CREATE TABLE IF NOT EXISTS commit_sync_cursor (
+    provider TEXT NOT NULL,
+    repo_uuid TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    last_commit_hash TEXT NOT NULL,
+    last_commit_date TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, repo_uuid, branch)
+);
+CREATE TABLE IF NOT EXISTS activity_sync_cursor (
+    provider TEXT NOT NULL,
+    repo_uuid TEXT NOT NULL,
+    last_synced_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, repo_uuid)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS activity_sync_cursor;
+DROP TABLE IF EXISTS commit_sync_cursor;
+DROP TABLE IF EXISTS pull_request_sync_cursor;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE repository_sync_audit ADD COLUMN main_branch TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS relayed_commit (
+    provider TEXT NOT NULL,
+    repo_uuid TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    relayed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, repo_uuid, hash)
+);
+-- commits are tracked per branch from now on
+DELETE FROM commit_sync_cursor WHERE branch = '*';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS relayed_commit;
+ALTER TABLE repository_sync_audit DROP COLUMN main_branch;
+-- +goose StatementEnd
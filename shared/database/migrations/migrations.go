@@ -0,0 +1,7 @@
+// Package migrations embeds the goose migrations so they can be applied in-process, e.g. to a temporary test database.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,63 @@
+-- name: GetIdentity :one
+SELECT *
+FROM identity
+WHERE id = :id;
+
+
+-- name: UpsertIdentity :one
+INSERT INTO identity (id, display_name, email)
+VALUES (:id, :display_name, :email)
+ON CONFLICT (id) DO UPDATE
+SET display_name = excluded.display_name,
+    email = excluded.email,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+
+-- name: DeleteIdentity :exec
+DELETE FROM identity
+WHERE id = :id;
+
+
+-- name: DeleteOrphanIdentities :exec
+DELETE FROM identity
+WHERE id NOT IN (SELECT identity_id FROM identity_alias);
+
+
+-- name: GetIdentityAlias :one
+SELECT *
+FROM identity_alias
+WHERE kind = :kind AND value = :value;
+
+
+-- name: UpsertIdentityAlias :exec
+INSERT INTO identity_alias (kind, value, identity_id, source)
+VALUES (:kind, :value, :identity_id, :source)
+ON CONFLICT (kind, value) DO UPDATE
+SET identity_id = excluded.identity_id,
+    source = excluded.source,
+    updated_at = CURRENT_TIMESTAMP;
+
+
+-- name: ReassignIdentityAliases :exec
+UPDATE identity_alias
+SET identity_id = :new_identity_id,
+    updated_at = CURRENT_TIMESTAMP
+WHERE identity_id = :identity_id;
+
+
+-- name: CountIdentityAliasesBySource :one
+SELECT COUNT(*)
+FROM identity_alias
+WHERE identity_id = :identity_id AND source = :source;
+
+
+-- name: CountIdentityAliasesByKind :one
+SELECT COUNT(*)
+FROM identity_alias
+WHERE identity_id = :identity_id AND kind = :kind;
+
+
+-- name: DeleteIdentityAliasesBySource :exec
+DELETE FROM identity_alias
+WHERE source = :source;
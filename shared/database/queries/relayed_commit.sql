@@ -0,0 +1,21 @@
+-- name: GetRelayedCommit :one
+SELECT *
+FROM relayed_commit
+WHERE provider = :provider AND repo_uuid = :repo_uuid AND hash = :hash;
+
+
+-- name: CreateRelayedCommit :exec
+INSERT INTO relayed_commit (provider, repo_uuid, hash)
+VALUES (:provider, :repo_uuid, :hash)
+ON CONFLICT (provider, repo_uuid, hash) DO NOTHING;
+
+
+-- name: DeleteRelayedCommits :exec
+DELETE FROM relayed_commit
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: ReassignRelayedCommits :exec
+UPDATE relayed_commit
+SET repo_uuid = :new_repo_uuid
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
@@ -1,43 +1,84 @@
 -- name: ListActiveRepoSyncAuditOrderBySuccessfulSyncTimeCreatedAt :many
 SELECT *
 FROM repository_sync_audit
-WHERE active = TRUE
+WHERE provider = :provider AND active = TRUE
 ORDER BY successful_sync_time ASC, created_at ASC
 LIMIT :limit OFFSET :offset;
 
 
--- name: GetRepoSyncAuditByID :one
+-- name: ListRepoSyncAudits :many
 SELECT *
 FROM repository_sync_audit
-WHERE id = :id;
+ORDER BY provider ASC, workspace_slug ASC, repo_name ASC;
+
+
+-- name: GetRepoSyncAudit :one
+SELECT *
+FROM repository_sync_audit
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: GetRepoSyncAuditBySlug :one
+SELECT *
+FROM repository_sync_audit
+WHERE provider = :provider AND workspace_slug = :workspace_slug AND repo_slug = :repo_slug
+ORDER BY active DESC, updated_at DESC
+LIMIT 1;
+
+
+-- name: ListInactiveRepoSyncAuditUpdatedBefore :many
+SELECT *
+FROM repository_sync_audit
+WHERE provider = :provider AND active = FALSE AND datetime(updated_at) < datetime(:cutoff)
+ORDER BY updated_at ASC;
 
 
 -- name: CreateRepoSyncAudit :one
-INSERT INTO repository_sync_audit (id, repo_name, workspace_slug, successful_sync_time, success, error_context)
-VALUES (:id, :repo_name, :workspace_slug, :successful_sync_time, :success, :error_context)
+INSERT INTO repository_sync_audit (provider, repo_uuid, repo_slug, repo_name, workspace_slug, main_branch, successful_sync_time, success, error_context)
+VALUES (:provider, :repo_uuid, :repo_slug, :repo_name, :workspace_slug, :main_branch, :successful_sync_time, :success, :error_context)
 RETURNING *;
 
 
 -- name: UpdateRepoSyncAudit :one
 UPDATE repository_sync_audit
-SET repo_name = :repo_name,
+SET repo_slug = :repo_slug,
+    repo_name = :repo_name,
     workspace_slug = :workspace_slug,
     successful_sync_time = :successful_sync_time,
     success = :success,
     error_context = :error_context,
+    consecutive_failures = CASE WHEN :success THEN 0 ELSE consecutive_failures + 1 END,
     updated_at = CURRENT_TIMESTAMP
-WHERE id = :id
+WHERE provider = :provider AND repo_uuid = :repo_uuid
 RETURNING *;
 
 -- name: UpdateRepoSyncAuditActiveStatus :one
 UPDATE repository_sync_audit
 SET active = :active,
     updated_at = CURRENT_TIMESTAMP
-WHERE id = :id
+WHERE provider = :provider AND repo_uuid = :repo_uuid
+RETURNING *;
+
+-- name: UpdateRepoSyncAuditLocation :one
+UPDATE repository_sync_audit
+SET repo_slug = :repo_slug,
+    repo_name = :repo_name,
+    workspace_slug = :workspace_slug,
+    main_branch = :main_branch,
+    active = TRUE,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = :provider AND repo_uuid = :repo_uuid
+RETURNING *;
+
+-- name: UpdateRepoSyncAuditRepoUUID :one
+UPDATE repository_sync_audit
+SET repo_uuid = :new_repo_uuid,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = :provider AND repo_uuid = :repo_uuid
 RETURNING *;
 
 
 -- name: DeleteInactiveRepoSyncAudit :one
 DELETE FROM repository_sync_audit
-WHERE id = :id AND active = FALSE
-RETURNING *;
\ No newline at end of file
+WHERE provider = :provider AND repo_uuid = :repo_uuid AND active = FALSE
+RETURNING *;
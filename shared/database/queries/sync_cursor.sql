@@ -0,0 +1,89 @@
+-- name: GetPullRequestSyncCursor :one
+SELECT *
+FROM pull_request_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: UpsertPullRequestSyncCursor :one
+INSERT INTO pull_request_sync_cursor (provider, repo_uuid, updated_on_watermark)
+VALUES (:provider, :repo_uuid, :updated_on_watermark)
+ON CONFLICT (provider, repo_uuid) DO UPDATE
+SET updated_on_watermark = excluded.updated_on_watermark,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+
+-- name: DeletePullRequestSyncCursor :exec
+DELETE FROM pull_request_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: ReassignPullRequestSyncCursor :exec
+UPDATE pull_request_sync_cursor
+SET repo_uuid = :new_repo_uuid
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: GetCommitSyncCursor :one
+SELECT *
+FROM commit_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid AND branch = :branch;
+
+
+-- name: ListCommitSyncCursors :many
+SELECT *
+FROM commit_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid
+ORDER BY branch ASC;
+
+
+-- name: UpsertCommitSyncCursor :one
+INSERT INTO commit_sync_cursor (provider, repo_uuid, branch, last_commit_hash, last_commit_date)
+VALUES (:provider, :repo_uuid, :branch, :last_commit_hash, :last_commit_date)
+ON CONFLICT (provider, repo_uuid, branch) DO UPDATE
+SET last_commit_hash = excluded.last_commit_hash,
+    last_commit_date = excluded.last_commit_date,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+
+-- name: DeleteCommitSyncCursor :exec
+DELETE FROM commit_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid AND branch = :branch;
+
+
+-- name: DeleteCommitSyncCursors :exec
+DELETE FROM commit_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: ReassignCommitSyncCursors :exec
+UPDATE commit_sync_cursor
+SET repo_uuid = :new_repo_uuid
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: GetActivitySyncCursor :one
+SELECT *
+FROM activity_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: UpsertActivitySyncCursor :one
+INSERT INTO activity_sync_cursor (provider, repo_uuid, last_synced_at)
+VALUES (:provider, :repo_uuid, :last_synced_at)
+ON CONFLICT (provider, repo_uuid) DO UPDATE
+SET last_synced_at = excluded.last_synced_at,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+
+-- name: DeleteActivitySyncCursor :exec
+DELETE FROM activity_sync_cursor
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
+
+
+-- name: ReassignActivitySyncCursor :exec
+UPDATE activity_sync_cursor
+SET repo_uuid = :new_repo_uuid
+WHERE provider = :provider AND repo_uuid = :repo_uuid;
@@ -0,0 +1,116 @@
+package httptransport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared"
+)
+
+// NewHTTPClient builds an HTTP client with the proxy, TLS and timeouts of the configuration. The client pools its
+// connections, it is meant to be shared by every caller instead of creating a client per request.
+func NewHTTPClient(cfg config.HTTPTransport) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout := time.Duration(cfg.ConnectTimeoutSeconds) * time.Second
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.RequestTimeoutSeconds) * time.Second,
+	}, nil
+}
+
+// newTLSConfig trusts the system roots plus the CA bundle, and presents the client certificate when one is set.
+func newTLSConfig(cfg config.HTTPTransport) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CABundlePath != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		caBundle, err := os.ReadFile(resolvePath(cfg.CABundlePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("CA bundle %s has no PEM certificate", cfg.CABundlePath)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if cfg.ClientCertPath != "" {
+		clientCert, err := tls.LoadX509KeyPair(resolvePath(cfg.ClientCertPath), resolvePath(cfg.ClientKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
+}
+
+func resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(shared.RootDir, path)
+}
+
+var httpClient *http.Client
+
+// InitializeHTTPClient creates the HTTP client shared by the integrations and the relay.
+func InitializeHTTPClient(cfg config.HTTPTransport) error {
+	if httpClient != nil {
+		return fmt.Errorf("http client already initialized")
+	}
+
+	newHTTPClient, err := NewHTTPClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize http client: %w", err)
+	}
+	httpClient = newHTTPClient
+	return nil
+}
+
+func AcquireHTTPClient() *http.Client {
+	if httpClient == nil {
+		panic("http client not initialized, call InitializeHTTPClient first")
+	}
+	return httpClient
+}
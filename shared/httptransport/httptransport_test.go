@@ -0,0 +1,155 @@
+package httptransport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTransportConfig() config.HTTPTransport {
+	return config.HTTPTransport{
+		ConnectTimeoutSeconds: 5,
+		ReadTimeoutSeconds:    5,
+		RequestTimeoutSeconds: 5,
+		MaxIdleConnsPerHost:   2,
+	}
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	filePath := filepath.Join(t.TempDir(), "file.pem")
+	require.NoError(t, os.WriteFile(filePath, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return filePath
+}
+
+// newClientCertificate creates a self-signed client certificate and returns it with the paths of its PEM files.
+func newClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "datapuller"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return certificate, writePEM(t, "CERTIFICATE", der), writePEM(t, "EC PRIVATE KEY", keyDER)
+}
+
+func TestNewHTTPClientTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(testTransportConfig())
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err, "the test server certificate is not trusted by the system roots")
+
+	cfg := testTransportConfig()
+	cfg.CABundlePath = writePEM(t, "CERTIFICATE", server.Certificate().Raw)
+	client, err = NewHTTPClient(cfg)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestNewHTTPClientPresentsClientCertificate(t *testing.T) {
+	clientCertificate, certPath, keyPath := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCertificate)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	cfg := testTransportConfig()
+	cfg.CABundlePath = writePEM(t, "CERTIFICATE", server.Certificate().Raw)
+	client, err := NewHTTPClient(cfg)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err, "the server requires a client certificate")
+
+	cfg.ClientCertPath, cfg.ClientKeyPath = certPath, keyPath
+	client, err = NewHTTPClient(cfg)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestNewHTTPClientUsesProxy(t *testing.T) {
+	var proxiedURLs []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURLs = append(proxiedURLs, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	cfg := testTransportConfig()
+	cfg.ProxyURL = proxy.URL
+	client, err := NewHTTPClient(cfg)
+	require.NoError(t, err)
+	response, err := client.Get("http://bitbucket.invalid/2.0/workspaces")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, []string{"http://bitbucket.invalid/2.0/workspaces"}, proxiedURLs)
+}
+
+func TestNewHTTPClientReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	cfg := testTransportConfig()
+	cfg.ReadTimeoutSeconds = 1
+	client, err := NewHTTPClient(cfg)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "timeout awaiting response headers")
+}
+
+func TestNewHTTPClientRejectsInvalidTLSFiles(t *testing.T) {
+	cfg := testTransportConfig()
+	cfg.CABundlePath = filepath.Join(t.TempDir(), "missing.pem")
+	_, err := NewHTTPClient(cfg)
+	assert.ErrorContains(t, err, "failed to read CA bundle")
+
+	cfg = testTransportConfig()
+	cfg.CABundlePath = writePEM(t, "PRIVATE KEY", []byte("not a certificate"))
+	_, err = NewHTTPClient(cfg)
+	assert.ErrorContains(t, err, "has no PEM certificate")
+
+	cfg = testTransportConfig()
+	_, certPath, _ := newClientCertificate(t)
+	cfg.ClientCertPath, cfg.ClientKeyPath = certPath, certPath
+	_, err = NewHTTPClient(cfg)
+	assert.ErrorContains(t, err, "failed to load client certificate")
+}
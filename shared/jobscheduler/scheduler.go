@@ -36,7 +36,9 @@ func NewJobScheduler(customLogger *shared.CustomLogger, stateManager *statemanag
 	}, nil
 }
 
-func (js *JobScheduler) Run() {
+// Run runs the job on the cron schedule until it fails. The error of the failed job is returned, so the caller can
+// close the state manager before exiting.
+func (js *JobScheduler) Run() error {
 	js.logger.Info(fmt.Sprintf("Running the job: %s", js.JobName))
 
 	// Set up signal handling
@@ -48,7 +50,8 @@ func (js *JobScheduler) Run() {
 		<-sigChan
 
 		js.logger.Info("Received shutdown signal. Saving state...")
-		if err := js.stateManager.SaveStateWithMutex(); err != nil {
+		// Close saves the usage deferred by the write-behind mode and releases the token pool leases
+		if err := js.stateManager.Close(); err != nil {
 			js.logger.Error("Failed to save state before shutdown", "error", err)
 			js.logger.Error("Exiting without saving state")
 			os.Exit(1)
@@ -64,7 +67,7 @@ func (js *JobScheduler) Run() {
 		schedule, err := cron.ParseStandard(js.config.Common.CronExpression)
 		if err != nil {
 			js.logger.Error("Invalid cron expression", "error", err)
-			return
+			return fmt.Errorf("invalid cron expression: %w", err)
 		}
 
 		// Calculate the next run time based on the cron expression if not the first run
@@ -89,7 +92,7 @@ func (js *JobScheduler) Run() {
 
 		if err != nil {
 			js.logger.Error("Job execution failed: job", "jobName", js.JobName, "error", err)
-			os.Exit(1)
+			return fmt.Errorf("job %s failed: %w", js.JobName, err)
 		} else {
 			js.logger.Info("Job execution completed successfully", "jobName", js.JobName)
 		}
@@ -0,0 +1,33 @@
+package jobscheduler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/storage/state/statemanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReturnsTheErrorOfAFailedJob(t *testing.T) {
+	sm, err := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	cfg := &config.Config{Defaults: *config.NewDefaults()}
+	cfg.Common.CronExpression = "0 * * * *"
+	jobErr := errors.New("boom")
+	runs := 0
+	scheduler, err := NewJobScheduler(&shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, sm, "Datapull", func() error {
+		runs++
+		return jobErr
+	}, cfg)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, scheduler.Run(), jobErr)
+	assert.Equal(t, 1, runs)
+	assert.False(t, sm.State.LastJobExecutionEndTime.IsZero(), "the failed run is recorded")
+}
@@ -0,0 +1,146 @@
+package jsonschema
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Incompatibilities lists why a document matching current may not match published, i.e. how a consumer of the
+// published schema could reject or misread what the current types encode. Narrowing a type, requiring a property or
+// adding a property published leaves open is compatible. It is an empty list when current is compatible.
+func Incompatibilities(published, current *Schema) []string {
+	c := &comparison{publishedRoot: published, currentRoot: current, visited: map[[2]*Schema]bool{}}
+	c.compare(published, current, "")
+	return c.problems
+}
+
+type comparison struct {
+	publishedRoot *Schema
+	currentRoot   *Schema
+	// visited holds the compared pairs of definitions, recursive types are compared once
+	visited  map[[2]*Schema]bool
+	problems []string
+}
+
+func (c *comparison) fail(pointer string, format string, args ...any) {
+	c.problems = append(c.problems, fmt.Sprintf("%s: %s", cmpOr(pointer, "/"), fmt.Sprintf(format, args...)))
+}
+
+func resolve(root, schema *Schema) (*Schema, error) {
+	for schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, defsRefPrefix)
+		target, found := root.Defs[name]
+		if !ok || !found {
+			return nil, fmt.Errorf("unresolvable reference %s", schema.Ref)
+		}
+		schema = target
+	}
+	return schema, nil
+}
+
+func (c *comparison) compare(published, current *Schema, pointer string) {
+	if published.Ref != "" || current.Ref != "" {
+		var err error
+		if published, err = resolve(c.publishedRoot, published); err != nil {
+			c.fail(pointer, "published schema has an %v", err)
+			return
+		}
+		if current, err = resolve(c.currentRoot, current); err != nil {
+			c.fail(pointer, "current schema has an %v", err)
+			return
+		}
+		if c.visited[[2]*Schema{published, current}] {
+			return
+		}
+		c.visited[[2]*Schema{published, current}] = true
+	}
+
+	if isUnconstrained(published) {
+		return
+	}
+	if len(current.AnyOf) > 0 {
+		for _, alternative := range current.AnyOf {
+			c.compare(published, alternative, pointer)
+		}
+		return
+	}
+	if len(published.AnyOf) > 0 {
+		for _, alternative := range published.AnyOf {
+			branch := &comparison{publishedRoot: c.publishedRoot, currentRoot: c.currentRoot, visited: maps.Clone(c.visited)}
+			branch.compare(alternative, current, pointer)
+			if len(branch.problems) == 0 {
+				return
+			}
+		}
+		c.fail(pointer, "matches none of the published alternatives")
+		return
+	}
+
+	if published.Const != nil && (current.Const == nil || !sameJSONValue(published.Const, current.Const)) {
+		c.fail(pointer, "must be %v", published.Const)
+	}
+	if len(published.Type) > 0 {
+		if len(current.Type) == 0 {
+			c.fail(pointer, "any type is allowed, the published type is %s", strings.Join(published.Type, " or "))
+		}
+		for _, typeName := range current.Type {
+			if !slices.Contains(published.Type, typeName) && !(typeName == "integer" && slices.Contains(published.Type, "number")) {
+				c.fail(pointer, "type %s is not allowed by the published type %s", typeName, strings.Join(published.Type, " or "))
+			}
+		}
+	}
+	if published.Format != "" && current.Format != published.Format {
+		c.fail(pointer, "format %q is not the published format %q", current.Format, published.Format)
+	}
+
+	if allowsType(current, "object") {
+		c.compareObjects(published, current, pointer)
+	}
+	if published.Items != nil && allowsType(current, "array") {
+		if current.Items == nil {
+			c.fail(pointer, "items are unconstrained")
+		} else {
+			c.compare(published.Items, current.Items, pointer+"/*")
+		}
+	}
+}
+
+func (c *comparison) compareObjects(published, current *Schema, pointer string) {
+	for _, name := range published.Required {
+		if !slices.Contains(current.Required, name) {
+			c.fail(pointer, "property %q may be missing", name)
+		}
+	}
+	for _, name := range sortedKeys(current.Properties) {
+		propertyPointer := pointer + "/" + escapePointer(name)
+		if publishedProperty, ok := published.Properties[name]; ok {
+			c.compare(publishedProperty, current.Properties[name], propertyPointer)
+		} else if published.AdditionalProperties != nil {
+			c.compare(published.AdditionalProperties, current.Properties[name], propertyPointer)
+		}
+	}
+	if published.AdditionalProperties != nil && current.AdditionalProperties != nil {
+		c.compare(published.AdditionalProperties, current.AdditionalProperties, pointer+"/*")
+	}
+}
+
+func allowsType(schema *Schema, typeName string) bool {
+	return len(schema.Type) == 0 || slices.Contains(schema.Type, typeName)
+}
+
+func isUnconstrained(schema *Schema) bool {
+	return schema.Ref == "" && len(schema.Type) == 0 && schema.Format == "" && schema.Const == nil &&
+		len(schema.Properties) == 0 && len(schema.Required) == 0 && schema.AdditionalProperties == nil &&
+		schema.Items == nil && len(schema.AnyOf) == 0
+}
+
+func sortedKeys(properties map[string]*Schema) []string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,268 @@
+// Package jsonschema generates JSON Schemas from Go types, describing the JSON encoding/json produces for them, and
+// validates JSON documents against such schemas. Only the keywords the generator emits are supported.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// Types is the type keyword, written as a string when there is a single type.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = multiple
+	return nil
+}
+
+const defsRefPrefix = "#/$defs/"
+
+var timeType = reflect.TypeFor[time.Time]()
+var jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+// Generate returns the schema of the JSON encoding of t. Named structs are defined once in $defs and referenced,
+// nil slices, maps and pointers are nullable, and struct fields without omitempty are required.
+func Generate(t reflect.Type) *Schema {
+	g := &generator{defs: map[string]*Schema{}}
+	root := g.schemaOf(t)
+	root.Schema = Draft
+	if len(g.defs) > 0 {
+		root.Defs = g.defs
+	}
+	return root
+}
+
+type generator struct {
+	defs map[string]*Schema
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(jsonMarshalerType) {
+		// custom encodings are not described
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.schemaOf(t.Elem()))
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64 encoded
+			return &Schema{Type: Types{"string", "null"}}
+		}
+		return &Schema{Type: Types{"array", "null"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: Types{"array"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object", "null"}, AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" || strings.Contains(name, "[") {
+			// anonymous and generic structs are inlined
+			return g.structSchema(t)
+		}
+		if _, ok := g.defs[name]; !ok {
+			// registered before its fields so recursive types terminate
+			g.defs[name] = &Schema{}
+			*g.defs[name] = *g.structSchema(t)
+		}
+		return &Schema{Ref: defsRefPrefix + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func nullable(schema *Schema) *Schema {
+	switch {
+	case schema.Ref != "":
+		return &Schema{AnyOf: []*Schema{schema, {Type: Types{"null"}}}}
+	case len(schema.Type) == 0 || slices.Contains(schema.Type, "null"):
+		return schema
+	default:
+		schema.Type = append(slices.Clone(schema.Type), "null")
+		return schema
+	}
+}
+
+// structField is a field as encoding/json encodes it, possibly promoted from an embedded struct.
+type structField struct {
+	name      string
+	tagged    bool
+	depth     int
+	omitEmpty bool
+	fieldType reflect.Type
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	for _, field := range jsonFields(t) {
+		schema.Properties[field.name] = g.schemaOf(field.fieldType)
+		// omitempty never omits a struct
+		if !field.omitEmpty || field.fieldType.Kind() == reflect.Struct {
+			schema.Required = append(schema.Required, field.name)
+		}
+	}
+	slices.Sort(schema.Required)
+	return schema
+}
+
+// jsonFields lists the fields encoding/json encodes for a struct: fields of embedded structs are promoted, and of
+// fields sharing a name the shallowest wins, a tagged one among equally shallow ones, or none if still ambiguous.
+func jsonFields(t reflect.Type) []structField {
+	var candidates []structField
+	var collect func(t reflect.Type, depth int, visited map[reflect.Type]bool)
+	collect = func(t reflect.Type, depth int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embeddedType := field.Type
+				if embeddedType.Kind() == reflect.Pointer {
+					embeddedType = embeddedType.Elem()
+				}
+				if embeddedType.Kind() == reflect.Struct {
+					collect(embeddedType, depth+1, visited)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			candidates = append(candidates, structField{
+				name:      cmpOr(name, field.Name),
+				tagged:    name != "",
+				depth:     depth,
+				omitEmpty: slices.Contains(strings.Split(options, ","), "omitempty"),
+				fieldType: field.Type,
+			})
+		}
+	}
+	collect(t, 0, map[reflect.Type]bool{})
+
+	var fields []structField
+	byName := map[string][]structField{}
+	var names []string
+	for _, candidate := range candidates {
+		if _, ok := byName[candidate.name]; !ok {
+			names = append(names, candidate.name)
+		}
+		byName[candidate.name] = append(byName[candidate.name], candidate)
+	}
+	for _, name := range names {
+		if field, ok := dominantField(byName[name]); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func dominantField(candidates []structField) (structField, bool) {
+	minDepth := slices.MinFunc(candidates, func(a, b structField) int { return a.depth - b.depth }).depth
+	var shallowest []structField
+	for _, candidate := range candidates {
+		if candidate.depth == minDepth {
+			shallowest = append(shallowest, candidate)
+		}
+	}
+	if len(shallowest) == 1 {
+		return shallowest[0], true
+	}
+	var tagged []structField
+	for _, candidate := range shallowest {
+		if candidate.tagged {
+			tagged = append(tagged, candidate)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return structField{}, false
+}
+
+func cmpOr(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// AnyOf combines schemas, each generated with its own $defs, into a schema matching any of them.
+func AnyOf(schemas ...*Schema) *Schema {
+	combined := &Schema{Schema: Draft}
+	for _, schema := range schemas {
+		alternative := *schema
+		alternative.Schema = ""
+		for name, def := range alternative.Defs {
+			if combined.Defs == nil {
+				combined.Defs = map[string]*Schema{}
+			}
+			combined.Defs[name] = def
+		}
+		alternative.Defs = nil
+		combined.AnyOf = append(combined.AnyOf, &alternative)
+	}
+	return combined
+}
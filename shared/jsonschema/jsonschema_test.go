@@ -0,0 +1,174 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testActor struct {
+	Name string `json:"name"`
+}
+
+type testBase struct {
+	Reviewer any    `json:"reviewer"`
+	Label    string `json:"label,omitempty"`
+}
+
+type testItem struct {
+	testBase
+	Reviewer  any               `json:"reviewer"`
+	ID        int               `json:"id"`
+	Score     float64           `json:"score,omitempty"`
+	Author    testActor         `json:"author,omitempty"`
+	Editor    *testActor        `json:"editor,omitempty"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Untagged  bool
+	Ignored   string `json:"-"`
+	internal  string
+	Children  []testItem `json:"children,omitempty"`
+}
+
+func TestGenerateDescribesTheJSONEncoding(t *testing.T) {
+	schema := Generate(reflect.TypeFor[[]testItem]())
+
+	encoded, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": ["array", "null"],
+		"items": {"$ref": "#/$defs/testItem"},
+		"$defs": {
+			"testActor": {"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]},
+			"testItem": {
+				"type": "object",
+				"properties": {
+					"reviewer": {},
+					"label": {"type": "string"},
+					"id": {"type": "integer"},
+					"score": {"type": "number"},
+					"author": {"$ref": "#/$defs/testActor"},
+					"editor": {"anyOf": [{"$ref": "#/$defs/testActor"}, {"type": "null"}]},
+					"tags": {"type": ["array", "null"], "items": {"type": "string"}},
+					"labels": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+					"createdAt": {"type": "string", "format": "date-time"},
+					"Untagged": {"type": "boolean"},
+					"children": {"type": ["array", "null"], "items": {"$ref": "#/$defs/testItem"}}
+				},
+				"required": ["Untagged", "author", "createdAt", "id", "reviewer", "tags"]
+			}
+		}
+	}`, string(encoded))
+}
+
+func TestValidateAcceptsEncodedValues(t *testing.T) {
+	schema := Generate(reflect.TypeFor[testItem]())
+	item := testItem{ID: 1, Editor: &testActor{Name: "Jane"}, CreatedAt: time.Now(), Children: []testItem{{ID: 2}}}
+	encoded, err := json.Marshal(item)
+	require.NoError(t, err)
+	assert.NoError(t, schema.ValidateJSON(encoded))
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	schema := Generate(reflect.TypeFor[testItem]())
+
+	err := schema.ValidateJSON([]byte(`{
+		"reviewer": null, "id": 1.5, "author": {}, "editor": {"name": 3}, "tags": ["a", 2],
+		"labels": {"team": true}, "createdAt": "2025-03-01", "Untagged": false, "extra": "kept"
+	}`))
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []string{
+		`/author: missing required property "name"`,
+		`/createdAt: must be an RFC 3339 date-time, got "2025-03-01"`,
+		`/editor: matches none of the 2 alternatives`,
+		`/id: must be of type integer, got number`,
+		`/labels/team: must be of type string, got boolean`,
+		`/tags/1: must be of type string, got integer`,
+	}, validationErr.Violations)
+
+	assert.ErrorContains(t, schema.ValidateJSON([]byte(`[]`)), "/: must be of type object, got array")
+	assert.ErrorContains(t, schema.ValidateJSON([]byte(`{} {}`)), "unexpected data after the top-level value")
+}
+
+func TestAnyOfKeepsTheDefinitionsOfEverySchema(t *testing.T) {
+	schema := AnyOf(Generate(reflect.TypeFor[testActor]()), Generate(reflect.TypeFor[string]()))
+
+	assert.Len(t, schema.Defs, 1)
+	assert.Empty(t, schema.AnyOf[0].Schema)
+	assert.NoError(t, schema.ValidateJSON([]byte(`{"name": "Jane"}`)))
+	assert.NoError(t, schema.ValidateJSON([]byte(`"failed"`)))
+	assert.Error(t, schema.ValidateJSON([]byte(`{"name": 1}`)))
+}
+
+func TestConstMatchesJSONValues(t *testing.T) {
+	schema := &Schema{Properties: map[string]*Schema{"version": {Const: 1}}}
+	assert.NoError(t, schema.ValidateJSON([]byte(`{"version": 1}`)))
+	assert.ErrorContains(t, schema.ValidateJSON([]byte(`{"version": "1"}`)), "/version: must be 1")
+}
+
+type publishedTeam struct {
+	Name    string         `json:"name"`
+	Size    float64        `json:"size"`
+	Lead    testActor      `json:"lead"`
+	Members []testActor    `json:"members"`
+	Note    string         `json:"note,omitempty"`
+	Parent  *publishedTeam `json:"parent,omitempty"`
+}
+
+type extendedTeam struct {
+	Name    string        `json:"name"`
+	Size    int           `json:"size"`
+	Lead    testActor     `json:"lead"`
+	Members []testActor   `json:"members"`
+	Note    string        `json:"note"`
+	Parent  *extendedTeam `json:"parent,omitempty"`
+	Budget  float64       `json:"budget,omitempty"`
+}
+
+type brokenActor struct {
+	Name []string `json:"name"`
+}
+
+type brokenTeam struct {
+	Size    string        `json:"size"`
+	Lead    *testActor    `json:"lead"`
+	Members []brokenActor `json:"members"`
+	Note    string        `json:"note,omitempty"`
+	Parent  *brokenTeam   `json:"parent,omitempty"`
+}
+
+func TestIncompatibilitiesAllowNarrowingAndExtending(t *testing.T) {
+	published := Generate(reflect.TypeFor[publishedTeam]())
+	assert.Empty(t, Incompatibilities(published, published))
+	assert.Empty(t, Incompatibilities(published, Generate(reflect.TypeFor[extendedTeam]())),
+		"an integer is a number, a property may become required and a new property is allowed")
+}
+
+func TestIncompatibilitiesReportBreakingChanges(t *testing.T) {
+	published := Generate(reflect.TypeFor[publishedTeam]())
+
+	assert.Equal(t, []string{
+		`/: property "name" may be missing`,
+		`/lead: type null is not allowed by the published type object`,
+		`/members/*/name: type array is not allowed by the published type string`,
+		`/members/*/name: type null is not allowed by the published type string`,
+		`/size: type string is not allowed by the published type number`,
+	}, Incompatibilities(published, Generate(reflect.TypeFor[brokenTeam]())))
+}
+
+func TestIncompatibilitiesOfPublishedSchemaFiles(t *testing.T) {
+	encoded, err := json.Marshal(AnyOf(Generate(reflect.TypeFor[testActor]()), Generate(reflect.TypeFor[string]())))
+	require.NoError(t, err)
+	var published Schema
+	require.NoError(t, json.Unmarshal(encoded, &published))
+
+	assert.Empty(t, Incompatibilities(&published, Generate(reflect.TypeFor[string]())))
+	assert.Equal(t, []string{"/: matches none of the published alternatives"}, Incompatibilities(&published, Generate(reflect.TypeFor[int]())))
+}
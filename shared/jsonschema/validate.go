@@ -0,0 +1,190 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every violation of a schema found in a document.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "document does not match the schema: " + strings.Join(e.Violations, "; ")
+}
+
+// ValidateJSON decodes data and validates it against the schema.
+func (s *Schema) ValidateJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Errorf("failed to decode the document: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("failed to decode the document: unexpected data after the top-level value")
+	}
+	return s.Validate(document)
+}
+
+// Validate validates a document decoded by encoding/json against the schema, whose $defs resolve the references.
+// Each violation is prefixed by the JSON pointer of the value.
+func (s *Schema) Validate(document any) error {
+	v := &validator{root: s}
+	v.validate(s, document, "")
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+type validator struct {
+	root       *Schema
+	violations []string
+}
+
+func (v *validator) fail(pointer string, format string, args ...any) {
+	v.violations = append(v.violations, fmt.Sprintf("%s: %s", cmpOr(pointer, "/"), fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) validate(schema *Schema, value any, pointer string) {
+	if schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, defsRefPrefix)
+		target, found := v.root.Defs[name]
+		if !ok || !found {
+			v.fail(pointer, "unresolvable reference %s", schema.Ref)
+			return
+		}
+		v.validate(target, value, pointer)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, alternative := range schema.AnyOf {
+			branch := &validator{root: v.root}
+			branch.validate(alternative, value, pointer)
+			if len(branch.violations) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(pointer, "matches none of the %d alternatives", len(schema.AnyOf))
+		}
+	}
+
+	if schema.Const != nil && !sameJSONValue(schema.Const, value) {
+		v.fail(pointer, "must be %v", schema.Const)
+	}
+
+	if len(schema.Type) > 0 && !slices.ContainsFunc(schema.Type, func(typeName string) bool { return hasType(value, typeName) }) {
+		v.fail(pointer, "must be of type %s, got %s", strings.Join(schema.Type, " or "), typeOf(value))
+		return
+	}
+
+	switch typed := value.(type) {
+	case string:
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, typed); err != nil {
+				v.fail(pointer, "must be an RFC 3339 date-time, got %q", typed)
+			}
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range typed {
+				v.validate(schema.Items, item, fmt.Sprintf("%s/%d", pointer, i))
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := typed[name]; !ok {
+				v.fail(pointer, "missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			propertyPointer := pointer + "/" + escapePointer(name)
+			if propertySchema, ok := schema.Properties[name]; ok {
+				v.validate(propertySchema, typed[name], propertyPointer)
+			} else if schema.AdditionalProperties != nil {
+				v.validate(schema.AdditionalProperties, typed[name], propertyPointer)
+			}
+		}
+	}
+}
+
+func hasType(value any, typeName string) bool {
+	switch typeName {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "integer":
+		n, ok := number(value)
+		return ok && n == math.Trunc(n)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	default:
+		return false
+	}
+}
+
+func number(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case json.Number:
+		n, err := typed.Float64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func typeOf(value any) string {
+	for _, typeName := range []string{"null", "boolean", "string", "integer", "number", "array", "object"} {
+		if hasType(value, typeName) {
+			return typeName
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sameJSONValue compares a schema value and a document value by their JSON encodings, so numbers compare whatever
+// their Go type.
+func sameJSONValue(expected, actual any) bool {
+	var normalized [2]any
+	for i, value := range []any{expected, actual} {
+		encoded, err := json.Marshal(value)
+		if err != nil || json.Unmarshal(encoded, &normalized[i]) != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1])
+}
+
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
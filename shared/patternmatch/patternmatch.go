@@ -0,0 +1,64 @@
+package patternmatch
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RegexPrefix marks a pattern as a regular expression. Patterns without it are treated as globs (path.Match syntax).
+const RegexPrefix = "re:"
+
+// Matcher reports whether a value matches any of a list of glob or regular expression patterns.
+type Matcher struct {
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// Compile validates and compiles the given patterns.
+// A pattern prefixed with "re:" is a regular expression, e.g. "re:^svc-[0-9]+$"; every other pattern is a glob, e.g. "svc-*".
+func Compile(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("empty pattern")
+		}
+		if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+			}
+			m.regexps = append(m.regexps, re)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+		m.globs = append(m.globs, pattern)
+	}
+	return m, nil
+}
+
+// IsEmpty reports whether the matcher has no patterns.
+func (m *Matcher) IsEmpty() bool {
+	return m == nil || (len(m.globs) == 0 && len(m.regexps) == 0)
+}
+
+// Match reports whether value matches at least one pattern. An empty matcher matches nothing.
+func (m *Matcher) Match(value string) bool {
+	if m == nil {
+		return false
+	}
+	for _, glob := range m.globs {
+		if ok, _ := path.Match(glob, value); ok {
+			return true
+		}
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package patternmatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcherGlobAndRegex(t *testing.T) {
+	m, err := Compile([]string{"svc-*", "re:^lib-[0-9]+$"})
+	assert.NoError(t, err)
+
+	assert.True(t, m.Match("svc-payments"))
+	assert.True(t, m.Match("lib-42"))
+	assert.False(t, m.Match("lib-core"))
+	assert.False(t, m.Match("frontend"))
+	assert.False(t, m.IsEmpty())
+}
+
+func TestEmptyMatcherMatchesNothing(t *testing.T) {
+	m, err := Compile(nil)
+	assert.NoError(t, err)
+	assert.True(t, m.IsEmpty())
+	assert.False(t, m.Match("anything"))
+}
+
+func TestCompileRejectsInvalidPatterns(t *testing.T) {
+	_, err := Compile([]string{"re:("})
+	assert.Error(t, err)
+
+	_, err = Compile([]string{"[a-"})
+	assert.Error(t, err)
+
+	_, err = Compile([]string{""})
+	assert.Error(t, err)
+}
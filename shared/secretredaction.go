@@ -0,0 +1,57 @@
+package shared
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+const RedactedValue = "[REDACTED]"
+
+// Redactable is implemented by values that must never be logged as is, such as credentials.
+// Redacted returns what is logged in their place.
+type Redactable interface {
+	Redacted() any
+}
+
+// secretAttrKeys are attribute keys, lower cased, whose values are always redacted.
+var secretAttrKeys = map[string]bool{
+	"password":        true,
+	"credkey":         true,
+	"apikey":          true,
+	"ddapikey":        true,
+	"authorization":   true,
+	"secret":          true,
+	"clientsecret":    true,
+	"accesstoken":     true,
+	"refreshtoken":    true,
+	"privacyhashsalt": true,
+}
+
+// RedactSecretAttr is a slog ReplaceAttr function that hides credentials: Redactable values and slices of them are
+// replaced by their redacted form and attributes with secret keys by RedactedValue.
+func RedactSecretAttr(groups []string, a slog.Attr) slog.Attr {
+	if secretAttrKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, RedactedValue)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+
+	value := a.Value.Any()
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() == reflect.Pointer && reflected.IsNil() {
+		return a
+	}
+	if redactable, ok := value.(Redactable); ok {
+		return slog.Any(a.Key, redactable.Redacted())
+	}
+	if reflected.Kind() == reflect.Slice && reflected.Type().Elem().Implements(reflect.TypeFor[Redactable]()) {
+		redacted := make([]any, reflected.Len())
+		for i := range redacted {
+			redacted[i] = reflected.Index(i).Interface().(Redactable).Redacted()
+		}
+		return slog.Any(a.Key, redacted)
+	}
+	return a
+}
@@ -0,0 +1,38 @@
+package shared
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/bluelock-go/shared/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactSecretAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: RedactSecretAttr}))
+	credentials := []auth.Credential{
+		{Username: "user_1", Password: "password_1", CredKey: "dXNlcl8xOnBhc3N3b3JkXzE=", TokenID: "tok-1"},
+		{Username: "user_2", Password: "password_2", CredKey: "dXNlcl8yOnBhc3N3b3JkXzI="},
+	}
+	var nilCredential *auth.Credential
+
+	logger.Info("Credentials loaded",
+		"credentials", credentials,
+		"credential", &credentials[0],
+		"nilCredential", nilCredential,
+		"ddApiKey", "api-key-value",
+		"Password", "password_3",
+		"workspace", "acme",
+	)
+
+	output := buf.String()
+	for _, secret := range []string{"password_1", "password_2", "password_3", "dXNlcl8xOnBhc3N3b3JkXzE=", "dXNlcl8yOnBhc3N3b3JkXzI=", "api-key-value"} {
+		assert.NotContains(t, output, secret)
+	}
+	assert.Contains(t, output, "credentials=\"[tok-1 "+auth.MaskCredKey(credentials[1].CredKey)+"]\"")
+	assert.Contains(t, output, "credential=tok-1")
+	assert.Contains(t, output, "ddApiKey="+RedactedValue)
+	assert.Contains(t, output, "workspace=acme")
+}
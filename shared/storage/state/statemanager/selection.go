@@ -0,0 +1,160 @@
+package statemanager
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared/storage/state/token"
+)
+
+// TokenSelectionStrategy picks the token of the next request among the active tokens.
+type TokenSelectionStrategy interface {
+	// SelectToken returns one of candidates, the IDs of the active tokens sorted ascending. Ties are broken by the
+	// order of candidates, so the same states always select the same token.
+	SelectToken(candidates []string, tokenStates map[string]token.TokenState) string
+}
+
+// NewTokenSelectionStrategy returns the strategy selected in the configuration.
+func NewTokenSelectionStrategy(cfg config.TokenSelection) (TokenSelectionStrategy, error) {
+	switch cfg.Strategy {
+	case "", config.TokenSelectionLeastUsed:
+		return LeastUsedStrategy{}, nil
+	case config.TokenSelectionRoundRobin:
+		return &RoundRobinStrategy{}, nil
+	case config.TokenSelectionMostRemainingQuota:
+		return MostRemainingQuotaStrategy{}, nil
+	case config.TokenSelectionWeighted:
+		return WeightedStrategy{
+			RemainingQuotaWeight: cfg.Weights.RemainingQuota,
+			LatencyWeight:        cfg.Weights.Latency,
+			FailuresWeight:       cfg.Weights.Failures,
+			UsageWeight:          cfg.Weights.Usage,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported token selection strategy: %s", cfg.Strategy)
+	}
+}
+
+// RoundRobinStrategy cycles through the active tokens in token ID order. It is not safe for concurrent use on its
+// own, the StateManager serializes the selections.
+type RoundRobinStrategy struct {
+	lastTokenID string
+}
+
+func (s *RoundRobinStrategy) SelectToken(candidates []string, tokenStates map[string]token.TokenState) string {
+	selected := candidates[0]
+	for _, tokenID := range candidates {
+		if tokenID > s.lastTokenID {
+			selected = tokenID
+			break
+		}
+	}
+	s.lastTokenID = selected
+	return selected
+}
+
+// LeastUsedStrategy picks the token with the fewest successful requests since the last rate limit reset, then the one
+// used longest ago.
+type LeastUsedStrategy struct{}
+
+func (LeastUsedStrategy) SelectToken(candidates []string, tokenStates map[string]token.TokenState) string {
+	selected := candidates[0]
+	for _, tokenID := range candidates[1:] {
+		tokenState, selectedState := tokenStates[tokenID], tokenStates[selected]
+		if tokenState.SuccessfulUsageCount < selectedState.SuccessfulUsageCount ||
+			(tokenState.SuccessfulUsageCount == selectedState.SuccessfulUsageCount && tokenState.LastUsageAt.Before(selectedState.LastUsageAt)) {
+			selected = tokenID
+		}
+	}
+	return selected
+}
+
+// MostRemainingQuotaStrategy picks the token with the most requests left according to the rate limit headers, then
+// the least used one. Tokens without a known quota come first, their first response tells how much is left.
+type MostRemainingQuotaStrategy struct{}
+
+func (MostRemainingQuotaStrategy) SelectToken(candidates []string, tokenStates map[string]token.TokenState) string {
+	remainingQuota := func(tokenState token.TokenState) int {
+		remaining, known := tokenState.RemainingQuota()
+		if !known {
+			return math.MaxInt
+		}
+		return remaining
+	}
+
+	selected := candidates[0]
+	for _, tokenID := range candidates[1:] {
+		tokenState, selectedState := tokenStates[tokenID], tokenStates[selected]
+		remaining, selectedRemaining := remainingQuota(tokenState), remainingQuota(selectedState)
+		if remaining > selectedRemaining ||
+			(remaining == selectedRemaining && tokenState.SuccessfulUsageCount < selectedState.SuccessfulUsageCount) {
+			selected = tokenID
+		}
+	}
+	return selected
+}
+
+// WeightedStrategy scores the tokens by their remaining quota, minus their latency, consecutive failures and usage,
+// and picks the highest score. The remaining quota is the share of the rate limit that is left, a token without a
+// known quota counts as unused. The other metrics are relative to the highest value among the candidates.
+type WeightedStrategy struct {
+	RemainingQuotaWeight float64
+	LatencyWeight        float64
+	FailuresWeight       float64
+	UsageWeight          float64
+}
+
+func (s WeightedStrategy) SelectToken(candidates []string, tokenStates map[string]token.TokenState) string {
+	var maxRemaining, maxFailures, maxUsage int
+	var maxLatency float64
+	for _, tokenID := range candidates {
+		tokenState := tokenStates[tokenID]
+		if remaining, known := tokenState.RemainingQuota(); known {
+			maxRemaining = max(maxRemaining, remaining)
+		}
+		maxLatency = max(maxLatency, tokenState.LatencyMillis)
+		maxFailures = max(maxFailures, tokenState.ConsecutiveFailureCount)
+		maxUsage = max(maxUsage, tokenState.SuccessfulUsageCount)
+	}
+
+	ratio := func(value, maxValue float64) float64 {
+		if maxValue <= 0 {
+			return 0
+		}
+		return value / maxValue
+	}
+	score := func(tokenState token.TokenState) float64 {
+		remainingShare := 1.0
+		if remaining, known := tokenState.RemainingQuota(); known {
+			if tokenState.RateLimitLimit > 0 {
+				remainingShare = ratio(float64(remaining), float64(tokenState.RateLimitLimit))
+			} else {
+				remainingShare = ratio(float64(remaining), float64(maxRemaining))
+			}
+		}
+		return s.RemainingQuotaWeight*remainingShare -
+			s.LatencyWeight*ratio(tokenState.LatencyMillis, maxLatency) -
+			s.FailuresWeight*ratio(float64(tokenState.ConsecutiveFailureCount), float64(maxFailures)) -
+			s.UsageWeight*ratio(float64(tokenState.SuccessfulUsageCount), float64(maxUsage))
+	}
+
+	selected, selectedScore := candidates[0], score(tokenStates[candidates[0]])
+	for _, tokenID := range candidates[1:] {
+		if tokenScore := score(tokenStates[tokenID]); tokenScore > selectedScore {
+			selected, selectedScore = tokenID, tokenScore
+		}
+	}
+	return selected
+}
+
+// sortedTokenIDs returns the token IDs of tokenStates in ascending order, the candidate order of the strategies.
+func sortedTokenIDs(tokenStates map[string]token.TokenState) []string {
+	tokenIDs := make([]string, 0, len(tokenStates))
+	for tokenID := range tokenStates {
+		tokenIDs = append(tokenIDs, tokenID)
+	}
+	slices.Sort(tokenIDs)
+	return tokenIDs
+}
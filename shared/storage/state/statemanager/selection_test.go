@@ -0,0 +1,210 @@
+package statemanager
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/config"
+	"github.com/bluelock-go/shared/storage/state/token"
+)
+
+func newSelectionTestStateManager(t *testing.T, tokenStates map[string]token.TokenState) *StateManager {
+	sm, err := NewStateManager(filepath.Join(t.TempDir(), "test_state.json"))
+	if err != nil {
+		t.Fatalf("Failed to create StateManager: %v", err)
+	}
+	for tokenID, tokenState := range tokenStates {
+		if tokenState.Status == "" {
+			tokenState.Status = token.TokenActive
+		}
+		sm.State.TokenStates[tokenID] = tokenState
+	}
+	return sm
+}
+
+func TestTokenSelectionStrategies(t *testing.T) {
+	now := time.Now()
+	tokenStates := map[string]token.TokenState{
+		"token_a": {SuccessfulUsageCount: 5, LastUsageAt: now, RateLimitRemaining: 100, RateLimitLimit: 1000, RateLimitObservedAt: now, LatencyMillis: 100},
+		"token_b": {SuccessfulUsageCount: 2, LastUsageAt: now, RateLimitRemaining: 900, RateLimitLimit: 1000, RateLimitObservedAt: now, LatencyMillis: 900, ConsecutiveFailureCount: 3},
+		"token_c": {SuccessfulUsageCount: 2, LastUsageAt: now.Add(-time.Minute), RateLimitRemaining: 700, RateLimitLimit: 1000, RateLimitObservedAt: now, LatencyMillis: 120},
+		"token_d": {Status: token.TokenExhausted},
+	}
+
+	testCases := []struct {
+		name          string
+		strategy      TokenSelectionStrategy
+		expectedToken string
+	}{
+		{"least used, then used longest ago", LeastUsedStrategy{}, "token_c"},
+		{"most remaining quota", MostRemainingQuotaStrategy{}, "token_b"},
+		{"weighted avoids slow and failing tokens", WeightedStrategy{RemainingQuotaWeight: 1, LatencyWeight: 0.5, FailuresWeight: 1, UsageWeight: 0.5}, "token_c"},
+		{"weighted by quota only", WeightedStrategy{RemainingQuotaWeight: 1}, "token_b"},
+		{"round robin starts with the first token", &RoundRobinStrategy{}, "token_a"},
+	}
+	for _, tc := range testCases {
+		sm := newSelectionTestStateManager(t, tokenStates)
+		sm.SetTokenSelectionStrategy(tc.strategy)
+		selected, err := sm.SelectActiveToken()
+		if err != nil {
+			t.Fatalf("%s: failed to select token: %v", tc.name, err)
+		}
+		if selected != tc.expectedToken {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expectedToken, selected)
+		}
+	}
+}
+
+func TestTokenSelectionTieBreaking(t *testing.T) {
+	strategies := map[string]TokenSelectionStrategy{
+		"leastUsed":          LeastUsedStrategy{},
+		"mostRemainingQuota": MostRemainingQuotaStrategy{},
+		"weighted":           WeightedStrategy{RemainingQuotaWeight: 1, LatencyWeight: 1, FailuresWeight: 1, UsageWeight: 1},
+	}
+	tokenStates := map[string]token.TokenState{}
+	for _, tokenID := range []string{"token_e", "token_c", "token_a", "token_d", "token_b"} {
+		tokenStates[tokenID] = token.TokenState{}
+	}
+
+	for name, strategy := range strategies {
+		sm := newSelectionTestStateManager(t, tokenStates)
+		sm.SetTokenSelectionStrategy(strategy)
+		// map iteration order changes between runs, the selection must not
+		for i := 0; i < 50; i++ {
+			selected, err := sm.SelectActiveToken()
+			if err != nil {
+				t.Fatalf("%s: failed to select token: %v", name, err)
+			}
+			if selected != "token_a" {
+				t.Fatalf("%s: expected ties to select token_a, got %s", name, selected)
+			}
+		}
+	}
+
+	// unknown quotas come first, among them the least used token
+	sm := newSelectionTestStateManager(t, map[string]token.TokenState{
+		"token_a": {SuccessfulUsageCount: 1, RateLimitRemaining: 1000, RateLimitObservedAt: time.Now()},
+		"token_b": {SuccessfulUsageCount: 3},
+		"token_c": {SuccessfulUsageCount: 2},
+	})
+	sm.SetTokenSelectionStrategy(MostRemainingQuotaStrategy{})
+	if selected, _ := sm.SelectActiveToken(); selected != "token_c" {
+		t.Errorf("Expected the least used token without known quota, got %s", selected)
+	}
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	sm := newSelectionTestStateManager(t, map[string]token.TokenState{
+		"token_a": {}, "token_b": {}, "token_c": {},
+	})
+	sm.SetTokenSelectionStrategy(&RoundRobinStrategy{})
+
+	var selections []string
+	for i := 0; i < 4; i++ {
+		selected, _ := sm.SelectActiveToken()
+		selections = append(selections, selected)
+	}
+	expected := []string{"token_a", "token_b", "token_c", "token_a"}
+	for i := range expected {
+		if selections[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, selections)
+		}
+	}
+
+	// an exhausted token is skipped and the cycle continues after the last selected token
+	sm.SetTokenStatusToRateLimited("token_b")
+	if selected, _ := sm.SelectActiveToken(); selected != "token_c" {
+		t.Errorf("Expected token_c after skipping the exhausted token_b, got %s", selected)
+	}
+}
+
+func TestConcurrentRoundRobinSelection(t *testing.T) {
+	sm := newSelectionTestStateManager(t, map[string]token.TokenState{
+		"token_a": {}, "token_b": {}, "token_c": {},
+	})
+	sm.SetTokenSelectionStrategy(&RoundRobinStrategy{})
+
+	var wg sync.WaitGroup
+	var selectionsMu sync.Mutex
+	selectionCounts := map[string]int{}
+	numGoroutines := 30
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			selected, err := sm.SelectActiveToken()
+			if err != nil {
+				t.Errorf("Failed to select token: %v", err)
+				return
+			}
+			selectionsMu.Lock()
+			selectionCounts[selected]++
+			selectionsMu.Unlock()
+		}()
+	}
+
+	// Wait for all goroutines to finish
+	wg.Wait()
+
+	for _, tokenID := range []string{"token_a", "token_b", "token_c"} {
+		if selectionCounts[tokenID] != numGoroutines/3 {
+			t.Errorf("Expected token %s to be selected %d times, got %d", tokenID, numGoroutines/3, selectionCounts[tokenID])
+		}
+	}
+}
+
+func TestConcurrentTokenResponseRecording(t *testing.T) {
+	sm := newSelectionTestStateManager(t, map[string]token.TokenState{"shared_token": {}})
+
+	var wg sync.WaitGroup
+	numGoroutines := 10
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sm.RecordTokenResponse("shared_token", token.ResponseObservation{ObservedAt: time.Now(), Latency: time.Second, StatusCode: 503})
+			if err != nil {
+				t.Errorf("Failed to record token response: %v", err)
+			}
+		}()
+	}
+
+	// Wait for all goroutines to finish
+	wg.Wait()
+
+	tokenState := sm.State.TokenStates["shared_token"]
+	if tokenState.ConsecutiveFailureCount != numGoroutines {
+		t.Errorf("Expected %d consecutive failures, got %d", numGoroutines, tokenState.ConsecutiveFailureCount)
+	}
+	if tokenState.LatencyMillis != 1000 {
+		t.Errorf("Expected a latency of 1000ms, got %v", tokenState.LatencyMillis)
+	}
+}
+
+func TestNewTokenSelectionStrategy(t *testing.T) {
+	for kind, expected := range map[config.TokenSelectionStrategyKind]TokenSelectionStrategy{
+		"":                                      LeastUsedStrategy{},
+		config.TokenSelectionLeastUsed:          LeastUsedStrategy{},
+		config.TokenSelectionMostRemainingQuota: MostRemainingQuotaStrategy{},
+		config.TokenSelectionWeighted:           WeightedStrategy{RemainingQuotaWeight: 1, UsageWeight: 0.5},
+	} {
+		strategy, err := NewTokenSelectionStrategy(config.TokenSelection{Strategy: kind, Weights: config.TokenSelectionWeights{RemainingQuota: 1, Usage: 0.5}})
+		if err != nil {
+			t.Fatalf("Failed to create %q strategy: %v", kind, err)
+		}
+		if strategy != expected {
+			t.Errorf("Expected %#v for %q, got %#v", expected, kind, strategy)
+		}
+	}
+
+	if strategy, _ := NewTokenSelectionStrategy(config.TokenSelection{Strategy: config.TokenSelectionRoundRobin}); strategy == nil {
+		t.Errorf("Expected a round robin strategy")
+	}
+	if _, err := NewTokenSelectionStrategy(config.TokenSelection{Strategy: "random"}); err == nil {
+		t.Errorf("Expected an unsupported strategy to fail")
+	}
+}
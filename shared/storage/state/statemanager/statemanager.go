@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,23 +14,42 @@ import (
 	"github.com/bluelock-go/shared/auth"
 	"github.com/bluelock-go/shared/customerrors"
 	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/bluelock-go/shared/storage/state/tokenpool"
 )
 
+// CurrentStateVersion is the version of the state file format.
+// Version 2 keys the token states by token ID instead of the raw credKey.
+const CurrentStateVersion = 2
+
 // State holds the persistent state information
 type State struct {
+	Version                   int                         `json:"version"`
 	LastJobExecutionStartTime time.Time                   `json:"lastJobExecutionStartTime"`
 	LastJobExecutionEndTime   time.Time                   `json:"lastJobExecutionEndTime"`
 	OngoingJobStartTime       time.Time                   `json:"ongoingJobStartTime"`
 	RateLimitResetAt          time.Time                   `json:"rateLimitResetAt"`
 	CooldownCompletedAt       time.Time                   `json:"cooldownCompletedAt"`
 	TokenStates               map[string]token.TokenState `json:"tokenStates"`
+	// OAuthTokens caches the access tokens of the OAuth consumers by token ID.
+	OAuthTokens map[string]token.OAuthToken `json:"oauthTokens,omitempty"`
 }
 
 // StateManager wraps State with a mutex for concurrency safety
 type StateManager struct {
 	filePath string
-	mu       sync.Mutex
-	State    State
+	// dryRun keeps every change in memory, the state file is read but never written
+	dryRun            bool
+	mu                sync.Mutex
+	State             State
+	selectionStrategy TokenSelectionStrategy
+	// writeBehind defers the writes of the usage accounting to the next flush, dirty marks usage not written yet
+	writeBehind  bool
+	dirty        bool
+	stopFlushing chan struct{}
+	flushingDone chan struct{}
+	// tokenPool shares the token states with the other processes using the same tokens, nil when they are not shared
+	tokenPool       *tokenpool.TokenPool
+	tokenPoolLogger *shared.CustomLogger
 }
 
 // NewStateManager initializes StateManager and loads existing state
@@ -39,6 +60,7 @@ func NewStateManager(filePath string) (*StateManager, error) {
 		State: State{
 			TokenStates: make(map[string]token.TokenState),
 		},
+		selectionStrategy: LeastUsedStrategy{},
 	}
 
 	// Load state from file if it exists
@@ -50,6 +72,17 @@ func NewStateManager(filePath string) (*StateManager, error) {
 	return sm, nil
 }
 
+// NewDryRunStateManager loads the state like NewStateManager, but never writes it back: the token usage, the token
+// status transitions and the cached OAuth access tokens of a dry run are lost with the process.
+func NewDryRunStateManager(filePath string) (*StateManager, error) {
+	sm, err := NewStateManager(filePath)
+	if err != nil {
+		return nil, err
+	}
+	sm.dryRun = true
+	return sm, nil
+}
+
 // LoadState reads the state from a JSON file
 func (sm *StateManager) LoadState() error {
 	sm.mu.Lock()
@@ -68,33 +101,171 @@ func (sm *StateManager) SyncTokenStatusWithLatestAuthCredentials(credentials []a
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Create a map to store the latest token states
-	latestTokenStates := make(map[string]token.TokenState)
+	err := sm.withTokenPool(func(snapshot *tokenpool.Snapshot) error {
+		// Create a map to store the latest token states
+		latestTokenStates := make(map[string]token.TokenState)
+
+		// Iterate through the credentials and update the token states
+		for _, cred := range credentials {
+			tokenID := cred.TokenID
+			if tokenID == "" {
+				return fmt.Errorf("credential has no token ID: %s: %w", cred.Redacted(), customerrors.ErrCritical)
+			}
+			tokenState, exists := sm.State.TokenStates[tokenID]
+			if !exists && snapshot != nil {
+				// a token new to this process may already be used by the other processes of the pool
+				tokenState, exists = snapshot.TokenStates[tokenID]
+			}
+			if !exists {
+				// state files before version 2 keyed the token states by credKey, carry them over to the token ID
+				tokenState, exists = sm.State.TokenStates[cred.CredKey]
+			}
+			if !exists {
+				tokenState = token.TokenState{}
+			}
+			// revoked tokens stay revoked, they come back only with new secrets, which changes their token ID.
+			// Unauthorized tokens stay unauthorized until the token health checker restores them.
+			// Exhausted tokens of the pool stay exhausted, another process ran them out of quota
+			if !tokenState.IsRevoked() && !tokenState.IsUnauthorized() && (snapshot == nil || !tokenState.IsExhausted()) {
+				tokenState.UpdateTokenStatus(token.TokenActive, time.Now())
+			}
+			latestTokenStates[tokenID] = tokenState
+		}
 
-	// Iterate through the credentials and update the token states
-	for _, cred := range credentials {
-		tokenID := cred.CredKey
-		tokenState, exists := sm.State.TokenStates[tokenID]
-		if !exists {
-			tokenState = token.TokenState{}
+		sm.State.TokenStates = latestTokenStates
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sm.State.Version = CurrentStateVersion
+	// access tokens of removed consumers are dropped with them
+	for tokenID := range sm.State.OAuthTokens {
+		if _, exists := sm.State.TokenStates[tokenID]; !exists {
+			delete(sm.State.OAuthTokens, tokenID)
 		}
-		tokenState.UpdateTokenStatus(token.TokenActive, time.Now())
-		latestTokenStates[tokenID] = tokenState
 	}
 
-	sm.State.TokenStates = latestTokenStates
-
 	return sm.saveState()
 }
 
-// saveState writes the state to a JSON file
+// saveState writes the state to a JSON file, including the usage deferred by the write-behind mode.
+// The state is written to a temporary file replacing the state file, so a crash leaves the previous or the new state
+// behind but never a partial one.
 func (sm *StateManager) saveState() error {
+	if sm.dryRun {
+		sm.dirty = false
+		return nil
+	}
 	data, err := json.MarshalIndent(sm.State, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(sm.filePath, data, 0644)
+	// the state holds the cached OAuth access tokens, CreateTemp makes it readable by the owner only
+	tempFile, err := os.CreateTemp(filepath.Dir(sm.filePath), filepath.Base(sm.filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile.Name(), sm.filePath); err != nil {
+		return err
+	}
+
+	sm.dirty = false
+	return nil
+}
+
+// saveUsage writes the state after a change of the usage accounting, or marks it dirty in write-behind mode. Losing
+// usage in a crash only skews the token selection, the status transitions are always written by saveState.
+func (sm *StateManager) saveUsage() error {
+	if sm.writeBehind {
+		sm.dirty = true
+		return nil
+	}
+	return sm.saveState()
+}
+
+// StartWriteBehind defers the writes of the usage accounting and flushes them every flushInterval until Close.
+func (sm *StateManager) StartWriteBehind(flushInterval time.Duration, logger *shared.CustomLogger) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.writeBehind {
+		return fmt.Errorf("write-behind is already started")
+	}
+	if flushInterval <= 0 {
+		return fmt.Errorf("flush interval must be greater than 0")
+	}
+	stopFlushing, flushingDone := make(chan struct{}), make(chan struct{})
+	sm.writeBehind, sm.stopFlushing, sm.flushingDone = true, stopFlushing, flushingDone
+
+	go func() {
+		defer close(flushingDone)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopFlushing:
+				return
+			case <-ticker.C:
+				// a failed flush keeps the state dirty, it is retried with the next one
+				if err := sm.Flush(); err != nil {
+					logger.Error("Failed to flush state", "error", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Flush writes the usage deferred by the write-behind mode.
+func (sm *StateManager) Flush() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !sm.dirty {
+		return nil
+	}
+	return sm.saveState()
+}
+
+// Close stops the write-behind flushes, writes the deferred usage and leaves the token pool.
+func (sm *StateManager) Close() error {
+	sm.mu.Lock()
+	writeBehind, stopFlushing, flushingDone := sm.writeBehind, sm.stopFlushing, sm.flushingDone
+	sm.writeBehind = false
+	sm.mu.Unlock()
+
+	if writeBehind {
+		close(stopFlushing)
+		<-flushingDone
+	}
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.tokenPool == nil {
+		return nil
+	}
+	pool := sm.tokenPool
+	sm.tokenPool = nil
+	return pool.Close()
 }
 
 func (sm *StateManager) SaveStateWithMutex() error {
@@ -127,17 +298,49 @@ func (sm *StateManager) UpdateRateLimitResetTime(resetTime time.Time) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sm.State.RateLimitResetAt = resetTime
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		sm.State.RateLimitResetAt = resetTime
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
 	return sm.saveState()
 }
 
+// ScheduleRateLimitReset returns when the tokens exhausted at exhaustedAt are reset. The reset time another process
+// of the token pool scheduled after exhaustedAt is honored, otherwise resetAt is scheduled, so the processes sharing
+// the tokens wait for the same reset.
+func (sm *StateManager) ScheduleRateLimitReset(exhaustedAt, resetAt time.Time) (time.Time, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		if !sm.State.RateLimitResetAt.After(exhaustedAt) {
+			sm.State.RateLimitResetAt = resetAt
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return sm.State.RateLimitResetAt, sm.saveState()
+}
+
 // ✅ Replace Token State
 func (sm *StateManager) ReplaceTokenState(tokenID string, newState token.TokenState) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sm.State.TokenStates[tokenID] = newState
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		sm.State.TokenStates[tokenID] = newState
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 	return sm.saveState()
 }
 
@@ -146,14 +349,13 @@ func (sm *StateManager) SetTokenStatusToRateLimited(tokenID string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	token, exists := sm.State.TokenStates[tokenID]
-	if !exists {
-		return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+	err := sm.updateTokenState(tokenID, func(tokenState *token.TokenState) {
+		tokenState.SetTokenAsExhausted(currentTime)
+	})
+	if err != nil {
+		return err
 	}
 
-	token.SetTokenAsExhausted(currentTime)
-	sm.State.TokenStates[tokenID] = token
-
 	return sm.saveState()
 }
 func (sm *StateManager) SetTokenStatusToUnauthorized(tokenID string) error {
@@ -161,31 +363,203 @@ func (sm *StateManager) SetTokenStatusToUnauthorized(tokenID string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	token, exists := sm.State.TokenStates[tokenID]
-	if !exists {
-		return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+	err := sm.updateTokenState(tokenID, func(tokenState *token.TokenState) {
+		tokenState.SetTokenAsUnauthorized(currentTime)
+	})
+	if err != nil {
+		return err
 	}
 
-	token.SetTokenAsUnauthorized(currentTime)
-	sm.State.TokenStates[tokenID] = token
-
 	return sm.saveState()
 }
 
+// GetTokensDueForProbe returns the unauthorized tokens whose health probe is due at the given time.
+func (sm *StateManager) GetTokensDueForProbe(at time.Time, firstProbeDelay time.Duration) []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var dueTokens []string
+	sm.refreshFromTokenPool()
+	for tokenID, tokenState := range sm.State.TokenStates {
+		if tokenState.IsDueForProbe(at, firstProbeDelay) {
+			dueTokens = append(dueTokens, tokenID)
+		}
+	}
+	slices.Sort(dueTokens)
+
+	return dueTokens
+}
+
+// RecordFailedTokenProbe counts a failed health probe of an unauthorized token and returns its resulting status. The
+// token is marked revoked after revokeAfterFailures consecutive failures, otherwise it is probed again with backoff.
+func (sm *StateManager) RecordFailedTokenProbe(tokenID string, probeTime time.Time, probeInterval, maxProbeInterval time.Duration, revokeAfterFailures int) (token.TokenStatus, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var status token.TokenStatus
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		tokenState, exists := sm.State.TokenStates[tokenID]
+		if !exists {
+			return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+		}
+		status = tokenState.Status
+		if !tokenState.IsUnauthorized() {
+			return nil
+		}
+
+		tokenState.RecordFailedProbe(probeTime, probeInterval, maxProbeInterval)
+		if tokenState.ProbeFailureCount >= revokeAfterFailures {
+			tokenState.SetTokenAsRevoked(probeTime)
+		}
+		sm.State.TokenStates[tokenID] = tokenState
+		status = tokenState.Status
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return status, sm.saveState()
+}
+
+// RestoreUnauthorizedToken makes an unauthorized token that passed its health probe active again. It reports false
+// when the token is no longer unauthorized, e.g. because it was revoked meanwhile.
+func (sm *StateManager) RestoreUnauthorizedToken(tokenID string) (bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	restored := false
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		tokenState, exists := sm.State.TokenStates[tokenID]
+		if !exists {
+			return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+		}
+		if !tokenState.IsUnauthorized() {
+			return nil
+		}
+
+		tokenState.RestoreFromUnauthorized(time.Now())
+		sm.State.TokenStates[tokenID] = tokenState
+		restored = true
+		return nil
+	})
+	if err != nil || !restored {
+		return false, err
+	}
+
+	return true, sm.saveState()
+}
+
 // ✅ Update Last Token Usage Time
 func (sm *StateManager) UpdateTokenUsage(tokenID string, usageTime time.Time) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	token, exists := sm.State.TokenStates[tokenID]
-	if !exists {
-		return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+	err := sm.updateTokenState(tokenID, func(tokenState *token.TokenState) {
+		tokenState.UpdateTokenUsage(usageTime)
+	})
+	if err != nil {
+		return err
 	}
 
-	token.UpdateTokenUsage(usageTime)
-	sm.State.TokenStates[tokenID] = token
+	return sm.saveUsage()
+}
 
-	return sm.saveState()
+// RecordTokenResponse accounts a response to the token it was requested with, counting a successful response as a
+// usage of the token, and updates the rate limit, latency and failures of the token with it.
+func (sm *StateManager) RecordTokenResponse(tokenID string, observation token.ResponseObservation) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	err := sm.updateTokenState(tokenID, func(tokenState *token.TokenState) {
+		tokenState.RecordResponse(observation)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sm.saveUsage()
+}
+
+// updateTokenState applies update to the state of an existing token.
+func (sm *StateManager) updateTokenState(tokenID string, update func(tokenState *token.TokenState)) error {
+	return sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		tokenState, exists := sm.State.TokenStates[tokenID]
+		if !exists {
+			return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+		}
+
+		update(&tokenState)
+		sm.State.TokenStates[tokenID] = tokenState
+		return nil
+	})
+}
+
+// SetTokenSelectionStrategy replaces the strategy SelectActiveToken picks the tokens with.
+func (sm *StateManager) SetTokenSelectionStrategy(strategy TokenSelectionStrategy) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.selectionStrategy = strategy
+}
+
+// SetTokenPool shares the token states, the rate limit reset and the cooldown with the other processes of the pool.
+// The usage accounting goes to the pool on every request, the write-behind mode only defers the state file.
+func (sm *StateManager) SetTokenPool(pool *tokenpool.TokenPool, logger *shared.CustomLogger) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.tokenPool, sm.tokenPoolLogger = pool, logger
+}
+
+// withTokenPool runs fn on the token states of this process refreshed from the token pool, and stores them back in
+// the pool, as a single update the other processes cannot interleave with. It only runs fn without a token pool.
+// fn receives the snapshot of the pool, nil without one.
+func (sm *StateManager) withTokenPool(fn func(snapshot *tokenpool.Snapshot) error) error {
+	if sm.tokenPool == nil {
+		return fn(nil)
+	}
+
+	var fnErr error
+	err := sm.tokenPool.Update(func(snapshot *tokenpool.Snapshot) error {
+		// the pool holds the latest states, the tokens of this process not in the pool yet keep their local state
+		for tokenID := range sm.State.TokenStates {
+			if pooledState, exists := snapshot.TokenStates[tokenID]; exists {
+				sm.State.TokenStates[tokenID] = pooledState
+			}
+		}
+		if snapshot.RateLimitResetAt.After(sm.State.RateLimitResetAt) {
+			sm.State.RateLimitResetAt = snapshot.RateLimitResetAt
+		}
+		if snapshot.CooldownCompletedAt.After(sm.State.CooldownCompletedAt) {
+			sm.State.CooldownCompletedAt = snapshot.CooldownCompletedAt
+		}
+
+		if fnErr = fn(snapshot); fnErr != nil {
+			return fnErr
+		}
+
+		for tokenID, tokenState := range sm.State.TokenStates {
+			snapshot.TokenStates[tokenID] = tokenState
+		}
+		snapshot.RateLimitResetAt = sm.State.RateLimitResetAt
+		snapshot.CooldownCompletedAt = sm.State.CooldownCompletedAt
+		return nil
+	})
+	if fnErr != nil {
+		return fnErr
+	} else if err != nil {
+		return fmt.Errorf("failed to update token pool: %w", err)
+	}
+	return nil
+}
+
+// refreshFromTokenPool picks up the changes of the other processes of the token pool for a read. A failed refresh
+// keeps the states this process knows, they are only staler.
+func (sm *StateManager) refreshFromTokenPool() {
+	if err := sm.withTokenPool(func(*tokenpool.Snapshot) error { return nil }); err != nil {
+		sm.tokenPoolLogger.Warn("Failed to refresh token states from token pool", "error", err)
+	}
 }
 
 // ResetUsageMetricsForAllTokens resets the usage metrics for all tokens managed by the StateManager.
@@ -203,15 +577,51 @@ func (sm *StateManager) ResetUsageMetricsForAllTokens(resumeTime time.Time) erro
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		sm.resetUsageMetrics(resumeTime)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sm.saveState()
+}
+
+func (sm *StateManager) resetUsageMetrics(resumeTime time.Time) {
 	sm.State.CooldownCompletedAt = resumeTime
 
-	// Reset all token states to active
+	// Reset the token states to active, unauthorized and revoked tokens are left to the token health checker
 	for tokenID, token := range sm.State.TokenStates {
+		if token.IsIgnored() {
+			continue
+		}
 		token.ResetUsageMetrics(resumeTime)
 		sm.State.TokenStates[tokenID] = token
 	}
+}
 
-	return sm.saveState()
+// ResetUsageMetricsAfterExhaustion resets the usage metrics like ResetUsageMetricsForAllTokens, unless the tokens
+// were already reset after exhaustedAt, by another process of the token pool. Resetting them again would undo the
+// exhaustion the other processes observed since. It reports whether the tokens were reset.
+func (sm *StateManager) ResetUsageMetricsAfterExhaustion(exhaustedAt, resumeTime time.Time) (bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	reset := false
+	err := sm.withTokenPool(func(*tokenpool.Snapshot) error {
+		if sm.State.CooldownCompletedAt.After(exhaustedAt) {
+			return nil
+		}
+		sm.resetUsageMetrics(resumeTime)
+		reset = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return reset, sm.saveState()
 }
 
 func (sm *StateManager) GetLeastUsageToken() (string, error) {
@@ -234,19 +644,54 @@ func (sm *StateManager) GetLeastUsageActiveToken() (string, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	return sm.selectActiveTokenFromPool(LeastUsedStrategy{})
+}
+
+// SelectActiveToken returns the token ID of the active token picked by the token selection strategy.
+// If no active tokens are found, it returns the same errors as GetLeastUsageActiveToken.
+func (sm *StateManager) SelectActiveToken() (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.selectActiveTokenFromPool(sm.selectionStrategy)
+}
+
+// selectActiveTokenFromPool selects the token on the latest states of the token pool and leases it to this process.
+// The tokens leased by the other processes are left to them as long as this process has other active tokens.
+func (sm *StateManager) selectActiveTokenFromPool(strategy TokenSelectionStrategy) (string, error) {
+	var selectedTokenID string
+	err := sm.withTokenPool(func(snapshot *tokenpool.Snapshot) error {
+		var err error
+		selectedTokenID, err = sm.selectActiveToken(strategy, snapshot)
+		if err == nil && snapshot != nil {
+			snapshot.Lease(selectedTokenID)
+		}
+		return err
+	})
+	return selectedTokenID, err
+}
+
+func (sm *StateManager) selectActiveToken(strategy TokenSelectionStrategy, snapshot *tokenpool.Snapshot) (string, error) {
 	if len(sm.State.TokenStates) == 0 {
 		return "", ErrEmptyTokenPool
 	}
 
 	activeTokens := make(map[string]token.TokenState)
+	unleasedTokens := make(map[string]token.TokenState)
 	for tokenID, tokenState := range sm.State.TokenStates {
 		if tokenState.IsActive() {
 			activeTokens[tokenID] = tokenState
+			if snapshot == nil || !snapshot.IsLeasedByOthers(tokenID) {
+				unleasedTokens[tokenID] = tokenState
+			}
 		}
 	}
 
+	if len(unleasedTokens) > 0 {
+		return strategy.SelectToken(sortedTokenIDs(unleasedTokens), unleasedTokens), nil
+	}
 	if len(activeTokens) > 0 {
-		return GetLeastUsageToken(activeTokens)
+		return strategy.SelectToken(sortedTokenIDs(activeTokens), activeTokens), nil
 	}
 
 	ignoredTokenCount := 0
@@ -277,14 +722,13 @@ func (sm *StateManager) UpdateTokenStatus(tokenID string, status token.TokenStat
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	token, exists := sm.State.TokenStates[tokenID]
-	if !exists {
-		return fmt.Errorf("tokenID %s: %w", tokenID, ErrTokenNotFound)
+	err := sm.updateTokenState(tokenID, func(tokenState *token.TokenState) {
+		tokenState.UpdateTokenStatus(status, time.Now())
+	})
+	if err != nil {
+		return err
 	}
 
-	token.UpdateTokenStatus(status, time.Now())
-	sm.State.TokenStates[tokenID] = token
-
 	return sm.saveState()
 }
 
@@ -301,11 +745,47 @@ func (sm *StateManager) GetTokenStatus(tokenID string) (token.TokenStatus, bool)
 	return token.Status, true
 }
 
+// GetOAuthToken returns the cached access token of an OAuth consumer.
+func (sm *StateManager) GetOAuthToken(tokenID string) (token.OAuthToken, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	oauthToken, exists := sm.State.OAuthTokens[tokenID]
+	return oauthToken, exists
+}
+
+// SetOAuthToken caches the access token of an OAuth consumer.
+func (sm *StateManager) SetOAuthToken(tokenID string, oauthToken token.OAuthToken) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.State.OAuthTokens == nil {
+		sm.State.OAuthTokens = make(map[string]token.OAuthToken)
+	}
+	sm.State.OAuthTokens[tokenID] = oauthToken
+
+	return sm.saveState()
+}
+
+// DeleteOAuthToken drops the cached access token of an OAuth consumer, so the next request fetches a new one.
+func (sm *StateManager) DeleteOAuthToken(tokenID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.State.OAuthTokens[tokenID]; !exists {
+		return nil
+	}
+	delete(sm.State.OAuthTokens, tokenID)
+
+	return sm.saveState()
+}
+
 func (sm *StateManager) GetActiveTokens() []string {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	var activeTokens []string
+	sm.refreshFromTokenPool()
 	for tokenID, tokenState := range sm.State.TokenStates {
 		if tokenState.IsActive() {
 			activeTokens = append(activeTokens, tokenID)
@@ -320,17 +800,7 @@ func GetLeastUsageToken(tokens map[string]token.TokenState) (string, error) {
 		return "", fmt.Errorf("no tokens available")
 	}
 
-	var leastUsedTokenID string
-	var leastUsedCount int
-
-	for tokenID, token := range tokens {
-		if leastUsedTokenID == "" || token.SuccessfulUsageCount < leastUsedCount {
-			leastUsedTokenID = tokenID
-			leastUsedCount = token.SuccessfulUsageCount
-		}
-	}
-
-	return leastUsedTokenID, nil
+	return LeastUsedStrategy{}.SelectToken(sortedTokenIDs(tokens), tokens), nil
 }
 
 type TokenError error
@@ -365,6 +835,24 @@ func InitializeStateManager(stateJsonFilePath string) error {
 
 	return nil
 }
+
+// InitializeDryRunStateManager initializes the state manager like InitializeStateManager, with a state that is never
+// written back to stateJsonFilePath.
+func InitializeDryRunStateManager(stateJsonFilePath string) error {
+	customLogger := shared.AcquireCustomLogger()
+	if stateManager != nil {
+		return fmt.Errorf("state manager is already initialized")
+	}
+
+	var err error
+	stateManager, err = NewDryRunStateManager(stateJsonFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize dry run state manager: %w", err)
+	}
+	customLogger.Info("Dry run state manager initialized, the state is not written back", "stateJsonFilePath", stateJsonFilePath)
+	return nil
+}
+
 func AcquireStateManager() *StateManager {
 	if stateManager == nil {
 		panic("state manager not initialized, call InitializeStateManager first")
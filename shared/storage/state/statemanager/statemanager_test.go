@@ -2,9 +2,11 @@ package statemanager
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/bluelock-go/shared/auth"
 	"github.com/bluelock-go/shared/storage/state/token"
 	"github.com/stretchr/testify/assert"
 )
@@ -82,6 +84,23 @@ func TestResetUsageMetricsForAllTokens(t *testing.T) {
 	assert.Equal(t, resumeTime.Truncate(time.Nanosecond), loadedSm.State.CooldownCompletedAt.Truncate(time.Nanosecond))
 }
 
+func TestResetUsageMetricsForAllTokensKeepsIgnoredTokens(t *testing.T) {
+	sm, err := NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}, {TokenID: "tok-3"}}))
+	assert.NoError(t, sm.SetTokenStatusToRateLimited("tok-1"))
+	assert.NoError(t, sm.SetTokenStatusToUnauthorized("tok-2"))
+	assert.NoError(t, sm.ReplaceTokenState("tok-3", token.TokenState{Status: token.TokenRevoked}))
+
+	assert.NoError(t, sm.ResetUsageMetricsForAllTokens(time.Now()))
+	status, _ := sm.GetTokenStatus("tok-1")
+	assert.Equal(t, token.TokenActive, status)
+	status, _ = sm.GetTokenStatus("tok-2")
+	assert.Equal(t, token.TokenUnauthorized, status, "unauthorized tokens wait for their health probe")
+	status, _ = sm.GetTokenStatus("tok-3")
+	assert.Equal(t, token.TokenRevoked, status, "revoked tokens are not reactivated by a rate limit reset")
+}
+
 func TestGetLeastUsageToken(t *testing.T) {
 	filePath := "test_state.json"
 	defer os.Remove(filePath)
@@ -98,3 +117,152 @@ func TestGetLeastUsageToken(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, token1ID, leastUsed)
 }
+
+func TestSyncTokenStatusMigratesCredKeyStates(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	legacyState := []byte(`{"tokenStates": {
+		"dXNlcjpwYXNzd29yZA==": {"status": "exhausted", "successfulUsageCount": 7},
+		"cmVtb3ZlZDpwYXNzd29yZA==": {"status": "active"}
+	}}`)
+	assert.NoError(t, os.WriteFile(filePath, legacyState, 0600))
+
+	sm, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	credentials := []auth.Credential{{Username: "user", Password: "password", CredKey: "dXNlcjpwYXNzd29yZA=="}}
+	auth.NewFingerprinter([]byte("test-fingerprint-key")).AssignTokenIDs(credentials)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(credentials))
+
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "dXNlcjpwYXNzd29yZA==")
+	assert.NotContains(t, string(data), "cmVtb3ZlZDpwYXNzd29yZA==")
+
+	loadedSm, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentStateVersion, loadedSm.State.Version)
+	assert.Len(t, loadedSm.State.TokenStates, 1)
+	tokenState, exists := loadedSm.State.TokenStates[credentials[0].TokenID]
+	assert.True(t, exists)
+	assert.Equal(t, 7, tokenState.SuccessfulUsageCount, "the usage of the token is carried over")
+	assert.Equal(t, token.TokenActive, tokenState.Status)
+
+	assert.Error(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{CredKey: "dXNlcjpwYXNzd29yZA=="}}), "credentials need a token ID")
+}
+
+func TestDryRunStateManagerNeverWritesTheState(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}}))
+	saved, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+
+	dryRunSm, err := NewDryRunStateManager(filePath)
+	assert.NoError(t, err)
+	assert.Contains(t, dryRunSm.State.TokenStates, "tok-1", "the state is loaded")
+	assert.NoError(t, dryRunSm.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200}))
+	assert.NoError(t, dryRunSm.SetTokenStatusToUnauthorized("tok-1"))
+	assert.NoError(t, dryRunSm.SetOAuthToken("tok-1", token.OAuthToken{AccessToken: "access-token", ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.NoError(t, dryRunSm.Close())
+
+	status, _ := dryRunSm.GetTokenStatus("tok-1")
+	assert.Equal(t, token.TokenUnauthorized, status, "the changes are kept in memory")
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, data)
+	files, err := os.ReadDir(filepath.Dir(filePath))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestOAuthTokenCache(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}))
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.NoError(t, sm.SetOAuthToken("tok-1", token.OAuthToken{AccessToken: "access-token-1", ExpiresAt: expiresAt}))
+	assert.NoError(t, sm.SetOAuthToken("tok-2", token.OAuthToken{AccessToken: "access-token-2", ExpiresAt: expiresAt}))
+	info, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the state holds access tokens")
+
+	reloaded, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	cached, ok := reloaded.GetOAuthToken("tok-1")
+	assert.True(t, ok)
+	assert.Equal(t, "access-token-1", cached.AccessToken)
+	assert.True(t, cached.ExpiresAt.Equal(expiresAt))
+	assert.NotContains(t, cached.String(), "access-token-1")
+
+	assert.NoError(t, reloaded.DeleteOAuthToken("tok-1"))
+	_, ok = reloaded.GetOAuthToken("tok-1")
+	assert.False(t, ok)
+
+	assert.NoError(t, reloaded.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}}))
+	_, ok = reloaded.GetOAuthToken("tok-2")
+	assert.False(t, ok, "the access tokens of removed consumers are dropped")
+}
+
+func TestTokenProbeTransitions(t *testing.T) {
+	sm, err := NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}))
+	assert.NoError(t, sm.SetTokenStatusToUnauthorized("tok-1"))
+	assert.NoError(t, sm.SetTokenStatusToUnauthorized("tok-2"))
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}))
+	status, _ := sm.GetTokenStatus("tok-1")
+	assert.Equal(t, token.TokenUnauthorized, status, "unauthorized tokens wait for their health probe across restarts")
+
+	now := time.Now()
+	assert.Empty(t, sm.GetTokensDueForProbe(now, time.Minute))
+	assert.Equal(t, []string{"tok-1", "tok-2"}, sm.GetTokensDueForProbe(now.Add(time.Minute), time.Minute))
+
+	restored, err := sm.RestoreUnauthorizedToken("tok-1")
+	assert.NoError(t, err)
+	assert.True(t, restored)
+	status, _ = sm.GetTokenStatus("tok-1")
+	assert.Equal(t, token.TokenActive, status)
+
+	status, err = sm.RecordFailedTokenProbe("tok-2", now, time.Minute, time.Hour, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, token.TokenUnauthorized, status)
+	assert.Empty(t, sm.GetTokensDueForProbe(now.Add(time.Minute-time.Second), time.Minute), "the next probe waits for the backoff")
+	status, err = sm.RecordFailedTokenProbe("tok-2", now.Add(time.Minute), time.Minute, time.Hour, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, token.TokenRevoked, status)
+	assert.Empty(t, sm.GetTokensDueForProbe(now.Add(24*time.Hour), time.Minute), "revoked tokens are not probed")
+
+	restored, err = sm.RestoreUnauthorizedToken("tok-2")
+	assert.NoError(t, err)
+	assert.False(t, restored, "revoked tokens are not restored")
+
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}))
+	status, _ = sm.GetTokenStatus("tok-2")
+	assert.Equal(t, token.TokenRevoked, status, "revoked tokens stay revoked across restarts")
+}
+
+func TestTokenUsageAccountingIsPersisted(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}}))
+
+	now := time.Now()
+	assert.NoError(t, sm.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: now, StatusCode: 200, Bytes: 512}))
+	assert.NoError(t, sm.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: now, StatusCode: 429}))
+	assert.NoError(t, sm.SetTokenStatusToRateLimited("tok-1"))
+	assert.NoError(t, sm.ResetUsageMetricsForAllTokens(now))
+	assert.ErrorIs(t, sm.RecordTokenResponse("tok-2", token.ResponseObservation{ObservedAt: now, StatusCode: 200}), ErrTokenNotFound)
+
+	reloaded, err := NewStateManager(filePath)
+	assert.NoError(t, err)
+	tokenState := reloaded.State.TokenStates["tok-1"]
+	assert.Equal(t, token.UsageCounts{SuccessCount: 1, RateLimitedCount: 1, Bytes: 512}, tokenState.Usage.Total)
+	assert.Len(t, tokenState.Usage.HourlyWindows, 1)
+	assert.Equal(t, 1, tokenState.PreRateLimitSuccessCount)
+	quota, known := tokenState.Usage.EstimatedHourlyQuota()
+	assert.True(t, known)
+	assert.Equal(t, 1, quota)
+}
@@ -0,0 +1,152 @@
+package statemanager
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/bluelock-go/shared/storage/state/tokenpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPooledStateManager creates the state manager of one datapuller sharing the token pool at poolFilePath.
+func newPooledStateManager(t *testing.T, poolFilePath, owner string, credentials []auth.Credential) *StateManager {
+	sm, err := NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	pool, err := tokenpool.NewTokenPool(poolFilePath, owner, time.Minute)
+	require.NoError(t, err)
+	sm.SetTokenPool(pool, &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	t.Cleanup(func() { sm.Close() })
+	require.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials(credentials))
+	return sm
+}
+
+func TestTokenPoolSharesTokenStates(t *testing.T) {
+	poolFilePath := filepath.Join(t.TempDir(), "token_pool.db")
+	credentials := []auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}
+	first := newPooledStateManager(t, poolFilePath, "first", credentials)
+	second := newPooledStateManager(t, poolFilePath, "second", credentials)
+
+	// the exhaustion by one process is seen by the other
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-1"))
+	selected, err := second.SelectActiveToken()
+	require.NoError(t, err)
+	assert.Equal(t, "tok-2", selected)
+
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-2"))
+	_, err = second.SelectActiveToken()
+	assert.ErrorIs(t, err, ErrAllTokensExhausted)
+
+	// a restarted process does not reactivate the tokens the others exhausted
+	third := newPooledStateManager(t, poolFilePath, "third", credentials)
+	assert.Empty(t, third.GetActiveTokens())
+
+	// so is the reset after the rate limit window
+	resumeTime := time.Now()
+	require.NoError(t, second.ResetUsageMetricsForAllTokens(resumeTime))
+	assert.Len(t, first.GetActiveTokens(), 2)
+	assert.True(t, resumeTime.Equal(first.State.CooldownCompletedAt))
+
+	require.NoError(t, first.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200}))
+	status, exists := second.GetTokenStatus("tok-1")
+	assert.True(t, exists)
+	assert.Equal(t, token.TokenActive, status)
+	require.NoError(t, second.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200}))
+	assert.Equal(t, 2, second.State.TokenStates["tok-1"].SuccessfulUsageCount, "the usage of both processes is counted")
+}
+
+func TestTokenPoolSpreadsProcessesOverTokens(t *testing.T) {
+	poolFilePath := filepath.Join(t.TempDir(), "token_pool.db")
+	credentials := []auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}
+	first := newPooledStateManager(t, poolFilePath, "first", credentials)
+	second := newPooledStateManager(t, poolFilePath, "second", credentials)
+
+	for range 3 {
+		firstSelected, err := first.SelectActiveToken()
+		require.NoError(t, err)
+		secondSelected, err := second.SelectActiveToken()
+		require.NoError(t, err)
+		assert.NotEqual(t, firstSelected, secondSelected, "the token leased by the other process is left to it")
+	}
+
+	// the leased token is shared when it is the only active one
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-2"))
+	for _, sm := range []*StateManager{first, second} {
+		selected, err := sm.SelectActiveToken()
+		require.NoError(t, err)
+		assert.Equal(t, "tok-1", selected)
+	}
+}
+
+func TestConcurrentTokenUsageAcrossPooledStateManagers(t *testing.T) {
+	poolFilePath := filepath.Join(t.TempDir(), "token_pool.db")
+	credentials := []auth.Credential{{TokenID: "shared_token"}}
+	stateManagers := []*StateManager{
+		newPooledStateManager(t, poolFilePath, "first", credentials),
+		newPooledStateManager(t, poolFilePath, "second", credentials),
+	}
+
+	var wg sync.WaitGroup
+	usagesPerStateManager := 20
+	for _, sm := range stateManagers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range usagesPerStateManager {
+				assert.NoError(t, sm.UpdateTokenUsage("shared_token", time.Now()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, stateManagers[0].UpdateTokenUsage("shared_token", time.Now()))
+	assert.Equal(t, len(stateManagers)*usagesPerStateManager+1, stateManagers[0].State.TokenStates["shared_token"].SuccessfulUsageCount)
+}
+
+func TestTokenPoolCoordinatesRateLimitResets(t *testing.T) {
+	poolFilePath := filepath.Join(t.TempDir(), "token_pool.db")
+	credentials := []auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}
+	first := newPooledStateManager(t, poolFilePath, "first", credentials)
+	second := newPooledStateManager(t, poolFilePath, "second", credentials)
+
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-1"))
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-2"))
+	firstExhaustedAt := time.Now()
+	secondExhaustedAt := firstExhaustedAt.Add(time.Second)
+
+	// both processes wait for the reset the first one scheduled
+	resetAt, err := first.ScheduleRateLimitReset(firstExhaustedAt, firstExhaustedAt.Add(3*time.Second))
+	require.NoError(t, err)
+	assert.True(t, firstExhaustedAt.Add(3*time.Second).Equal(resetAt))
+	secondResetAt, err := second.ScheduleRateLimitReset(secondExhaustedAt, secondExhaustedAt.Add(3*time.Second))
+	require.NoError(t, err)
+	assert.True(t, resetAt.Equal(secondResetAt), "the reset scheduled by the other process is honored")
+
+	// the first process to wake up resets the pool and runs a token out of quota again
+	reset, err := first.ResetUsageMetricsAfterExhaustion(firstExhaustedAt, resetAt)
+	require.NoError(t, err)
+	assert.True(t, reset)
+	require.NoError(t, first.SetTokenStatusToRateLimited("tok-1"))
+
+	// the other process does not reset the pool a second time, undoing that exhaustion
+	reset, err = second.ResetUsageMetricsAfterExhaustion(secondExhaustedAt, resetAt.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.False(t, reset)
+	status, _ := second.GetTokenStatus("tok-1")
+	assert.Equal(t, token.TokenExhausted, status)
+	status, _ = second.GetTokenStatus("tok-2")
+	assert.Equal(t, token.TokenActive, status)
+
+	// a later exhaustion schedules a new reset
+	laterExhaustedAt := resetAt.Add(time.Minute)
+	laterResetAt, err := second.ScheduleRateLimitReset(laterExhaustedAt, laterExhaustedAt.Add(3*time.Second))
+	require.NoError(t, err)
+	assert.True(t, laterExhaustedAt.Add(3*time.Second).Equal(laterResetAt))
+}
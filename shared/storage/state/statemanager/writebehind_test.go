@@ -0,0 +1,123 @@
+package statemanager
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared"
+	"github.com/bluelock-go/shared/auth"
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSuccessCount(t *testing.T, filePath, tokenID string) int {
+	reloaded, err := NewStateManager(filePath)
+	require.NoError(t, err)
+	return reloaded.State.TokenStates[tokenID].Usage.Total.SuccessCount
+}
+
+func TestWriteBehind(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(filePath)
+	require.NoError(t, err)
+	require.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}, {TokenID: "tok-2"}}))
+	logger := &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	require.NoError(t, sm.StartWriteBehind(time.Hour, logger))
+	assert.Error(t, sm.StartWriteBehind(time.Hour, logger), "write-behind is started once")
+
+	success := token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200}
+	require.NoError(t, sm.RecordTokenResponse("tok-1", success))
+	assert.Equal(t, 0, loadSuccessCount(t, filePath, "tok-1"), "the usage is not written yet")
+	assert.Equal(t, 1, sm.State.TokenStates["tok-1"].Usage.Total.SuccessCount, "the usage is in memory")
+
+	// status changes are written immediately, with the usage before them
+	require.NoError(t, sm.SetTokenStatusToRateLimited("tok-2"))
+	assert.Equal(t, 1, loadSuccessCount(t, filePath, "tok-1"))
+
+	require.NoError(t, sm.RecordTokenResponse("tok-1", success))
+	require.NoError(t, sm.Flush())
+	assert.Equal(t, 2, loadSuccessCount(t, filePath, "tok-1"))
+
+	require.NoError(t, sm.RecordTokenResponse("tok-1", success))
+	require.NoError(t, sm.Close())
+	assert.Equal(t, 3, loadSuccessCount(t, filePath, "tok-1"), "close writes the deferred usage")
+
+	require.NoError(t, sm.RecordTokenResponse("tok-1", success))
+	assert.Equal(t, 4, loadSuccessCount(t, filePath, "tok-1"), "usage is written immediately after close")
+
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary state file is left behind")
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestWriteBehindFlushesOnInterval(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(filePath)
+	require.NoError(t, err)
+	require.NoError(t, sm.SyncTokenStatusWithLatestAuthCredentials([]auth.Credential{{TokenID: "tok-1"}}))
+	require.NoError(t, sm.StartWriteBehind(10*time.Millisecond, &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}))
+	defer sm.Close()
+
+	require.NoError(t, sm.RecordTokenResponse("tok-1", token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200}))
+	assert.Eventually(t, func() bool {
+		return loadSuccessCount(t, filePath, "tok-1") == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func newBenchmarkStateManager(b *testing.B, tokenCount int) *StateManager {
+	sm, err := NewStateManager(filepath.Join(b.TempDir(), "state.json"))
+	if err != nil {
+		b.Fatalf("Failed to create StateManager: %v", err)
+	}
+	var credentials []auth.Credential
+	for i := range tokenCount {
+		credentials = append(credentials, auth.Credential{TokenID: "tok-" + string(rune('a'+i))})
+	}
+	if err := sm.SyncTokenStatusWithLatestAuthCredentials(credentials); err != nil {
+		b.Fatalf("Failed to sync tokens: %v", err)
+	}
+	// a day of hourly windows, the size the state file grows to
+	for i := range token.UsageWindowCount {
+		for _, cred := range credentials {
+			sm.RecordTokenResponse(cred.TokenID, token.ResponseObservation{ObservedAt: time.Now().Add(time.Duration(i-token.UsageWindowCount) * time.Hour), StatusCode: 200})
+		}
+	}
+	return sm
+}
+
+// benchmarkRecordTokenResponse records a response per iteration, as HandleRequestWithRetries does per request.
+func benchmarkRecordTokenResponse(b *testing.B, writeBehind bool) {
+	sm := newBenchmarkStateManager(b, 10)
+	if writeBehind {
+		if err := sm.StartWriteBehind(time.Second, &shared.CustomLogger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}); err != nil {
+			b.Fatalf("Failed to start write-behind: %v", err)
+		}
+		defer sm.Close()
+	}
+	observation := token.ResponseObservation{ObservedAt: time.Now(), StatusCode: 200, Bytes: 4096}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := sm.RecordTokenResponse("tok-a", observation); err != nil {
+				b.Errorf("Failed to record token response: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkRecordTokenResponseImmediate(b *testing.B) {
+	benchmarkRecordTokenResponse(b, false)
+}
+
+func BenchmarkRecordTokenResponseWriteBehind(b *testing.B) {
+	benchmarkRecordTokenResponse(b, true)
+}
@@ -0,0 +1,22 @@
+package token
+
+import (
+	"fmt"
+	"time"
+)
+
+// OAuthToken is an access token fetched for an OAuth consumer, cached until it expires.
+type OAuthToken struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// IsValidAt reports whether the access token can still be used at the given time for at least margin.
+func (t OAuthToken) IsValidAt(at time.Time, margin time.Duration) bool {
+	return t.AccessToken != "" && at.Add(margin).Before(t.ExpiresAt)
+}
+
+// String keeps the access token out of the logs.
+func (t OAuthToken) String() string {
+	return fmt.Sprintf("{AccessToken:[REDACTED] ExpiresAt:%s}", t.ExpiresAt.Format(time.RFC3339))
+}
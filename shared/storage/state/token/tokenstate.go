@@ -13,6 +13,42 @@ type TokenState struct {
 	StatusChangedAt          time.Time   `json:"statusChangedAt"`
 	SuccessfulUsageCount     int         `json:"successfulUsageCount"`
 	PreRateLimitSuccessCount int         `json:"preRateLimitSuccessCount"`
+	// ProbeFailureCount is the number of consecutive failed health probes of an unauthorized token.
+	ProbeFailureCount int `json:"probeFailureCount,omitempty"`
+	// NextProbeAt is when an unauthorized token is probed again after a failed probe.
+	NextProbeAt time.Time `json:"nextProbeAt"`
+	// RateLimitRemaining and RateLimitLimit are the rate limit headers of the last response that had them. They are
+	// unknown while RateLimitObservedAt is zero.
+	RateLimitRemaining  int       `json:"rateLimitRemaining,omitempty"`
+	RateLimitLimit      int       `json:"rateLimitLimit,omitempty"`
+	RateLimitObservedAt time.Time `json:"rateLimitObservedAt"`
+	// LatencyMillis is the moving average of the response latency.
+	LatencyMillis float64 `json:"latencyMillis,omitempty"`
+	// ConsecutiveFailureCount is the number of failed requests since the last successful one.
+	ConsecutiveFailureCount int        `json:"consecutiveFailureCount,omitempty"`
+	Usage                   TokenUsage `json:"usage"`
+}
+
+// latencySmoothing is the weight of the newest latency in LatencyMillis.
+const latencySmoothing = 0.3
+
+// ResponseObservation is what a response tells about the token it was requested with.
+type ResponseObservation struct {
+	ObservedAt time.Time
+	Latency    time.Duration
+	// StatusCode is 0 for requests that did not get a response.
+	StatusCode int
+	// Bytes is the size of the response body.
+	Bytes int64
+	// HasRateLimit is set when the response carried the rate limit headers.
+	HasRateLimit       bool
+	RateLimitRemaining int
+	RateLimitLimit     int
+}
+
+// Failed reports whether the request did not get a response or got a server error.
+func (o ResponseObservation) Failed() bool {
+	return o.StatusCode == 0 || o.StatusCode >= 500
 }
 
 func (ts *TokenState) IsExhausted() bool {
@@ -25,6 +61,10 @@ func (ts *TokenState) IsActive() bool {
 	return ts.Status == TokenActive
 }
 
+func (ts *TokenState) IsRevoked() bool {
+	return ts.Status == TokenRevoked
+}
+
 func (ts *TokenState) IsIgnored() bool {
 
 	return slices.Contains(IgnoredTokenStatuses, ts.Status)
@@ -38,11 +78,53 @@ func (ts *TokenState) UpdateTokenStatus(status TokenStatus, statusChangedAt time
 func (ts *TokenState) SetTokenAsExhausted(exhaustionTime time.Time) {
 	ts.UpdateTokenStatus(TokenExhausted, exhaustionTime)
 	ts.ExhaustedAt = exhaustionTime
+	ts.RateLimitRemaining = 0
+	ts.RateLimitObservedAt = exhaustionTime
 }
 
 func (ts *TokenState) SetTokenAsUnauthorized(unauthorizedTime time.Time) {
 	ts.UpdateTokenStatus(TokenUnauthorized, unauthorizedTime)
 	ts.ExhaustedAt = unauthorizedTime
+	ts.ProbeFailureCount = 0
+	ts.NextProbeAt = time.Time{}
+}
+
+// IsDueForProbe reports whether an unauthorized token should be probed at the given time. The first probe is due
+// firstProbeDelay after the token became unauthorized, later ones at NextProbeAt.
+func (ts *TokenState) IsDueForProbe(at time.Time, firstProbeDelay time.Duration) bool {
+	if !ts.IsUnauthorized() {
+		return false
+	}
+	if ts.NextProbeAt.IsZero() {
+		return !at.Before(ts.StatusChangedAt.Add(firstProbeDelay))
+	}
+	return !at.Before(ts.NextProbeAt)
+}
+
+// RecordFailedProbe counts a failed health probe and schedules the next one, doubling probeInterval with every
+// consecutive failure up to maxProbeInterval.
+func (ts *TokenState) RecordFailedProbe(probeTime time.Time, probeInterval, maxProbeInterval time.Duration) {
+	backoff := probeInterval
+	for range ts.ProbeFailureCount {
+		if backoff >= maxProbeInterval {
+			break
+		}
+		backoff *= 2
+	}
+	ts.ProbeFailureCount++
+	ts.NextProbeAt = probeTime.Add(min(backoff, maxProbeInterval))
+}
+
+// RestoreFromUnauthorized makes a token that passed its health probe active again.
+func (ts *TokenState) RestoreFromUnauthorized(restoreTime time.Time) {
+	ts.UpdateTokenStatus(TokenActive, restoreTime)
+	ts.ProbeFailureCount = 0
+	ts.NextProbeAt = time.Time{}
+}
+
+func (ts *TokenState) SetTokenAsRevoked(revokeTime time.Time) {
+	ts.UpdateTokenStatus(TokenRevoked, revokeTime)
+	ts.NextProbeAt = time.Time{}
 }
 
 func (ts *TokenState) UpdateTokenUsage(tokenUsageTime time.Time) {
@@ -51,7 +133,48 @@ func (ts *TokenState) UpdateTokenUsage(tokenUsageTime time.Time) {
 }
 
 func (ts *TokenState) ResetUsageMetrics(resumeTime time.Time) {
+	// only an exhausted token used up its quota, the usage of the other tokens says nothing about it
+	if ts.IsExhausted() && ts.SuccessfulUsageCount > 0 {
+		ts.Usage.recordQuota(ts.SuccessfulUsageCount)
+	}
 	ts.UpdateTokenStatus(TokenActive, resumeTime)
 	ts.PreRateLimitSuccessCount = ts.SuccessfulUsageCount
 	ts.SuccessfulUsageCount = 0
+	// the quota is renewed with the rate limit window, the next response tells how much is left
+	ts.RateLimitObservedAt = time.Time{}
+}
+
+// RecordResponse accounts a response of the token and updates its rate limit, latency and failures with it.
+func (ts *TokenState) RecordResponse(observation ResponseObservation) {
+	ts.Usage.record(observation.ObservedAt, observation.StatusCode, observation.Bytes)
+	if observation.StatusCode >= 200 && observation.StatusCode < 300 {
+		ts.UpdateTokenUsage(observation.ObservedAt)
+	}
+
+	if observation.HasRateLimit {
+		ts.RateLimitRemaining = observation.RateLimitRemaining
+		ts.RateLimitLimit = observation.RateLimitLimit
+		ts.RateLimitObservedAt = observation.ObservedAt
+	}
+
+	latencyMillis := float64(observation.Latency) / float64(time.Millisecond)
+	if ts.LatencyMillis == 0 {
+		ts.LatencyMillis = latencyMillis
+	} else {
+		ts.LatencyMillis += latencySmoothing * (latencyMillis - ts.LatencyMillis)
+	}
+
+	if observation.Failed() {
+		ts.ConsecutiveFailureCount++
+	} else {
+		ts.ConsecutiveFailureCount = 0
+	}
+}
+
+// RemainingQuota returns the requests left in the current rate limit window, if a response told.
+func (ts *TokenState) RemainingQuota() (int, bool) {
+	if ts.RateLimitObservedAt.IsZero() {
+		return 0, false
+	}
+	return ts.RateLimitRemaining, true
 }
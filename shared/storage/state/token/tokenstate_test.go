@@ -1,6 +1,9 @@
 package token
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestValidateTokenStatus(t *testing.T) {
 	// Test valid statuses
@@ -19,3 +22,147 @@ func TestValidateTokenStatus(t *testing.T) {
 		}
 	}
 }
+
+func TestOAuthTokenIsValidAt(t *testing.T) {
+	now := time.Now()
+	oauthToken := OAuthToken{AccessToken: "access-token", ExpiresAt: now.Add(2 * time.Minute)}
+	if !oauthToken.IsValidAt(now, time.Minute) {
+		t.Errorf("Expected the token to be valid")
+	}
+	if oauthToken.IsValidAt(now.Add(90*time.Second), time.Minute) {
+		t.Errorf("Expected the token to expire within the margin")
+	}
+	if (OAuthToken{ExpiresAt: now.Add(time.Hour)}).IsValidAt(now, time.Minute) {
+		t.Errorf("Expected a token without access token to be invalid")
+	}
+}
+
+func TestRecordFailedProbeBacksOff(t *testing.T) {
+	unauthorizedAt := time.Now()
+	ts := TokenState{}
+	ts.SetTokenAsUnauthorized(unauthorizedAt)
+	if ts.IsDueForProbe(unauthorizedAt.Add(4*time.Minute), 5*time.Minute) {
+		t.Errorf("Expected the first probe to wait for the probe interval")
+	}
+	if !ts.IsDueForProbe(unauthorizedAt.Add(5*time.Minute), 5*time.Minute) {
+		t.Errorf("Expected the first probe to be due after the probe interval")
+	}
+
+	expectedBackoffs := []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 30 * time.Minute, 30 * time.Minute}
+	for i, expectedBackoff := range expectedBackoffs {
+		probeTime := unauthorizedAt.Add(time.Duration(i) * time.Hour)
+		ts.RecordFailedProbe(probeTime, 5*time.Minute, 30*time.Minute)
+		if got := ts.NextProbeAt.Sub(probeTime); got != expectedBackoff {
+			t.Errorf("Expected backoff %s after %d failures, got %s", expectedBackoff, i+1, got)
+		}
+	}
+	if ts.ProbeFailureCount != len(expectedBackoffs) {
+		t.Errorf("Expected %d probe failures, got %d", len(expectedBackoffs), ts.ProbeFailureCount)
+	}
+
+	ts.RestoreFromUnauthorized(time.Now())
+	if !ts.IsActive() || ts.ProbeFailureCount != 0 || !ts.NextProbeAt.IsZero() {
+		t.Errorf("Expected a restored token to be active without probe failures, got %+v", ts)
+	}
+	if ts.IsDueForProbe(time.Now().Add(time.Hour), 5*time.Minute) {
+		t.Errorf("Expected active tokens not to be probed")
+	}
+}
+
+func TestRecordResponse(t *testing.T) {
+	ts := TokenState{Status: TokenActive}
+	if _, known := ts.RemainingQuota(); known {
+		t.Errorf("Expected the remaining quota to be unknown before a response")
+	}
+
+	observedAt := time.Now()
+	ts.RecordResponse(ResponseObservation{ObservedAt: observedAt, Latency: 100 * time.Millisecond, StatusCode: 200, HasRateLimit: true, RateLimitRemaining: 900, RateLimitLimit: 1000})
+	ts.RecordResponse(ResponseObservation{ObservedAt: observedAt, Latency: 200 * time.Millisecond, StatusCode: 503})
+	if remaining, known := ts.RemainingQuota(); !known || remaining != 900 {
+		t.Errorf("Expected 900 remaining requests from the last rate limit headers, got %d", remaining)
+	}
+	if ts.LatencyMillis != 130 {
+		t.Errorf("Expected a moving average latency of 130ms, got %v", ts.LatencyMillis)
+	}
+	if ts.ConsecutiveFailureCount != 1 {
+		t.Errorf("Expected 1 consecutive failure, got %d", ts.ConsecutiveFailureCount)
+	}
+
+	ts.RecordResponse(ResponseObservation{ObservedAt: observedAt, Latency: 130 * time.Millisecond, StatusCode: 200})
+	if ts.ConsecutiveFailureCount != 0 {
+		t.Errorf("Expected a successful response to reset the failures, got %d", ts.ConsecutiveFailureCount)
+	}
+
+	ts.SetTokenAsExhausted(observedAt)
+	if remaining, known := ts.RemainingQuota(); !known || remaining != 0 {
+		t.Errorf("Expected an exhausted token to have no quota left, got %d", remaining)
+	}
+	ts.ResetUsageMetrics(observedAt)
+	if _, known := ts.RemainingQuota(); known {
+		t.Errorf("Expected the remaining quota to be unknown after the reset")
+	}
+}
+
+func TestUsageAccounting(t *testing.T) {
+	ts := TokenState{Status: TokenActive}
+	hour := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	ts.RecordResponse(ResponseObservation{ObservedAt: hour.Add(5 * time.Minute), StatusCode: 200, Bytes: 100})
+	ts.RecordResponse(ResponseObservation{ObservedAt: hour.Add(10 * time.Minute), StatusCode: 429, Bytes: 10})
+	ts.RecordResponse(ResponseObservation{ObservedAt: hour.Add(70 * time.Minute), StatusCode: 200, Bytes: 200})
+	ts.RecordResponse(ResponseObservation{ObservedAt: hour.Add(80 * time.Minute)})
+
+	expectedTotal := UsageCounts{SuccessCount: 2, FailureCount: 1, RateLimitedCount: 1, Bytes: 310}
+	if ts.Usage.Total != expectedTotal {
+		t.Errorf("Expected total %+v, got %+v", expectedTotal, ts.Usage.Total)
+	}
+	if ts.SuccessfulUsageCount != 2 || !ts.LastUsageAt.Equal(hour.Add(70*time.Minute)) {
+		t.Errorf("Expected successful responses to count as token usage, got %d at %s", ts.SuccessfulUsageCount, ts.LastUsageAt)
+	}
+	if len(ts.Usage.HourlyWindows) != 2 {
+		t.Fatalf("Expected 2 hourly windows, got %d", len(ts.Usage.HourlyWindows))
+	}
+	if counts := ts.Usage.CountsSince(hour.Add(time.Hour)); counts != (UsageCounts{SuccessCount: 1, FailureCount: 1, Bytes: 200}) {
+		t.Errorf("Expected the counts of the second hour, got %+v", counts)
+	}
+
+	// windows older than UsageWindowCount hours roll out
+	ts.RecordResponse(ResponseObservation{ObservedAt: hour.Add(UsageWindowCount * time.Hour), StatusCode: 200})
+	if len(ts.Usage.HourlyWindows) != 2 || !ts.Usage.HourlyWindows[0].Start.Equal(hour.Add(time.Hour)) {
+		t.Errorf("Expected the first hour to roll out, got %+v", ts.Usage.HourlyWindows)
+	}
+}
+
+func TestEstimatedHourlyQuota(t *testing.T) {
+	ts := TokenState{Status: TokenActive}
+	if _, known := ts.Usage.EstimatedHourlyQuota(); known {
+		t.Errorf("Expected the quota to be unknown before the token was exhausted")
+	}
+
+	for _, successCount := range []int{950, 400, 1000, 990} {
+		ts.SuccessfulUsageCount = successCount
+		ts.SetTokenAsExhausted(time.Now())
+		ts.ResetUsageMetrics(time.Now())
+	}
+	// a reset of a token that was not exhausted does not tell its quota
+	ts.SuccessfulUsageCount = 10
+	ts.ResetUsageMetrics(time.Now())
+
+	if quota, known := ts.Usage.EstimatedHourlyQuota(); !known || quota != 970 {
+		t.Errorf("Expected the median quota 970, got %d", quota)
+	}
+	if ts.PreRateLimitSuccessCount != 10 {
+		t.Errorf("Expected the last pre rate limit success count 10, got %d", ts.PreRateLimitSuccessCount)
+	}
+
+	for range QuotaHistoryLength {
+		ts.SuccessfulUsageCount = 500
+		ts.SetTokenAsExhausted(time.Now())
+		ts.ResetUsageMetrics(time.Now())
+	}
+	if len(ts.Usage.QuotaHistory) != QuotaHistoryLength {
+		t.Errorf("Expected the quota history to keep %d windows, got %d", QuotaHistoryLength, len(ts.Usage.QuotaHistory))
+	}
+	if quota, _ := ts.Usage.EstimatedHourlyQuota(); quota != 500 {
+		t.Errorf("Expected the quota to follow the recent windows, got %d", quota)
+	}
+}
@@ -15,10 +15,12 @@ const (
 	TokenActive       TokenStatus = "active"
 	TokenExhausted    TokenStatus = "exhausted"
 	TokenUnauthorized TokenStatus = "unauthorized"
+	// TokenRevoked is an unauthorized token that kept failing its health probes. It is no longer probed.
+	TokenRevoked TokenStatus = "revoked"
 )
 
-var ValidTokenStatuses = []TokenStatus{TokenActive, TokenExhausted, TokenUnauthorized}
-var IgnoredTokenStatuses = []TokenStatus{TokenUnauthorized}
+var ValidTokenStatuses = []TokenStatus{TokenActive, TokenExhausted, TokenUnauthorized, TokenRevoked}
+var IgnoredTokenStatuses = []TokenStatus{TokenUnauthorized, TokenRevoked}
 
 func IsTokenStatusValid(status TokenStatus) bool {
 	return slices.Contains(ValidTokenStatuses, status)
@@ -0,0 +1,101 @@
+package token
+
+import (
+	"slices"
+	"time"
+)
+
+// UsageWindowCount is the number of hourly usage windows kept per token.
+const UsageWindowCount = 24
+
+// QuotaHistoryLength is the number of rate limit windows the hourly quota estimate is learned from.
+const QuotaHistoryLength = 10
+
+// UsageCounts counts the requests of a token by outcome and the bytes of their responses.
+type UsageCounts struct {
+	SuccessCount     int   `json:"successCount"`
+	FailureCount     int   `json:"failureCount"`
+	RateLimitedCount int   `json:"rateLimitedCount"`
+	Bytes            int64 `json:"bytes"`
+}
+
+// UsageWindow holds the counts of one clock hour, Start is the beginning of the hour in UTC.
+type UsageWindow struct {
+	Start time.Time `json:"start"`
+	UsageCounts
+}
+
+// TokenUsage is the request accounting of a token since it was added.
+type TokenUsage struct {
+	Total UsageCounts `json:"total"`
+	// HourlyWindows holds the counts of the last UsageWindowCount hours with requests, oldest first.
+	HourlyWindows []UsageWindow `json:"hourlyWindows,omitempty"`
+	// QuotaHistory holds the PreRateLimitSuccessCount of the last QuotaHistoryLength rate limit windows the token was
+	// exhausted in, oldest first.
+	QuotaHistory []int `json:"quotaHistory,omitempty"`
+}
+
+// record counts a response of the given status code, 0 for requests without a response.
+func (u *TokenUsage) record(at time.Time, statusCode int, bytes int64) {
+	windowStart := at.UTC().Truncate(time.Hour)
+	if len(u.HourlyWindows) == 0 || u.HourlyWindows[len(u.HourlyWindows)-1].Start.Before(windowStart) {
+		u.HourlyWindows = append(u.HourlyWindows, UsageWindow{Start: windowStart})
+	}
+	// windows that rolled out of the last UsageWindowCount hours are dropped
+	oldestWindowStart := windowStart.Add(-(UsageWindowCount - 1) * time.Hour)
+	u.HourlyWindows = slices.DeleteFunc(u.HourlyWindows, func(window UsageWindow) bool {
+		return window.Start.Before(oldestWindowStart)
+	})
+	// a response older than the newest window, e.g. after a clock change, is counted in the newest window
+	window := &u.HourlyWindows[len(u.HourlyWindows)-1]
+
+	for _, counts := range []*UsageCounts{&u.Total, &window.UsageCounts} {
+		switch {
+		case statusCode >= 200 && statusCode < 300:
+			counts.SuccessCount++
+		case statusCode == 429:
+			counts.RateLimitedCount++
+		default:
+			counts.FailureCount++
+		}
+		counts.Bytes += bytes
+	}
+}
+
+// recordQuota keeps the successful requests of a rate limit window the token was exhausted in.
+func (u *TokenUsage) recordQuota(successCount int) {
+	u.QuotaHistory = append(u.QuotaHistory, successCount)
+	if len(u.QuotaHistory) > QuotaHistoryLength {
+		u.QuotaHistory = u.QuotaHistory[len(u.QuotaHistory)-QuotaHistoryLength:]
+	}
+}
+
+// EstimatedHourlyQuota returns the median of the quota history, the number of successful requests the token can make
+// per rate limit window. It is unknown until the token was exhausted once.
+func (u *TokenUsage) EstimatedHourlyQuota() (int, bool) {
+	if len(u.QuotaHistory) == 0 {
+		return 0, false
+	}
+	quotas := slices.Clone(u.QuotaHistory)
+	slices.Sort(quotas)
+	middle := len(quotas) / 2
+	if len(quotas)%2 == 0 {
+		return (quotas[middle-1] + quotas[middle]) / 2, true
+	}
+	return quotas[middle], true
+}
+
+// CountsSince sums the hourly windows starting at or after since.
+func (u *TokenUsage) CountsSince(since time.Time) UsageCounts {
+	var counts UsageCounts
+	for _, window := range u.HourlyWindows {
+		if window.Start.Before(since.UTC().Truncate(time.Hour)) {
+			continue
+		}
+		counts.SuccessCount += window.SuccessCount
+		counts.FailureCount += window.FailureCount
+		counts.RateLimitedCount += window.RateLimitedCount
+		counts.Bytes += window.Bytes
+	}
+	return counts
+}
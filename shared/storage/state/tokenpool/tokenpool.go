@@ -0,0 +1,290 @@
+package tokenpool
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/bluelock-go/shared/storage/state/token"
+)
+
+// lockTimeout bounds the wait for the other processes of the pool.
+const lockTimeout = 10 * time.Second
+
+const schema = `
+CREATE TABLE IF NOT EXISTS token_pool_state (
+	token_id TEXT PRIMARY KEY,
+	state TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS token_pool_meta (
+	key TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS token_pool_lease (
+	token_id TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (token_id, owner)
+);
+`
+
+const (
+	rateLimitResetAtKey    = "rate_limit_reset_at"
+	cooldownCompletedAtKey = "cooldown_completed_at"
+)
+
+// TokenPool shares the token states between the processes using the same tokens, e.g. one datapuller per workspace
+// with the same auth tokens file. The states are kept in a SQLite file, and every update is a read-modify-write
+// serialized by a lock file, so the processes see each other's usage, exhaustion and rate limit resets.
+type TokenPool struct {
+	db       *sql.DB
+	lock     *flock.Flock
+	owner    string
+	leaseTTL time.Duration
+	// mu serializes the updates of this process, the lock file only serializes the processes
+	mu sync.Mutex
+}
+
+// Snapshot is the shared state of the pool during an update.
+type Snapshot struct {
+	// TokenStates holds the states of every token of the pool, including the tokens of other processes.
+	TokenStates         map[string]token.TokenState
+	RateLimitResetAt    time.Time
+	CooldownCompletedAt time.Time
+	// leasedByOthers holds the tokens with a live lease of another process.
+	leasedByOthers map[string]bool
+	leasedTokenID  string
+}
+
+// IsLeasedByOthers reports whether another process of the pool is using the token.
+func (s *Snapshot) IsLeasedByOthers(tokenID string) bool {
+	return s.leasedByOthers[tokenID]
+}
+
+// Lease marks the token as used by this process, replacing its previous lease.
+func (s *Snapshot) Lease(tokenID string) {
+	s.leasedTokenID = tokenID
+}
+
+// NewTokenPool opens the pool at filePath, creating it when needed. owner identifies the process in the leases, which
+// expire leaseTTL after the last selection of their token.
+func NewTokenPool(filePath, owner string, leaseTTL time.Duration) (*TokenPool, error) {
+	if leaseTTL <= 0 {
+		return nil, fmt.Errorf("lease TTL must be greater than 0")
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token pool: %w", err)
+	}
+	pool := &TokenPool{db: db, lock: flock.New(filePath + ".lock"), owner: owner, leaseTTL: leaseTTL}
+
+	if err := pool.withLock(func() error {
+		_, err := db.Exec(schema)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create token pool tables: %w", err)
+	}
+	// the pool holds the cached usage of every token, it is readable by the owner only like the state file
+	if err := os.Chmod(filePath, 0600); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to restrict token pool permissions: %w", err)
+	}
+
+	return pool, nil
+}
+
+// DefaultOwner identifies this process in the leases.
+func DefaultOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// ReadSnapshot reads the shared state of the pool at filePath without joining the pool, e.g. to report the token
+// states. The pool is opened read-only, every live lease counts as leased by others.
+func ReadSnapshot(filePath string) (*Snapshot, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, fmt.Errorf("failed to read token pool: %w", err)
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token pool: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin token pool transaction: %w", err)
+	}
+	defer tx.Rollback()
+	return (&TokenPool{db: db}).load(tx, time.Now())
+}
+
+func (p *TokenPool) withLock(fn func() error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	if ok, err := p.lock.TryLockContext(ctx, 10*time.Millisecond); err != nil {
+		return fmt.Errorf("failed to acquire token pool lock: %w", err)
+	} else if !ok {
+		return fmt.Errorf("failed to acquire token pool lock in %s: another process is holding the lock", lockTimeout)
+	}
+	defer p.lock.Unlock()
+
+	return fn()
+}
+
+// Update runs fn with the shared state and stores the token states, reset times and lease fn leaves in the snapshot.
+// Tokens removed from the snapshot stay in the pool, they may belong to another process.
+func (p *TokenPool) Update(fn func(snapshot *Snapshot) error) error {
+	return p.withLock(func() error {
+		tx, err := p.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin token pool transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		now := time.Now()
+		snapshot, err := p.load(tx, now)
+		if err != nil {
+			return err
+		}
+		if err := fn(snapshot); err != nil {
+			return err
+		}
+		if err := p.store(tx, snapshot, now); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit token pool transaction: %w", err)
+		}
+		return nil
+	})
+}
+
+func (p *TokenPool) load(tx *sql.Tx, now time.Time) (*Snapshot, error) {
+	snapshot := &Snapshot{TokenStates: map[string]token.TokenState{}, leasedByOthers: map[string]bool{}}
+
+	rows, err := tx.Query("SELECT token_id, state FROM token_pool_state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token pool states: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tokenID, state string
+		if err := rows.Scan(&tokenID, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan token pool state: %w", err)
+		}
+		var tokenState token.TokenState
+		if err := json.Unmarshal([]byte(state), &tokenState); err != nil {
+			return nil, fmt.Errorf("failed to decode token pool state of token %s: %w", tokenID, err)
+		}
+		snapshot.TokenStates[tokenID] = tokenState
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token pool states: %w", err)
+	}
+
+	for key, target := range map[string]*time.Time{
+		rateLimitResetAtKey:    &snapshot.RateLimitResetAt,
+		cooldownCompletedAtKey: &snapshot.CooldownCompletedAt,
+	} {
+		var unixNano int64
+		err := tx.QueryRow("SELECT value FROM token_pool_meta WHERE key = ?", key).Scan(&unixNano)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read token pool %s: %w", key, err)
+		}
+		*target = time.Unix(0, unixNano)
+	}
+
+	leaseRows, err := tx.Query("SELECT token_id FROM token_pool_lease WHERE owner != ? AND expires_at > ?", p.owner, now.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token pool leases: %w", err)
+	}
+	defer leaseRows.Close()
+	for leaseRows.Next() {
+		var tokenID string
+		if err := leaseRows.Scan(&tokenID); err != nil {
+			return nil, fmt.Errorf("failed to scan token pool lease: %w", err)
+		}
+		snapshot.leasedByOthers[tokenID] = true
+	}
+	if err := leaseRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token pool leases: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func (p *TokenPool) store(tx *sql.Tx, snapshot *Snapshot, now time.Time) error {
+	for tokenID, tokenState := range snapshot.TokenStates {
+		state, err := json.Marshal(tokenState)
+		if err != nil {
+			return fmt.Errorf("failed to encode token pool state of token %s: %w", tokenID, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO token_pool_state (token_id, state, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (token_id) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at
+			WHERE state != excluded.state`, tokenID, string(state), now.UnixNano()); err != nil {
+			return fmt.Errorf("failed to store token pool state of token %s: %w", tokenID, err)
+		}
+	}
+
+	for key, value := range map[string]time.Time{
+		rateLimitResetAtKey:    snapshot.RateLimitResetAt,
+		cooldownCompletedAtKey: snapshot.CooldownCompletedAt,
+	} {
+		if value.IsZero() {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO token_pool_meta (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value.UnixNano()); err != nil {
+			return fmt.Errorf("failed to store token pool %s: %w", key, err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM token_pool_lease WHERE expires_at <= ?", now.UnixNano()); err != nil {
+		return fmt.Errorf("failed to drop expired token pool leases: %w", err)
+	}
+	if snapshot.leasedTokenID != "" {
+		if _, err := tx.Exec("DELETE FROM token_pool_lease WHERE owner = ? AND token_id != ?", p.owner, snapshot.leasedTokenID); err != nil {
+			return fmt.Errorf("failed to release token pool lease: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO token_pool_lease (token_id, owner, expires_at) VALUES (?, ?, ?)
+			ON CONFLICT (token_id, owner) DO UPDATE SET expires_at = excluded.expires_at`,
+			snapshot.leasedTokenID, p.owner, now.Add(p.leaseTTL).UnixNano()); err != nil {
+			return fmt.Errorf("failed to store token pool lease: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close releases the leases of this process and closes the pool.
+func (p *TokenPool) Close() error {
+	err := p.withLock(func() error {
+		_, err := p.db.Exec("DELETE FROM token_pool_lease WHERE owner = ?", p.owner)
+		return err
+	})
+	if closeErr := p.db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close token pool: %w", err)
+	}
+	return nil
+}
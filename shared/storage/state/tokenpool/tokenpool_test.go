@@ -0,0 +1,187 @@
+package tokenpool
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluelock-go/shared/storage/state/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPool opens the pool as another process would, every pool has its own connection and lock file descriptor.
+func newTestPool(t *testing.T, filePath, owner string, leaseTTL time.Duration) *TokenPool {
+	pool, err := NewTokenPool(filePath, owner, leaseTTL)
+	require.NoError(t, err)
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func TestTokenPoolSharesStates(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token_pool.db")
+	first := newTestPool(t, filePath, "first", time.Minute)
+	second := newTestPool(t, filePath, "second", time.Minute)
+
+	resetAt := time.Now().Add(time.Hour).Round(0)
+	require.NoError(t, first.Update(func(snapshot *Snapshot) error {
+		assert.Empty(t, snapshot.TokenStates)
+		snapshot.TokenStates["tok-1"] = token.TokenState{Status: token.TokenExhausted, SuccessfulUsageCount: 7}
+		snapshot.RateLimitResetAt = resetAt
+		return nil
+	}))
+
+	require.NoError(t, second.Update(func(snapshot *Snapshot) error {
+		assert.Equal(t, token.TokenExhausted, snapshot.TokenStates["tok-1"].Status)
+		assert.Equal(t, 7, snapshot.TokenStates["tok-1"].SuccessfulUsageCount)
+		assert.True(t, resetAt.Equal(snapshot.RateLimitResetAt))
+		// tokens missing from a snapshot stay in the pool
+		delete(snapshot.TokenStates, "tok-1")
+		return nil
+	}))
+	require.NoError(t, first.Update(func(snapshot *Snapshot) error {
+		assert.Contains(t, snapshot.TokenStates, "tok-1")
+		return nil
+	}))
+
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestReadSnapshot(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token_pool.db")
+	_, err := ReadSnapshot(filePath)
+	assert.Error(t, err, "a missing pool is not created")
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+
+	pool := newTestPool(t, filePath, "owner", time.Minute)
+	resetAt := time.Now().Add(time.Hour).Round(0)
+	require.NoError(t, pool.Update(func(snapshot *Snapshot) error {
+		snapshot.TokenStates["tok-1"] = token.TokenState{Status: token.TokenExhausted, SuccessfulUsageCount: 7}
+		snapshot.RateLimitResetAt = resetAt
+		snapshot.Lease("tok-1")
+		return nil
+	}))
+
+	snapshot, err := ReadSnapshot(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, token.TokenState{Status: token.TokenExhausted, SuccessfulUsageCount: 7}, snapshot.TokenStates["tok-1"])
+	assert.True(t, resetAt.Equal(snapshot.RateLimitResetAt))
+	assert.True(t, snapshot.IsLeasedByOthers("tok-1"))
+
+	// the reader does not hold the pool, the datapullers keep updating it
+	require.NoError(t, pool.Update(func(snapshot *Snapshot) error {
+		snapshot.TokenStates["tok-2"] = token.TokenState{Status: token.TokenActive}
+		return nil
+	}))
+}
+
+func TestTokenPoolRollsBackFailedUpdates(t *testing.T) {
+	pool := newTestPool(t, filepath.Join(t.TempDir(), "token_pool.db"), "owner", time.Minute)
+
+	assert.Error(t, pool.Update(func(snapshot *Snapshot) error {
+		snapshot.TokenStates["tok-1"] = token.TokenState{Status: token.TokenActive}
+		return assert.AnError
+	}))
+	require.NoError(t, pool.Update(func(snapshot *Snapshot) error {
+		assert.Empty(t, snapshot.TokenStates)
+		return nil
+	}))
+}
+
+func TestTokenPoolLeases(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token_pool.db")
+	first := newTestPool(t, filePath, "first", time.Minute)
+	second := newTestPool(t, filePath, "second", time.Minute)
+
+	require.NoError(t, first.Update(func(snapshot *Snapshot) error {
+		snapshot.Lease("tok-1")
+		return nil
+	}))
+	require.NoError(t, second.Update(func(snapshot *Snapshot) error {
+		assert.True(t, snapshot.IsLeasedByOthers("tok-1"))
+		snapshot.Lease("tok-2")
+		return nil
+	}))
+	require.NoError(t, first.Update(func(snapshot *Snapshot) error {
+		assert.False(t, snapshot.IsLeasedByOthers("tok-1"), "the own lease is not leased by others")
+		assert.True(t, snapshot.IsLeasedByOthers("tok-2"))
+		// a process leases one token at a time
+		snapshot.Lease("tok-3")
+		return nil
+	}))
+	require.NoError(t, second.Update(func(snapshot *Snapshot) error {
+		assert.False(t, snapshot.IsLeasedByOthers("tok-1"))
+		assert.True(t, snapshot.IsLeasedByOthers("tok-3"))
+		return nil
+	}))
+
+	// closing a pool releases its leases
+	require.NoError(t, first.Close())
+	require.NoError(t, second.Update(func(snapshot *Snapshot) error {
+		assert.False(t, snapshot.IsLeasedByOthers("tok-3"))
+		return nil
+	}))
+}
+
+func TestTokenPoolLeasesExpire(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token_pool.db")
+	first := newTestPool(t, filePath, "first", 50*time.Millisecond)
+	second := newTestPool(t, filePath, "second", time.Minute)
+
+	require.NoError(t, first.Update(func(snapshot *Snapshot) error {
+		snapshot.Lease("tok-1")
+		return nil
+	}))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, second.Update(func(snapshot *Snapshot) error {
+		assert.False(t, snapshot.IsLeasedByOthers("tok-1"), "the lease expired")
+		return nil
+	}))
+}
+
+func TestTokenPoolConcurrentUpdates(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token_pool.db")
+	var pools []*TokenPool
+	for _, owner := range []string{"first", "second", "third"} {
+		pools = append(pools, newTestPool(t, filePath, owner, time.Minute))
+	}
+
+	require.NoError(t, pools[0].Update(func(snapshot *Snapshot) error {
+		snapshot.TokenStates["shared_token"] = token.TokenState{Status: token.TokenActive}
+		return nil
+	}))
+
+	var wg sync.WaitGroup
+	updatesPerPool := 20
+	for _, pool := range pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updatesPerPool {
+				err := pool.Update(func(snapshot *Snapshot) error {
+					tokenState := snapshot.TokenStates["shared_token"]
+					tokenState.SuccessfulUsageCount++
+					snapshot.TokenStates["shared_token"] = tokenState
+					return nil
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, pools[0].Update(func(snapshot *Snapshot) error {
+		assert.Equal(t, len(pools)*updatesPerPool, snapshot.TokenStates["shared_token"].SuccessfulUsageCount, "no update is lost")
+		return nil
+	}))
+}
+
+func TestNewTokenPoolRequiresLeaseTTL(t *testing.T) {
+	_, err := NewTokenPool(filepath.Join(t.TempDir(), "token_pool.db"), "owner", 0)
+	assert.Error(t, err)
+}
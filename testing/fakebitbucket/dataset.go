@@ -0,0 +1,177 @@
+package fakebitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Dataset is the content served by the fake server.
+type Dataset struct {
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+type Workspace struct {
+	Slug         string       `json:"slug"`
+	Name         string       `json:"name"`
+	Repositories []Repository `json:"repositories"`
+}
+
+type Repository struct {
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	UUID       string `json:"uuid"`
+	IsPrivate  bool   `json:"isPrivate"`
+	ProjectKey string `json:"projectKey"`
+	MainBranch string `json:"mainBranch"`
+	// Branches maps branch names to the hash of their head commit.
+	Branches map[string]string `json:"branches"`
+	// Commits is the commit graph of the repository, linked by the parents of the commits.
+	Commits      []Commit      `json:"commits"`
+	PullRequests []PullRequest `json:"pullRequests"`
+}
+
+type User struct {
+	AccountID   string `json:"accountId"`
+	UUID        string `json:"uuid"`
+	DisplayName string `json:"displayName"`
+}
+
+type Commit struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+	// Author is the raw git author, "Name <email>". User is the Bitbucket account it maps to, if any.
+	Author  string    `json:"author"`
+	User    *User     `json:"user,omitempty"`
+	Date    time.Time `json:"date"`
+	Parents []string  `json:"parents"`
+	// Files are the changes of the commit against its first parent, served as its diffstat.
+	Files []FileChange `json:"files"`
+}
+
+type FileChange struct {
+	// Status is added, removed, modified or renamed. OldPath is only set for renamed files.
+	Status       string `json:"status"`
+	Path         string `json:"path"`
+	OldPath      string `json:"oldPath,omitempty"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesRemoved int    `json:"linesRemoved"`
+}
+
+type PullRequest struct {
+	ID                int       `json:"id"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description"`
+	State             string    `json:"state"`
+	Author            User      `json:"author"`
+	Reviewers         []User    `json:"reviewers"`
+	SourceBranch      string    `json:"sourceBranch"`
+	DestinationBranch string    `json:"destinationBranch"`
+	CreatedOn         time.Time `json:"createdOn"`
+	UpdatedOn         time.Time `json:"updatedOn"`
+	CommentCount      int       `json:"commentCount"`
+	// Commits are the hashes of the commits of the pull request, newest first.
+	Commits  []string   `json:"commits"`
+	Activity []Activity `json:"activity"`
+}
+
+// Activity is an event of a pull request. Type is approval, comment or update, Content is the text of a comment
+// and State the state an update moved the pull request to.
+type Activity struct {
+	Type    string    `json:"type"`
+	User    User      `json:"user"`
+	Date    time.Time `json:"date"`
+	Content string    `json:"content,omitempty"`
+	State   string    `json:"state,omitempty"`
+}
+
+// LoadDataset reads a dataset from a JSON file.
+func LoadDataset(filePath string) (Dataset, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	var dataset Dataset
+	if err := json.Unmarshal(content, &dataset); err != nil {
+		return Dataset{}, fmt.Errorf("failed to unmarshal dataset %s: %w", filePath, err)
+	}
+	return dataset, nil
+}
+
+// SeedDataset returns a small deterministic dataset: the acme workspace with an api repository, with a main and a
+// feature branch and two pull requests, and a web repository with a single commit.
+func SeedDataset() Dataset {
+	jane := User{AccountID: "557058:jane", UUID: "{jane}", DisplayName: "Jane Doe"}
+	john := User{AccountID: "557058:john", UUID: "{john}", DisplayName: "John Roe"}
+	day := func(day int, hour int) time.Time {
+		return time.Date(2025, time.March, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	return Dataset{Workspaces: []Workspace{{
+		Slug: "acme",
+		Name: "Acme",
+		Repositories: []Repository{
+			{
+				Slug:       "api",
+				Name:       "API",
+				UUID:       "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0001}",
+				IsPrivate:  true,
+				ProjectKey: "CORE",
+				MainBranch: "main",
+				Branches:   map[string]string{"main": "a3", "feature/login": "f2"},
+				Commits: []Commit{
+					{Hash: "a1", Message: "Initial commit", Author: "Jane Doe <jane@acme.test>", User: &jane, Date: day(1, 9), Files: []FileChange{
+						{Status: "added", Path: "go.mod", LinesAdded: 3},
+						{Status: "added", Path: "main.go", LinesAdded: 20},
+					}},
+					{Hash: "a2", Message: "Add health endpoint", Author: "John Roe <john@acme.test>", User: &john, Date: day(2, 10), Parents: []string{"a1"}, Files: []FileChange{
+						{Status: "modified", Path: "main.go", LinesAdded: 12, LinesRemoved: 2},
+					}},
+					{Hash: "f1", Message: "Add login form", Author: "Jane Doe <jane@acme.test>", User: &jane, Date: day(3, 11), Parents: []string{"a2"}, Files: []FileChange{
+						{Status: "added", Path: "login.go", LinesAdded: 40},
+					}},
+					{Hash: "f2", Message: "Validate login form", Author: "Jane Doe <jane.doe@home.test>", Date: day(4, 12), Parents: []string{"f1"}, Files: []FileChange{
+						{Status: "modified", Path: "login.go", LinesAdded: 8, LinesRemoved: 3},
+					}},
+					{Hash: "a3", Message: "Merge health checks", Author: "John Roe <john@acme.test>", User: &john, Date: day(5, 13), Parents: []string{"a2"}, Files: []FileChange{
+						{Status: "renamed", OldPath: "main.go", Path: "cmd/api/main.go", LinesAdded: 1, LinesRemoved: 1},
+					}},
+				},
+				PullRequests: []PullRequest{
+					{
+						ID: 1, Title: "Add health endpoint", State: "MERGED", Author: john, Reviewers: []User{jane},
+						SourceBranch: "health", DestinationBranch: "main", CreatedOn: day(2, 8), UpdatedOn: day(2, 11),
+						CommentCount: 2, Commits: []string{"a2"},
+						Activity: []Activity{
+							{Type: "update", User: john, Date: day(2, 11), State: "MERGED"},
+							{Type: "approval", User: jane, Date: day(2, 10)},
+							{Type: "comment", User: jane, Date: day(2, 9), Content: "Please add a test"},
+						},
+					},
+					{
+						ID: 2, Title: "Login form", Description: "Adds the login form", State: "OPEN", Author: jane, Reviewers: []User{john},
+						SourceBranch: "feature/login", DestinationBranch: "main", CreatedOn: day(3, 12), UpdatedOn: day(4, 13),
+						Commits: []string{"f2", "f1"},
+						Activity: []Activity{
+							{Type: "comment", User: john, Date: day(4, 13), Content: "Looks good"},
+						},
+					},
+				},
+			},
+			{
+				Slug:       "web",
+				Name:       "Web",
+				UUID:       "{7c1f6c43-0d5e-4a8e-9a57-0b6d1b1a0002}",
+				ProjectKey: "WEB",
+				MainBranch: "main",
+				Branches:   map[string]string{"main": "w1"},
+				Commits: []Commit{
+					{Hash: "w1", Message: "Scaffold web app", Author: "John Roe <john@acme.test>", User: &john, Date: day(6, 9), Files: []FileChange{
+						{Status: "added", Path: "index.html", LinesAdded: 15},
+					}},
+				},
+			},
+		},
+	}}}
+}
@@ -0,0 +1,179 @@
+package fakebitbucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FaultKind string
+
+const (
+	// FaultUnauthorized answers 401, as for a revoked token.
+	FaultUnauthorized FaultKind = "unauthorized"
+	// FaultRateLimited answers 429 with a Retry-After header.
+	FaultRateLimited FaultKind = "rateLimited"
+	// FaultSlow delays the response by Delay and then serves it.
+	FaultSlow FaultKind = "slow"
+	// FaultMalformedJSON answers 200 with a truncated JSON body.
+	FaultMalformedJSON FaultKind = "malformedJSON"
+)
+
+// Fault injects a failure into the requests whose path starts with PathPrefix, every request when it is empty.
+type Fault struct {
+	Kind       FaultKind `json:"kind"`
+	PathPrefix string    `json:"pathPrefix"`
+	// Every injects the fault into every nth matching request, into every matching request when 0 or 1.
+	Every int `json:"every"`
+	// Times stops injecting the fault after that many injections, 0 never stops.
+	Times             int      `json:"times"`
+	RetryAfterSeconds int      `json:"retryAfterSeconds"`
+	Delay             Duration `json:"delay"`
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"500ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (f Fault) Validate() error {
+	switch f.Kind {
+	case FaultUnauthorized, FaultMalformedJSON:
+	case FaultRateLimited:
+		if f.RetryAfterSeconds < 0 {
+			return fmt.Errorf("retryAfterSeconds must not be negative")
+		}
+	case FaultSlow:
+		if f.Delay <= 0 {
+			return fmt.Errorf("slow fault needs a positive delay")
+		}
+	default:
+		return fmt.Errorf("unknown fault kind: %q", f.Kind)
+	}
+	if f.Every < 0 || f.Times < 0 {
+		return fmt.Errorf("every and times must not be negative")
+	}
+	return nil
+}
+
+// LoadFaults reads a JSON array of faults.
+func LoadFaults(filePath string) ([]Fault, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read faults: %w", err)
+	}
+	var faults []Fault
+	if err := json.Unmarshal(content, &faults); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal faults %s: %w", filePath, err)
+	}
+	for i, fault := range faults {
+		if err := fault.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid fault %d: %w", i, err)
+		}
+	}
+	return faults, nil
+}
+
+// faultState counts the requests a fault matched and the failures it injected.
+type faultState struct {
+	fault    Fault
+	matched  int
+	injected int
+}
+
+// pickFaults returns the faults to inject into a request, in the order they were set.
+func (s *Server) pickFaults(r *http.Request) []Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var picked []Fault
+	for _, state := range s.faults {
+		if !strings.HasPrefix(r.URL.Path, state.fault.PathPrefix) {
+			continue
+		}
+		if state.fault.Times > 0 && state.injected >= state.fault.Times {
+			continue
+		}
+		state.matched++
+		if every := max(state.fault.Every, 1); state.matched%every != 0 {
+			continue
+		}
+		state.injected++
+		picked = append(picked, state.fault)
+	}
+	return picked
+}
+
+// injectFaults fails the request with the first failing fault, after the delays of the slow ones. It returns false
+// when the request was answered.
+func injectFaults(w http.ResponseWriter, r *http.Request, faults []Fault, serve http.HandlerFunc) bool {
+	for _, fault := range faults {
+		if fault.Kind != FaultSlow {
+			continue
+		}
+		select {
+		case <-time.After(time.Duration(fault.Delay)):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	for _, fault := range faults {
+		switch fault.Kind {
+		case FaultUnauthorized:
+			writeError(w, http.StatusUnauthorized, "token is invalid, expired or not supported for this endpoint")
+			return false
+		case FaultRateLimited:
+			w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfterSeconds))
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			writeError(w, http.StatusTooManyRequests, "rate limit for this resource has been exceeded")
+			return false
+		case FaultMalformedJSON:
+			recorder := &bufferedResponse{header: http.Header{}, statusCode: http.StatusOK}
+			serve(recorder, r)
+			body := recorder.body.Bytes()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body[:len(body)/2])
+			return false
+		}
+	}
+	return true
+}
+
+// bufferedResponse keeps a response in memory so a malformed version of it can be written.
+type bufferedResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+}
@@ -0,0 +1,508 @@
+// Package fakebitbucket serves a dataset through the subset of the Bitbucket Cloud REST API used by the datapuller,
+// so integration tests and local runs do not depend on api.bitbucket.org.
+package fakebitbucket
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPageLen = 10
+const maxPageLen = 100
+
+// Server is an http.Handler serving the Bitbucket Cloud API under /2.0 and the OAuth token endpoint of
+// bitbucket.org. Any Authorization header is accepted, failures are simulated with faults.
+type Server struct {
+	dataset Dataset
+	mux     *http.ServeMux
+	mu      sync.Mutex
+	faults  []*faultState
+}
+
+func NewServer(dataset Dataset) *Server {
+	s := &Server{dataset: dataset, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /2.0/user", s.handleUser)
+	s.mux.HandleFunc("GET /2.0/workspaces", s.handleWorkspaces)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}", s.handleRepositories)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/pullrequests", s.handlePullRequests)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/pullrequests/{id}/commits", s.handlePullRequestCommits)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/pullrequests/{id}/activity", s.handlePullRequestActivity)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/refs/branches", s.handleBranches)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/commits", s.handleCommits)
+	s.mux.HandleFunc("GET /2.0/repositories/{workspace}/{repository}/diffstat/{spec}", s.handleDiffstat)
+	s.mux.HandleFunc("POST /site/oauth2/access_token", s.handleOAuthAccessToken)
+	return s
+}
+
+// SetFaults replaces the faults injected into the following requests and resets their counts.
+func (s *Server) SetFaults(faults []Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make([]*faultState, len(faults))
+	for i, fault := range faults {
+		s.faults[i] = &faultState{fault: fault}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if injectFaults(w, r, s.pickFaults(r), s.serve) {
+		s.serve(w, r)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"username": "fake-bitbucket", "display_name": "Fake Bitbucket"})
+}
+
+// handleOAuthAccessToken grants an access token to any OAuth consumer with the client credentials grant.
+func (s *Server) handleOAuthAccessToken(w http.ResponseWriter, r *http.Request) {
+	clientID, _, ok := r.BasicAuth()
+	if !ok || clientID == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	writeJSON(w, map[string]any{"access_token": "fake-access-token-" + clientID, "token_type": "bearer", "expires_in": 7200})
+}
+
+func (s *Server) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	workspaces := make([]any, len(s.dataset.Workspaces))
+	for i, workspace := range s.dataset.Workspaces {
+		workspaces[i] = map[string]string{"slug": workspace.Slug, "name": workspace.Name}
+	}
+	writePage(w, r, workspaces)
+}
+
+func (s *Server) handleRepositories(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := s.findWorkspace(r.PathValue("workspace"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+	repositories := make([]any, len(workspace.Repositories))
+	for i, repository := range workspace.Repositories {
+		repositories[i] = repositoryJSON(workspace.Slug, repository)
+	}
+	writePage(w, r, repositories)
+}
+
+var stateFilterPattern = regexp.MustCompile(`state IN \(([^)]*)\)`)
+var updatedOnFilterPattern = regexp.MustCompile(`updated_on >= (\S+)`)
+
+// handlePullRequests understands the state and updated_on filters of the q parameter and the updated_on sort the
+// datapuller sends. Like Bitbucket, only open pull requests are listed without a state filter.
+func (s *Server) handlePullRequests(w http.ResponseWriter, r *http.Request) {
+	workspace, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query().Get("q")
+	states := []string{"OPEN"}
+	if match := stateFilterPattern.FindStringSubmatch(query); match != nil {
+		states = nil
+		for _, state := range strings.Split(match[1], ",") {
+			states = append(states, strings.Trim(strings.TrimSpace(state), `"`))
+		}
+	}
+	var updatedSince time.Time
+	if match := updatedOnFilterPattern.FindStringSubmatch(query); match != nil {
+		var err error
+		if updatedSince, err = time.Parse(time.RFC3339, match[1]); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid updated_on filter: %s", match[1]))
+			return
+		}
+	}
+
+	matching := []PullRequest{}
+	for _, pullRequest := range repository.PullRequests {
+		if slices.Contains(states, pullRequest.State) && !pullRequest.UpdatedOn.Before(updatedSince) {
+			matching = append(matching, pullRequest)
+		}
+	}
+	switch sort := r.URL.Query().Get("sort"); sort {
+	case "":
+	case "updated_on", "-updated_on":
+		slices.SortStableFunc(matching, func(a, b PullRequest) int { return a.UpdatedOn.Compare(b.UpdatedOn) })
+		if sort == "-updated_on" {
+			slices.Reverse(matching)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported sort: %s", sort))
+		return
+	}
+
+	pullRequests := []any{}
+	for _, pullRequest := range matching {
+		pullRequests = append(pullRequests, pullRequestJSON(workspace.Slug, repository, pullRequest))
+	}
+	writePage(w, r, pullRequests)
+}
+
+func (s *Server) handlePullRequestCommits(w http.ResponseWriter, r *http.Request) {
+	workspace, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	index := slices.IndexFunc(repository.PullRequests, func(pullRequest PullRequest) bool { return pullRequest.ID == id })
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "pull request not found")
+		return
+	}
+	commits := []any{}
+	for _, hash := range repository.PullRequests[index].Commits {
+		if commit, ok := findCommit(repository, hash); ok {
+			commits = append(commits, commitJSON(workspace.Slug, repository, commit))
+		}
+	}
+	writePage(w, r, commits)
+}
+
+// handlePullRequestActivity lists the activity of a pull request, newest first, in the shapes of Bitbucket: an
+// approval, comment or update member plus the pull request.
+func (s *Server) handlePullRequestActivity(w http.ResponseWriter, r *http.Request) {
+	_, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	index := slices.IndexFunc(repository.PullRequests, func(pullRequest PullRequest) bool { return pullRequest.ID == id })
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "pull request not found")
+		return
+	}
+	pullRequest := repository.PullRequests[index]
+	activities := slices.Clone(pullRequest.Activity)
+	slices.SortStableFunc(activities, func(a, b Activity) int { return b.Date.Compare(a.Date) })
+
+	values := []any{}
+	pullRequestRef := map[string]any{"id": pullRequest.ID, "title": pullRequest.Title, "type": "pullrequest"}
+	for i, activity := range activities {
+		value := map[string]any{"pull_request": pullRequestRef}
+		switch activity.Type {
+		case "approval":
+			value["approval"] = map[string]any{"date": activity.Date, "user": userJSON(activity.User)}
+		case "comment":
+			value["comment"] = map[string]any{
+				"id":         pullRequest.ID*1000 + i,
+				"content":    map[string]string{"raw": activity.Content},
+				"created_on": activity.Date,
+				"user":       userJSON(activity.User),
+			}
+		default:
+			value["update"] = map[string]any{
+				"state":  cmp.Or(activity.State, pullRequest.State),
+				"date":   activity.Date,
+				"author": userJSON(activity.User),
+				"source": map[string]any{"branch": map[string]string{"name": pullRequest.SourceBranch}},
+				"destination": map[string]any{
+					"branch": map[string]string{"name": pullRequest.DestinationBranch},
+				},
+			}
+		}
+		values = append(values, value)
+	}
+	writePage(w, r, values)
+}
+
+func (s *Server) handleBranches(w http.ResponseWriter, r *http.Request) {
+	workspace, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	names := make([]string, 0, len(repository.Branches))
+	for name := range repository.Branches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	branches := []any{}
+	for _, name := range names {
+		head, _ := findCommit(repository, repository.Branches[name])
+		branches = append(branches, map[string]any{"name": name, "target": commitJSON(workspace.Slug, repository, head)})
+	}
+	writePage(w, r, branches)
+}
+
+// handleCommits lists the commits reachable from the include refs, every branch when there is none, but not from
+// the exclude refs, newest first. A ref is a branch name or a commit hash, an unknown ref answers 404.
+func (s *Server) handleCommits(w http.ResponseWriter, r *http.Request) {
+	workspace, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	include := r.URL.Query()["include"]
+	if len(include) == 0 {
+		for _, head := range repository.Branches {
+			include = append(include, head)
+		}
+	}
+	included, err := reachableCommits(repository, include)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	excluded, err := reachableCommits(repository, r.URL.Query()["exclude"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	listed := []Commit{}
+	for _, commit := range repository.Commits {
+		if included[commit.Hash] && !excluded[commit.Hash] {
+			listed = append(listed, commit)
+		}
+	}
+	slices.SortStableFunc(listed, func(a, b Commit) int {
+		return cmp.Or(b.Date.Compare(a.Date), strings.Compare(a.Hash, b.Hash))
+	})
+	commits := make([]any, len(listed))
+	for i, commit := range listed {
+		commits[i] = commitJSON(workspace.Slug, repository, commit)
+	}
+	writePage(w, r, commits)
+}
+
+// handleDiffstat lists the file changes of a commit. The spec is a commit hash or branch name, a "to..from" spec
+// is answered with the changes of its first commit.
+func (s *Server) handleDiffstat(w http.ResponseWriter, r *http.Request) {
+	_, repository, ok := s.findRepository(w, r)
+	if !ok {
+		return
+	}
+	ref, _, _ := strings.Cut(r.PathValue("spec"), "..")
+	if head, ok := repository.Branches[ref]; ok {
+		ref = head
+	}
+	commit, ok := findCommit(repository, ref)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown commit: %s", ref))
+		return
+	}
+
+	values := []any{}
+	for _, file := range commit.Files {
+		var oldFile, newFile any
+		switch file.Status {
+		case "added":
+			newFile = map[string]string{"path": file.Path, "type": "commit_file"}
+		case "removed":
+			oldFile = map[string]string{"path": file.Path, "type": "commit_file"}
+		case "renamed":
+			oldFile = map[string]string{"path": file.OldPath, "type": "commit_file"}
+			newFile = map[string]string{"path": file.Path, "type": "commit_file"}
+		default:
+			oldFile = map[string]string{"path": file.Path, "type": "commit_file"}
+			newFile = oldFile
+		}
+		values = append(values, map[string]any{
+			"type":          "diffstat",
+			"status":        file.Status,
+			"lines_added":   file.LinesAdded,
+			"lines_removed": file.LinesRemoved,
+			"old":           oldFile,
+			"new":           newFile,
+		})
+	}
+	writePage(w, r, values)
+}
+
+func (s *Server) findWorkspace(slug string) (Workspace, bool) {
+	for _, workspace := range s.dataset.Workspaces {
+		if workspace.Slug == slug {
+			return workspace, true
+		}
+	}
+	return Workspace{}, false
+}
+
+// findRepository looks up the repository of the request path, answering 404 when there is none.
+func (s *Server) findRepository(w http.ResponseWriter, r *http.Request) (Workspace, Repository, bool) {
+	workspace, ok := s.findWorkspace(r.PathValue("workspace"))
+	if ok {
+		for _, repository := range workspace.Repositories {
+			if repository.Slug == r.PathValue("repository") {
+				return workspace, repository, true
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "repository not found")
+	return Workspace{}, Repository{}, false
+}
+
+func findCommit(repository Repository, hash string) (Commit, bool) {
+	for _, commit := range repository.Commits {
+		if commit.Hash == hash {
+			return commit, true
+		}
+	}
+	return Commit{}, false
+}
+
+func reachableCommits(repository Repository, refs []string) (map[string]bool, error) {
+	reachable := map[string]bool{}
+	var pending []string
+	for _, ref := range refs {
+		if head, ok := repository.Branches[ref]; ok {
+			ref = head
+		}
+		if _, ok := findCommit(repository, ref); !ok {
+			return nil, fmt.Errorf("unknown ref: %s", ref)
+		}
+		pending = append(pending, ref)
+	}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+		commit, _ := findCommit(repository, hash)
+		pending = append(pending, commit.Parents...)
+	}
+	return reachable, nil
+}
+
+func htmlLink(href string) map[string]any {
+	return map[string]any{"html": map[string]string{"href": href}}
+}
+
+func userJSON(user User) map[string]any {
+	return map[string]any{
+		"uuid":         user.UUID,
+		"account_id":   user.AccountID,
+		"display_name": user.DisplayName,
+		"links":        htmlLink("https://bitbucket.org/" + user.UUID),
+	}
+}
+
+func repositoryJSON(workspaceSlug string, repository Repository) map[string]any {
+	return map[string]any{
+		"slug":        repository.Slug,
+		"name":        repository.Name,
+		"uuid":        repository.UUID,
+		"is_private":  repository.IsPrivate,
+		"is_archived": false,
+		"project":     map[string]string{"key": repository.ProjectKey, "name": repository.ProjectKey},
+		"mainbranch":  map[string]string{"name": repository.MainBranch},
+		"links":       htmlLink(fmt.Sprintf("https://bitbucket.org/%s/%s", workspaceSlug, repository.Slug)),
+	}
+}
+
+func commitJSON(workspaceSlug string, repository Repository, commit Commit) map[string]any {
+	author := map[string]any{"raw": commit.Author}
+	if commit.User != nil {
+		author["user"] = userJSON(*commit.User)
+	}
+	parents := make([]any, len(commit.Parents))
+	for i, parent := range commit.Parents {
+		parents[i] = map[string]any{"hash": parent}
+	}
+	return map[string]any{
+		"hash":    commit.Hash,
+		"message": commit.Message,
+		"author":  author,
+		"date":    commit.Date,
+		"parents": parents,
+		"links":   htmlLink(fmt.Sprintf("https://bitbucket.org/%s/%s/commits/%s", workspaceSlug, repository.Slug, commit.Hash)),
+	}
+}
+
+func pullRequestJSON(workspaceSlug string, repository Repository, pullRequest PullRequest) map[string]any {
+	reviewers := make([]any, len(pullRequest.Reviewers))
+	for i, reviewer := range pullRequest.Reviewers {
+		reviewers[i] = userJSON(reviewer)
+	}
+	branchRef := func(branch string) map[string]any {
+		return map[string]any{"branch": map[string]string{"name": branch}, "repository": repositoryJSON(workspaceSlug, repository)}
+	}
+	return map[string]any{
+		"id":            pullRequest.ID,
+		"title":         pullRequest.Title,
+		"description":   pullRequest.Description,
+		"state":         pullRequest.State,
+		"created_on":    pullRequest.CreatedOn,
+		"updated_on":    pullRequest.UpdatedOn,
+		"author":        userJSON(pullRequest.Author),
+		"reviewers":     reviewers,
+		"source":        branchRef(pullRequest.SourceBranch),
+		"destination":   branchRef(pullRequest.DestinationBranch),
+		"comment_count": pullRequest.CommentCount,
+		"draft":         false,
+		"links":         htmlLink(fmt.Sprintf("https://bitbucket.org/%s/%s/pull-requests/%d", workspaceSlug, repository.Slug, pullRequest.ID)),
+	}
+}
+
+// writePage answers one page of values, paged like Bitbucket with the 1 based page and pagelen parameters and an
+// absolute next link.
+func writePage(w http.ResponseWriter, r *http.Request, values []any) {
+	query := r.URL.Query()
+	pageLen, err := strconv.Atoi(query.Get("pagelen"))
+	if err != nil || pageLen <= 0 {
+		pageLen = defaultPageLen
+	}
+	pageLen = min(pageLen, maxPageLen)
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*pageLen, len(values))
+	end := min(start+pageLen, len(values))
+	response := map[string]any{
+		"pagelen": pageLen,
+		"page":    page,
+		"size":    len(values),
+		"values":  values[start:end],
+	}
+	if end < len(values) {
+		query.Set("page", strconv.Itoa(page+1))
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		next := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		response["next"] = next.String()
+	}
+	writeJSON(w, response)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+}
+
+func writeOAuthError(w http.ResponseWriter, statusCode int, oauthError string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": oauthError})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]any{"type": "error", "error": map[string]string{"message": message}})
+}
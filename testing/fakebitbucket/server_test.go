@@ -0,0 +1,245 @@
+package fakebitbucket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPage struct {
+	Values []map[string]any `json:"values"`
+	Next   string           `json:"next"`
+}
+
+func getPage(t *testing.T, requestURL string) (int, testPage) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer token")
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	var page testPage
+	if response.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&page))
+	}
+	return response.StatusCode, page
+}
+
+func hashes(page testPage) []any {
+	values := []any{}
+	for _, value := range page.Values {
+		values = append(values, value["hash"])
+	}
+	return values
+}
+
+func TestServerRequiresAuthorization(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/2.0/workspaces")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+func TestServerGrantsOAuthAccessTokens(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+
+	requestToken := func(clientID, grantType string) (int, map[string]any) {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/site/oauth2/access_token", strings.NewReader(url.Values{"grant_type": {grantType}}.Encode()))
+		require.NoError(t, err)
+		request.SetBasicAuth(clientID, "secret")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+		return response.StatusCode, body
+	}
+
+	statusCode, body := requestToken("consumer", "client_credentials")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "fake-access-token-consumer", body["access_token"])
+	assert.Equal(t, float64(7200), body["expires_in"])
+
+	statusCode, body = requestToken("consumer", "password")
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, "unsupported_grant_type", body["error"])
+}
+
+func ids(page testPage) []any {
+	values := []any{}
+	for _, value := range page.Values {
+		values = append(values, value["id"])
+	}
+	return values
+}
+
+func TestServerPagesValues(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+
+	statusCode, page := getPage(t, server.URL+"/2.0/repositories/acme?pagelen=1")
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Len(t, page.Values, 1)
+	assert.Equal(t, "api", page.Values[0]["slug"])
+	assert.Equal(t, server.URL+"/2.0/repositories/acme?page=2&pagelen=1", page.Next)
+
+	_, page = getPage(t, page.Next)
+	require.Len(t, page.Values, 1)
+	assert.Equal(t, "web", page.Values[0]["slug"])
+	assert.Empty(t, page.Next)
+
+	statusCode, _ = getPage(t, server.URL+"/2.0/repositories/unknown")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestServerListsCommitsBetweenRefs(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+	commitsURL := server.URL + "/2.0/repositories/acme/api/commits?"
+
+	_, page := getPage(t, commitsURL+url.Values{"include": {"main"}}.Encode())
+	assert.Equal(t, []any{"a3", "a2", "a1"}, hashes(page))
+	_, page = getPage(t, commitsURL+url.Values{"include": {"f2"}, "exclude": {"main"}}.Encode())
+	assert.Equal(t, []any{"f2", "f1"}, hashes(page))
+	_, page = getPage(t, commitsURL)
+	assert.Equal(t, []any{"a3", "f2", "f1", "a2", "a1"}, hashes(page), "every branch without include")
+
+	statusCode, _ := getPage(t, commitsURL+url.Values{"include": {"main"}, "exclude": {"force-pushed"}}.Encode())
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestServerFiltersPullRequests(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+	pullRequestsURL := server.URL + "/2.0/repositories/acme/api/pullrequests?"
+
+	_, page := getPage(t, pullRequestsURL)
+	require.Len(t, page.Values, 1, "only open pull requests without a state filter")
+	assert.Equal(t, float64(2), page.Values[0]["id"])
+
+	_, page = getPage(t, pullRequestsURL+url.Values{"q": {`state IN ("OPEN", "MERGED") AND updated_on >= 2025-03-01T00:00:00Z`}}.Encode())
+	assert.Len(t, page.Values, 2)
+	_, page = getPage(t, pullRequestsURL+url.Values{"q": {`state IN ("OPEN", "MERGED") AND updated_on >= 2025-03-03T00:00:00Z`}}.Encode())
+	assert.Len(t, page.Values, 1)
+
+	allStates := `state IN ("OPEN", "MERGED")`
+	_, page = getPage(t, pullRequestsURL+url.Values{"q": {allStates}, "sort": {"-updated_on"}}.Encode())
+	assert.Equal(t, []any{float64(2), float64(1)}, ids(page))
+	_, page = getPage(t, pullRequestsURL+url.Values{"q": {allStates}, "sort": {"updated_on"}}.Encode())
+	assert.Equal(t, []any{float64(1), float64(2)}, ids(page))
+	status, _ := getPage(t, pullRequestsURL+url.Values{"sort": {"title"}}.Encode())
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	_, page = getPage(t, server.URL+"/2.0/repositories/acme/api/pullrequests/2/commits")
+	assert.Equal(t, []any{"f2", "f1"}, hashes(page))
+}
+
+func TestServerListsActivityAndDiffstat(t *testing.T) {
+	server := httptest.NewServer(NewServer(SeedDataset()))
+	defer server.Close()
+
+	_, page := getPage(t, server.URL+"/2.0/repositories/acme/api/pullrequests/1/activity")
+	require.Len(t, page.Values, 3)
+	assert.Contains(t, page.Values[0], "update", "newest first")
+	assert.Contains(t, page.Values[1], "approval")
+	comment := page.Values[2]["comment"].(map[string]any)
+	assert.Equal(t, map[string]any{"raw": "Please add a test"}, comment["content"])
+
+	_, page = getPage(t, server.URL+"/2.0/repositories/acme/api/diffstat/a3")
+	require.Len(t, page.Values, 1)
+	assert.Equal(t, "renamed", page.Values[0]["status"])
+	assert.Equal(t, map[string]any{"path": "main.go", "type": "commit_file"}, page.Values[0]["old"])
+	assert.Equal(t, map[string]any{"path": "cmd/api/main.go", "type": "commit_file"}, page.Values[0]["new"])
+
+	_, page = getPage(t, server.URL+"/2.0/repositories/acme/api/diffstat/main..a2")
+	assert.Equal(t, "renamed", page.Values[0]["status"], "a branch spec resolves to its head")
+	_, page = getPage(t, server.URL+"/2.0/repositories/acme/api/diffstat/a1")
+	assert.Len(t, page.Values, 2)
+	assert.Nil(t, page.Values[0]["old"])
+	statusCode, _ := getPage(t, server.URL+"/2.0/repositories/acme/api/diffstat/unknown")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func getRaw(t *testing.T, requestURL string) (*http.Response, []byte) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer token")
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response, body
+}
+
+func TestServerInjectsFaults(t *testing.T) {
+	fakeServer := NewServer(SeedDataset())
+	server := httptest.NewServer(fakeServer)
+	defer server.Close()
+	workspacesURL := server.URL + "/2.0/workspaces"
+
+	fakeServer.SetFaults([]Fault{{Kind: FaultRateLimited, PathPrefix: "/2.0/workspaces", Every: 2, Times: 1, RetryAfterSeconds: 30}})
+	response, _ := getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response, _ = getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode, "every second request")
+	assert.Equal(t, "30", response.Header.Get("Retry-After"))
+	response, _ = getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response, _ = getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "the fault was injected its number of times")
+
+	fakeServer.SetFaults([]Fault{{Kind: FaultUnauthorized, PathPrefix: "/2.0/repositories"}})
+	response, _ = getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "other paths are not affected")
+	response, _ = getRaw(t, server.URL+"/2.0/repositories/acme")
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	fakeServer.SetFaults([]Fault{{Kind: FaultMalformedJSON}})
+	response, body := getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Error(t, json.Unmarshal(body, &testPage{}))
+	assert.True(t, strings.HasPrefix(string(body), `{"page"`), "the body is the start of the real response")
+
+	fakeServer.SetFaults([]Fault{{Kind: FaultSlow, Delay: Duration(200 * time.Millisecond)}})
+	startTime := time.Now()
+	response, _ = getRaw(t, workspacesURL)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(startTime), 200*time.Millisecond)
+}
+
+func TestLoadDatasetAndFaults(t *testing.T) {
+	dir := t.TempDir()
+	datasetContent, err := json.Marshal(SeedDataset())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dataset.json"), datasetContent, 0600))
+	dataset, err := LoadDataset(filepath.Join(dir, "dataset.json"))
+	require.NoError(t, err)
+	assert.Equal(t, SeedDataset(), dataset)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "faults.json"), []byte(`[{"kind": "slow", "delay": "1.5s"}, {"kind": "rateLimited", "retryAfterSeconds": 60}]`), 0600))
+	faults, err := LoadFaults(filepath.Join(dir, "faults.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []Fault{{Kind: FaultSlow, Delay: Duration(1500 * time.Millisecond)}, {Kind: FaultRateLimited, RetryAfterSeconds: 60}}, faults)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "faults.json"), []byte(`[{"kind": "slow"}]`), 0600))
+	_, err = LoadFaults(filepath.Join(dir, "faults.json"))
+	assert.ErrorContains(t, err, "slow fault needs a positive delay")
+}
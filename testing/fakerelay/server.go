@@ -0,0 +1,199 @@
+// Package fakerelay implements the pull-data and pull-error endpoints of the Bluelock relay. It validates the bodies
+// against the payload schemas of gitdtos and keeps what it receives in a SQLite store, so tests and local runs can
+// assert on the payloads the datapuller delivers.
+package fakerelay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bluelock-go/integrations/git/gitdtos"
+	"github.com/bluelock-go/shared/jsonschema"
+)
+
+const (
+	KindData  = "pull-data"
+	KindError = "pull-error"
+)
+
+// Payload is a request received by the relay. Body is the "data" member of a pull-data request or the "error"
+// member of a pull-error request, RunID is the run ID of its envelope, and Violations lists why the request body does
+// not match the schema of its payload type.
+type Payload struct {
+	ID         int64           `json:"id"`
+	OrgCode    string          `json:"orgCode"`
+	Service    string          `json:"service"`
+	Kind       string          `json:"kind"`
+	Type       string          `json:"type,omitempty"`
+	RunID      string          `json:"runId,omitempty"`
+	Query      url.Values      `json:"query,omitempty"`
+	Body       json.RawMessage `json:"body"`
+	Valid      bool            `json:"valid"`
+	Violations []string        `json:"violations,omitempty"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+}
+
+// Server is an http.Handler serving /api/v1/bluelock/{org}/{service}/pull-data and /pull-error, and
+// /api/v1/fake-relay/payloads to list or clear the stored payloads. Requests without the bearer API key are rejected
+// with 401, and bodies not matching their schema are stored, then rejected with 422.
+type Server struct {
+	apiKey string
+	store  *Store
+	mux    *http.ServeMux
+}
+
+func NewServer(apiKey string, store *Store) *Server {
+	s := &Server{apiKey: apiKey, store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /api/v1/bluelock/{org}/{service}/pull-data", s.authorized(s.handlePayload(KindData, "data")))
+	s.mux.HandleFunc("POST /api/v1/bluelock/{org}/{service}/pull-error", s.authorized(s.handlePayload(KindError, "error")))
+	s.mux.HandleFunc("GET /api/v1/fake-relay/payloads", s.authorized(s.handleListPayloads))
+	s.mux.HandleFunc("DELETE /api/v1/fake-relay/payloads", s.authorized(s.handleClearPayloads))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+			writeError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handlePayload(kind, member string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read body: "+err.Error())
+			return
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(rawBody, &body); err != nil {
+			writeError(w, http.StatusBadRequest, "body is not a JSON object: "+err.Error())
+			return
+		}
+		payloadBody, ok := body[member]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "body has no "+member+" member")
+			return
+		}
+
+		payload := Payload{
+			OrgCode:    r.PathValue("org"),
+			Service:    r.PathValue("service"),
+			Kind:       kind,
+			Type:       r.URL.Query().Get("type"),
+			Query:      r.URL.Query(),
+			Body:       payloadBody,
+			ReceivedAt: time.Now().UTC(),
+		}
+		// a missing or invalid run ID is reported by the schema
+		json.Unmarshal(body["runId"], &payload.RunID)
+		payload.Violations = validateBody(kind, payload.Type, rawBody)
+		payload.Valid = len(payload.Violations) == 0
+
+		payload, err = s.store.Add(payload)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !payload.Valid {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "body does not match its schema", "id": payload.ID, "violations": payload.Violations})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "id": payload.ID})
+	}
+}
+
+// validateBody validates a request body against the schema of its payload type, the type query parameter of a
+// pull-data request.
+func validateBody(kind, payloadType string, body []byte) []string {
+	if kind == KindError {
+		payloadType = gitdtos.PayloadTypePullError
+	}
+	schema, err := gitdtos.PayloadSchema(payloadType)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	err = schema.ValidateJSON(body)
+	var validationErr *jsonschema.ValidationError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &validationErr):
+		return validationErr.Violations
+	default:
+		return []string{err.Error()}
+	}
+}
+
+// handleListPayloads lists the stored payloads matching the org, service, kind, type, runId, valid and limit query
+// parameters.
+func (s *Server) handleListPayloads(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := Filter{OrgCode: query.Get("org"), Service: query.Get("service"), Kind: query.Get("kind"), Type: query.Get("type"), RunID: query.Get("runId")}
+	if rawValid := query.Get("valid"); rawValid != "" {
+		valid, err := strconv.ParseBool(rawValid)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid valid parameter: "+err.Error())
+			return
+		}
+		filter.Valid = &valid
+	}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit parameter: "+rawLimit)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	payloads, err := s.store.Find(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if payloads == nil {
+		payloads = []Payload{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"payloads": payloads})
+}
+
+func (s *Server) handleClearPayloads(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Clear(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Payloads returns the stored payloads, in the order they were received.
+func (s *Server) Payloads() ([]Payload, error) {
+	return s.store.Find(Filter{})
+}
+
+// Reset drops the stored payloads.
+func (s *Server) Reset() error {
+	return s.store.Clear()
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error": message})
+}
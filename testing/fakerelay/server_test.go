@@ -0,0 +1,168 @@
+package fakerelay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validRepo = `{"slug": "api", "name": "API", "id": "{1}", "isPublic": false, "link": "https://bitbucket.org/acme/api", "commits": null, "prs": []}`
+
+// envelope wraps a payload as the datapuller sends it.
+func envelope(payloadType, member, payload string) string {
+	return fmt.Sprintf(`{"schemaVersion": 1, "orgCode": "org", "service": "BitbucketCloud", "type": %q, "runId": "run-1", "sentAt": "2025-03-01T10:00:00Z", %q: %s}`,
+		payloadType, member, payload)
+}
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "relay.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	relay := NewServer("api-key", store)
+	server := httptest.NewServer(relay)
+	t.Cleanup(server.Close)
+	return relay, server
+}
+
+func send(t *testing.T, method, requestURL, apiKey, body string) (int, map[string]any) {
+	t.Helper()
+	request, err := http.NewRequest(method, requestURL, strings.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+apiKey)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	var decoded map[string]any
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&decoded))
+	return response.StatusCode, decoded
+}
+
+func post(t *testing.T, requestURL, apiKey, body string) int {
+	t.Helper()
+	statusCode, _ := send(t, http.MethodPost, requestURL, apiKey, body)
+	return statusCode
+}
+
+func TestServerKeepsPayloads(t *testing.T) {
+	relay, server := newTestServer(t)
+	baseURL := server.URL + "/api/v1/bluelock/org/BitbucketCloud"
+
+	assert.Equal(t, http.StatusOK, post(t, baseURL+"/pull-data?type=repo_pull", "api-key", envelope("repo_pull", "data", `[`+validRepo+`]`)))
+	assert.Equal(t, http.StatusOK, post(t, baseURL+"/pull-error", "api-key", envelope("pull_error", "error", `{"repo_id": "api"}`)))
+	assert.Equal(t, http.StatusUnauthorized, post(t, baseURL+"/pull-data", "wrong-key", `{"data": []}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, baseURL+"/pull-data", "api-key", `{"error": []}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, baseURL+"/pull-data", "api-key", `not json`))
+
+	payloads, err := relay.Payloads()
+	require.NoError(t, err)
+	require.Len(t, payloads, 2)
+	assert.Equal(t, "org", payloads[0].OrgCode)
+	assert.Equal(t, "BitbucketCloud", payloads[0].Service)
+	assert.Equal(t, KindData, payloads[0].Kind)
+	assert.Equal(t, "repo_pull", payloads[0].Type)
+	assert.Equal(t, "run-1", payloads[0].RunID)
+	assert.True(t, payloads[0].Valid)
+	assert.JSONEq(t, `[`+validRepo+`]`, string(payloads[0].Body))
+	assert.Equal(t, KindError, payloads[1].Kind)
+	assert.JSONEq(t, `{"repo_id": "api"}`, string(payloads[1].Body))
+
+	require.NoError(t, relay.Reset())
+	payloads, err = relay.Payloads()
+	require.NoError(t, err)
+	assert.Empty(t, payloads)
+}
+
+func TestServerValidatesPayloadBodies(t *testing.T) {
+	relay, server := newTestServer(t)
+	baseURL := server.URL + "/api/v1/bluelock/org/BitbucketCloud"
+
+	statusCode, response := send(t, http.MethodPost, baseURL+"/pull-data?type=repo_pull", "api-key", envelope("repo_pull", "data", `[{"slug": "api", "isPublic": "no"}]`))
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, response["violations"], `/data/0: missing required property "name"`)
+	assert.Contains(t, response["violations"], "/data/0/isPublic: must be of type boolean, got string")
+
+	statusCode, response = send(t, http.MethodPost, baseURL+"/pull-data?type=activity_pull", "api-key", envelope("activity_pull", "data",
+		`{"workspaceKey": "acme", "repos": [{"slug": "api", "name": "API", "id": "{1}", "isPublic": false, "link": "", "prs": null,
+			"commits": [{"id": "a1", "message": "", "committer": {"id": "", "name": "", "displayName": "", "emailAddress": ""}, "committerTimestamp": "yesterday", "changed_files": null}]}]}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, []any{`/data/repos/0/commits/0/committerTimestamp: must be an RFC 3339 date-time, got "yesterday"`}, response["violations"])
+
+	statusCode, response = send(t, http.MethodPost, baseURL+"/pull-data?type=activity_pull", "api-key", envelope("repo_pull", "data", `{"workspaceKey": "acme", "repos": []}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, []any{`/type: must be activity_pull`}, response["violations"], "the envelope type is the type query parameter")
+
+	statusCode, response = send(t, http.MethodPost, baseURL+"/pull-data?type=unknown", "api-key", envelope("unknown", "data", `{}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, []any{`unknown payload type "unknown"`}, response["violations"])
+
+	statusCode, response = send(t, http.MethodPost, baseURL+"/pull-data?type=repo_pull", "api-key", `{"data": []}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, response["violations"], `/: missing required property "schemaVersion"`, "the payload has no envelope")
+
+	assert.Equal(t, http.StatusOK, post(t, baseURL+"/pull-error", "api-key", envelope("pull_error", "error", `"failed to get repositories"`)))
+	assert.Equal(t, http.StatusOK, post(t, baseURL+"/pull-error", "api-key", envelope("pull_error", "error", `{"token_errors": [{"token_id": "t1", "previous_status": "active", "status": "revoked"}]}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(t, baseURL+"/pull-error", "api-key", envelope("pull_error", "error", `42`)))
+
+	invalid := false
+	payloads, err := relay.store.Find(Filter{Valid: &invalid})
+	require.NoError(t, err)
+	require.Len(t, payloads, 6, "invalid payloads are stored too")
+	assert.NotEmpty(t, payloads[0].Violations)
+}
+
+func TestServerListsAndClearsPayloads(t *testing.T) {
+	_, server := newTestServer(t)
+	baseURL := server.URL + "/api/v1/bluelock/org/BitbucketCloud"
+	payloadsURL := server.URL + "/api/v1/fake-relay/payloads"
+
+	require.Equal(t, http.StatusOK, post(t, baseURL+"/pull-data?type=repo_pull", "api-key", envelope("repo_pull", "data", `[]`)))
+	require.Equal(t, http.StatusOK, post(t, baseURL+"/pull-data?type=repo_pull", "api-key", envelope("repo_pull", "data", `[`+validRepo+`]`)))
+	require.Equal(t, http.StatusOK, post(t, baseURL+"/pull-error", "api-key", envelope("pull_error", "error", `"failed"`)))
+
+	statusCode, _ := send(t, http.MethodGet, payloadsURL, "wrong-key", "")
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	_, response := send(t, http.MethodGet, payloadsURL+"?kind=pull-data&type=repo_pull&limit=1", "api-key", "")
+	payloads := response["payloads"].([]any)
+	require.Len(t, payloads, 1, "the most recent one")
+	assert.Equal(t, float64(2), payloads[0].(map[string]any)["id"])
+
+	_, response = send(t, http.MethodGet, payloadsURL+"?valid=true&runId=run-1", "api-key", "")
+	assert.Len(t, response["payloads"], 3)
+	_, response = send(t, http.MethodGet, payloadsURL+"?runId=run-2", "api-key", "")
+	assert.Empty(t, response["payloads"])
+	statusCode, _ = send(t, http.MethodGet, payloadsURL+"?valid=maybe", "api-key", "")
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+
+	statusCode, _ = send(t, http.MethodDelete, payloadsURL, "api-key", "")
+	assert.Equal(t, http.StatusOK, statusCode)
+	_, response = send(t, http.MethodGet, payloadsURL, "api-key", "")
+	assert.Empty(t, response["payloads"])
+}
+
+func TestStorePersistsPayloads(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "relay.db")
+	store, err := OpenStore(filePath)
+	require.NoError(t, err)
+	_, err = store.Add(Payload{OrgCode: "org", Service: "BitbucketCloud", Kind: KindError, RunID: "run-1", Body: json.RawMessage(`"failed"`), Violations: []string{"/: invalid"}})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = OpenStore(filePath)
+	require.NoError(t, err)
+	defer store.Close()
+	payloads, err := store.Find(Filter{OrgCode: "org", Kind: KindError, RunID: "run-1"})
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	assert.Equal(t, int64(1), payloads[0].ID)
+	assert.Equal(t, []string{"/: invalid"}, payloads[0].Violations)
+	assert.JSONEq(t, `"failed"`, string(payloads[0].Body))
+}
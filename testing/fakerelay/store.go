@@ -0,0 +1,146 @@
+package fakerelay
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS payloads (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	org_code TEXT NOT NULL,
+	service TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	type TEXT NOT NULL,
+	run_id TEXT NOT NULL,
+	query TEXT NOT NULL,
+	body TEXT NOT NULL,
+	valid INTEGER NOT NULL,
+	violations TEXT NOT NULL,
+	received_at INTEGER NOT NULL
+);
+`
+
+// Store keeps the received payloads in a SQLite file, so they outlive the fake relay and can be inspected with any
+// SQLite client.
+type Store struct {
+	db *sql.DB
+}
+
+// Filter selects payloads, empty fields match every payload.
+type Filter struct {
+	OrgCode string
+	Service string
+	Kind    string
+	Type    string
+	RunID   string
+	Valid   *bool
+	// Limit keeps the most recent payloads, 0 keeps them all.
+	Limit int
+}
+
+// OpenStore opens the store at filePath, creating it when needed.
+func OpenStore(filePath string) (*Store, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payload store: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create payload store tables: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add stores a payload and returns it with its ID.
+func (s *Store) Add(payload Payload) (Payload, error) {
+	violations, err := json.Marshal(payload.Violations)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to marshal payload violations: %w", err)
+	}
+	result, err := s.db.Exec(
+		`INSERT INTO payloads (org_code, service, kind, type, run_id, query, body, valid, violations, received_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		payload.OrgCode, payload.Service, payload.Kind, payload.Type, payload.RunID, payload.Query.Encode(), string(payload.Body), payload.Valid, string(violations), payload.ReceivedAt.UnixNano(),
+	)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to store payload: %w", err)
+	}
+	if payload.ID, err = result.LastInsertId(); err != nil {
+		return Payload{}, fmt.Errorf("failed to get stored payload ID: %w", err)
+	}
+	return payload, nil
+}
+
+// Find returns the payloads matching the filter, in the order they were received.
+func (s *Store) Find(filter Filter) ([]Payload, error) {
+	var conditions []string
+	var args []any
+	for column, value := range map[string]string{"org_code": filter.OrgCode, "service": filter.Service, "kind": filter.Kind, "type": filter.Type, "run_id": filter.RunID} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if filter.Valid != nil {
+		conditions = append(conditions, "valid = ?")
+		args = append(args, *filter.Valid)
+	}
+	query := `SELECT id, org_code, service, kind, type, run_id, query, body, valid, violations, received_at FROM payloads`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payloads: %w", err)
+	}
+	defer rows.Close()
+
+	var payloads []Payload
+	for rows.Next() {
+		var payload Payload
+		var rawQuery, body, violations string
+		var receivedAt int64
+		if err := rows.Scan(&payload.ID, &payload.OrgCode, &payload.Service, &payload.Kind, &payload.Type, &payload.RunID, &rawQuery, &body, &payload.Valid, &violations, &receivedAt); err != nil {
+			return nil, fmt.Errorf("failed to read payload: %w", err)
+		}
+		if payload.Query, err = url.ParseQuery(rawQuery); err != nil {
+			return nil, fmt.Errorf("failed to parse query of payload %d: %w", payload.ID, err)
+		}
+		if err := json.Unmarshal([]byte(violations), &payload.Violations); err != nil {
+			return nil, fmt.Errorf("failed to parse violations of payload %d: %w", payload.ID, err)
+		}
+		payload.Body = json.RawMessage(body)
+		payload.ReceivedAt = time.Unix(0, receivedAt).UTC()
+		payloads = append(payloads, payload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read payloads: %w", err)
+	}
+	// the most recent payloads were selected first
+	slices.Reverse(payloads)
+	return payloads, nil
+}
+
+// Clear drops every payload.
+func (s *Store) Clear() error {
+	if _, err := s.db.Exec(`DELETE FROM payloads`); err != nil {
+		return fmt.Errorf("failed to clear payloads: %w", err)
+	}
+	return nil
+}
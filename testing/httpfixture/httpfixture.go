@@ -0,0 +1,357 @@
+// Package httpfixture records HTTP interactions into fixture files and replays them, so integration tests run
+// offline and deterministically against responses captured once from a real or fake API.
+package httpfixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluelock-go/shared"
+)
+
+// RecordEnvVar switches Transport from replaying its fixture to recording it again.
+const RecordEnvVar = "BLUELOCK_RECORD_FIXTURES"
+
+// Interaction is a request and the response it got. The URL of the request is kept without scheme and host, so a
+// fixture replays against any base URL.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Fixture is the content of a fixture file.
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Sanitizer edits a recorded interaction before it is kept, e.g. to mask personal data of a real API.
+type Sanitizer func(*Interaction)
+
+// recordedRequestHeaders and recordedResponseHeaders are the only headers kept, anything else may carry credentials
+// or session cookies.
+var recordedRequestHeaders = []string{"Accept", "Content-Type"}
+var recordedResponseHeaders = []string{"Content-Type", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+// secretKeys are query parameters and JSON keys, lower cased without separators, whose values are redacted.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"clientsecret":  true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"apikey":        true,
+	"authorization": true,
+	"credkey":       true,
+}
+
+func isSecretKey(key string) bool {
+	return secretKeys[strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))]
+}
+
+// Recorder is a RoundTripper that sends the requests through its transport and records them, sanitized.
+type Recorder struct {
+	transport    http.RoundTripper
+	sanitizers   []Sanitizer
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder records the requests sent through transport, http.DefaultTransport when nil. The sanitizers run after
+// the credentials were stripped.
+func NewRecorder(transport http.RoundTripper, sanitizers ...Sanitizer) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport, sanitizers: sanitizers}
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if request.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	response, err := r.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method: request.Method,
+			URL:    sanitizeURL(request.URL),
+			Header: keepHeaders(request.Header, recordedRequestHeaders),
+			Body:   sanitizeBody(requestBody),
+		},
+		Response: Response{
+			StatusCode: response.StatusCode,
+			Header:     keepHeaders(response.Header, recordedResponseHeaders),
+			Body:       sanitizeBody(responseBody),
+		},
+	}
+	for _, sanitize := range r.sanitizers {
+		sanitize(&interaction)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, interaction)
+	return response, nil
+}
+
+// Interactions returns the interactions recorded so far, in the order of their responses.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.interactions)
+}
+
+// Save writes the recorded interactions to a fixture file.
+func (r *Recorder) Save(filePath string) error {
+	content, err := json.MarshalIndent(Fixture{Interactions: r.Interactions()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(filePath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// sanitizeURL drops scheme, host and user info and redacts secret query parameters. The query is re-encoded, so its
+// parameters are sorted.
+func sanitizeURL(requestURL *url.URL) string {
+	query := requestURL.Query()
+	for key, values := range query {
+		if isSecretKey(key) {
+			for i := range values {
+				values[i] = shared.RedactedValue
+			}
+		}
+	}
+	sanitized := requestURL.EscapedPath()
+	if len(query) > 0 {
+		sanitized += "?" + query.Encode()
+	}
+	return sanitized
+}
+
+func keepHeaders(header http.Header, keys []string) http.Header {
+	kept := http.Header{}
+	for _, key := range keys {
+		if values := header.Values(key); len(values) > 0 {
+			kept[http.CanonicalHeaderKey(key)] = slices.Clone(values)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// sanitizeBody redacts the values of secret keys in JSON bodies. Form bodies have their secret fields redacted too,
+// other bodies are kept as they are.
+func sanitizeBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var document any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err == nil && !decoder.More() {
+		redacted, err := json.Marshal(redactJSON(document))
+		if err == nil {
+			return string(redacted)
+		}
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil && strings.Contains(string(body), "=") {
+		redacted := false
+		for key, values := range form {
+			if isSecretKey(key) {
+				for i := range values {
+					values[i] = shared.RedactedValue
+				}
+				redacted = true
+			}
+		}
+		if redacted {
+			return form.Encode()
+		}
+	}
+	return string(body)
+}
+
+func redactJSON(document any) any {
+	switch value := document.(type) {
+	case map[string]any:
+		for key, member := range value {
+			if isSecretKey(key) {
+				value[key] = shared.RedactedValue
+				continue
+			}
+			value[key] = redactJSON(member)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = redactJSON(item)
+		}
+	}
+	return document
+}
+
+// Replayer is a RoundTripper that answers from recorded interactions and never touches the network.
+// Requests are matched on method, path and query, ignoring scheme and host. Identical requests consume their
+// interactions in recorded order.
+type Replayer struct {
+	ignoredQueryParams []string
+	mu                 sync.Mutex
+	interactions       []Interaction
+	used               []bool
+}
+
+// NewReplayer replays interactions. The ignoredQueryParams are left out of the matching, for parameters derived
+// from the clock such as the updated_on filter of a query.
+func NewReplayer(interactions []Interaction, ignoredQueryParams ...string) *Replayer {
+	return &Replayer{
+		ignoredQueryParams: ignoredQueryParams,
+		interactions:       interactions,
+		used:               make([]bool, len(interactions)),
+	}
+}
+
+// LoadReplayer replays the interactions of a fixture file.
+func LoadReplayer(filePath string, ignoredQueryParams ...string) (*Replayer, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(content, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fixture %s: %w", filePath, err)
+	}
+	return NewReplayer(fixture.Interactions, ignoredQueryParams...), nil
+}
+
+func (r *Replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	key := r.matchKey(request.Method, sanitizeURL(request.URL))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || r.matchKey(interaction.Request.Method, interaction.Request.URL) != key {
+			continue
+		}
+		r.used[i] = true
+		header := http.Header{}
+		for name, values := range interaction.Response.Header {
+			header[name] = slices.Clone(values)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       request,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction left for %s", key)
+}
+
+// Unused returns the interactions no request has consumed yet.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+func (r *Replayer) matchKey(method, sanitizedURL string) string {
+	path, rawQuery, _ := strings.Cut(sanitizedURL, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	for _, ignored := range r.ignoredQueryParams {
+		query.Del(ignored)
+	}
+	if len(query) == 0 {
+		return method + " " + path
+	}
+	return method + " " + path + "?" + query.Encode()
+}
+
+// Transport returns the transport of a test backed by the fixture at filePath. It replays the fixture, unless
+// RecordEnvVar is set: then the requests go through live and the fixture is rewritten when the test ends.
+func Transport(t testing.TB, filePath string, live http.RoundTripper, ignoredQueryParams ...string) http.RoundTripper {
+	t.Helper()
+	if os.Getenv(RecordEnvVar) == "" {
+		replayer, err := LoadReplayer(filePath, ignoredQueryParams...)
+		if err != nil {
+			t.Fatalf("failed to load fixture, record it with %s=1: %v", RecordEnvVar, err)
+		}
+		return replayer
+	}
+
+	recorder := NewRecorder(live)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("test failed, fixture %s is not rewritten", filePath)
+			return
+		}
+		if err := recorder.Save(filePath); err != nil {
+			t.Errorf("failed to save fixture: %v", err)
+		}
+	})
+	return recorder
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+var _ http.RoundTripper = (*Replayer)(nil)
@@ -0,0 +1,146 @@
+package httpfixture
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bluelock-go/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, client *http.Client, requestURL string) (int, string) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer live-token")
+	request.Header.Set("Accept", "application/json")
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response.StatusCode, string(body)
+}
+
+func TestRecorderSanitizesInteractions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("X-RateLimit-Remaining", "99")
+		if r.URL.Path == "/oauth" {
+			w.Write([]byte(`{"access_token": "live-access", "scopes": "repository", "nested": [{"refreshToken": "live-refresh"}]}`))
+			return
+		}
+		w.Write([]byte(`{"values": ["api"]}`))
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder(nil)
+	client := &http.Client{Transport: recorder}
+	statusCode, body := get(t, client, server.URL+"/2.0/workspaces?pagelen=50&access_token=live-query")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, `{"values": ["api"]}`, body, "the caller gets the live response")
+	_, body = get(t, client, server.URL+"/oauth")
+	assert.Contains(t, body, "live-access")
+
+	response, err := client.PostForm(server.URL+"/oauth", url.Values{"grant_type": {"client_credentials"}, "client_secret": {"live-secret"}})
+	require.NoError(t, err)
+	response.Body.Close()
+
+	interactions := recorder.Interactions()
+	require.Len(t, interactions, 3)
+	workspaces := interactions[0]
+	assert.Equal(t, "GET", workspaces.Request.Method)
+	assert.Equal(t, "/2.0/workspaces?access_token=%5BREDACTED%5D&pagelen=50", workspaces.Request.URL)
+	assert.Equal(t, http.Header{"Accept": {"application/json"}}, workspaces.Request.Header, "the authorization header is dropped")
+	assert.Equal(t, http.Header{"Content-Type": {"application/json"}, "X-Ratelimit-Remaining": {"99"}}, workspaces.Response.Header)
+	assert.JSONEq(t, `{"values": ["api"]}`, workspaces.Response.Body)
+
+	oauth := interactions[1].Response.Body
+	assert.JSONEq(t, `{"access_token": "[REDACTED]", "scopes": "repository", "nested": [{"refreshToken": "[REDACTED]"}]}`, oauth)
+	assert.Equal(t, "client_secret=%5BREDACTED%5D&grant_type=client_credentials", interactions[2].Request.Body)
+
+	fixturePath := filepath.Join(t.TempDir(), "fixtures", "recorded.json")
+	require.NoError(t, recorder.Save(fixturePath))
+	replayer, err := LoadReplayer(fixturePath)
+	require.NoError(t, err)
+	assert.Len(t, replayer.Unused(), 3)
+}
+
+func TestRecorderRunsSanitizers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"author": "Jane <jane@acme.test>"}`))
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder(nil, func(interaction *Interaction) {
+		interaction.Response.Body = strings.ReplaceAll(interaction.Response.Body, "jane@acme.test", "user@example.com")
+	})
+	get(t, &http.Client{Transport: recorder}, server.URL)
+	assert.JSONEq(t, `{"author": "Jane <user@example.com>"}`, recorder.Interactions()[0].Response.Body)
+}
+
+func TestReplayer(t *testing.T) {
+	replayer := NewReplayer([]Interaction{
+		{Request: Request{Method: "GET", URL: "/2.0/workspaces?pagelen=50"}, Response: Response{StatusCode: 200, Body: `{"values": ["first"]}`}},
+		{Request: Request{Method: "GET", URL: "/2.0/workspaces?pagelen=50"}, Response: Response{StatusCode: 429, Header: http.Header{"Retry-After": {"1"}}}},
+		{Request: Request{Method: "GET", URL: "/2.0/pullrequests?pagelen=50&q=updated_on+%3E%3D+2025-01-01"}, Response: Response{StatusCode: 200, Body: `{"values": []}`}},
+	}, "q")
+	client := &http.Client{Transport: replayer}
+
+	// the host and the order of the query parameters do not matter
+	statusCode, body := get(t, client, "https://api.bitbucket.org/2.0/workspaces?pagelen=50")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, `{"values": ["first"]}`, body)
+	response, err := client.Get("http://localhost:1/2.0/workspaces?pagelen=50")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode, "identical requests replay in recorded order")
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+
+	_, err = client.Get("http://localhost:1/2.0/workspaces?pagelen=50")
+	assert.ErrorContains(t, err, "no recorded interaction left for GET /2.0/workspaces?pagelen=50")
+	_, err = client.Get("http://localhost:1/2.0/workspaces?pagelen=10")
+	assert.Error(t, err)
+
+	assert.Len(t, replayer.Unused(), 1)
+	statusCode, _ = get(t, client, "http://localhost:1/2.0/pullrequests?q=updated_on+%3E%3D+2026-10-01&pagelen=50")
+	assert.Equal(t, http.StatusOK, statusCode, "ignored query parameters are not matched")
+	assert.Empty(t, replayer.Unused())
+}
+
+func TestReplayerMatchesRedactedQueries(t *testing.T) {
+	replayer := NewReplayer([]Interaction{
+		{Request: Request{Method: "GET", URL: "/user?access_token=" + url.QueryEscape(shared.RedactedValue)}, Response: Response{StatusCode: 200}},
+	})
+	statusCode, _ := get(t, &http.Client{Transport: replayer}, "http://localhost:1/user?access_token=another-live-token")
+	assert.Equal(t, http.StatusOK, statusCode)
+}
+
+func TestTransportReplaysAndRecords(t *testing.T) {
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("live"))
+	}))
+	defer server.Close()
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(RecordEnvVar, "1")
+		transport := Transport(t, fixturePath, nil)
+		_, body := get(t, &http.Client{Transport: transport}, server.URL+"/ping")
+		assert.Equal(t, "live", body)
+	})
+	server.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		transport := Transport(t, fixturePath, nil)
+		_, body := get(t, &http.Client{Transport: transport}, server.URL+"/ping")
+		assert.Equal(t, "live", body, "the server is closed, the body comes from the fixture")
+	})
+}
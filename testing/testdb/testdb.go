@@ -0,0 +1,124 @@
+// Package testdb opens throwaway SQLite databases for the tests, with the schema of the embedded migrations. The
+// application databases are migrated with the goose CLI (make db-up), this package only stands in for it in tests.
+package testdb
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/bluelock-go/shared/database/migrations"
+)
+
+// Open opens a database in a temporary directory of the test, with every migration applied. It is closed when the
+// test ends.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "database.db"))
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := applyMigrations(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// applyMigrations runs the "Up" section of every embedded goose migration that is not applied yet.
+// Applied versions are recorded in goose_db_version like goose does.
+func applyMigrations(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`); err != nil {
+		return fmt.Errorf("failed to create goose_db_version table: %w", err)
+	}
+
+	applied := map[int64]bool{}
+	rows, err := db.Query("SELECT version_id, is_applied FROM goose_db_version ORDER BY id ASC")
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = isApplied
+	}
+	rows.Close()
+	if len(applied) == 0 {
+		if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1)"); err != nil {
+			return fmt.Errorf("failed to initialize goose_db_version: %w", err)
+		}
+	}
+
+	fileNames, err := fs.Glob(migrations.FS, "*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		version, err := strconv.ParseInt(strings.SplitN(fileName, "_", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration file name %s: %w", fileName, err)
+		}
+		if applied[version] {
+			continue
+		}
+
+		content, err := fs.ReadFile(migrations.FS, fileName)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", fileName, err)
+		}
+		if _, err := tx.Exec(upSection(string(content))); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %w", fileName, err)
+		}
+		if _, err := tx.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, 1)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", fileName, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// upSection returns the statements between "-- +goose Up" and "-- +goose Down" without the goose annotations.
+func upSection(migration string) string {
+	var statements []string
+	inUp := false
+	for _, line := range strings.Split(migration, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "-- +goose Up"):
+			inUp = true
+		case strings.HasPrefix(trimmed, "-- +goose Down"):
+			inUp = false
+		case strings.HasPrefix(trimmed, "-- +goose"):
+		case inUp:
+			statements = append(statements, line)
+		}
+	}
+	return strings.Join(statements, "\n")
+}